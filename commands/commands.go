@@ -88,6 +88,65 @@ func configure(configuration string) (map[string]any, error) {
 	return config, nil
 }
 
+// tunnels returns the TOML file and the sections listed in the [tunnels] table of the TOML
+// file, keyed by tunnel tag e.g.
+//
+//	[tunnels]
+//	workshop = "tcp-client"
+//	office = "tls-client"
+//
+// Returns an empty list if the configuration specifies a section or the TOML file does not
+// have a [tunnels] table.
+func tunnels(configuration string) (string, map[string]string, error) {
+	sections := map[string]string{}
+
+	file := configuration
+	if match := regexp.MustCompile("(.*?)(?:::|#)(.*)").FindStringSubmatch(configuration); match != nil {
+		return file, sections, nil
+	}
+
+	if file == "" && DefaultConfig == "" {
+		return file, sections, nil
+	}
+
+	if file == "" {
+		if _, err := os.Stat(DefaultConfig); err != nil && !os.IsNotExist(err) {
+			return file, sections, err
+		} else if err != nil {
+			return file, sections, nil
+		} else {
+			file = DefaultConfig
+		}
+	}
+
+	if bytes, err := os.ReadFile(file); err != nil {
+		return file, sections, err
+	} else {
+		c := map[string]any{}
+		if err := toml.Unmarshal(bytes, &c); err != nil {
+			return file, sections, err
+		}
+
+		if m, ok := c["tunnels"]; ok {
+			if table, ok := m.(map[string]any); !ok {
+				return file, sections, fmt.Errorf("invalid [tunnels] table")
+			} else {
+				for tag, v := range table {
+					if section, ok := v.(string); !ok || section == "" {
+						return file, sections, fmt.Errorf("invalid [tunnels] section for '%v' (%v)", tag, v)
+					} else if _, ok := c[section].(map[string]any); !ok {
+						return file, sections, fmt.Errorf("[tunnels] section '%v' for '%v' does not exist", section, tag)
+					} else {
+						sections[tag] = section
+					}
+				}
+			}
+		}
+	}
+
+	return file, sections, nil
+}
+
 func helpOptions(flagset *flag.FlagSet) {
 	flags := 0
 	count := 0
@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTunnels(t *testing.T) {
+	tests := []struct {
+		name     string
+		toml     string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			name: "tunnels",
+			toml: `
+[tunnels]
+workshop = "tcp-client"
+office = "tls-client"
+
+[tcp-client]
+in = "udp/listen:0.0.0.0:60000"
+
+[tls-client]
+in = "udp/listen:0.0.0.0:60001"
+`,
+			expected: map[string]string{"workshop": "tcp-client", "office": "tls-client"},
+		},
+		{
+			name: "no tunnels",
+			toml: `
+[tcp-client]
+in = "udp/listen:0.0.0.0:60000"
+`,
+			expected: map[string]string{},
+		},
+		{
+			name: "missing section",
+			toml: `
+[tunnels]
+workshop = "tcp-client"
+office = "tls-client"
+
+[tcp-client]
+in = "udp/listen:0.0.0.0:60000"
+`,
+			err: true,
+		},
+		{
+			name: "empty section",
+			toml: `
+[tunnels]
+workshop = ""
+`,
+			err: true,
+		},
+		{
+			name: "invalid section",
+			toml: `
+[tunnels]
+workshop = 12345
+`,
+			err: true,
+		},
+		{
+			name: "section is not a table",
+			toml: `
+tcp-client = "udp/listen:0.0.0.0:60000"
+
+[tunnels]
+workshop = "tcp-client"
+`,
+			err: true,
+		},
+		{
+			name: "invalid tunnels table",
+			toml: `
+tunnels = "tcp-client"
+`,
+			err: true,
+		},
+		{
+			name: "invalid TOML",
+			toml: `
+[tunnels
+workshop = "tcp-client"
+`,
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "uhppoted.conf")
+			if err := os.WriteFile(file, []byte(test.toml), 0600); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			_, sections, err := tunnels(file)
+
+			if test.err && err == nil {
+				t.Fatalf("expected error, got %v", sections)
+			} else if !test.err && err != nil {
+				t.Fatalf("unexpected error (%v)", err)
+			} else if !test.err && !maps.Equal(sections, test.expected) {
+				t.Errorf("incorrect sections - expected:%v, got:%v", test.expected, sections)
+			}
+		})
+	}
+}
+
+func TestTunnelsWithSection(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "uhppoted.conf")
+	if err := os.WriteFile(file, []byte("[tunnels]\nworkshop = \"tcp-client\"\n"), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// ... a configuration that selects a section runs just that tunnel
+	for _, configuration := range []string{file + "::tcp-client", file + "#tcp-client"} {
+		if _, sections, err := tunnels(configuration); err != nil {
+			t.Errorf("%v: unexpected error (%v)", configuration, err)
+		} else if len(sections) != 0 {
+			t.Errorf("%v: expected no tunnels, got %v", configuration, sections)
+		}
+	}
+}
+
+func TestTunnelsWithMissingFile(t *testing.T) {
+	if _, _, err := tunnels(filepath.Join(t.TempDir(), "uhppoted.conf")); err == nil {
+		t.Errorf("expected error for missing configuration file")
+	}
+}
+
+func TestMakeQueue(t *testing.T) {
+	workdir := t.TempDir()
+	cmd := Run{
+		workdir:        workdir,
+		eventQueueSize: 16,
+	}
+
+	tests := []struct {
+		tag      string
+		spec     string
+		expected string
+	}{
+		{"", "tcp/client:192.168.1.100:12345", "tcp-client-192.168.1.100-12345"},
+		{"workshop", "tcp/client:192.168.1.100:12345", "workshop-tcp-client-192.168.1.100-12345"},
+		{"warehouse", "tcp/client:192.168.1.100:12345", "warehouse-tcp-client-192.168.1.100-12345"},
+	}
+
+	for _, test := range tests {
+		if _, err := cmd.makeQueue(test.tag, test.spec); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if info, err := os.Stat(filepath.Join(workdir, "events", test.expected)); err != nil {
+			t.Errorf("%v: missing event queue folder (%v)", test.tag, err)
+		} else if !info.IsDir() {
+			t.Errorf("%v: event queue folder %v is not a directory", test.tag, test.expected)
+		}
+	}
+}
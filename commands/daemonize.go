@@ -58,10 +58,29 @@ func (cmd *Daemonize) validate() (string, error) {
 
 	case
 		strings.HasPrefix(in, "udp/listen:"),
+		strings.HasPrefix(in, "udp/multicast:"),
+		strings.HasPrefix(in, "udp/client:"),
+		strings.HasPrefix(in, "udp/server:"),
 		strings.HasPrefix(in, "tcp/client:"),
 		strings.HasPrefix(in, "tcp/server:"),
 		strings.HasPrefix(in, "tls/client:"),
 		strings.HasPrefix(in, "tls/server:"),
+		strings.HasPrefix(in, "ws/client:"),
+		strings.HasPrefix(in, "ws/server:"),
+		strings.HasPrefix(in, "wss/client:"),
+		strings.HasPrefix(in, "wss/server:"),
+		strings.HasPrefix(in, "quic/client:"),
+		strings.HasPrefix(in, "quic/server:"),
+		strings.HasPrefix(in, "dtls/client:"),
+		strings.HasPrefix(in, "dtls/server:"),
+		strings.HasPrefix(in, "mqtt/client:"),
+		strings.HasPrefix(in, "mqtts/client:"),
+		strings.HasPrefix(in, "ssh/client:"),
+		strings.HasPrefix(in, "ssh/server:"),
+		strings.HasPrefix(in, "unix/client:"),
+		strings.HasPrefix(in, "unix/server:"),
+		strings.HasPrefix(in, "unixgram/client:"),
+		strings.HasPrefix(in, "unixgram/server:"),
 		strings.HasPrefix(in, "http/"),
 		strings.HasPrefix(in, "https/"):
 	// OK
@@ -77,10 +96,29 @@ func (cmd *Daemonize) validate() (string, error) {
 
 	case
 		strings.HasPrefix(out, "udp/broadcast:"),
+		strings.HasPrefix(out, "udp/multicast:"),
+		strings.HasPrefix(out, "udp/client:"),
+		strings.HasPrefix(out, "udp/server:"),
 		strings.HasPrefix(out, "tcp/client:"),
 		strings.HasPrefix(out, "tcp/server:"),
 		strings.HasPrefix(out, "tls/client:"),
 		strings.HasPrefix(out, "tls/server:"),
+		strings.HasPrefix(out, "ws/client:"),
+		strings.HasPrefix(out, "ws/server:"),
+		strings.HasPrefix(out, "wss/client:"),
+		strings.HasPrefix(out, "wss/server:"),
+		strings.HasPrefix(out, "quic/client:"),
+		strings.HasPrefix(out, "quic/server:"),
+		strings.HasPrefix(out, "dtls/client:"),
+		strings.HasPrefix(out, "dtls/server:"),
+		strings.HasPrefix(out, "mqtt/client:"),
+		strings.HasPrefix(out, "mqtts/client:"),
+		strings.HasPrefix(out, "ssh/client:"),
+		strings.HasPrefix(out, "ssh/server:"),
+		strings.HasPrefix(out, "unix/client:"),
+		strings.HasPrefix(out, "unix/server:"),
+		strings.HasPrefix(out, "unixgram/client:"),
+		strings.HasPrefix(out, "unixgram/server:"),
 		strings.HasPrefix(out, "ip/out:"):
 	// OK
 
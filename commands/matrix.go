@@ -0,0 +1,283 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+)
+
+// matrix returns true if the tunnel is a routing matrix i.e. the 'in' and/or 'out'
+// connectors are defined as TOML tables of named connectors, e.g.
+//
+//	[bridge.in]
+//	local = "udp/listen:0.0.0.0:60000"
+//
+//	[bridge.out]
+//	site-a = "tls/client:192.168.1.100:12345"
+//	home = "ip/out:192.168.1.255:60000"
+//
+// A tunnel with a [routes] table is also a routing matrix.
+func (cmd *Run) matrix() bool {
+	return len(cmd.connectors.in) > 0 || len(cmd.connectors.out) > 0 || len(cmd.routes) > 0
+}
+
+// named returns the named 'in' and 'out' connector specifications for a routing matrix. A
+// connector defined by an ordinary --in or --out argument is named 'in' or 'out'.
+func (cmd *Run) named() (map[string]string, map[string]string) {
+	in := maps.Clone(cmd.connectors.in)
+	out := maps.Clone(cmd.connectors.out)
+
+	if len(in) == 0 && cmd.in != "" {
+		in = map[string]string{"in": cmd.in}
+	}
+
+	if len(out) == 0 && cmd.out != "" {
+		out = map[string]string{"out": cmd.out}
+	}
+
+	return in, out
+}
+
+// spec returns a string representation of the tunnel connectors (used to generate the
+// default lockfile name).
+func (cmd *Run) spec() string {
+	if !cmd.matrix() {
+		return cmd.in + cmd.out
+	}
+
+	var b strings.Builder
+
+	in, out := cmd.named()
+	for _, m := range []map[string]string{in, out} {
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			fmt.Fprintf(&b, "%v=%v;", k, m[k])
+		}
+	}
+
+	return b.String()
+}
+
+// validateMatrix checks that a routing matrix has at least one connector in each direction,
+// that the connector names are unique and that the rules only refer to defined connectors.
+func (cmd *Run) validateMatrix() error {
+	in, out := cmd.named()
+
+	if len(in) == 0 {
+		return fmt.Errorf("missing 'in' connector")
+	}
+
+	if len(out) == 0 {
+		return fmt.Errorf("missing 'out' connector")
+	}
+
+	for k := range in {
+		if _, ok := out[k]; ok {
+			return fmt.Errorf("duplicate connector name '%v'", k)
+		}
+	}
+
+	exists := func(name string) bool {
+		_, ok := in[name]
+		_, ok2 := out[name]
+		return ok || ok2
+	}
+
+	for i, rule := range cmd.rules {
+		if len(rule.To) == 0 {
+			return fmt.Errorf("rule %v: missing 'to' connector", i+1)
+		}
+
+		for _, name := range append(slices.Clone(rule.Source), rule.To...) {
+			if !exists(name) {
+				return fmt.Errorf("rule %v: unknown connector '%v'", i+1, name)
+			}
+		}
+	}
+
+	for _, route := range cmd.routes {
+		for _, name := range route.To {
+			if _, ok := out[name]; !ok {
+				return fmt.Errorf("route %v: unknown 'out' connector '%v'", route.Serial, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// makeMatrix creates the named connectors and the routing matrix between them.
+func (cmd *Run) makeMatrix(tag string, limiter *rate.Limiter, ctx context.Context) (*tunnel.Tunnel, error) {
+	in, out := cmd.named()
+
+	// ... events matrix ?
+	events := func(m map[string]string) bool {
+		for _, spec := range m {
+			if isEvents(spec) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	incoming := map[string]tunnel.Conn{}
+	outgoing := map[string]tunnel.Conn{}
+
+	for _, k := range slices.Sorted(maps.Keys(in)) {
+		if c, err := cmd.makeInConn(tag, fmt.Sprintf("in.%v", k), in[k], events(out), ctx); err != nil {
+			return nil, err
+		} else {
+			incoming[k] = c
+		}
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(out)) {
+		if c, err := cmd.makeOutConn(tag, fmt.Sprintf("out.%v", k), out[k], events(in), ctx); err != nil {
+			return nil, err
+		} else {
+			outgoing[k] = c
+		}
+	}
+
+	rules := slices.Clone(cmd.rules)
+	if len(cmd.routes) > 0 {
+		rules = append(rules, tunnel.Routes(cmd.routes, slices.Sorted(maps.Keys(in)), slices.Sorted(maps.Keys(out)))...)
+	}
+
+	return tunnel.NewMatrix(tag, incoming, outgoing, rules, limiter, ctx), nil
+}
+
+// connectors returns the named connector specifications from a TOML [in] or [out] table.
+func connectors(table map[string]any) map[string]string {
+	m := map[string]string{}
+
+	for k, v := range table {
+		m[k] = fmt.Sprintf("%v", v)
+	}
+
+	return m
+}
+
+// rules parses the routing rules from a TOML [[rules]] array of tables, e.g.
+//
+//	[[bridge.rules]]
+//	serial = [405419896, "303986000-303986999"]
+//	function = "0x94"
+//	to = "site-a"
+//
+// Serial numbers and function codes may be integers or strings (with an optional 0x prefix
+// for hexadecimal), serial numbers may also be ranges and all criteria may be either a single
+// value or a list.
+func rules(table []any) ([]tunnel.Rule, error) {
+	list := []tunnel.Rule{}
+
+	for i, v := range table {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid rule %v (%v)", i+1, v)
+		}
+
+		rule := tunnel.Rule{}
+
+		for k, v := range m {
+			switch k {
+			case "source":
+				rule.Source = strs(v)
+
+			case "to":
+				rule.To = strs(v)
+
+			case "serial":
+				for _, s := range strs(v) {
+					if r, err := serials(s); err != nil {
+						return nil, fmt.Errorf("rule %v: %w", i+1, err)
+					} else {
+						rule.Serial = append(rule.Serial, r)
+					}
+				}
+
+			case "function":
+				for _, s := range strs(v) {
+					if u, err := strconv.ParseUint(s, 0, 8); err != nil {
+						return nil, fmt.Errorf("rule %v: invalid function code (%v)", i+1, s)
+					} else {
+						rule.Function = append(rule.Function, uint8(u))
+					}
+				}
+
+			default:
+				return nil, fmt.Errorf("rule %v: unknown key '%v'", i+1, k)
+			}
+		}
+
+		list = append(list, rule)
+	}
+
+	return list, nil
+}
+
+// routes parses the serial number routes from a TOML [routes] table, e.g.
+//
+//	[bridge.routes]
+//	405419896 = "site-a"
+//	"303986000-303986999" = [ "site-b", "home" ]
+func routes(table map[string]any) ([]tunnel.Route, error) {
+	list := []tunnel.Route{}
+
+	for _, k := range slices.Sorted(maps.Keys(table)) {
+		if r, err := serials(k); err != nil {
+			return nil, fmt.Errorf("invalid route: %w", err)
+		} else if to := strs(table[k]); len(to) == 0 {
+			return nil, fmt.Errorf("route %v: missing 'out' connector", k)
+		} else {
+			list = append(list, tunnel.Route{
+				Serial: r,
+				To:     to,
+			})
+		}
+	}
+
+	return list, nil
+}
+
+// serials parses a controller serial number or an inclusive range of serial numbers
+// e.g. 405419896 or 303986000-303986999.
+func serials(s string) (tunnel.Range, error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(s), "-")
+
+	p, err := strconv.ParseUint(strings.TrimSpace(from), 0, 32)
+	if err != nil {
+		return tunnel.Range{}, fmt.Errorf("invalid serial number (%v)", s)
+	}
+
+	if !isRange {
+		return tunnel.Serial(uint32(p)), nil
+	}
+
+	q, err := strconv.ParseUint(strings.TrimSpace(to), 0, 32)
+	if err != nil || q < p {
+		return tunnel.Range{}, fmt.Errorf("invalid serial number range (%v)", s)
+	}
+
+	return tunnel.Range{From: uint32(p), To: uint32(q)}, nil
+}
+
+func strs(v any) []string {
+	if l, ok := v.([]any); ok {
+		list := []string{}
+		for _, u := range l {
+			list = append(list, fmt.Sprintf("%v", u))
+		}
+
+		return list
+	}
+
+	return []string{fmt.Sprintf("%v", v)}
+}
@@ -12,8 +12,6 @@ import (
 	"github.com/uhppoted/uhppote-core/uhppote"
 	"github.com/uhppoted/uhppoted-lib/config"
 	"github.com/uhppoted/uhppoted-lib/eventlog"
-
-	"github.com/uhppoted/uhppoted-tunnel/tunnel"
 )
 
 var RUN = Run{
@@ -21,12 +19,18 @@ var RUN = Run{
 	out:               "",
 	maxRetries:        MAX_RETRIES,
 	maxRetryDelay:     MAX_RETRY_DELAY,
+	heartbeatInterval: HEARTBEAT_INTERVAL,
+	heartbeatMisses:   HEARTBEAT_MISSES,
+	eventQueueSize:    EVENT_QUEUE_SIZE,
+	eventQueueAge:     EVENT_QUEUE_AGE,
 	udpTimeout:        UDP_TIMEOUT,
+	multicastTTL:      MULTICAST_TTL,
 	caCertificate:     "ca.cert",
 	certificate:       "",
 	key:               "",
 	requireClientAuth: false,
 	html:              "./html",
+	batchConcurrency:  BATCH_CONCURRENCY,
 	lockfile: config.Lockfile{
 		File:   DefaultLockfile,
 		Remove: false,
@@ -54,14 +58,14 @@ func (cmd *Run) FlagSet() *flag.FlagSet {
 func (cmd *Run) Execute(args ...interface{}) error {
 	log.Printf("%s service %s - %s (PID %d)\n", SERVICE, uhppote.VERSION, "Linux", os.Getpid())
 
-	f := func(t *tunnel.Tunnel, ctx context.Context, cancel context.CancelFunc) {
+	f := func(t runnable, ctx context.Context, cancel context.CancelFunc) {
 		cmd.exec(t, ctx, cancel)
 	}
 
 	return cmd.execute(f)
 }
 
-func (cmd *Run) exec(t *tunnel.Tunnel, ctx context.Context, cancel context.CancelFunc) {
+func (cmd *Run) exec(t runnable, ctx context.Context, cancel context.CancelFunc) {
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.LstdFlags)
 
@@ -17,8 +17,6 @@ import (
 	"github.com/uhppoted/uhppote-core/uhppote"
 	"github.com/uhppoted/uhppoted-lib/config"
 	"github.com/uhppoted/uhppoted-lib/eventlog"
-
-	"github.com/uhppoted/uhppoted-tunnel/tunnel"
 )
 
 var RUN = Run{
@@ -26,12 +24,18 @@ var RUN = Run{
 	out:               "",
 	maxRetries:        MAX_RETRIES,
 	maxRetryDelay:     MAX_RETRY_DELAY,
+	heartbeatInterval: HEARTBEAT_INTERVAL,
+	heartbeatMisses:   HEARTBEAT_MISSES,
+	eventQueueSize:    EVENT_QUEUE_SIZE,
+	eventQueueAge:     EVENT_QUEUE_AGE,
 	udpTimeout:        UDP_TIMEOUT,
+	multicastTTL:      MULTICAST_TTL,
 	caCertificate:     "ca.cert",
 	certificate:       "",
 	key:               "",
 	requireClientAuth: false,
 	html:              "./html",
+	batchConcurrency:  BATCH_CONCURRENCY,
 	lockfile: config.Lockfile{
 		File:   DefaultLockfile,
 		Remove: true,
@@ -55,7 +59,7 @@ var RUN = Run{
 type service struct {
 	name   string
 	cmd    *Run
-	tunnel *tunnel.Tunnel
+	tunnel runnable
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -76,14 +80,14 @@ func (cmd *Run) Execute(args ...interface{}) error {
 
 	log.Printf("%s service %s - %s (PID %d)\n", name, uhppote.VERSION, "Microsoft Windows", os.Getpid())
 
-	f := func(t *tunnel.Tunnel, ctx context.Context, cancel context.CancelFunc) {
+	f := func(t runnable, ctx context.Context, cancel context.CancelFunc) {
 		cmd.start(t, ctx, cancel)
 	}
 
 	return cmd.execute(f)
 }
 
-func (cmd *Run) start(t *tunnel.Tunnel, ctx context.Context, cancel context.CancelFunc) {
+func (cmd *Run) start(t runnable, ctx context.Context, cancel context.CancelFunc) {
 	if cmd.console && !cmd.daemon {
 		log.SetOutput(os.Stdout)
 		log.SetFlags(log.LstdFlags)
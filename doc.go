@@ -21,10 +21,25 @@ The package includes the following connectors:
   - udp/listen: receives and relays UDP commands from a management application and return the replies.
   - udp/broadcast: broadcasts UDP commands to the access controllers and relays the replies.
   - udp/event: relays access controller events
+  - udp/multicast: relays UDP commands and replies (or events with udp/multicast/event) to and from a multicast group
+  - udp/client: connects to a remote UDP server and relays commands, replies and events as datagrams
+  - udp/server: accepts remote UDP clients and relays commands, replies and events as datagrams
   - tcp/client: bidirectional TCP/IP pipe that connects to a remote server and relays commands and replies
   - tcp/server: bidirectional TCP/IP pipe that accepts remote connections and relays commands and replies
   - tls/client: tcp/client connector secured with TLS
   - tls/server: tcp/client connector secured with TLS
-  - http: relays commands submitted as HTTP POST requests and returns the reply
+  - ws/client, wss/client: tcp/client connector that relays messages as binary WebSocket messages
+  - ws/server, wss/server: tcp/server connector that relays messages as binary WebSocket messages
+  - quic/client: connects to a remote QUIC server and relays each command (and replies) or event on a separate stream
+  - quic/server: accepts remote QUIC connections and relays each command (and replies) or event on a separate stream
+  - dtls/client: tcp/client connector that relays messages as DTLS datagrams, with retransmission of unanswered requests
+  - dtls/server: tcp/server connector that relays messages as DTLS datagrams, with retransmission of unanswered requests
+  - mqtt/client, mqtts/client: relays commands, replies and events through an MQTT broker
+  - ssh/client: tcp/client connector that relays messages over an SSH channel
+  - ssh/server: tcp/server connector that relays messages over an SSH channel
+  - unix/client, unixgram/client: tcp/client connector that relays messages over a Unix stream or datagram socket
+  - unix/server, unixgram/server: tcp/server connector that relays messages over a Unix stream or datagram socket
+  - http: relays commands submitted as HTTP POST requests (or as JSON REST API requests) and returns the reply, and
+    publishes events to subscribers at /events
 */
 package tunnel
@@ -0,0 +1,153 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Version 2 frame header:
+//
+//	0-1   magic ('U','T')
+//	2     protocol version
+//	3     frame type
+//	4-5   flags
+//	6-7   message length
+//	8-11  message ID
+//
+// Version 1 frames (as generated by Packetize) have only the length and ID. The framing
+// version for a connection is determined by whether the connection starts with a HELLO
+// frame (see Stream).
+const VERSION uint8 = 2
+const MAGIC uint16 = 0x5554
+const HEADER = 12
+
+// MAX_MESSAGE is the longest message that can be sent in a single frame (the frame header has
+// a 16-bit message length).
+const MAX_MESSAGE = 65535
+
+var ErrMessageTooLarge = fmt.Errorf("message exceeds maximum frame size (%v bytes)", MAX_MESSAGE)
+
+type FrameType uint8
+
+const (
+	DATA  FrameType = 0x00
+	HELLO FrameType = 0x01
+	PING  FrameType = 0x02
+	PONG  FrameType = 0x03
+	ACK   FrameType = 0x04
+)
+
+func (t FrameType) String() string {
+	switch t {
+	case DATA:
+		return "DATA"
+	case HELLO:
+		return "HELLO"
+	case PING:
+		return "PING"
+	case PONG:
+		return "PONG"
+	case ACK:
+		return "ACK"
+	default:
+		return fmt.Sprintf("%02x", uint8(t))
+	}
+}
+
+// Features is the bitmask of optional protocol features offered in a HELLO frame. The
+// features used on a connection are the features offered by both peers.
+type Features uint16
+
+const (
+	HEARTBEAT   Features = 0x0001 // responds to PING frames
+	ACKNOWLEDGE Features = 0x0002 // acknowledges DATA frames flagged with ACK_REQUEST
+)
+
+// ACK_REQUEST flags a DATA frame (e.g. an event) that should be acknowledged with an ACK
+// frame with the same ID.
+const ACK_REQUEST uint16 = 0x0001
+
+type Frame struct {
+	Version uint8
+	Type    FrameType
+	Flags   uint16
+	ID      uint32
+	Message []byte
+}
+
+// Encode returns the frame encoded as a version 2 frame. The message length is not checked
+// and the caller must reject messages longer than MAX_MESSAGE (see Frame.Check).
+func (f Frame) Encode() []byte {
+	packet := make([]byte, HEADER+len(f.Message))
+
+	binary.BigEndian.PutUint16(packet[0:], MAGIC)
+	packet[2] = VERSION
+	packet[3] = byte(f.Type)
+	binary.BigEndian.PutUint16(packet[4:], f.Flags)
+	binary.BigEndian.PutUint16(packet[6:], uint16(len(f.Message)))
+	binary.BigEndian.PutUint32(packet[8:], f.ID)
+
+	copy(packet[HEADER:], f.Message)
+
+	return packet
+}
+
+// Check returns ErrMessageTooLarge if the message is too long to be encoded in a frame.
+func (f Frame) Check() error {
+	if len(f.Message) > MAX_MESSAGE {
+		return ErrMessageTooLarge
+	}
+
+	return nil
+}
+
+// Hello constructs the HELLO frame sent when a connection is established.
+func Hello(features Features) Frame {
+	return Frame{
+		Version: VERSION,
+		Type:    HELLO,
+		Flags:   uint16(features),
+		Message: []byte{},
+	}
+}
+
+// Ping constructs a heartbeat PING frame.
+func Ping(id uint32) Frame {
+	return Frame{
+		Version: VERSION,
+		Type:    PING,
+		ID:      id,
+		Message: []byte{},
+	}
+}
+
+// Pong constructs the PONG frame sent in reply to a PING, echoing the PING ID.
+func Pong(id uint32) Frame {
+	return Frame{
+		Version: VERSION,
+		Type:    PONG,
+		ID:      id,
+		Message: []byte{},
+	}
+}
+
+// Ack constructs the ACK frame sent to acknowledge a DATA frame, echoing the DATA frame ID.
+func Ack(id uint32) Frame {
+	return Frame{
+		Version: VERSION,
+		Type:    ACK,
+		ID:      id,
+		Message: []byte{},
+	}
+}
+
+func isV2(buffer []byte) bool {
+	return len(buffer) >= 2 && binary.BigEndian.Uint16(buffer) == MAGIC
+}
+
+// isHello returns true if the buffer starts with a version 2 (or later) HELLO frame header.
+// A version 1 frame can only be mistaken for a HELLO if it has a length of 0x5554 (21844
+// bytes), which is far larger than any controller message.
+func isHello(buffer []byte) bool {
+	return len(buffer) >= 4 && isV2(buffer) && buffer[2] >= 2 && FrameType(buffer[3]) == HELLO
+}
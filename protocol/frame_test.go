@@ -0,0 +1,102 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFrameEncode(t *testing.T) {
+	frame := Frame{
+		Type:    DATA,
+		ID:      12345,
+		Message: []byte{0x01, 0x23, 0x45, 0x67},
+	}
+
+	expected := []byte{0x55, 0x54, 0x02, 0x00, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x30, 0x39, 0x01, 0x23, 0x45, 0x67}
+
+	if packet := frame.Encode(); !reflect.DeepEqual(packet, expected) {
+		t.Errorf("Incorrectly encoded frame\n   expected:%#v\n   got:     %#v", expected, packet)
+	}
+}
+
+func TestFrameCheck(t *testing.T) {
+	tests := []struct {
+		length   int
+		expected error
+	}{
+		{0, nil},
+		{MAX_MESSAGE, nil},
+		{MAX_MESSAGE + 1, ErrMessageTooLarge},
+	}
+
+	for _, test := range tests {
+		frame := Frame{Type: DATA, ID: 12345, Message: make([]byte, test.length)}
+
+		if err := frame.Check(); err != test.expected {
+			t.Errorf("incorrect error for %v byte message - expected:%v, got:%v", test.length, test.expected, err)
+		}
+	}
+}
+
+func TestHelloEncode(t *testing.T) {
+	expected := []byte{0x55, 0x54, 0x02, 0x01, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	if packet := Hello(0x0005).Encode(); !reflect.DeepEqual(packet, expected) {
+		t.Errorf("Incorrectly encoded HELLO\n   expected:%#v\n   got:     %#v", expected, packet)
+	}
+}
+
+func TestStreamDecodeV2(t *testing.T) {
+	buffer := []byte{
+		0x55, 0x54, 0x02, 0x01, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x55, 0x54, 0x02, 0x00, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x30, 0x39, 0x01, 0x23, 0x45, 0x67,
+	}
+
+	expected := []Frame{
+		{Version: 2, Type: HELLO, Flags: 0x0005, ID: 0, Message: []byte{}},
+		{Version: 2, Type: DATA, Flags: 0x0000, ID: 12345, Message: []byte{0x01, 0x23, 0x45, 0x67}},
+	}
+
+	stream := NewStream()
+	frames, err := stream.Decode(buffer)
+
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if !reflect.DeepEqual(frames, expected) {
+		t.Errorf("Incorrect frames\n   expected:%#v\n   got:     %#v", expected, frames)
+	}
+
+	if stream.Pending() != 0 {
+		t.Errorf("Incorrect pending bytes - expected:%v, got:%v", 0, stream.Pending())
+	}
+}
+
+func TestStreamDecodeFragmentedV2(t *testing.T) {
+	fragments := [][]byte{
+		{0x55},
+		{0x54, 0x02, 0x00, 0x00, 0x00, 0x00, 0x04, 0x00},
+		{0x00, 0x30, 0x39, 0x01, 0x23},
+		{0x45, 0x67},
+	}
+
+	expected := []Frame{
+		{Version: 2, Type: DATA, ID: 12345, Message: []byte{0x01, 0x23, 0x45, 0x67}},
+	}
+
+	stream := NewV2Stream()
+	frames := []Frame{}
+
+	for _, fragment := range fragments {
+		if decoded, err := stream.Decode(fragment); err != nil {
+			t.Fatalf("unexpected error (%v)", err)
+		} else {
+			frames = append(frames, decoded...)
+		}
+	}
+
+	if !reflect.DeepEqual(frames, expected) {
+		t.Errorf("Incorrect frames\n   expected:%#v\n   got:     %#v", expected, frames)
+	}
+}
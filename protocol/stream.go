@@ -0,0 +1,184 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Stream reassembles the frames received on a stream oriented connection (TCP, TLS,
+// Tailscale) where a single read may contain a partial frame or several frames.
+//
+// The framing version is determined by the first frame received on the connection. Peers
+// running protocol version 2 (or later) always open a connection with a HELLO frame, so a
+// connection that starts with anything other than a HELLO frame is decoded as version 1
+// frames (which allows peers running an older version to connect). Once the framing version
+// has been determined every frame is decoded with that framing and a version 2 frame with an
+// invalid magic number or an unsupported protocol version is rejected.
+//
+// The exception is a connection that starts with a HELLO, which also accepts version 1 frames:
+// a peer that did not receive the HELLO within its HELLO timeout (e.g. on a high latency link)
+// falls back to version 1 framing until the HELLO arrives, even though it has already sent its
+// own HELLO.
+type Stream struct {
+	version uint8
+	hello   bool
+	buffer  []byte
+	err     error
+	sync.Mutex
+}
+
+var ErrInvalidFrame = errors.New("invalid frame")
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+// NewStream creates a stream that determines the framing version from the first frame
+// received on the connection.
+func NewStream() *Stream {
+	return &Stream{
+		buffer: []byte{},
+	}
+}
+
+// NewV2Stream creates a stream for a connection that only uses version 2 frames and does
+// not start with a HELLO (e.g. QUIC streams and MQTT messages).
+func NewV2Stream() *Stream {
+	return &Stream{
+		version: 2,
+		buffer:  []byte{},
+	}
+}
+
+// Decode appends the received bytes to the stream buffer and returns the complete
+// frames in the order received. Any trailing partial frame is retained until the rest
+// of the frame is received.
+//
+// Returns an error (along with any frames decoded before the error) if a frame is invalid,
+// after which the stream cannot be resynchronised and all subsequent calls return the same
+// error.
+func (s *Stream) Decode(received []byte) ([]Frame, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.err != nil {
+		return []Frame{}, s.err
+	}
+
+	s.buffer = append(s.buffer, received...)
+	frames := []Frame{}
+
+	for len(s.buffer) >= 2 {
+		if s.version == 0 {
+			if isV2(s.buffer) && len(s.buffer) < 4 {
+				break
+			} else if isHello(s.buffer) {
+				s.version = 2
+				s.hello = true
+			} else {
+				s.version = 1
+			}
+		}
+
+		if s.version > 1 && (isV2(s.buffer) || !s.hello) {
+			if len(s.buffer) < HEADER {
+				break
+			}
+
+			if !isV2(s.buffer) {
+				s.fail(fmt.Errorf("%w (invalid magic number 0x%04x)", ErrInvalidFrame, binary.BigEndian.Uint16(s.buffer)))
+				return frames, s.err
+			}
+
+			// ... a HELLO from a newer version is accepted so that the version can be negotiated
+			if version := s.buffer[2]; version < 2 || (version > VERSION && FrameType(s.buffer[3]) != HELLO) {
+				s.fail(fmt.Errorf("%w (v%v)", ErrUnsupportedVersion, version))
+				return frames, s.err
+			}
+
+			N := int(binary.BigEndian.Uint16(s.buffer[6:]))
+			if len(s.buffer) < HEADER+N {
+				break
+			}
+
+			message := make([]byte, N)
+			copy(message, s.buffer[HEADER:HEADER+N])
+
+			frames = append(frames, Frame{
+				Version: s.buffer[2],
+				Type:    FrameType(s.buffer[3]),
+				Flags:   binary.BigEndian.Uint16(s.buffer[4:]),
+				ID:      binary.BigEndian.Uint32(s.buffer[8:]),
+				Message: message,
+			})
+
+			s.buffer = s.buffer[HEADER+N:]
+		} else {
+			if len(s.buffer) < 6 {
+				break
+			}
+
+			N := int(binary.BigEndian.Uint16(s.buffer[0:]))
+			if len(s.buffer) < N+6 {
+				break
+			}
+
+			message := make([]byte, N)
+			copy(message, s.buffer[6:6+N])
+
+			frames = append(frames, Frame{
+				Version: 1,
+				Type:    DATA,
+				ID:      binary.BigEndian.Uint32(s.buffer[2:]),
+				Message: message,
+			})
+
+			s.buffer = s.buffer[6+N:]
+		}
+	}
+
+	// ... compact buffer once it has been fully consumed
+	if len(s.buffer) == 0 {
+		s.buffer = []byte{}
+	}
+
+	return frames, nil
+}
+
+// Version returns the framing version of the stream (0 if not yet determined).
+func (s *Stream) Version() uint8 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.version
+}
+
+func (s *Stream) fail(err error) {
+	s.err = err
+	s.buffer = []byte{}
+}
+
+// Depacketize is a convenience wrapper around Decode that returns only the data
+// messages (decoded before an invalid frame, if any).
+func (s *Stream) Depacketize(received []byte) []Message {
+	messages := []Message{}
+	frames, _ := s.Decode(received)
+
+	for _, frame := range frames {
+		if frame.Type == DATA {
+			messages = append(messages, Message{
+				ID:      frame.ID,
+				Message: frame.Message,
+			})
+		}
+	}
+
+	return messages
+}
+
+// Pending returns the number of bytes buffered for an incomplete frame.
+func (s *Stream) Pending() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.buffer)
+}
@@ -0,0 +1,255 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStreamDepacketize(t *testing.T) {
+	buffer := []byte{0x00, 0x08, 0x00, 0x00, 0x30, 0x39, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	expected := []Message{
+		{ID: 12345, Message: []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}},
+	}
+
+	stream := NewStream()
+	messages := stream.Depacketize(buffer)
+
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Incorrect messages\n   expected:%#v\n   got:     %#v", expected, messages)
+	}
+
+	if stream.Pending() != 0 {
+		t.Errorf("Incorrect pending bytes - expected:%v, got:%v", 0, stream.Pending())
+	}
+}
+
+func TestStreamDepacketizeWithFragmentedHeader(t *testing.T) {
+	fragments := [][]byte{
+		{0x00, 0x08, 0x00},
+		{0x00, 0x30, 0x39, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+	}
+
+	expected := []Message{
+		{ID: 12345, Message: []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}},
+	}
+
+	stream := NewStream()
+
+	if messages := stream.Depacketize(fragments[0]); len(messages) != 0 {
+		t.Errorf("Unexpected messages from partial header %#v", messages)
+	}
+
+	if stream.Pending() != 3 {
+		t.Errorf("Incorrect pending bytes - expected:%v, got:%v", 3, stream.Pending())
+	}
+
+	if messages := stream.Depacketize(fragments[1]); !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Incorrect messages\n   expected:%#v\n   got:     %#v", expected, messages)
+	}
+}
+
+func TestStreamDepacketizeWithFragmentedMessage(t *testing.T) {
+	fragments := [][]byte{
+		{0x00, 0x08, 0x00, 0x00, 0x30, 0x39, 0x01, 0x23},
+		{0x45, 0x67},
+		{0x89, 0xab, 0xcd, 0xef},
+	}
+
+	expected := []Message{
+		{ID: 12345, Message: []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}},
+	}
+
+	stream := NewStream()
+	messages := []Message{}
+
+	for _, fragment := range fragments {
+		messages = append(messages, stream.Depacketize(fragment)...)
+	}
+
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Incorrect messages\n   expected:%#v\n   got:     %#v", expected, messages)
+	}
+
+	if stream.Pending() != 0 {
+		t.Errorf("Incorrect pending bytes - expected:%v, got:%v", 0, stream.Pending())
+	}
+}
+
+func TestStreamDepacketizeWithCoalescedMessages(t *testing.T) {
+	buffer := []byte{
+		0x00, 0x08, 0x00, 0x00, 0x30, 0x39, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+		0x00, 0x08, 0x00, 0x00, 0x30, 0x3a, 0xfe, 0xdc, 0xba, 0x98, 0x76, 0x54, 0x32, 0x10,
+		0x00, 0x00, 0x00, 0x00, 0x30, 0x3b,
+	}
+
+	expected := []Message{
+		{ID: 12345, Message: []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}},
+		{ID: 12346, Message: []byte{0xfe, 0xdc, 0xba, 0x98, 0x76, 0x54, 0x32, 0x10}},
+		{ID: 12347, Message: []byte{}},
+	}
+
+	stream := NewStream()
+	messages := stream.Depacketize(buffer)
+
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Incorrect messages\n   expected:%#v\n   got:     %#v", expected, messages)
+	}
+}
+
+func TestStreamDepacketizeWithCoalescedAndFragmentedMessages(t *testing.T) {
+	fragments := [][]byte{
+		{0x00, 0x08, 0x00, 0x00, 0x30, 0x39, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x00, 0x08, 0x00},
+		{0x00, 0x30, 0x3a, 0xfe, 0xdc, 0xba, 0x98, 0x76},
+		{0x54, 0x32, 0x10, 0x00, 0x04, 0x00, 0x00, 0x30, 0x3b, 0x01, 0x02, 0x03, 0x04},
+	}
+
+	expected := [][]Message{
+		{
+			{ID: 12345, Message: []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}},
+		},
+		{},
+		{
+			{ID: 12346, Message: []byte{0xfe, 0xdc, 0xba, 0x98, 0x76, 0x54, 0x32, 0x10}},
+			{ID: 12347, Message: []byte{0x01, 0x02, 0x03, 0x04}},
+		},
+	}
+
+	stream := NewStream()
+
+	for i, fragment := range fragments {
+		if messages := stream.Depacketize(fragment); !reflect.DeepEqual(messages, expected[i]) {
+			t.Errorf("Incorrect messages for fragment %v\n   expected:%#v\n   got:     %#v", i+1, expected[i], messages)
+		}
+	}
+
+	if stream.Pending() != 0 {
+		t.Errorf("Incorrect pending bytes - expected:%v, got:%v", 0, stream.Pending())
+	}
+}
+
+func TestStreamDepacketizeDoesNotRetainReceiveBuffer(t *testing.T) {
+	buffer := []byte{0x00, 0x02, 0x00, 0x00, 0x30, 0x39, 0x01, 0x23}
+	expected := []Message{
+		{ID: 12345, Message: []byte{0x01, 0x23}},
+	}
+
+	stream := NewStream()
+	messages := stream.Depacketize(buffer)
+
+	buffer[6] = 0xff
+	buffer[7] = 0xff
+
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Incorrect messages\n   expected:%#v\n   got:     %#v", expected, messages)
+	}
+}
+
+func TestStreamDecodeV1(t *testing.T) {
+	buffer := []byte{
+		0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0xaa, 0xbb,
+		0x55, 0x54, 0x02, 0x01, 0x00, 0x00,
+	}
+
+	// ... second frame has a 0x5554 ('UT') length prefix but is a version 1 frame
+	message := make([]byte, 0x5554)
+	message[0] = 0xcc
+
+	buffer = append(buffer, message...)
+
+	stream := NewStream()
+	frames, err := stream.Decode(buffer)
+
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if len(frames) != 2 {
+		t.Fatalf("incorrect number of frames - expected:%v, got:%v", 2, len(frames))
+	}
+
+	if f := frames[0]; f.Version != 1 || f.ID != 1 || !reflect.DeepEqual(f.Message, []byte{0xaa, 0xbb}) {
+		t.Errorf("incorrect frame - expected:%v, got:%v", "v1 frame 1", f)
+	}
+
+	if f := frames[1]; f.Version != 1 || f.Type != DATA || f.ID != 0x02010000 || len(f.Message) != 0x5554 {
+		t.Errorf("incorrect frame - expected:%v, got:%v %v %08x %v", "v1 frame 0x02010000", f.Version, f.Type, f.ID, len(f.Message))
+	}
+
+	if v := stream.Version(); v != 1 {
+		t.Errorf("incorrect stream version - expected:%v, got:%v", 1, v)
+	}
+}
+
+func TestStreamDecodeUnknownVersion(t *testing.T) {
+	buffer := []byte{
+		0x55, 0x54, 0x02, 0x01, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x55, 0x54, 0x07, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x30, 0x39, 0x01, 0x23,
+	}
+
+	stream := NewStream()
+	frames, err := stream.Decode(buffer)
+
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("incorrect error - expected:%v, got:%v", ErrUnsupportedVersion, err)
+	}
+
+	if len(frames) != 1 || frames[0].Type != HELLO {
+		t.Errorf("incorrect frames - expected:%v, got:%v", "HELLO", frames)
+	}
+
+	// ... stream cannot be resynchronised
+	if _, err := stream.Decode(Frame{Type: DATA, ID: 1}.Encode()); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("incorrect error - expected:%v, got:%v", ErrUnsupportedVersion, err)
+	}
+}
+
+func TestStreamDecodeHelloFromNewerVersion(t *testing.T) {
+	buffer := []byte{0x55, 0x54, 0x03, 0x01, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	stream := NewStream()
+	frames, err := stream.Decode(buffer)
+
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if len(frames) != 1 || frames[0].Type != HELLO || frames[0].Version != 3 {
+		t.Errorf("incorrect frames - expected:%v, got:%v", "v3 HELLO", frames)
+	}
+}
+
+func TestStreamDecodeInvalidMagic(t *testing.T) {
+	buffer := []byte{
+		0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0xaa, 0xbb, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	if _, err := NewV2Stream().Decode(buffer); !errors.Is(err, ErrInvalidFrame) {
+		t.Errorf("incorrect error - expected:%v, got:%v", ErrInvalidFrame, err)
+	}
+}
+
+func TestStreamDecodeV1AfterHello(t *testing.T) {
+	buffer := []byte{
+		0x55, 0x54, 0x02, 0x01, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0xaa, 0xbb,
+		0x55, 0x54, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0xcc,
+	}
+
+	frames, err := NewStream().Decode(buffer)
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if len(frames) != 3 {
+		t.Fatalf("incorrect frames - expected:%v, got:%v", 3, len(frames))
+	}
+
+	if f := frames[1]; f.Version != 1 || f.ID != 1 || !reflect.DeepEqual(f.Message, []byte{0xaa, 0xbb}) {
+		t.Errorf("incorrect version 1 frame - expected:%v, got:%v", "v1 DATA 1 [aa bb]", f)
+	}
+
+	if f := frames[2]; f.Version != 2 || f.ID != 2 || !reflect.DeepEqual(f.Message, []byte{0xcc}) {
+		t.Errorf("incorrect version 2 frame - expected:%v, got:%v", "v2 DATA 2 [cc]", f)
+	}
+}
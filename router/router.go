@@ -1,6 +1,8 @@
 package router
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -10,15 +12,43 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/log"
 )
 
+const IDLE_TIME = 15 * time.Second
+const SWEEP_INTERVAL = 15 * time.Second
+const RATE_LIMIT = 1
+const BURST_LIMIT = 120
+const EVENT_QUEUE = 256
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Switch connects a connector to the router. A message received by a connector is either
+// a reply to a request relayed to the connector (and is passed to the handler registered
+// for the request) or a new request/event (which is relayed by the switch relay function).
+// Requests are relayed concurrently but events (i.e. messages without a reply handler) are
+// relayed in the order in which they were received. Events are queued (up to EVENT_QUEUE) so
+// that a slow relay never blocks the connector read loop, and are discarded with a warning if
+// the queue is full.
 type Switch struct {
-	relay func(uint32, []byte)
+	router   *Router
+	handlers ihandlers
+	relay    func(uint32, []byte, func([]byte))
+	events   chan event
+}
+
+type event struct {
+	id      uint32
+	message []byte
 }
 
+// Router tracks the reply handlers for the requests relayed by a tunnel. Each tunnel
+// has its own router with its own handlers, idle time and rate limiter.
 type Router struct {
-	handlers ihandlers
+	tag      string
+	switches []*Switch
 	idletime time.Duration
+	limiter  *rate.Limiter
 	closing  chan struct{}
 	closed   chan struct{}
+	once     sync.Once
 	sync.RWMutex
 }
 
@@ -33,54 +63,152 @@ type handler struct {
 	touched time.Time
 }
 
-var router = Router{
-	handlers: hmake(),
-	idletime: 15 * time.Second,
-	closing:  make(chan struct{}),
-	closed:   make(chan struct{}),
-}
+// NewRouter creates a router that rate limits received requests using the limiter and
+// starts the sweeper that removes idle handlers. A nil limiter defaults to the standard
+// rate limit of 1 request per second with a burst limit of 120 requests. The (optional)
+// label identifies the tunnel in the router log messages.
+func NewRouter(label string, limiter *rate.Limiter) *Router {
+	if limiter == nil {
+		limiter = rate.NewLimiter(RATE_LIMIT, BURST_LIMIT)
+	}
+
+	tag := "ROUTER"
+	if label != "" {
+		tag = fmt.Sprintf("%v/%v", label, tag)
+	}
 
-var ticker = time.NewTicker(15 * time.Second)
-var limiter = rate.NewLimiter(1, 120)
+	r := Router{
+		tag:      tag,
+		switches: []*Switch{},
+		idletime: IDLE_TIME,
+		limiter:  limiter,
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
 
-func init() {
 	go func() {
+		ticker := time.NewTicker(SWEEP_INTERVAL)
+
 		defer func() {
-			router.closed <- struct{}{}
+			ticker.Stop()
+			close(r.closed)
 		}()
 
 		for {
 			select {
-			case <-router.closing:
+			case <-r.closing:
 				return
 
 			case <-ticker.C:
-				router.Sweep()
+				r.Sweep()
 			}
 		}
 	}()
+
+	return &r
 }
 
-func SetRateLimiter(l *rate.Limiter) {
-	if l != nil {
-		limiter = l
+// NewSwitch creates a switch with its own reply handlers. The relay function is invoked
+// for received messages that are not replies, with the requester reply handler (if any).
+func (r *Router) NewSwitch(f func(uint32, []byte, func([]byte))) *Switch {
+	s := Switch{
+		router:   r,
+		handlers: hmake(),
+		relay:    f,
+		events:   make(chan event, EVENT_QUEUE),
 	}
+
+	r.Lock()
+	r.switches = append(r.switches, &s)
+	r.Unlock()
+
+	go func() {
+		for {
+			select {
+			case e := <-s.events:
+				s.relay(e.id, e.message, nil)
+
+			case <-r.closing:
+				return
+			}
+		}
+	}()
+
+	return &s
 }
 
-func NewSwitch(f func(uint32, []byte)) Switch {
-	return Switch{
-		relay: f,
+// Received relays a received message, discarding the message (with a warning) if the router
+// rate limit has been exceeded.
+func (s *Switch) Received(id uint32, message []byte, h func([]byte)) {
+	if err := s.Accept(id, message, h); err != nil {
+		warnf(s.router.tag, "%v", err)
 	}
 }
 
-func (s *Switch) Received(id uint32, message []byte, h func([]byte)) {
-	if !limiter.Allow() {
-		warnf("ROUTER", "rate limit exceeded")
-		return
+// Accept is the same as Received but returns ErrRateLimited rather than logging a warning if
+// the message was discarded because the router rate limit has been exceeded, for connectors
+// that report the error back to the requester.
+func (s *Switch) Accept(id uint32, message []byte, h func([]byte)) error {
+	if !s.router.limiter.Allow() {
+		return ErrRateLimited
+	}
+
+	s.dispatch(id, message, h)
+
+	return nil
+}
+
+// AcceptWait is the same as Accept but waits for the router rate limiter rather than discarding
+// the message, for connectors that relay a list of requests (e.g. an HTTP batch request). Returns
+// the context error if the context is cancelled while waiting and ErrRateLimited if the rate
+// limiter has a burst limit of 0 (i.e. never permits a request).
+func (s *Switch) AcceptWait(ctx context.Context, id uint32, message []byte, h func([]byte)) error {
+	limiter := s.router.limiter
+
+	if limiter.Burst() == 0 && limiter.Limit() != rate.Inf {
+		return ErrRateLimited
 	}
 
+	if err := limiter.Wait(ctx); err != nil {
+		return err
+	}
+
+	s.dispatch(id, message, h)
+
+	return nil
+}
+
+// Delay returns the (estimated) time the router rate limiter would take to permit N requests,
+// for connectors that pace a list of requests. Returns false if the rate limiter would never
+// permit all the requests.
+func (s *Switch) Delay(N int) (time.Duration, bool) {
+	limiter := s.router.limiter
+	limit := limiter.Limit()
+	tokens := limiter.Tokens()
+
+	switch {
+	case limit == rate.Inf:
+		return 0, true
+
+	case limiter.Burst() == 0:
+		return 0, false
+
+	case float64(N) <= tokens:
+		return 0, true
+
+	case limit <= 0:
+		return 0, false
+
+	default:
+		return time.Duration((float64(N) - tokens) / float64(limit) * float64(time.Second)), true
+	}
+}
+
+func (s *Switch) dispatch(id uint32, message []byte, h func([]byte)) {
+	router := s.router
+
 	if message != nil {
-		hf := router.get(id)
+		hf := s.get(id)
 
 		switch {
 		case hf != nil:
@@ -88,28 +216,51 @@ func (s *Switch) Received(id uint32, message []byte, h func([]byte)) {
 				hf(message)
 			}()
 
-		default:
-			if h != nil {
-				router.add(id, h)
+		case h == nil:
+			select {
+			case s.events <- event{id, message}:
+			default:
+				warnf(router.tag, "event queue full - discarding event %v", id)
 			}
 
+		default:
 			go func() {
-				s.relay(id, message)
+				s.relay(id, message, h)
 			}()
 		}
 	}
 }
 
-func (r *Router) add(id uint32, h func([]byte)) {
-	r.handlers.put(id,
-		&handler{
-			f:       h,
-			touched: time.Now(),
-		})
+// Reply passes a reply to the handler registered for the request, for connectors that receive
+// the replies to a request separately from new requests and events. Returns false if there is
+// no handler for the request (e.g. a late reply after the handler has been removed as idle),
+// in which case the reply is discarded rather than relayed as an event.
+func (s *Switch) Reply(id uint32, message []byte) bool {
+	if hf := s.get(id); hf != nil {
+		go func() {
+			hf(message)
+		}()
+
+		return true
+	}
+
+	return false
 }
 
-func (r *Router) get(id uint32) func([]byte) {
-	if h := r.handlers.get(id); h != nil && h.f != nil {
+// Expect registers the handler for the replies to a request relayed to the switch
+// connector.
+func (s *Switch) Expect(id uint32, h func([]byte)) {
+	if h != nil {
+		s.handlers.put(id,
+			&handler{
+				f:       h,
+				touched: time.Now(),
+			})
+	}
+}
+
+func (s *Switch) get(id uint32) func([]byte) {
+	if h := s.handlers.get(id); h != nil && h.f != nil {
 		h.touched = time.Now()
 		return h.f
 	}
@@ -129,26 +280,36 @@ func (r *Router) Sweep() {
 		}
 
 		for _, k := range idle {
-			debugf("ROUTER", "removing idle handler function (%v)", k)
+			debugf(r.tag, "removing idle handler function (%v)", k)
 			delete(handlers, k)
 		}
 	}
 
-	r.handlers.apply(f)
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, s := range r.switches {
+		s.handlers.apply(f)
+	}
 }
 
-func Close() {
-	infof("ROUTER", "closing")
-	router.closing <- struct{}{}
+// Close stops the idle handler sweeper. Close is idempotent.
+func (r *Router) Close() {
+	r.once.Do(func() {
+		infof(r.tag, "closing")
+		close(r.closing)
 
-	timeout := time.NewTimer(5 * time.Second)
-	select {
-	case <-router.closed:
-		infof("ROUTER", "closed")
+		timeout := time.NewTimer(5 * time.Second)
+		defer timeout.Stop()
 
-	case <-timeout.C:
-		infof("ROUTER", "close timeout")
-	}
+		select {
+		case <-r.closed:
+			infof(r.tag, "closed")
+
+		case <-timeout.C:
+			infof(r.tag, "close timeout")
+		}
+	})
 }
 
 func debugf(tag string, format string, args ...any) {
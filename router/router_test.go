@@ -0,0 +1,344 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRoutersDoNotShareHandlers(t *testing.T) {
+	r1 := NewRouter("", nil)
+	r2 := NewRouter("", nil)
+
+	defer r1.Close()
+	defer r2.Close()
+
+	relayed := make(chan uint32, 2)
+	replied := make(chan []byte, 1)
+
+	s1 := r1.NewSwitch(func(id uint32, message []byte, h func([]byte)) {})
+	s2 := r2.NewSwitch(func(id uint32, message []byte, h func([]byte)) { relayed <- id })
+
+	s1.Expect(12345, func(reply []byte) { replied <- reply })
+	s2.Received(12345, []byte{0x02}, nil)
+
+	select {
+	case id := <-relayed:
+		if id != 12345 {
+			t.Errorf("incorrect relayed message ID - expected:%v, got:%v", 12345, id)
+		}
+
+	case <-replied:
+		t.Errorf("message routed to handler registered with another router")
+
+	case <-time.After(time.Second):
+		t.Errorf("message not relayed")
+	}
+}
+
+func TestSwitchReplyHandler(t *testing.T) {
+	r := NewRouter("", nil)
+	defer r.Close()
+
+	replied := make(chan []byte, 1)
+
+	out := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {})
+	in := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {
+		out.Expect(id, h)
+	})
+
+	in.Received(12345, []byte{0x01}, func(reply []byte) { replied <- reply })
+
+	time.Sleep(100 * time.Millisecond)
+	out.Received(12345, []byte{0x02}, nil)
+
+	select {
+	case reply := <-replied:
+		if len(reply) != 1 || reply[0] != 0x02 {
+			t.Errorf("incorrect reply - expected:%v, got:%v", []byte{0x02}, reply)
+		}
+
+	case <-time.After(time.Second):
+		t.Errorf("reply not routed to handler")
+	}
+}
+
+func TestSwitchReply(t *testing.T) {
+	r := NewRouter("", nil)
+	defer r.Close()
+
+	replied := make(chan []byte, 1)
+	relayed := make(chan uint32, 1)
+
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {
+		relayed <- id
+	})
+
+	s.Expect(12345, func(reply []byte) { replied <- reply })
+
+	if !s.Reply(12345, []byte{0x01}) {
+		t.Errorf("reply not routed to handler")
+	} else if reply := <-replied; len(reply) != 1 || reply[0] != 0x01 {
+		t.Errorf("incorrect reply - expected:%v, got:%v", []byte{0x01}, reply)
+	}
+
+	if s.Reply(54321, []byte{0x02}) {
+		t.Errorf("reply without handler routed to handler")
+	}
+
+	select {
+	case id := <-relayed:
+		t.Errorf("reply without handler relayed as event %v", id)
+
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSwitchesDoNotShareHandlers(t *testing.T) {
+	r := NewRouter("", nil)
+	defer r.Close()
+
+	relayed := make(chan uint32, 1)
+	replied := make(chan []byte, 1)
+
+	s1 := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {})
+	s2 := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) { relayed <- id })
+
+	s1.Expect(12345, func(reply []byte) { replied <- reply })
+	s2.Received(12345, []byte{0x02}, nil)
+
+	select {
+	case <-relayed:
+	case <-replied:
+		t.Errorf("request on one switch treated as reply to request relayed to another switch")
+	case <-time.After(time.Second):
+		t.Errorf("message not relayed")
+	}
+}
+
+func TestSwitchRelaysRequestsConcurrently(t *testing.T) {
+	r := NewRouter("", nil)
+	defer r.Close()
+
+	blocked := make(chan struct{})
+	relayed := make(chan uint32, 2)
+
+	defer close(blocked)
+
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {
+		if id == 1 {
+			<-blocked
+		}
+
+		relayed <- id
+	})
+
+	s.Received(1, []byte{0x01}, func([]byte) {})
+	s.Received(2, []byte{0x02}, func([]byte) {})
+
+	select {
+	case id := <-relayed:
+		if id != 2 {
+			t.Errorf("incorrect relayed message - expected:%v, got:%v", 2, id)
+		}
+
+	case <-time.After(time.Second):
+		t.Errorf("request blocked by a pending request")
+	}
+}
+
+func TestSwitchRelaysEventsInOrder(t *testing.T) {
+	r := NewRouter("", rate.NewLimiter(rate.Inf, 0))
+	defer r.Close()
+
+	relayed := make(chan uint32, 100)
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) { relayed <- id })
+
+	for id := uint32(1); id <= 100; id++ {
+		s.Received(id, []byte{0x20}, nil)
+	}
+
+	for expected := uint32(1); expected <= 100; expected++ {
+		select {
+		case id := <-relayed:
+			if id != expected {
+				t.Fatalf("event relayed out of order - expected:%v, got:%v", expected, id)
+			}
+
+		case <-time.After(time.Second):
+			t.Fatalf("event %v not relayed", expected)
+		}
+	}
+}
+
+func TestSwitchDiscardsEventsWhenQueueFull(t *testing.T) {
+	r := NewRouter("", rate.NewLimiter(rate.Inf, 0))
+	defer r.Close()
+
+	blocked := make(chan struct{})
+	relayed := make(chan uint32, 2*EVENT_QUEUE)
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {
+		<-blocked
+		relayed <- id
+	})
+
+	done := make(chan struct{})
+
+	go func() {
+		for id := uint32(1); id <= 2*EVENT_QUEUE; id++ {
+			s.Received(id, []byte{0x20}, nil)
+		}
+
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("event relay blocked by a full event queue")
+	}
+
+	close(blocked)
+
+	// ... the queued events (and the event being relayed when the queue filled up) are relayed
+	count := 0
+
+loop:
+	for {
+		select {
+		case <-relayed:
+			count++
+
+		case <-time.After(100 * time.Millisecond):
+			break loop
+		}
+	}
+
+	if count < EVENT_QUEUE || count > EVENT_QUEUE+1 {
+		t.Errorf("incorrect number of relayed events - expected:%v, got:%v", EVENT_QUEUE, count)
+	}
+}
+
+func TestRouterRateLimit(t *testing.T) {
+	r := NewRouter("", rate.NewLimiter(0, 1))
+	defer r.Close()
+
+	relayed := make(chan uint32, 2)
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) { relayed <- id })
+
+	s.Received(1, []byte{0x01}, nil)
+	s.Received(2, []byte{0x02}, nil)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if N := len(relayed); N != 1 {
+		t.Errorf("incorrect number of relayed messages - expected:%v, got:%v", 1, N)
+	}
+}
+
+func TestSwitchAcceptRateLimit(t *testing.T) {
+	r := NewRouter("", rate.NewLimiter(0, 1))
+	defer r.Close()
+
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {})
+
+	if err := s.Accept(1, []byte{0x01}, nil); err != nil {
+		t.Errorf("unexpected error - expected:%v, got:%v", nil, err)
+	}
+
+	if err := s.Accept(2, []byte{0x02}, nil); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("incorrect error - expected:%v, got:%v", ErrRateLimited, err)
+	}
+}
+
+func TestSwitchAcceptWait(t *testing.T) {
+	r := NewRouter("", rate.NewLimiter(100, 2))
+	defer r.Close()
+
+	relayed := make(chan uint32, 10)
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) { relayed <- id })
+
+	for i := uint32(1); i <= 10; i++ {
+		if err := s.AcceptWait(context.Background(), i, []byte{0x01}, func([]byte) {}); err != nil {
+			t.Fatalf("unexpected error - expected:%v, got:%v", nil, err)
+		}
+	}
+
+	timeout := time.After(time.Second)
+	for range 10 {
+		select {
+		case <-relayed:
+		case <-timeout:
+			t.Fatalf("rate limited requests not relayed")
+		}
+	}
+}
+
+func TestSwitchAcceptWaitCancelled(t *testing.T) {
+	r := NewRouter("", rate.NewLimiter(0, 1))
+	defer r.Close()
+
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+	defer cancel()
+
+	if err := s.AcceptWait(ctx, 1, []byte{0x01}, nil); err != nil {
+		t.Errorf("unexpected error - expected:%v, got:%v", nil, err)
+	}
+
+	if err := s.AcceptWait(ctx, 2, []byte{0x02}, nil); err == nil {
+		t.Errorf("expected error waiting for rate limiter")
+	}
+}
+
+func TestSwitchAcceptWaitWithZeroBurst(t *testing.T) {
+	r := NewRouter("", rate.NewLimiter(1, 0))
+	defer r.Close()
+
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {})
+
+	if err := s.AcceptWait(context.Background(), 1, []byte{0x01}, nil); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("incorrect error - expected:%v, got:%v", ErrRateLimited, err)
+	}
+}
+
+func TestSwitchDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *rate.Limiter
+		N       int
+		delay   time.Duration
+		ok      bool
+	}{
+		{"unlimited", rate.NewLimiter(rate.Inf, 0), 1000, 0, true},
+		{"within burst", rate.NewLimiter(1, 120), 100, 0, true},
+		{"exceeds burst", rate.NewLimiter(10, 100), 200, 10 * time.Second, true},
+		{"zero burst", rate.NewLimiter(1, 0), 1, 0, false},
+		{"zero rate", rate.NewLimiter(0, 10), 20, 0, false},
+	}
+
+	for _, test := range tests {
+		r := NewRouter("", test.limiter)
+		s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {})
+
+		delay, ok := s.Delay(test.N)
+		if ok != test.ok {
+			t.Errorf("%v: incorrect result - expected:%v, got:%v", test.name, test.ok, ok)
+		} else if ok && (delay < test.delay-time.Second || delay > test.delay) {
+			t.Errorf("%v: incorrect delay - expected:%v, got:%v", test.name, test.delay, delay)
+		}
+
+		r.Close()
+	}
+}
+
+func TestRouterCloseIsIdempotent(t *testing.T) {
+	r := NewRouter("", nil)
+
+	r.Close()
+	r.Close()
+}
@@ -10,6 +10,17 @@ import (
 
 const RETRY_MIN_DELAY = 5 * time.Second
 
+type failure struct{}
+
+// WithFailure returns a cancellable context that allows a connector to fail just the
+// tunnel it belongs to (e.g. when the retry count is exceeded) rather than terminating
+// the process.
+func WithFailure(parent context.Context) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	return context.WithValue(ctx, failure{}, cancel), cancel
+}
+
 type Backoff struct {
 	retries       int
 	retryDelay    time.Duration
@@ -36,7 +47,13 @@ func (b *Backoff) Reset() {
 func (b *Backoff) Wait(tag string) bool {
 	b.retries++
 	if b.maxRetries >= 0 && b.retries > b.maxRetries {
-		fatalf(tag, "retry count exceeded %v", b.maxRetries)
+		if fail, ok := b.ctx.Value(failure{}).(context.CancelCauseFunc); ok {
+			warnf(tag, "retry count exceeded %v", b.maxRetries)
+			fail(fmt.Errorf("%v retry count exceeded %v", tag, b.maxRetries))
+		} else {
+			fatalf(tag, "retry count exceeded %v", b.maxRetries)
+		}
+
 		return false
 	}
 
@@ -56,6 +73,12 @@ func (b *Backoff) Wait(tag string) bool {
 	return true
 }
 
+func warnf(tag string, format string, args ...any) {
+	f := fmt.Sprintf("%-10v %v", tag, format)
+
+	log.Warnf(f, args...)
+}
+
 func debugf(tag, format string, args ...any) {
 	f := fmt.Sprintf("%-10v %v", tag, format)
 
@@ -0,0 +1,72 @@
+package conn
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	retry := Backoff{
+		retryDelay:    10 * time.Millisecond,
+		maxRetries:    -1,
+		maxRetryDelay: 40 * time.Millisecond,
+		ctx:           ctx,
+	}
+
+	for _, expected := range []time.Duration{20, 40, 40} {
+		if !retry.Wait("TEST") {
+			t.Fatalf("unexpected retry failure")
+		}
+
+		if retry.retryDelay != expected*time.Millisecond {
+			t.Errorf("incorrect retry delay - expected:%v, got:%v", expected*time.Millisecond, retry.retryDelay)
+		}
+	}
+
+	retry.Reset()
+
+	if retry.retries != 0 || retry.retryDelay != RETRY_MIN_DELAY {
+		t.Errorf("incorrect reset - expected:%v %v, got:%v %v", 0, RETRY_MIN_DELAY, retry.retries, retry.retryDelay)
+	}
+}
+
+func TestBackoffWithFailure(t *testing.T) {
+	ctx, cancel := WithFailure(context.Background())
+	defer cancel(nil)
+
+	retry := NewBackoff(0, time.Second, ctx)
+
+	if retry.Wait("TEST") {
+		t.Fatalf("expected retry count exceeded")
+	}
+
+	// ... fails just the tunnel context rather than terminating the process
+	if ctx.Err() == nil {
+		t.Fatalf("tunnel context not cancelled")
+	}
+
+	if cause := context.Cause(ctx); cause == nil || cause.Error() != "TEST retry count exceeded 0" {
+		t.Errorf("incorrect failure cause - expected:%v, got:%v", "TEST retry count exceeded 0", cause)
+	}
+}
+
+func TestBackoffCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	retry := NewBackoff(-1, time.Minute, ctx)
+
+	cancel()
+
+	start := time.Now()
+
+	if retry.Wait("TEST") {
+		t.Errorf("expected Wait to return false after the context is cancelled")
+	}
+
+	if dt := time.Since(start); dt > time.Second {
+		t.Errorf("Wait did not return when the context was cancelled (%v)", dt)
+	}
+}
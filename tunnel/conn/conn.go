@@ -12,6 +12,14 @@ type Conn struct {
 	Tag string
 }
 
+// SetLabel prefixes the log tag with a tunnel label to distinguish the log messages of
+// tunnels running in the same process.
+func (c *Conn) SetLabel(label string) {
+	if label != "" {
+		c.Tag = fmt.Sprintf("%v/%v", label, c.Tag)
+	}
+}
+
 func (c Conn) Dumpf(message []byte, format string, args ...any) {
 	Dumpf(c.Tag, message, format, args...)
 }
@@ -0,0 +1,228 @@
+package conn
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const MAX_DATAGRAM = 65536
+
+// DatagramListener demultiplexes the datagrams received on a connectionless socket (UDP,
+// unixgram) into a connection for each remote address, so that a server connector can run a
+// session (or a DTLS connection) per remote peer in the same way as for a stream socket.
+//
+// The optional filter discards the first datagram from an unknown address unless it is a valid
+// connection request (e.g. a DTLS ClientHello). Datagrams from unbound sockets (e.g. an unnamed
+// unixgram socket) are discarded because there is no address to reply to.
+type DatagramListener struct {
+	socket net.PacketConn
+	filter func([]byte) bool
+	peers  map[string]*datagramConn
+	accept chan *datagramConn
+	closed chan struct{}
+	once   sync.Once
+	sync.Mutex
+}
+
+// datagramConn is the server end of a connection accepted by a DatagramListener.
+type datagramConn struct {
+	listener *DatagramListener
+	addr     net.Addr
+	ch       chan []byte
+	deadline chan struct{}
+	timer    *time.Timer
+	closed   chan struct{}
+	once     sync.Once
+	sync.Mutex
+}
+
+func NewDatagramListener(socket net.PacketConn, filter func([]byte) bool) *DatagramListener {
+	listener := DatagramListener{
+		socket: socket,
+		filter: filter,
+		peers:  map[string]*datagramConn{},
+		accept: make(chan *datagramConn, 16),
+		closed: make(chan struct{}),
+	}
+
+	go listener.read()
+
+	return &listener
+}
+
+func (l *DatagramListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener socket, which also closes all the accepted connections.
+func (l *DatagramListener) Close() error {
+	err := net.ErrClosed
+
+	l.once.Do(func() {
+		close(l.closed)
+		err = l.socket.Close()
+	})
+
+	return err
+}
+
+func (l *DatagramListener) Addr() net.Addr {
+	return l.socket.LocalAddr()
+}
+
+func (l *DatagramListener) read() {
+	defer l.Close()
+
+	buffer := make([]byte, MAX_DATAGRAM)
+
+	for {
+		N, addr, err := l.socket.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+
+		if addr == nil || addr.String() == "" {
+			continue
+		}
+
+		key := addr.String()
+
+		l.Lock()
+		c, ok := l.peers[key]
+		if !ok {
+			if l.filter != nil && !l.filter(buffer[:N]) {
+				l.Unlock()
+				continue
+			}
+
+			c = &datagramConn{
+				listener: l,
+				addr:     addr,
+				ch:       make(chan []byte, 16),
+				deadline: make(chan struct{}),
+				closed:   make(chan struct{}),
+			}
+
+			l.peers[key] = c
+		}
+		l.Unlock()
+
+		if !ok {
+			select {
+			case l.accept <- c:
+			case <-l.closed:
+				return
+			}
+		}
+
+		c.deliver(slices.Clone(buffer[:N]))
+	}
+}
+
+func (c *datagramConn) deliver(datagram []byte) {
+	select {
+	case c.ch <- datagram:
+	case <-c.closed:
+	case <-c.listener.closed:
+	}
+}
+
+func (c *datagramConn) Read(b []byte) (int, error) {
+	c.Lock()
+	deadline := c.deadline
+	c.Unlock()
+
+	select {
+	case datagram := <-c.ch:
+		return copy(b, datagram), nil
+
+	case <-deadline:
+		return 0, os.ErrDeadlineExceeded
+
+	case <-c.closed:
+		return 0, io.EOF
+
+	case <-c.listener.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *datagramConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+
+	default:
+		return c.listener.socket.WriteTo(b, c.addr)
+	}
+}
+
+// Close removes the connection from the listener. A subsequent datagram from the same remote
+// address is accepted as a new connection.
+func (c *datagramConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+
+		c.listener.Lock()
+		delete(c.listener.peers, c.addr.String())
+		c.listener.Unlock()
+	})
+
+	return nil
+}
+
+func (c *datagramConn) LocalAddr() net.Addr {
+	return c.listener.socket.LocalAddr()
+}
+
+func (c *datagramConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *datagramConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *datagramConn) SetReadDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	deadline := make(chan struct{})
+
+	switch {
+	case t.IsZero():
+
+	case !t.After(time.Now()):
+		close(deadline)
+
+	default:
+		c.timer = time.AfterFunc(time.Until(t), func() {
+			close(deadline)
+		})
+	}
+
+	c.deadline = deadline
+
+	return nil
+}
+
+// SetWriteDeadline is not supported - writes to a datagram socket do not block.
+func (c *datagramConn) SetWriteDeadline(t time.Time) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,84 @@
+package conn
+
+import (
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDatagramListener(t *testing.T) {
+	socket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	listener := NewDatagramListener(socket, func(b []byte) bool {
+		return len(b) > 0 && b[0] == 0x01
+	})
+
+	defer listener.Close()
+
+	client, err := net.Dial("udp4", socket.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer client.Close()
+
+	// ... filtered
+	client.Write([]byte{0x02, 0x03})
+	client.Write([]byte{0x01, 0x02})
+	client.Write([]byte{0x02, 0x03})
+
+	c, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if c.RemoteAddr().String() != client.LocalAddr().String() {
+		t.Errorf("incorrect remote address - expected:%v, got:%v", client.LocalAddr(), c.RemoteAddr())
+	}
+
+	buffer := make([]byte, 16)
+	for _, expected := range [][]byte{{0x01, 0x02}, {0x02, 0x03}} {
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		if N, err := c.Read(buffer); err != nil {
+			t.Fatalf("%v", err)
+		} else if !slices.Equal(buffer[:N], expected) {
+			t.Errorf("incorrect datagram - expected:%v, got:%v", expected, buffer[:N])
+		}
+	}
+
+	// ... reply
+	if _, err := c.Write([]byte{0x04}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if N, err := client.Read(buffer); err != nil {
+		t.Fatalf("%v", err)
+	} else if !slices.Equal(buffer[:N], []byte{0x04}) {
+		t.Errorf("incorrect reply - expected:%v, got:%v", []byte{0x04}, buffer[:N])
+	}
+
+	// ... read deadline
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := c.Read(buffer); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error, got:%v", err)
+	}
+
+	// ... closed
+	listener.Close()
+
+	c.SetReadDeadline(time.Time{})
+	if _, err := c.Read(buffer); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected closed error, got:%v", err)
+	}
+
+	if _, err := listener.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected closed error, got:%v", err)
+	}
+}
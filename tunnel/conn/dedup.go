@@ -0,0 +1,64 @@
+package conn
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const DEDUP_WINDOW = 10 * time.Minute
+
+// Dedup detects retransmitted messages (e.g. events that were received but for which the
+// ACK was lost). A message is identified by the message ID and a hash of the message
+// content, so that a message with a reused ID (e.g. after the sender restarts) is not
+// mistaken for a duplicate. Messages are remembered for the dedup window.
+type Dedup struct {
+	window time.Duration
+	seen   map[dedupKey]time.Time
+	swept  time.Time
+	sync.Mutex
+}
+
+type dedupKey struct {
+	id   uint32
+	hash uint64
+}
+
+func NewDedup(window time.Duration) *Dedup {
+	return &Dedup{
+		window: window,
+		seen:   map[dedupKey]time.Time{},
+		swept:  time.Now(),
+	}
+}
+
+// Duplicate returns true if the message has already been received within the dedup window
+// and records the message otherwise.
+func (d *Dedup) Duplicate(id uint32, message []byte) bool {
+	h := fnv.New64a()
+	h.Write(message)
+
+	key := dedupKey{id, h.Sum64()}
+	now := time.Now()
+
+	d.Lock()
+	defer d.Unlock()
+
+	if now.Sub(d.swept) > d.window {
+		for k, v := range d.seen {
+			if now.Sub(v) > d.window {
+				delete(d.seen, k)
+			}
+		}
+
+		d.swept = now
+	}
+
+	if t, ok := d.seen[key]; ok && now.Sub(t) <= d.window {
+		return true
+	}
+
+	d.seen[key] = now
+
+	return false
+}
@@ -0,0 +1,21 @@
+package conn
+
+import (
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	dedup := NewDedup(DEDUP_WINDOW)
+
+	if dedup.Duplicate(1, []byte{0x01}) {
+		t.Errorf("first event incorrectly identified as duplicate")
+	}
+
+	if !dedup.Duplicate(1, []byte{0x01}) {
+		t.Errorf("retransmitted event not identified as duplicate")
+	}
+
+	if dedup.Duplicate(1, []byte{0x02}) {
+		t.Errorf("event with reused ID incorrectly identified as duplicate")
+	}
+}
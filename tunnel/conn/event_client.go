@@ -0,0 +1,157 @@
+package conn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+)
+
+// EventClient implements the connect/reconnect loop shared by the stream event client
+// connectors. The connectors differ only in how the connection is established and in the
+// direction in which events are relayed, which are supplied as the Dial, Received and Relay
+// functions.
+type EventClient struct {
+	Forwarder
+	Dial     func(context.Context) (net.Conn, error)
+	Received func([]byte, *Session, *router.Switch, net.Conn)
+	Relay    func(*Session, uint32, []byte) error
+
+	addr      string
+	retry     Backoff
+	heartbeat Heartbeat
+	buffer    int
+	ctx       context.Context
+	closed    chan struct{}
+}
+
+// NewEventClient creates the EventClient for a connector, with an optional event queue. The
+// buffer size is the maximum size of a single read from the connection.
+func NewEventClient(tag string, addr string, retry Backoff, heartbeat Heartbeat, queue *Queue, buffer int, ctx context.Context) EventClient {
+	return EventClient{
+		Forwarder: NewForwarder(tag, queue),
+		addr:      addr,
+		retry:     retry,
+		heartbeat: heartbeat,
+		buffer:    buffer,
+		ctx:       ctx,
+		closed:    make(chan struct{}),
+	}
+}
+
+// Addr returns the address of the remote end of the connection.
+func (c *EventClient) Addr() string {
+	return c.addr
+}
+
+func (c *EventClient) Close() {
+	c.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-c.closed:
+		c.Infof("closed")
+
+	case <-timeout.C:
+		c.Infof("close timeout")
+	}
+}
+
+func (c *EventClient) Run(router *router.Switch) error {
+	c.connect(router)
+	c.closed <- struct{}{}
+
+	return nil
+}
+
+// Deliver sends an event to the remote end of the connection and waits for it to be
+// acknowledged (if the session supports acknowledgements).
+func (c *EventClient) Deliver(session *Session, id uint32, msg []byte) error {
+	if err := session.Deliver(id, msg); err != nil {
+		c.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
+		return err
+	} else {
+		c.Infof("msg %v  sent %v bytes to %v", id, len(msg), session.RemoteAddr())
+	}
+
+	return nil
+}
+
+func (c *EventClient) connect(router *router.Switch) {
+	for {
+		c.Infof("connecting to %v", c.addr)
+
+		if socket, err := c.Dial(c.ctx); err != nil {
+			c.Warnf("%v", err)
+		} else if socket == nil {
+			c.Warnf("connect %v failed (%v)", c.addr, socket)
+		} else {
+			c.retry.Reset()
+			session := NewSession(c.Conn, socket, c.heartbeat)
+			eof := make(chan struct{})
+
+			go func() {
+				send := func(id uint32, msg []byte) error {
+					return c.Relay(session, id, msg)
+				}
+
+				// ... reconnect to relay an undelivered event again
+				if err := c.Forward(eof, socket.RemoteAddr(), send); err != nil {
+					socket.Close()
+				}
+			}()
+
+			if err := c.listen(socket, session, router); err != nil && !disconnected(err) && c.ctx.Err() == nil {
+				c.Warnf("%v", err)
+			}
+
+			close(eof)
+		}
+
+		if !c.retry.Wait(c.Tag) {
+			return
+		}
+	}
+}
+
+func (c *EventClient) listen(socket net.Conn, session *Session, router *router.Switch) error {
+	c.Infof("connected  to %v", socket.RemoteAddr())
+
+	stop := context.AfterFunc(c.ctx, func() {
+		socket.Close()
+	})
+
+	defer stop()
+	defer socket.Close()
+	defer session.Close()
+
+	if err := session.Start(); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, c.buffer)
+
+	for {
+		N, err := socket.Read(buffer)
+		if err != nil {
+			return err
+		}
+
+		c.Received(buffer[:N], session, router, socket)
+	}
+}
+
+// Discard handles the data received on a connection that relays events to the remote end
+// of the tunnel. Events are relayed in one direction only so anything other than protocol
+// control frames is discarded.
+func Discard(buffer []byte, session *Session, router *router.Switch, socket net.Conn) {
+	session.Received(buffer)
+}
+
+// disconnected returns true if the error is the normal end of a connection.
+func disconnected(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
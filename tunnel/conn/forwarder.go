@@ -0,0 +1,108 @@
+package conn
+
+import (
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+)
+
+// Forwarder holds the events sent to an event client connector until they can be relayed to
+// the remote end of the tunnel. Events are held in the event queue if the connector has one
+// and otherwise in a small buffer that discards events while the buffer is full.
+type Forwarder struct {
+	Conn
+	queue *Queue
+	ch    chan protocol.Message
+}
+
+// NewForwarder creates a Forwarder for the connector, with an optional event queue.
+func NewForwarder(tag string, queue *Queue) Forwarder {
+	return Forwarder{
+		Conn: Conn{
+			Tag: tag,
+		},
+		queue: queue,
+		ch:    make(chan protocol.Message, 16),
+	}
+}
+
+// SetLabel sets the tunnel label for both the connector and the event queue (if any).
+func (f *Forwarder) SetLabel(label string) {
+	f.Conn.SetLabel(label)
+
+	if f.queue != nil {
+		f.queue.SetLabel(label)
+	}
+}
+
+func (f *Forwarder) Send(id uint32, msg []byte) {
+	if f.queue != nil {
+		f.queue.Put(id, msg)
+		return
+	}
+
+	select {
+	case f.ch <- protocol.Message{ID: id, Message: msg}:
+	default:
+	}
+}
+
+// Forward relays events to the remote end of the connection with the send function until
+// done is closed.
+//
+// Queued events are relayed in order and an event is only removed from the queue once it has
+// been sent, so that an event that could not be sent is relayed again after reconnecting.
+// Forward returns the send error in that case (and for an event that could not be sent by a
+// connector without a queue, which is discarded) so that the connector can drop the connection.
+// The queue counters are logged when forwarding starts and after the backlog of queued events
+// has been flushed.
+func (f *Forwarder) Forward(done <-chan struct{}, remote any, send func(uint32, []byte) error) error {
+	if f.queue == nil {
+		for {
+			select {
+			case msg := <-f.ch:
+				f.Infof("msg %v  relaying to %v", msg.ID, remote)
+				if err := send(msg.ID, msg.Message); err != nil {
+					return err
+				}
+
+			case <-done:
+				return nil
+			}
+		}
+	}
+
+	stats := f.queue.Stats()
+	flushing := stats.Queued > 0
+
+	f.Infof("event queue: %v", stats)
+
+	for {
+		if event, ok := f.queue.Peek(); ok {
+			select {
+			case <-done:
+				return nil
+
+			default:
+				f.Infof("msg %v  relaying to %v", event.ID, remote)
+				if err := send(event.ID, event.Message); err != nil {
+					return err
+				}
+
+				f.queue.Remove(event)
+			}
+
+			continue
+		}
+
+		if flushing {
+			f.Infof("event queue flushed: %v", f.queue.Stats())
+			flushing = false
+		}
+
+		select {
+		case <-f.queue.Ready():
+
+		case <-done:
+			return nil
+		}
+	}
+}
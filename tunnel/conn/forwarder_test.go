@@ -0,0 +1,105 @@
+package conn
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestForwarderRelaysQueuedEvents(t *testing.T) {
+	q, err := NewQueue(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("error creating queue (%v)", err)
+	}
+
+	f := NewForwarder("TEST", q)
+	done := make(chan struct{})
+	sent := make(chan uint32, 4)
+
+	f.Send(1, []byte{0x01})
+	f.Send(2, []byte{0x02})
+
+	go func() {
+		f.Forward(done, "test", func(id uint32, msg []byte) error {
+			sent <- id
+			return nil
+		})
+	}()
+
+	defer close(done)
+
+	f.Send(3, []byte{0x03})
+
+	ids := []uint32{}
+	timeout := time.After(time.Second)
+
+	for len(ids) < 3 {
+		select {
+		case id := <-sent:
+			ids = append(ids, id)
+
+		case <-timeout:
+			t.Fatalf("events not forwarded - expected:%v, got:%v", []uint32{1, 2, 3}, ids)
+		}
+	}
+
+	if !slices.Equal(ids, []uint32{1, 2, 3}) {
+		t.Errorf("incorrect forwarded events - expected:%v, got:%v", []uint32{1, 2, 3}, ids)
+	}
+}
+
+func TestForwarderKeepsUndeliveredEvent(t *testing.T) {
+	q, err := NewQueue(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("error creating queue (%v)", err)
+	}
+
+	f := NewForwarder("TEST", q)
+
+	f.Send(1, []byte{0x01})
+	f.Send(2, []byte{0x02})
+
+	err = f.Forward(make(chan struct{}), "test", func(id uint32, msg []byte) error {
+		if id == 2 {
+			return fmt.Errorf("no ACK")
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		t.Fatalf("expected error for undelivered event")
+	}
+
+	if event, ok := q.Peek(); !ok || event.ID != 2 {
+		t.Errorf("undelivered event not kept in the queue - expected:%v, got:%v", 2, event)
+	}
+
+	if stats := q.Stats(); stats.Queued != 1 || stats.Forwarded != 1 {
+		t.Errorf("incorrect queue stats - expected:%v, got:%+v", "1 queued, 1 forwarded", stats)
+	}
+}
+
+func TestForwarderWithoutQueueReturnsSendError(t *testing.T) {
+	f := NewForwarder("TEST", nil)
+
+	f.Send(1, []byte{0x01})
+
+	returned := make(chan error, 1)
+	go func() {
+		returned <- f.Forward(make(chan struct{}), "test", func(id uint32, msg []byte) error {
+			return fmt.Errorf("no ACK")
+		})
+	}()
+
+	select {
+	case err := <-returned:
+		if err == nil {
+			t.Errorf("expected error for undelivered event")
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("send error not returned")
+	}
+}
@@ -0,0 +1,31 @@
+package conn
+
+import (
+	"time"
+)
+
+const HEARTBEAT_INTERVAL = 30 * time.Second
+const HEARTBEAT_MISSES = 3
+
+// Heartbeat configures the PING/PONG keepalive used to detect half-open connections. A
+// connection is closed if the remote end does not respond to 'Misses' consecutive PINGs
+// sent every 'Interval'. A zero interval disables the heartbeat.
+type Heartbeat struct {
+	Interval time.Duration
+	Misses   int
+}
+
+func NewHeartbeat(interval time.Duration, misses int) Heartbeat {
+	if misses < 1 {
+		misses = HEARTBEAT_MISSES
+	}
+
+	return Heartbeat{
+		Interval: interval,
+		Misses:   misses,
+	}
+}
+
+func (h Heartbeat) Enabled() bool {
+	return h.Interval > 0
+}
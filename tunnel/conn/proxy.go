@@ -0,0 +1,261 @@
+package conn
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Proxy is the (optional) HTTP CONNECT or SOCKS5 proxy used by the client connectors to
+// connect to a remote server. A zero Proxy connects directly.
+type Proxy struct {
+	url *url.URL
+	ca  *x509.CertPool // CA for an https:// proxy certificate (nil uses the system roots)
+}
+
+// NewProxy parses a proxy URL of the form http://[user:password@]host:port, https://[user:password@]host:port
+// or socks5://[user:password@]host:port. An empty URL returns a Proxy that connects directly. The
+// CA (if not nil) verifies the certificate of an https:// proxy in place of the system roots.
+func NewProxy(spec string, ca *x509.CertPool) (Proxy, error) {
+	if spec == "" {
+		return Proxy{}, nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return Proxy{}, fmt.Errorf("invalid proxy URL '%v' (%v)", spec, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return Proxy{}, fmt.Errorf("unsupported proxy URL scheme '%v' (expected http, https or socks5)", u.Scheme)
+	}
+
+	if u.Hostname() == "" || u.Port() == "" {
+		return Proxy{}, fmt.Errorf("invalid proxy URL '%v' (requires host:port)", spec)
+	}
+
+	return Proxy{
+		url: u,
+		ca:  ca,
+	}, nil
+}
+
+func (p Proxy) Enabled() bool {
+	return p.url != nil
+}
+
+// String returns the proxy URL with the password (if any) redacted.
+func (p Proxy) String() string {
+	if p.url == nil {
+		return ""
+	}
+
+	return p.url.Redacted()
+}
+
+// Resolve returns the address to dial for a remote host:port. The host is resolved locally for a
+// direct connection but is passed unresolved to the proxy, which resolves it remotely e.g. for
+// hosts that only the proxy can resolve.
+func (p Proxy) Resolve(spec string) (string, error) {
+	if p.url != nil {
+		if _, _, err := net.SplitHostPort(spec); err != nil {
+			return "", err
+		}
+
+		return spec, nil
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", spec)
+	if err != nil {
+		return "", err
+	} else if addr == nil {
+		return "", fmt.Errorf("unable to resolve TCP address '%v'", spec)
+	}
+
+	return addr.String(), nil
+}
+
+// DialContext connects to the address through the proxy using the dialer to connect to the
+// proxy, or connects directly if the proxy is not enabled. The dialer timeout (if any) applies
+// to the proxy handshake as well as to connecting to the proxy, so that a proxy that accepts
+// the connection but never replies does not block the connector indefinitely.
+func (p Proxy) DialContext(ctx context.Context, dialer *net.Dialer, network string, address string) (net.Conn, error) {
+	if p.url == nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	if dialer.Timeout > 0 {
+		c, cancel := context.WithTimeout(ctx, dialer.Timeout)
+		ctx = c
+		defer cancel()
+	}
+
+	if p.url.Scheme == "socks5" {
+		return p.socks5(ctx, dialer, network, address)
+	}
+
+	return p.connect(ctx, dialer, address)
+}
+
+// DialTLS connects to the address through the proxy and then completes the TLS handshake with
+// the remote server.
+func (p Proxy) DialTLS(ctx context.Context, dialer *net.Dialer, network string, address string, config *tls.Config) (net.Conn, error) {
+	if p.url == nil {
+		d := tls.Dialer{
+			NetDialer: dialer,
+			Config:    config,
+		}
+
+		return d.DialContext(ctx, network, address)
+	}
+
+	if dialer.Timeout > 0 {
+		c, cancel := context.WithTimeout(ctx, dialer.Timeout)
+		ctx = c
+		defer cancel()
+	}
+
+	socket, err := p.DialContext(ctx, dialer, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config.Clone()
+	if cfg.ServerName == "" {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			cfg.ServerName = host
+		}
+	}
+
+	client := tls.Client(socket, cfg)
+	if err := client.HandshakeContext(ctx); err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (p Proxy) socks5(ctx context.Context, dialer *net.Dialer, network string, address string) (net.Conn, error) {
+	var auth *proxy.Auth
+
+	if p.url.User != nil {
+		password, _ := p.url.User.Password()
+		auth = &proxy.Auth{
+			User:     p.url.User.Username(),
+			Password: password,
+		}
+	}
+
+	d, err := proxy.SOCKS5("tcp", p.url.Host, auth, dialer)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.(proxy.ContextDialer).DialContext(ctx, network, address)
+}
+
+// connect opens a tunnel to the address with an HTTP CONNECT request, over TLS for an https://
+// proxy.
+func (p Proxy) connect(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+	socket, err := dialer.DialContext(ctx, "tcp", p.url.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.url.Scheme == "https" {
+		config := &tls.Config{
+			ServerName: p.url.Hostname(),
+			RootCAs:    p.ca,
+			MinVersion: tls.VersionTLS12,
+		}
+
+		client := tls.Client(socket, config)
+
+		if err := client.HandshakeContext(ctx); err != nil {
+			socket.Close()
+			return nil, err
+		}
+
+		socket = client
+	}
+
+	// ... unblocks the CONNECT request/response if the dial is cancelled
+	if deadline, ok := ctx.Deadline(); ok {
+		socket.SetDeadline(deadline)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		socket.SetDeadline(time.Now())
+	})
+
+	defer stop()
+
+	request := http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+
+	if p.url.User != nil {
+		password, _ := p.url.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.url.User.Username() + ":" + password))
+
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := request.Write(socket); err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(socket)
+	response, err := http.ReadResponse(reader, &request)
+	if err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	// ... the connection is the tunnel after a 200 response so the body is only closed on failure
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		socket.Close()
+		return nil, fmt.Errorf("proxy %v refused CONNECT to %v (%v)", p, address, response.Status)
+	}
+
+	if !stop() {
+		socket.Close()
+		return nil, ctx.Err()
+	}
+
+	socket.SetDeadline(time.Time{})
+
+	if reader.Buffered() > 0 {
+		return &buffered{Conn: socket, reader: reader}, nil
+	}
+
+	return socket, nil
+}
+
+// buffered is a net.Conn that returns any bytes read ahead of the CONNECT response before
+// reading from the connection.
+type buffered struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (b *buffered) Read(buffer []byte) (int, error) {
+	return b.reader.Read(buffer)
+}
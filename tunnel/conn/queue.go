@@ -0,0 +1,269 @@
+package conn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const EVENT_QUEUE_SIZE = 10000
+const EVENT_QUEUE_AGE = 24 * time.Hour
+
+// Queue is a bounded on-disk FIFO queue for events that cannot be relayed immediately (e.g.
+// because the tunnel is down). Each event is stored in its own file in the queue directory
+// so that queued events survive a restart. When the queue is full the oldest event is dropped
+// and events older than the age limit are discarded rather than forwarded.
+type Queue struct {
+	Conn
+	dir     string
+	size    int
+	age     time.Duration
+	entries []uint64
+	next    uint64
+	ready   chan struct{}
+	stats   QueueStats
+	sync.Mutex
+}
+
+// QueueStats is a snapshot of the queue counters.
+type QueueStats struct {
+	Queued    uint64 // events currently in the queue
+	Forwarded uint64 // events removed from the queue after being forwarded
+	Overflow  uint64 // events dropped because the queue was full
+	Expired   uint64 // events dropped because they exceeded the age limit
+	Invalid   uint64 // unreadable event files dropped from the queue
+	Failed    uint64 // events dropped because they could not be written to the queue
+}
+
+// Event is an event retrieved from the queue.
+type Event struct {
+	ID        uint32
+	Timestamp time.Time
+	Message   []byte
+	seq       uint64
+}
+
+const EVENT_HEADER = 12
+
+// NewQueue opens (or creates) the event queue in the directory. A size of 0 disables
+// the size limit and an age of 0 disables the age limit.
+func NewQueue(dir string, size int, age time.Duration) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	q := Queue{
+		Conn: Conn{
+			Tag: "QUEUE",
+		},
+		dir:     dir,
+		size:    size,
+		age:     age,
+		entries: []uint64{},
+		ready:   make(chan struct{}, 1),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if name, ok := strings.CutSuffix(f.Name(), ".event"); ok && !f.IsDir() {
+			if seq, err := strconv.ParseUint(name, 16, 64); err == nil {
+				q.entries = append(q.entries, seq)
+			}
+		} else if strings.HasSuffix(f.Name(), ".tmp") {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+
+	slices.Sort(q.entries)
+
+	if N := len(q.entries); N > 0 {
+		q.next = q.entries[N-1] + 1
+		q.Infof("%v queued events in %v", N, dir)
+		q.signal()
+	}
+
+	return &q, nil
+}
+
+// Put appends an event to the queue, dropping the oldest event if the queue is full.
+func (q *Queue) Put(id uint32, message []byte) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.expire()
+
+	for q.size > 0 && len(q.entries) >= q.size {
+		seq := q.entries[0]
+		q.entries = q.entries[1:]
+		q.stats.Overflow++
+		q.remove(seq)
+
+		q.Warnf("queue full - dropped oldest event (%v dropped)", q.stats.Overflow)
+	}
+
+	seq := q.next
+	buffer := make([]byte, EVENT_HEADER+len(message))
+
+	binary.BigEndian.PutUint64(buffer[0:], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint32(buffer[8:], id)
+	copy(buffer[EVENT_HEADER:], message)
+
+	if err := q.write(seq, buffer); err != nil {
+		q.stats.Failed++
+		q.Warnf("msg %v  error queueing event (%v)", id, err)
+		return
+	}
+
+	q.next++
+	q.entries = append(q.entries, seq)
+	q.Debugf("msg %v  queued (%v queued)", id, len(q.entries))
+	q.signal()
+}
+
+// Peek returns the oldest event in the queue without removing it, discarding any events
+// that have exceeded the age limit or cannot be read.
+func (q *Queue) Peek() (Event, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.expire()
+
+	for len(q.entries) > 0 {
+		seq := q.entries[0]
+
+		if event, err := q.read(seq); err != nil {
+			q.entries = q.entries[1:]
+			q.stats.Invalid++
+			q.remove(seq)
+			q.Warnf("dropped invalid queued event (%v)", err)
+		} else {
+			return event, true
+		}
+	}
+
+	return Event{}, false
+}
+
+// Remove removes a forwarded event from the queue.
+func (q *Queue) Remove(event Event) {
+	q.Lock()
+	defer q.Unlock()
+
+	if ix := slices.Index(q.entries, event.seq); ix >= 0 {
+		q.entries = slices.Delete(q.entries, ix, ix+1)
+		q.stats.Forwarded++
+		q.remove(event.seq)
+	}
+}
+
+// Ready returns a channel that is signalled when an event is added to the queue.
+func (q *Queue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Stats returns a snapshot of the queue counters.
+func (q *Queue) Stats() QueueStats {
+	q.Lock()
+	defer q.Unlock()
+
+	stats := q.stats
+	stats.Queued = uint64(len(q.entries))
+
+	return stats
+}
+
+func (s QueueStats) String() string {
+	return fmt.Sprintf("%v queued, %v forwarded, %v dropped (overflow:%v expired:%v invalid:%v failed:%v)",
+		s.Queued, s.Forwarded, s.Overflow+s.Expired+s.Invalid+s.Failed, s.Overflow, s.Expired, s.Invalid, s.Failed)
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// expire discards events at the head of the queue that have exceeded the age limit. Must be
+// invoked with the queue locked.
+func (q *Queue) expire() {
+	if q.age <= 0 {
+		return
+	}
+
+	cutoff := time.Now().Add(-q.age)
+
+	for len(q.entries) > 0 {
+		seq := q.entries[0]
+
+		if event, err := q.read(seq); err == nil && !event.Timestamp.Before(cutoff) {
+			return
+		} else if err != nil {
+			q.stats.Invalid++
+			q.Warnf("dropped invalid queued event (%v)", err)
+		} else {
+			q.stats.Expired++
+			q.Warnf("msg %v  dropped expired event queued at %v (%v expired)", event.ID, event.Timestamp.Format(time.DateTime), q.stats.Expired)
+		}
+
+		q.entries = q.entries[1:]
+		q.remove(seq)
+	}
+}
+
+func (q *Queue) filename(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%016x.event", seq))
+}
+
+func (q *Queue) write(seq uint64, buffer []byte) error {
+	file := q.filename(seq)
+	tmp := file + ".tmp"
+
+	if f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600); err != nil {
+		return err
+	} else if _, err := f.Write(buffer); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+func (q *Queue) read(seq uint64) (Event, error) {
+	bytes, err := os.ReadFile(q.filename(seq))
+	if err != nil {
+		return Event{}, err
+	}
+
+	if len(bytes) < EVENT_HEADER {
+		return Event{}, fmt.Errorf("invalid event file %v (%v bytes)", q.filename(seq), len(bytes))
+	}
+
+	return Event{
+		ID:        binary.BigEndian.Uint32(bytes[8:]),
+		Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(bytes[0:]))),
+		Message:   bytes[EVENT_HEADER:],
+		seq:       seq,
+	}, nil
+}
+
+func (q *Queue) remove(seq uint64) {
+	if err := os.Remove(q.filename(seq)); err != nil && !os.IsNotExist(err) {
+		q.Warnf("%v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package conn
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func drain(q *Queue) []uint32 {
+	ids := []uint32{}
+
+	for {
+		event, ok := q.Peek()
+		if !ok {
+			return ids
+		}
+
+		ids = append(ids, event.ID)
+		q.Remove(event)
+	}
+}
+
+func TestQueueReplaysInOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewQueue(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("error creating queue (%v)", err)
+	}
+
+	q.Put(1, []byte{0x01})
+	q.Put(2, []byte{0x02})
+	q.Put(3, []byte{0x03})
+
+	if event, ok := q.Peek(); !ok || event.ID != 1 || !slices.Equal(event.Message, []byte{0x01}) {
+		t.Errorf("incorrect queued event - expected:%v, got:%v", 1, event)
+	}
+
+	// ... reopen
+	q, err = NewQueue(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("error reopening queue (%v)", err)
+	}
+
+	select {
+	case <-q.Ready():
+	default:
+		t.Errorf("reopened queue not ready")
+	}
+
+	q.Put(4, []byte{0x04})
+
+	if ids := drain(q); !slices.Equal(ids, []uint32{1, 2, 3, 4}) {
+		t.Errorf("incorrect replayed events - expected:%v, got:%v", []uint32{1, 2, 3, 4}, ids)
+	}
+
+	if stats := q.Stats(); stats.Queued != 0 || stats.Forwarded != 4 {
+		t.Errorf("incorrect queue stats - expected:%v, got:%+v", "0 queued, 4 forwarded", stats)
+	}
+}
+
+func TestQueueSizeLimit(t *testing.T) {
+	q, err := NewQueue(t.TempDir(), 2, 0)
+	if err != nil {
+		t.Fatalf("error creating queue (%v)", err)
+	}
+
+	q.Put(1, []byte{0x01})
+	q.Put(2, []byte{0x02})
+	q.Put(3, []byte{0x03})
+
+	if stats := q.Stats(); stats.Queued != 2 || stats.Overflow != 1 {
+		t.Errorf("incorrect queue stats - expected:%v, got:%+v", "2 queued, 1 overflow", stats)
+	}
+
+	if ids := drain(q); !slices.Equal(ids, []uint32{2, 3}) {
+		t.Errorf("incorrect queued events - expected:%v, got:%v", []uint32{2, 3}, ids)
+	}
+}
+
+func TestQueueAgeLimit(t *testing.T) {
+	q, err := NewQueue(t.TempDir(), 0, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("error creating queue (%v)", err)
+	}
+
+	q.Put(1, []byte{0x01})
+	q.Put(2, []byte{0x02})
+
+	time.Sleep(100 * time.Millisecond)
+
+	q.Put(3, []byte{0x03})
+
+	if ids := drain(q); !slices.Equal(ids, []uint32{3}) {
+		t.Errorf("incorrect queued events - expected:%v, got:%v", []uint32{3}, ids)
+	}
+
+	if stats := q.Stats(); stats.Expired != 2 {
+		t.Errorf("incorrect queue stats - expected:%v, got:%+v", "2 expired", stats)
+	}
+}
+
+func TestQueueStatsString(t *testing.T) {
+	stats := QueueStats{Queued: 3, Forwarded: 10, Overflow: 1, Expired: 2}
+	expected := "3 queued, 10 forwarded, 3 dropped (overflow:1 expired:2 invalid:0 failed:0)"
+
+	if s := stats.String(); s != expected {
+		t.Errorf("incorrect queue stats - expected:%v, got:%v", expected, s)
+	}
+}
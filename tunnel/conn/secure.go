@@ -0,0 +1,296 @@
+package conn
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const HANDSHAKE_TIMEOUT = 5 * time.Second
+const MAX_RECORD = 16384
+
+// The pre-shared key handshake authenticates both ends of a connection with a key shared out
+// of band and agrees on session keys using ephemeral X25519 keys (so a compromised pre-shared
+// key does not expose previously recorded traffic):
+//
+//	client -> server  MAGIC | client public key | HMAC(psk, "client" | MAGIC | client public key)
+//	server -> client  server public key | HMAC(psk, "server" | client public key | server public key)
+//	client -> server  FINISHED
+//
+// The session keys and FINISHED are derived from the X25519 shared secret with HKDF-SHA256 (salted
+// with the pre-shared key) and each direction is encrypted with ChaCha20-Poly1305 in records with a
+// 2 byte length prefix. FINISHED proves that the client holds both the pre-shared key and the
+// private key for its ephemeral public key, so a replayed client hello is rejected by the server
+// before the connection is accepted. A server closes the connection without replying if the
+// client HMAC is invalid.
+
+var MAGIC = []byte("UHPT\x01")
+
+type secureConn struct {
+	net.Conn
+	tx       cipher.AEAD
+	rx       cipher.AEAD
+	txnonce  uint64
+	rxnonce  uint64
+	pending  []byte
+	reading  sync.Mutex
+	writing  sync.Mutex
+	header   [2]byte
+	received []byte
+}
+
+// SecureClient authenticates the connection to a server with the pre-shared key and returns a
+// connection that encrypts all subsequent traffic. The socket is returned unchanged if there is
+// no pre-shared key and is closed if the handshake fails.
+func SecureClient(socket net.Conn, key []byte) (net.Conn, error) {
+	if len(key) == 0 {
+		return socket, nil
+	}
+
+	c, err := secureClient(socket, key)
+	if err != nil {
+		socket.Close()
+	}
+
+	return c, err
+}
+
+// SecureServer authenticates a client connection with the pre-shared key and returns a
+// connection that encrypts all subsequent traffic. The socket is returned unchanged if there is
+// no pre-shared key and is closed if the handshake fails.
+func SecureServer(socket net.Conn, key []byte) (net.Conn, error) {
+	if len(key) == 0 {
+		return socket, nil
+	}
+
+	c, err := secureServer(socket, key)
+	if err != nil {
+		socket.Close()
+	}
+
+	return c, err
+}
+
+func secureClient(socket net.Conn, key []byte) (net.Conn, error) {
+	socket.SetDeadline(time.Now().Add(HANDSHAKE_TIMEOUT))
+	defer socket.SetDeadline(time.Time{})
+
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	public := private.PublicKey().Bytes()
+	hello := bytes.Join([][]byte{MAGIC, public, mac(key, []byte("client"), MAGIC, public)}, nil)
+
+	if _, err := socket.Write(hello); err != nil {
+		return nil, err
+	}
+
+	reply := make([]byte, 32+sha256.Size)
+	if _, err := io.ReadFull(socket, reply); err != nil {
+		return nil, fmt.Errorf("pre-shared key handshake with %v failed (%w)", socket.RemoteAddr(), err)
+	}
+
+	remote := reply[:32]
+	if !hmac.Equal(reply[32:], mac(key, []byte("server"), public, remote)) {
+		return nil, fmt.Errorf("pre-shared key handshake with %v failed (invalid server HMAC)", socket.RemoteAddr())
+	}
+
+	c, finished, err := secure(socket, key, private, public, remote, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := socket.Write(finished); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func secureServer(socket net.Conn, key []byte) (net.Conn, error) {
+	socket.SetDeadline(time.Now().Add(HANDSHAKE_TIMEOUT))
+	defer socket.SetDeadline(time.Time{})
+
+	hello := make([]byte, len(MAGIC)+32+sha256.Size)
+	if _, err := io.ReadFull(socket, hello); err != nil {
+		return nil, fmt.Errorf("pre-shared key handshake with %v failed (%w)", socket.RemoteAddr(), err)
+	}
+
+	magic := hello[:len(MAGIC)]
+	remote := hello[len(MAGIC) : len(MAGIC)+32]
+
+	if !bytes.Equal(magic, MAGIC) || !hmac.Equal(hello[len(MAGIC)+32:], mac(key, []byte("client"), MAGIC, remote)) {
+		return nil, fmt.Errorf("pre-shared key handshake with %v failed (invalid client HMAC)", socket.RemoteAddr())
+	}
+
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	public := private.PublicKey().Bytes()
+	reply := bytes.Join([][]byte{public, mac(key, []byte("server"), remote, public)}, nil)
+
+	if _, err := socket.Write(reply); err != nil {
+		return nil, err
+	}
+
+	c, finished, err := secure(socket, key, private, remote, public, false)
+	if err != nil {
+		return nil, err
+	}
+
+	confirm := make([]byte, len(finished))
+	if _, err := io.ReadFull(socket, confirm); err != nil {
+		return nil, fmt.Errorf("pre-shared key handshake with %v failed (%w)", socket.RemoteAddr(), err)
+	}
+
+	if !hmac.Equal(confirm, finished) {
+		return nil, fmt.Errorf("pre-shared key handshake with %v failed (invalid client FINISHED)", socket.RemoteAddr())
+	}
+
+	return c, nil
+}
+
+// secure derives the session keys and the FINISHED key confirmation from the client and server
+// public keys and wraps the socket.
+func secure(socket net.Conn, key []byte, private *ecdh.PrivateKey, client, server []byte, initiator bool) (net.Conn, []byte, error) {
+	remote := server
+	if !initiator {
+		remote = client
+	}
+
+	peer, err := ecdh.X25519().NewPublicKey(remote)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shared, err := private.ECDH(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transcript := string(client) + string(server)
+
+	c2s, err := hkdf.Key(sha256.New, shared, key, "uhppoted-tunnel client"+transcript, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s2c, err := hkdf.Key(sha256.New, shared, key, "uhppoted-tunnel server"+transcript, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	finished, err := hkdf.Key(sha256.New, shared, key, "uhppoted-tunnel finished"+transcript, sha256.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !initiator {
+		c2s, s2c = s2c, c2s
+	}
+
+	tx, err := chacha20poly1305.New(c2s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rx, err := chacha20poly1305.New(s2c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &secureConn{
+		Conn:     socket,
+		tx:       tx,
+		rx:       rx,
+		received: make([]byte, MAX_RECORD+chacha20poly1305.Overhead),
+	}, finished, nil
+}
+
+func (c *secureConn) Read(b []byte) (int, error) {
+	c.reading.Lock()
+	defer c.reading.Unlock()
+
+	if len(c.pending) == 0 {
+		if _, err := io.ReadFull(c.Conn, c.header[:]); err != nil {
+			return 0, err
+		}
+
+		N := int(binary.BigEndian.Uint16(c.header[:]))
+		if N > len(c.received) {
+			return 0, fmt.Errorf("invalid record length (%v bytes)", N)
+		}
+
+		if _, err := io.ReadFull(c.Conn, c.received[:N]); err != nil {
+			return 0, err
+		}
+
+		plaintext, err := c.rx.Open(c.received[:0], nonce(c.rxnonce), c.received[:N], c.header[:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid record from %v (%w)", c.RemoteAddr(), err)
+		}
+
+		c.rxnonce++
+		c.pending = plaintext
+	}
+
+	N := copy(b, c.pending)
+	c.pending = c.pending[N:]
+
+	return N, nil
+}
+
+func (c *secureConn) Write(b []byte) (int, error) {
+	c.writing.Lock()
+	defer c.writing.Unlock()
+
+	written := 0
+	for len(b) > 0 {
+		chunk := b[:min(len(b), MAX_RECORD)]
+		header := binary.BigEndian.AppendUint16(nil, uint16(len(chunk)+c.tx.Overhead()))
+		record := c.tx.Seal(bytes.Clone(header), nonce(c.txnonce), chunk, header)
+
+		c.txnonce++
+
+		if _, err := c.Conn.Write(record); err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+
+	return written, nil
+}
+
+func mac(key []byte, fields ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, f := range fields {
+		h.Write(f)
+	}
+
+	return h.Sum(nil)
+}
+
+func nonce(counter uint64) []byte {
+	n := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(n[4:], counter)
+
+	return n
+}
@@ -0,0 +1,186 @@
+package conn
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+type secured struct {
+	socket net.Conn
+	err    error
+}
+
+func TestSecureRoundTrip(t *testing.T) {
+	local, remote := pipe(t)
+	client, server := handshake(t, local, remote, []byte("0123456789abcdef"), []byte("0123456789abcdef"))
+
+	defer local.Close()
+	defer remote.Close()
+
+	if client.err != nil {
+		t.Fatalf("client handshake failed (%v)", client.err)
+	}
+
+	if server.err != nil {
+		t.Fatalf("server handshake failed (%v)", server.err)
+	}
+
+	request := []byte{0x17, 0x94, 0x00, 0x00, 0x78, 0x37, 0x2a, 0x18}
+	reply := []byte{0x17, 0x94, 0x00, 0x00, 0x78, 0x37, 0x2a, 0x18, 0x01}
+
+	if _, err := client.socket.Write(request); err != nil {
+		t.Fatalf("error writing request (%v)", err)
+	}
+
+	buffer := make([]byte, len(request))
+	if _, err := io.ReadFull(server.socket, buffer); err != nil {
+		t.Fatalf("error reading request (%v)", err)
+	} else if !bytes.Equal(buffer, request) {
+		t.Errorf("incorrect request - expected:%v, got:%v", request, buffer)
+	}
+
+	if _, err := server.socket.Write(reply); err != nil {
+		t.Fatalf("error writing reply (%v)", err)
+	}
+
+	buffer = make([]byte, len(reply))
+	if _, err := io.ReadFull(client.socket, buffer); err != nil {
+		t.Fatalf("error reading reply (%v)", err)
+	} else if !bytes.Equal(buffer, reply) {
+		t.Errorf("incorrect reply - expected:%v, got:%v", reply, buffer)
+	}
+}
+
+func TestSecureRejectsInvalidKey(t *testing.T) {
+	local, remote := pipe(t)
+
+	defer local.Close()
+	defer remote.Close()
+
+	client, server := handshake(t, local, remote, []byte("fedcba9876543210"), []byte("0123456789abcdef"))
+
+	if client.err == nil {
+		t.Errorf("expected client handshake error with invalid key")
+	}
+
+	if server.err == nil {
+		t.Errorf("expected server handshake error with invalid key")
+	}
+}
+
+func TestSecureRejectsReplayedClientHello(t *testing.T) {
+	key := []byte("0123456789abcdef")
+
+	// ... record the client hello from a genuine handshake
+	local, remote := pipe(t)
+
+	defer local.Close()
+	defer remote.Close()
+
+	recorded := make(chan []byte, 1)
+	go func() {
+		hello := make([]byte, len(MAGIC)+32+32)
+		if _, err := io.ReadFull(remote, hello); err != nil {
+			t.Errorf("error reading client hello (%v)", err)
+		}
+
+		recorded <- hello
+		remote.Close()
+	}()
+
+	SecureClient(local, key)
+
+	hello := <-recorded
+
+	// ... and replay it to the server
+	attacker, server := pipe(t)
+
+	defer attacker.Close()
+	defer server.Close()
+
+	ch := make(chan secured, 1)
+	go func() {
+		socket, err := SecureServer(server, key)
+		ch <- secured{socket, err}
+	}()
+
+	if _, err := attacker.Write(hello); err != nil {
+		t.Fatalf("error replaying client hello (%v)", err)
+	}
+
+	reply := make([]byte, 32+32)
+	if _, err := io.ReadFull(attacker, reply); err != nil {
+		t.Fatalf("error reading server reply (%v)", err)
+	}
+
+	// ... without the client ephemeral private key an attacker can only guess the FINISHED key
+	//     confirmation
+	if _, err := attacker.Write(make([]byte, 32)); err != nil {
+		t.Fatalf("error writing FINISHED (%v)", err)
+	}
+
+	if result := <-ch; result.err == nil {
+		t.Errorf("expected server handshake error for replayed client hello")
+	}
+}
+
+func TestSecureLargeWrite(t *testing.T) {
+	local, remote := pipe(t)
+	client, server := handshake(t, local, remote, []byte("0123456789abcdef"), []byte("0123456789abcdef"))
+
+	defer local.Close()
+	defer remote.Close()
+
+	if client.err != nil || server.err != nil {
+		t.Fatalf("handshake failed (%v, %v)", client.err, server.err)
+	}
+
+	message := make([]byte, 3*MAX_RECORD+17)
+	for i := range message {
+		message[i] = byte(i)
+	}
+
+	go func() {
+		if N, err := client.socket.Write(message); err != nil {
+			t.Errorf("error writing message (%v)", err)
+		} else if N != len(message) {
+			t.Errorf("incorrect write count - expected:%v, got:%v", len(message), N)
+		}
+	}()
+
+	buffer := make([]byte, len(message))
+	if _, err := io.ReadFull(server.socket, buffer); err != nil {
+		t.Fatalf("error reading message (%v)", err)
+	} else if !bytes.Equal(buffer, message) {
+		t.Errorf("incorrect message received")
+	}
+}
+
+func TestSecureWithoutKey(t *testing.T) {
+	local, remote := pipe(t)
+
+	defer local.Close()
+	defer remote.Close()
+
+	if socket, err := SecureClient(local, nil); err != nil {
+		t.Errorf("unexpected error (%v)", err)
+	} else if socket != local {
+		t.Errorf("expected unmodified socket without a pre-shared key")
+	}
+}
+
+func handshake(t *testing.T, local, remote net.Conn, clientKey, serverKey []byte) (secured, secured) {
+	t.Helper()
+
+	ch := make(chan secured, 1)
+	go func() {
+		socket, err := SecureServer(remote, serverKey)
+		ch <- secured{socket, err}
+	}()
+
+	socket, err := SecureClient(local, clientKey)
+
+	return secured{socket, err}, <-ch
+}
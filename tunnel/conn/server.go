@@ -0,0 +1,310 @@
+package conn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+)
+
+// OUTBOX_SIZE is the maximum number of events queued for delivery to a single client.
+const OUTBOX_SIZE = 64
+
+// Server implements the listen/accept loop shared by the stream server connectors. The
+// connectors differ only in how the listen socket is opened, how an incoming connection is
+// accepted (e.g. the SSH or DTLS handshake) and how the received data is handled, which are
+// supplied as the Listen, Accept and Received functions.
+//
+// Incoming connections are tracked from the start of the Accept handshake so that a connection
+// that is still handshaking is also closed on shutdown.
+//
+// Events posted with Post are queued for each client and delivered in order by a single
+// goroutine per session. A client that falls more than OUTBOX_SIZE events behind is
+// disconnected rather than being allowed to accumulate an unbounded backlog.
+type Server struct {
+	Conn
+	Listen   func() (net.Listener, error)
+	Accept   func(net.Conn) (net.Conn, error)
+	Received func([]byte, *Session, *router.Switch, net.Conn)
+
+	retry       Backoff
+	heartbeat   Heartbeat
+	buffer      int
+	connections map[net.Conn]*Session
+	outboxes    map[*Session]chan protocol.Message
+	ctx         context.Context
+	closed      chan struct{}
+	sync.RWMutex
+}
+
+// NewServer creates the Server for a connector. The buffer size is the maximum size of a single
+// read from a connection.
+func NewServer(tag string, retry Backoff, heartbeat Heartbeat, buffer int, ctx context.Context) Server {
+	return Server{
+		Conn: Conn{
+			Tag: tag,
+		},
+		retry:       retry,
+		heartbeat:   heartbeat,
+		buffer:      buffer,
+		connections: map[net.Conn]*Session{},
+		outboxes:    map[*Session]chan protocol.Message{},
+		ctx:         ctx,
+		closed:      make(chan struct{}),
+	}
+}
+
+func (s *Server) Close() {
+	s.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-s.closed:
+		s.Infof("closed")
+
+	case <-timeout.C:
+		s.Infof("close timeout")
+	}
+}
+
+func (s *Server) Run(router *router.Switch) error {
+	go func() {
+	loop:
+		for {
+			if socket, err := s.Listen(); err != nil {
+				s.Warnf("%v", err)
+			} else {
+				s.retry.Reset()
+				s.listen(socket, router)
+			}
+
+			if s.ctx.Err() != nil || !s.retry.Wait(s.Tag) {
+				break loop
+			}
+		}
+
+		s.RLock()
+		for k := range s.connections {
+			k.Close()
+		}
+		s.RUnlock()
+
+		s.closed <- struct{}{}
+	}()
+
+	<-s.ctx.Done()
+
+	return nil
+}
+
+// Send relays a message to every connected client.
+func (s *Server) Send(id uint32, message []byte) {
+	s.Broadcast(func(session *Session) {
+		s.Reply(session, id, message)
+	})
+}
+
+// Broadcast invokes f (in its own goroutine) for the session of every connected client.
+func (s *Server) Broadcast(f func(*Session)) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, session := range s.connections {
+		if session != nil {
+			go f(session)
+		}
+	}
+}
+
+// Post queues an event for delivery to every connected client. A client whose queue is full is
+// disconnected.
+func (s *Server) Post(id uint32, message []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, session := range s.connections {
+		if session == nil {
+			continue
+		}
+
+		outbox, ok := s.outboxes[session]
+		if !ok {
+			outbox = make(chan protocol.Message, OUTBOX_SIZE)
+			s.outboxes[session] = outbox
+
+			go s.deliver(session, outbox)
+		}
+
+		select {
+		case outbox <- protocol.Message{ID: id, Message: message}:
+		default:
+			s.Warnf("msg %v  event queue for %v is full - closing connection", id, session.RemoteAddr())
+			session.socket.Close()
+		}
+	}
+}
+
+// Sessions returns the sessions of the connected clients, excluding connections that have not
+// yet completed the Accept handshake.
+func (s *Server) Sessions() []*Session {
+	s.RLock()
+	defer s.RUnlock()
+
+	sessions := []*Session{}
+	for _, session := range s.connections {
+		if session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions
+}
+
+// Reply sends a message to a connected client.
+func (s *Server) Reply(session *Session, id uint32, message []byte) error {
+	if err := session.Send(id, message); err != nil {
+		s.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
+		return err
+	} else {
+		s.Infof("msg %v sent %v bytes to %v", id, len(message), session.RemoteAddr())
+	}
+
+	return nil
+}
+
+// Deliver sends an event to a connected client and waits for it to be acknowledged (if the
+// session supports acknowledgements).
+func (s *Server) Deliver(session *Session, id uint32, message []byte) error {
+	if err := session.Deliver(id, message); err != nil {
+		s.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
+		return err
+	} else {
+		s.Infof("msg %v sent %v bytes to %v", id, len(message), session.RemoteAddr())
+	}
+
+	return nil
+}
+
+// deliver relays the events queued for a session, in order, until the session is closed.
+func (s *Server) deliver(session *Session, outbox chan protocol.Message) {
+	defer func() {
+		s.Lock()
+		delete(s.outboxes, session)
+		s.Unlock()
+	}()
+
+	for {
+		select {
+		case <-session.closed:
+			return
+
+		case msg := <-outbox:
+			s.Deliver(session, msg.ID, msg.Message)
+		}
+	}
+}
+
+// Dispatch handles the data received on a connection that relays requests, replying to each
+// request on the same connection.
+func (s *Server) Dispatch(buffer []byte, session *Session, router *router.Switch, socket net.Conn) {
+	s.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
+
+		router.Received(id, msg.Message, func(message []byte) {
+			s.Reply(session, id, message)
+		})
+	}
+}
+
+func (s *Server) listen(socket net.Listener, router *router.Switch) {
+	s.Infof("listening on %v", socket.Addr())
+
+	stop := context.AfterFunc(s.ctx, func() {
+		socket.Close()
+	})
+
+	defer stop()
+	defer socket.Close()
+
+	for {
+		client, err := socket.Accept()
+		if err != nil {
+			if s.ctx.Err() == nil {
+				s.Warnf("%v", err)
+			}
+			return
+		}
+
+		s.Infof("incoming connection (%v)", client.RemoteAddr())
+
+		go s.serve(client, router)
+	}
+}
+
+func (s *Server) serve(client net.Conn, router *router.Switch) {
+	s.Lock()
+	s.connections[client] = nil
+	s.Unlock()
+
+	defer func() {
+		s.Lock()
+		delete(s.connections, client)
+		s.Unlock()
+	}()
+
+	defer client.Close()
+
+	socket := client
+	if s.Accept != nil {
+		if accepted, err := s.Accept(client); err != nil {
+			s.Warnf("%v", err)
+			return
+		} else {
+			socket = accepted
+		}
+	}
+
+	stop := context.AfterFunc(s.ctx, func() {
+		socket.Close()
+	})
+
+	defer stop()
+	defer socket.Close()
+
+	session := NewSession(s.Conn, socket, s.heartbeat)
+
+	defer session.Close()
+
+	s.Lock()
+	s.connections[client] = session
+	s.Unlock()
+
+	if err := session.Start(); err != nil {
+		s.Warnf("%v", err)
+	}
+
+	buffer := make([]byte, s.buffer)
+
+	for {
+		N, err := socket.Read(buffer)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				s.Infof("client connection %v closed ", socket.RemoteAddr())
+			} else if s.ctx.Err() != nil {
+				s.Infof("shutdown client connection %v", socket.RemoteAddr())
+			} else {
+				s.Warnf("%v", err)
+			}
+			return
+		}
+
+		s.Received(buffer[:N], session, router, socket)
+	}
+}
@@ -0,0 +1,186 @@
+package conn
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+)
+
+func TestServerClosesHandshakingConnectionOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	r := router.NewRouter("", rate.NewLimiter(rate.Inf, 0))
+	defer r.Close()
+
+	handshaking := make(chan struct{})
+
+	server := NewServer("TEST", NewBackoff(-1, time.Second, ctx), Heartbeat{}, 2048, ctx)
+	server.Listen = func() (net.Listener, error) {
+		return listener, nil
+	}
+
+	// ... a handshake that never completes
+	server.Accept = func(client net.Conn) (net.Conn, error) {
+		close(handshaking)
+
+		buffer := make([]byte, 1)
+		_, err := client.Read(buffer)
+
+		return nil, err
+	}
+
+	server.Received = Discard
+
+	go server.Run(r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {}))
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer client.Close()
+
+	select {
+	case <-handshaking:
+	case <-time.After(time.Second):
+		t.Fatalf("connection not accepted")
+	}
+
+	cancel()
+	server.Close()
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Errorf("handshaking connection not closed on shutdown")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Errorf("handshaking connection not closed on shutdown (%v)", err)
+	}
+}
+
+func TestServerPostDeliversInOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server, client := connected(t, ctx)
+
+	defer func() {
+		cancel()
+		server.Close()
+	}()
+
+	received := make(chan uint32, 16)
+
+	// ... client acknowledges every event
+	go func() {
+		stream := protocol.NewStream()
+		buffer := make([]byte, 2048)
+
+		for {
+			N, err := client.Read(buffer)
+			if err != nil {
+				return
+			}
+
+			frames, _ := stream.Decode(buffer[:N])
+			for _, frame := range frames {
+				if frame.Type == protocol.DATA {
+					client.Write(protocol.Ack(frame.ID).Encode())
+					received <- frame.ID
+				}
+			}
+		}
+	}()
+
+	for id := uint32(1); id <= 10; id++ {
+		server.Post(id, []byte{0x01, 0x02, 0x03})
+	}
+
+	for expected := uint32(1); expected <= 10; expected++ {
+		select {
+		case id := <-received:
+			if id != expected {
+				t.Fatalf("incorrect event ID - expected:%v, got:%v", expected, id)
+			}
+
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for event %v", expected)
+		}
+	}
+}
+
+func TestServerPostClosesStalledClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server, client := connected(t, ctx)
+
+	defer func() {
+		cancel()
+		server.Close()
+	}()
+
+	// ... client never acknowledges so the first event is still in flight while the rest are queued
+	for id := uint32(1); id <= OUTBOX_SIZE+2; id++ {
+		server.Post(id, []byte{0x01, 0x02, 0x03})
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+
+	buffer := make([]byte, 2048)
+	for {
+		if _, err := client.Read(buffer); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				t.Errorf("stalled client not disconnected (%v)", err)
+			}
+			break
+		}
+	}
+}
+
+// connected starts a Server and returns it with a client connection that has completed the
+// HELLO exchange.
+func connected(t *testing.T, ctx context.Context) (*Server, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	r := router.NewRouter("", rate.NewLimiter(rate.Inf, 0))
+	t.Cleanup(r.Close)
+
+	server := NewServer("TEST", NewBackoff(-1, time.Second, ctx), Heartbeat{}, 2048, ctx)
+	server.Listen = func() (net.Listener, error) {
+		return listener, nil
+	}
+
+	server.Received = Discard
+
+	go server.Run(r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {}))
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	t.Cleanup(func() { client.Close() })
+
+	if _, err := client.Write(protocol.Hello(protocol.ACKNOWLEDGE).Encode()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if sessions := server.Sessions(); len(sessions) > 0 && sessions[0].Version() > 1 {
+			break
+		} else if time.Since(start) > time.Second {
+			t.Fatalf("client not connected")
+		}
+	}
+
+	return &server, client
+}
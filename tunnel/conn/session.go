@@ -0,0 +1,370 @@
+package conn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+)
+
+// HELLO_TIMEOUT is the time a session waits for the peer HELLO before falling back to version 1
+// framing. Both ends send a HELLO as soon as the connection is established, so a current peer's
+// HELLO arrives within a round trip, but a version 1 peer never sends one and the first message
+// sent to it is held for the full timeout. A peer whose HELLO arrives after the timeout (e.g. on
+// a high latency link) accepts the version 1 frames sent in the meantime and the session is
+// upgraded once its HELLO is received.
+const HELLO_TIMEOUT = 1 * time.Second
+const ACK_TIMEOUT = 5 * time.Second
+const ACK_MAX_TIMEOUT = 60 * time.Second
+const ACK_MAX_ATTEMPTS = 5
+
+var ErrNotAcknowledged = errors.New("message not acknowledged")
+
+// Session manages the framing for a single stream connection. A session starts by
+// exchanging HELLO frames to agree on the protocol version and features and falls back
+// to version 1 framing if the peer either sends a version 1 frame or does not send a
+// HELLO within HELLO_TIMEOUT.
+//
+// Outgoing messages are held until the HELLO has been sent and the protocol version has been
+// agreed, so that the HELLO is always the first frame on the connection.
+//
+// If both ends support heartbeats the session sends a PING every heartbeat interval and
+// closes the connection if the remote end fails to respond to too many consecutive PINGs,
+// which unblocks the connector read loop so that it can reconnect.
+//
+// If both ends support acknowledgements, messages sent with Deliver are retransmitted (with
+// backoff) until the remote end acknowledges them with an ACK frame, for at most ACK_MAX_ATTEMPTS
+// transmissions.
+type Session struct {
+	Conn
+	socket    net.Conn
+	stream    *protocol.Stream
+	heartbeat Heartbeat
+	offered   protocol.Features
+	version   uint8
+	features  protocol.Features
+	timer     *time.Timer
+	missed    int
+	acks      map[uint32]chan struct{}
+	timeout   time.Duration
+	attempts  int
+	started   chan struct{}
+	ready     chan struct{}
+	closed    chan struct{}
+	once      sync.Once
+	writing   sync.Mutex
+	sync.RWMutex
+}
+
+func NewSession(c Conn, socket net.Conn, heartbeat Heartbeat) *Session {
+	return &Session{
+		Conn:      c,
+		socket:    socket,
+		stream:    protocol.NewStream(),
+		heartbeat: heartbeat,
+		offered:   protocol.HEARTBEAT | protocol.ACKNOWLEDGE,
+		acks:      map[uint32]chan struct{}{},
+		timeout:   ACK_TIMEOUT,
+		attempts:  ACK_MAX_ATTEMPTS,
+		started:   make(chan struct{}),
+		ready:     make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+}
+
+// Start sends the HELLO frame that opens the protocol negotiation.
+func (s *Session) Start() error {
+	s.Lock()
+	s.timer = time.AfterFunc(HELLO_TIMEOUT, func() {
+		s.negotiated(1, 0, "no HELLO")
+	})
+	s.Unlock()
+
+	if err := s.write(protocol.Hello(s.offered).Encode()); err != nil {
+		return err
+	}
+
+	close(s.started)
+
+	return nil
+}
+
+func (s *Session) Close() {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+}
+
+func (s *Session) RemoteAddr() net.Addr {
+	return s.socket.RemoteAddr()
+}
+
+// Version returns the agreed protocol version (0 if not yet agreed).
+func (s *Session) Version() uint8 {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.version
+}
+
+// Features returns the agreed protocol features.
+func (s *Session) Features() protocol.Features {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.features
+}
+
+// Received decodes the frames in the received bytes, handles the protocol control
+// frames and returns the data messages. The connection is closed if the received bytes
+// contain an invalid frame.
+func (s *Session) Received(buffer []byte) []protocol.Message {
+	messages := []protocol.Message{}
+	frames, err := s.stream.Decode(buffer)
+
+	// ... the stream cannot be resynchronised so close the connection to force a reconnect
+	if err != nil {
+		s.Warnf("%v  %v - closing connection", s.socket.RemoteAddr(), err)
+		s.socket.Close()
+	}
+
+	for _, frame := range frames {
+		switch {
+		case frame.Version < 2:
+			s.negotiated(1, 0, "version 1 frame")
+			messages = append(messages, protocol.Message{
+				ID:      frame.ID,
+				Message: frame.Message,
+			})
+
+		case frame.Type == protocol.HELLO:
+			version := min(frame.Version, protocol.VERSION)
+			features := s.offered & protocol.Features(frame.Flags)
+
+			s.negotiated(version, features, "HELLO")
+
+		case frame.Type == protocol.PING:
+			if err := s.write(protocol.Pong(frame.ID).Encode()); err != nil {
+				s.Warnf("error sending PONG to %v (%v)", s.socket.RemoteAddr(), err)
+			}
+
+		case frame.Type == protocol.PONG:
+			s.Lock()
+			s.missed = 0
+			s.Unlock()
+
+		case frame.Type == protocol.ACK:
+			s.Lock()
+			if ack, ok := s.acks[frame.ID]; ok {
+				close(ack)
+				delete(s.acks, frame.ID)
+			}
+			s.Unlock()
+
+		case frame.Type == protocol.DATA:
+			if frame.Flags&protocol.ACK_REQUEST == protocol.ACK_REQUEST {
+				if err := s.write(protocol.Ack(frame.ID).Encode()); err != nil {
+					s.Warnf("msg %v  error sending ACK to %v (%v)", frame.ID, s.socket.RemoteAddr(), err)
+				}
+			}
+
+			messages = append(messages, protocol.Message{
+				ID:      frame.ID,
+				Message: frame.Message,
+			})
+
+		default:
+			s.Debugf("ignoring %v frame from %v", frame.Type, s.socket.RemoteAddr())
+		}
+	}
+
+	return messages
+}
+
+// Send encodes a message using the agreed protocol version and writes it to the
+// connection, waiting for the protocol negotiation to complete if necessary. Returns
+// protocol.ErrMessageTooLarge if the message is too long for a single frame.
+func (s *Session) Send(id uint32, message []byte) error {
+	if len(message) > protocol.MAX_MESSAGE {
+		return protocol.ErrMessageTooLarge
+	}
+
+	if err := s.wait(); err != nil {
+		return err
+	}
+
+	if s.Version() < 2 {
+		return s.write(protocol.Packetize(id, message))
+	}
+
+	frame := protocol.Frame{
+		Type:    protocol.DATA,
+		ID:      id,
+		Message: message,
+	}
+
+	return s.write(frame.Encode())
+}
+
+// Deliver sends a message and waits for the remote end to acknowledge it, retransmitting
+// the message with exponential backoff until it is acknowledged, the session is closed or
+// the message has been sent ACK_MAX_ATTEMPTS times without an acknowledgement (in which case it
+// returns ErrNotAcknowledged). Deliver is equivalent to Send if the remote end does not support acknowledgements.
+func (s *Session) Deliver(id uint32, message []byte) error {
+	if len(message) > protocol.MAX_MESSAGE {
+		return protocol.ErrMessageTooLarge
+	}
+
+	if err := s.wait(); err != nil {
+		return err
+	}
+
+	if s.Features()&protocol.ACKNOWLEDGE != protocol.ACKNOWLEDGE {
+		return s.Send(id, message)
+	}
+
+	ack := make(chan struct{})
+
+	s.Lock()
+	s.acks[id] = ack
+	s.Unlock()
+
+	defer func() {
+		s.Lock()
+		delete(s.acks, id)
+		s.Unlock()
+	}()
+
+	frame := protocol.Frame{
+		Type:    protocol.DATA,
+		Flags:   protocol.ACK_REQUEST,
+		ID:      id,
+		Message: message,
+	}
+
+	packet := frame.Encode()
+	timeout := s.timeout
+
+	for attempt := 1; ; attempt++ {
+		if err := s.write(packet); err != nil {
+			return err
+		}
+
+		timer := time.NewTimer(timeout)
+
+		select {
+		case <-ack:
+			timer.Stop()
+			return nil
+
+		case <-s.closed:
+			timer.Stop()
+			return net.ErrClosed
+
+		case <-timer.C:
+			if attempt >= s.attempts {
+				return fmt.Errorf("%w after %v attempts", ErrNotAcknowledged, attempt)
+			}
+
+			s.Warnf("msg %v  no ACK from %v after %v - retransmitting", id, s.socket.RemoteAddr(), timeout)
+			timeout = min(2*timeout, ACK_MAX_TIMEOUT)
+		}
+	}
+}
+
+// wait blocks until the HELLO has been sent and the protocol version has been agreed.
+func (s *Session) wait() error {
+	for _, ch := range []chan struct{}{s.started, s.ready} {
+		select {
+		case <-ch:
+		case <-s.closed:
+			return net.ErrClosed
+		}
+	}
+
+	return nil
+}
+
+func (s *Session) write(packet []byte) error {
+	s.writing.Lock()
+	defer s.writing.Unlock()
+
+	if N, err := s.socket.Write(packet); err != nil {
+		return err
+	} else if N != len(packet) {
+		return fmt.Errorf("sent %v of %v bytes to %v", N, len(packet), s.socket.RemoteAddr())
+	}
+
+	return nil
+}
+
+// negotiated sets the protocol version and features for the session. A session that has
+// fallen back to version 1 is upgraded if a (late) HELLO is subsequently received.
+func (s *Session) negotiated(version uint8, features protocol.Features, reason string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.version == 0 || (s.version == 1 && version > 1) {
+		s.version = version
+		s.features = features
+
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+
+		s.Infof("%v  using protocol v%v (%v)", s.socket.RemoteAddr(), version, reason)
+
+		if s.heartbeat.Enabled() && features&protocol.HEARTBEAT == protocol.HEARTBEAT {
+			go s.ping()
+		}
+	}
+
+	s.once.Do(func() {
+		close(s.ready)
+	})
+}
+
+// ping sends a PING every heartbeat interval and closes the connection if the remote end
+// has not replied to the configured number of consecutive PINGs.
+func (s *Session) ping() {
+	ticker := time.NewTicker(s.heartbeat.Interval)
+	id := uint32(0)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Lock()
+			missed := s.missed
+			s.missed++
+			s.Unlock()
+
+			if missed >= s.heartbeat.Misses {
+				s.Warnf("%v  no reply to %v heartbeats - closing connection", s.socket.RemoteAddr(), missed)
+				s.socket.Close()
+				return
+			}
+
+			id++
+			if err := s.write(protocol.Ping(id).Encode()); err != nil {
+				s.Warnf("error sending PING to %v (%v)", s.socket.RemoteAddr(), err)
+			}
+
+		case <-s.closed:
+			return
+		}
+	}
+}
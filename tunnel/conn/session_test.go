@@ -0,0 +1,426 @@
+package conn
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+)
+
+func TestSessionNegotiatesV2(t *testing.T) {
+	local, remote := pipe(t)
+	a := NewSession(Conn{Tag: "A"}, local, Heartbeat{})
+	b := NewSession(Conn{Tag: "B"}, remote, Heartbeat{})
+	received := make(chan protocol.Message, 1)
+
+	defer a.Close()
+	defer b.Close()
+	defer local.Close()
+	defer remote.Close()
+
+	go listen(a, local, nil)
+	go listen(b, remote, received)
+	go a.Start()
+	go b.Start()
+
+	if err := a.Send(12345, []byte{0x01, 0x02, 0x03}); err != nil {
+		t.Fatalf("error sending message (%v)", err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.ID != 12345 {
+			t.Errorf("incorrect message ID - expected:%v, got:%v", 12345, msg.ID)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for message")
+	}
+
+	if v := a.Version(); v != 2 {
+		t.Errorf("incorrect protocol version - expected:%v, got:%v", 2, v)
+	}
+
+	if f := a.Features(); f != protocol.HEARTBEAT|protocol.ACKNOWLEDGE {
+		t.Errorf("incorrect protocol features - expected:%v, got:%v", protocol.HEARTBEAT|protocol.ACKNOWLEDGE, f)
+	}
+}
+
+func TestSessionFallsBackToV1ForSilentPeer(t *testing.T) {
+	local, remote := pipe(t)
+	session := NewSession(Conn{Tag: "A"}, local, Heartbeat{})
+	received := make(chan []byte, 1)
+
+	defer session.Close()
+	defer local.Close()
+	defer remote.Close()
+
+	// ... version 1 peer that never sends a HELLO
+	go func() {
+		packet := protocol.Packetize(12345, []byte{0x01, 0x02, 0x03})
+		buffer := []byte{}
+		chunk := make([]byte, 64)
+
+		for {
+			N, err := remote.Read(chunk)
+			if err != nil {
+				return
+			}
+
+			if buffer = append(buffer, chunk[:N]...); bytes.HasSuffix(buffer, packet) {
+				received <- packet
+				return
+			}
+		}
+	}()
+
+	go listen(session, local, nil)
+	go session.Start()
+
+	start := time.Now()
+
+	if err := session.Send(12345, []byte{0x01, 0x02, 0x03}); err != nil {
+		t.Fatalf("error sending message (%v)", err)
+	}
+
+	dt := time.Since(start)
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatalf("version 1 message not received")
+	}
+
+	if v := session.Version(); v != 1 {
+		t.Errorf("incorrect protocol version - expected:%v, got:%v", 1, v)
+	}
+
+	if dt < HELLO_TIMEOUT || dt > HELLO_TIMEOUT+250*time.Millisecond {
+		t.Errorf("incorrect fallback latency - expected:%v, got:%v", HELLO_TIMEOUT, dt)
+	}
+}
+
+func TestSessionWithDelayedHello(t *testing.T) {
+	local, remote := pipe(t)
+	a := NewSession(Conn{Tag: "A"}, local, Heartbeat{})
+	b := NewSession(Conn{Tag: "B"}, remote, Heartbeat{})
+	receivedA := make(chan protocol.Message, 1)
+	receivedB := make(chan protocol.Message, 1)
+
+	defer a.Close()
+	defer b.Close()
+	defer local.Close()
+	defer remote.Close()
+
+	expect := func(received chan protocol.Message, id uint32) {
+		t.Helper()
+
+		select {
+		case msg := <-received:
+			if msg.ID != id {
+				t.Errorf("incorrect message ID - expected:%v, got:%v", id, msg.ID)
+			}
+
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for message %v", id)
+		}
+	}
+
+	// ... B receives the HELLO from A immediately but A only reads the HELLO from B after the HELLO timeout
+	go listen(b, remote, receivedB)
+	go a.Start()
+	go b.Start()
+
+	if err := a.Send(1, []byte{0x01}); err != nil {
+		t.Fatalf("error sending message (%v)", err)
+	}
+
+	expect(receivedB, 1)
+
+	if v := a.Version(); v != 1 {
+		t.Errorf("incorrect protocol version - expected:%v, got:%v", 1, v)
+	}
+
+	go listen(a, local, receivedA)
+
+	deadline := time.Now().Add(time.Second)
+	for a.Version() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if v := a.Version(); v != 2 {
+		t.Fatalf("incorrect protocol version - expected:%v, got:%v", 2, v)
+	}
+
+	// ... and the connection is still usable in both directions
+	if err := a.Send(2, []byte{0x02}); err != nil {
+		t.Fatalf("error sending message (%v)", err)
+	}
+
+	expect(receivedB, 2)
+
+	if err := b.Send(3, []byte{0x03}); err != nil {
+		t.Fatalf("error sending message (%v)", err)
+	}
+
+	expect(receivedA, 3)
+}
+
+func TestSessionRejectsOversizeMessage(t *testing.T) {
+	local, remote := pipe(t)
+	session := NewSession(Conn{Tag: "A"}, local, Heartbeat{})
+
+	defer session.Close()
+	defer local.Close()
+	defer remote.Close()
+
+	message := make([]byte, protocol.MAX_MESSAGE+1)
+
+	if err := session.Send(12345, message); !errors.Is(err, protocol.ErrMessageTooLarge) {
+		t.Errorf("incorrect Send error - expected:%v, got:%v", protocol.ErrMessageTooLarge, err)
+	}
+
+	if err := session.Deliver(12345, message); !errors.Is(err, protocol.ErrMessageTooLarge) {
+		t.Errorf("incorrect Deliver error - expected:%v, got:%v", protocol.ErrMessageTooLarge, err)
+	}
+}
+
+func TestSessionHeartbeatClosesSilentConnection(t *testing.T) {
+	local, remote := pipe(t)
+	session := NewSession(Conn{Tag: "A"}, local, Heartbeat{Interval: 10 * time.Millisecond, Misses: 2})
+	closed := make(chan struct{})
+
+	defer session.Close()
+	defer remote.Close()
+
+	// ... remote end replies to the HELLO and then ignores everything
+	go func() {
+		buffer := make([]byte, 64)
+		for {
+			if _, err := remote.Read(buffer); err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+
+	go listen(session, local, nil)
+	go session.Start()
+
+	remote.Write(protocol.Hello(protocol.HEARTBEAT).Encode())
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Errorf("connection not closed after missed heartbeats")
+	}
+}
+
+func TestSessionHeartbeatKeepsConnectionOpen(t *testing.T) {
+	local, remote := pipe(t)
+	heartbeat := Heartbeat{Interval: 10 * time.Millisecond, Misses: 2}
+	a := NewSession(Conn{Tag: "A"}, local, heartbeat)
+	b := NewSession(Conn{Tag: "B"}, remote, heartbeat)
+	closed := make(chan struct{})
+
+	defer a.Close()
+	defer b.Close()
+	defer local.Close()
+	defer remote.Close()
+
+	go func() {
+		listen(a, local, nil)
+		close(closed)
+	}()
+
+	go listen(b, remote, nil)
+	go a.Start()
+	go b.Start()
+
+	select {
+	case <-closed:
+		t.Errorf("connection closed by heartbeat")
+	case <-time.After(250 * time.Millisecond):
+	}
+}
+
+func TestSessionDeliverIsAcknowledged(t *testing.T) {
+	local, remote := pipe(t)
+	a := NewSession(Conn{Tag: "A"}, local, Heartbeat{})
+	b := NewSession(Conn{Tag: "B"}, remote, Heartbeat{})
+	received := make(chan protocol.Message, 1)
+
+	defer a.Close()
+	defer b.Close()
+	defer local.Close()
+	defer remote.Close()
+
+	go listen(a, local, nil)
+	go listen(b, remote, received)
+	go a.Start()
+	go b.Start()
+
+	delivered := make(chan error, 1)
+	go func() {
+		delivered <- a.Deliver(12345, []byte{0x01, 0x02, 0x03})
+	}()
+
+	select {
+	case err := <-delivered:
+		if err != nil {
+			t.Errorf("error delivering message (%v)", err)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for ACK")
+	}
+
+	if msg := <-received; msg.ID != 12345 {
+		t.Errorf("incorrect message ID - expected:%v, got:%v", 12345, msg.ID)
+	}
+}
+
+func TestSessionDeliverRetransmits(t *testing.T) {
+	local, remote := pipe(t)
+	session := NewSession(Conn{Tag: "A"}, local, Heartbeat{})
+	session.timeout = 20 * time.Millisecond
+
+	defer session.Close()
+	defer local.Close()
+	defer remote.Close()
+
+	// ... remote end acknowledges the second transmission
+	go func() {
+		remote.Write(protocol.Hello(protocol.ACKNOWLEDGE).Encode())
+
+		stream := protocol.NewStream()
+		buffer := make([]byte, 64)
+		count := 0
+
+		for {
+			N, err := remote.Read(buffer)
+			if err != nil {
+				return
+			}
+
+			frames, _ := stream.Decode(buffer[:N])
+
+			for _, frame := range frames {
+				if frame.Type == protocol.DATA && frame.Flags&protocol.ACK_REQUEST != 0 {
+					if count++; count > 1 {
+						remote.Write(protocol.Ack(frame.ID).Encode())
+					}
+				}
+			}
+		}
+	}()
+
+	go listen(session, local, nil)
+	go session.Start()
+
+	delivered := make(chan error, 1)
+	go func() {
+		delivered <- session.Deliver(12345, []byte{0x01, 0x02, 0x03})
+	}()
+
+	select {
+	case err := <-delivered:
+		if err != nil {
+			t.Errorf("error delivering message (%v)", err)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("message not retransmitted")
+	}
+}
+
+func TestSessionDeliverGivesUp(t *testing.T) {
+	local, remote := pipe(t)
+	session := NewSession(Conn{Tag: "A"}, local, Heartbeat{})
+	session.timeout = 10 * time.Millisecond
+	session.attempts = 3
+
+	defer session.Close()
+	defer local.Close()
+	defer remote.Close()
+
+	// ... remote end never acknowledges
+	go func() {
+		remote.Write(protocol.Hello(protocol.ACKNOWLEDGE).Encode())
+
+		buffer := make([]byte, 64)
+		for {
+			if _, err := remote.Read(buffer); err != nil {
+				return
+			}
+		}
+	}()
+
+	go listen(session, local, nil)
+	go session.Start()
+
+	delivered := make(chan error, 1)
+	go func() {
+		delivered <- session.Deliver(12345, []byte{0x01, 0x02, 0x03})
+	}()
+
+	select {
+	case err := <-delivered:
+		if !errors.Is(err, ErrNotAcknowledged) {
+			t.Errorf("incorrect error - expected:%v, got:%v", ErrNotAcknowledged, err)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("Deliver did not give up")
+	}
+}
+
+// pipe returns a connected pair of loopback TCP sockets (net.Pipe is unbuffered and
+// deadlocks when both ends write at the same time).
+func pipe(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error creating listener (%v)", err)
+	}
+
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if socket, err := listener.Accept(); err == nil {
+			accepted <- socket
+		}
+		close(accepted)
+	}()
+
+	local, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("error connecting to listener (%v)", err)
+	}
+
+	remote := <-accepted
+	if remote == nil {
+		t.Fatalf("error accepting connection")
+	}
+
+	return local, remote
+}
+
+func listen(session *Session, socket net.Conn, received chan protocol.Message) {
+	buffer := make([]byte, 64)
+	for {
+		N, err := socket.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		for _, msg := range session.Received(buffer[:N]) {
+			if received != nil {
+				received <- msg
+			}
+		}
+	}
+}
@@ -18,3 +18,14 @@ func IsIPv4(ip net.IP) bool {
 
 	return false
 }
+
+// UDPBind returns the network and wildcard local address for a socket used to send datagrams to
+// addr. IPv4 datagrams are sent from an IPv4 socket because broadcast is not supported on dual-stack
+// sockets and IPv6 datagrams (e.g. to a link-local or multicast address) are sent from an IPv6 socket.
+func UDPBind(addr *net.UDPAddr) (string, *net.UDPAddr) {
+	if addr.IP == nil || IsIPv4(addr.IP) {
+		return "udp4", &net.UDPAddr{IP: net.IPv4zero}
+	}
+
+	return "udp6", &net.UDPAddr{IP: net.IPv6unspecified}
+}
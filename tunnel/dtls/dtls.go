@@ -0,0 +1,145 @@
+package dtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	DTLS "github.com/pion/dtls/v3"
+	DTLSNET "github.com/pion/dtls/v3/pkg/net"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// The DTLS connectors carry each tunnel protocol frame as a single DTLS record over UDP, for
+// links that only pass UDP traffic. The connectors use the same session framing, heartbeats
+// and acknowledgements as the TLS connectors, so events are retransmitted until acknowledged.
+//
+// Requests and replies are not acknowledged, so a request that does not get a reply within
+// RETRANSMIT_INTERVAL is retransmitted (up to RETRANSMIT_ATTEMPTS times). The receiving end
+// relays a retransmitted request only once and answers the retransmissions with the replies
+// (if any) already received for the request.
+//
+// Both ends are authenticated with X.509 certificates i.e. a client certificate is required.
+
+const MAX_RECORD = 2048
+
+func resolve(spec string) (*net.UDPAddr, string, error) {
+	addr, err := net.ResolveUDPAddr("udp", spec)
+	if err != nil {
+		return nil, "", err
+	} else if addr == nil {
+		return nil, "", fmt.Errorf("unable to resolve UDP address '%v'", spec)
+	} else if addr.Port == 0 {
+		return nil, "", fmt.Errorf("DTLS host requires a non-zero port")
+	}
+
+	host, _, err := net.SplitHostPort(spec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return addr, host, nil
+}
+
+func clientConfig(host string, ca *x509.CertPool, keypair tls.Certificate) *DTLS.Config {
+	return &DTLS.Config{
+		ServerName:           host,
+		RootCAs:              ca,
+		Certificates:         []tls.Certificate{keypair},
+		ExtendedMasterSecret: DTLS.RequireExtendedMasterSecret,
+	}
+}
+
+func serverConfig(ca *x509.CertPool, keypair tls.Certificate) *DTLS.Config {
+	return &DTLS.Config{
+		ClientCAs:            ca,
+		Certificates:         []tls.Certificate{keypair},
+		ClientAuth:           DTLS.RequireAndVerifyClientCert,
+		ExtendedMasterSecret: DTLS.RequireExtendedMasterSecret,
+	}
+}
+
+// dial opens a UDP socket to the server (bound to the network interface, if any) and completes
+// the DTLS handshake. The UDP socket is closed when the DTLS connection is closed.
+func dial(hwif string, addr *net.UDPAddr, config *DTLS.Config, timeout time.Duration, c conn.Conn, ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if hwif != "" {
+				return conn.BindToDevice(connection, hwif, conn.IsIPv4(addr.IP), c)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	socket, err := dialer.DialContext(ctx, "udp", fmt.Sprintf("%v", addr))
+	if err != nil {
+		return nil, err
+	}
+
+	connection, err := DTLS.Client(DTLSNET.PacketConnFromConn(socket), socket.RemoteAddr(), config)
+	if err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	return handshake(connection, timeout, ctx)
+}
+
+// listen opens the UDP socket for a DTLS server (bound to the network interface, if any) and
+// returns a listener that accepts a connection for each client that sends a DTLS ClientHello.
+func listen(hwif string, addr *net.UDPAddr, c conn.Conn) (net.Listener, error) {
+	listener := net.ListenConfig{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if hwif != "" {
+				return conn.BindToDevice(connection, hwif, conn.IsIPv4(addr.IP), c)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	socket, err := listener.ListenPacket(context.Background(), "udp", fmt.Sprintf("%v", addr))
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.NewDatagramListener(socket, hello), nil
+}
+
+// accept completes the DTLS handshake for a client connection accepted by the listener.
+func accept(client net.Conn, config *DTLS.Config, timeout time.Duration, ctx context.Context) (net.Conn, error) {
+	connection, err := DTLS.Server(DTLSNET.PacketConnFromConn(client), client.RemoteAddr(), config)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return handshake(connection, timeout, ctx)
+}
+
+func handshake(connection *DTLS.Conn, timeout time.Duration, ctx context.Context) (net.Conn, error) {
+	handshake, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := connection.HandshakeContext(handshake); err != nil {
+		connection.Close()
+		return nil, err
+	}
+
+	return connection, nil
+}
+
+// hello returns true if the datagram is a DTLS handshake record containing a ClientHello, so
+// that the listener ignores stray datagrams from unknown addresses.
+func hello(datagram []byte) bool {
+	const HANDSHAKE = 22
+	const CLIENT_HELLO = 1
+
+	return len(datagram) > 13 && datagram[0] == HANDSHAKE && datagram[13] == CLIENT_HELLO
+}
@@ -0,0 +1,204 @@
+package dtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	DTLS "github.com/pion/dtls/v3"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type dtlsClient struct {
+	conn.Conn
+	hwif         string
+	addr         *net.UDPAddr
+	config       *DTLS.Config
+	retry        conn.Backoff
+	heartbeat    conn.Heartbeat
+	timeout      time.Duration
+	transactions *transactions
+	ch           chan protocol.Message
+	ctx          context.Context
+	closed       chan struct{}
+}
+
+func NewDTLSInClient(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsClient, error) {
+	client, err := makeDTLSClient(hwif, spec, ca, keypair, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::dtls-client-in")
+	}
+
+	return client, err
+}
+
+func NewDTLSOutClient(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsClient, error) {
+	client, err := makeDTLSClient(hwif, spec, ca, keypair, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::dtls-client-out")
+	}
+
+	return client, err
+}
+
+func makeDTLSClient(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsClient, error) {
+	addr, host, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	client := dtlsClient{
+		Conn: conn.Conn{
+			Tag: "DTLS",
+		},
+		hwif:         hwif,
+		addr:         addr,
+		config:       clientConfig(host, ca, keypair),
+		retry:        retry,
+		heartbeat:    heartbeat,
+		timeout:      5 * time.Second,
+		transactions: newTransactions(),
+		ch:           make(chan protocol.Message, 16),
+		ctx:          ctx,
+		closed:       make(chan struct{}),
+	}
+
+	return &client, nil
+}
+
+func (dtls *dtlsClient) Close() {
+	dtls.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-dtls.closed:
+		dtls.Infof("closed")
+
+	case <-timeout.C:
+		dtls.Infof("close timeout")
+	}
+}
+
+func (dtls *dtlsClient) Run(router *router.Switch) error {
+	dtls.connect(router)
+	dtls.closed <- struct{}{}
+
+	return nil
+}
+
+func (dtls *dtlsClient) Send(id uint32, msg []byte) {
+	select {
+	case dtls.ch <- protocol.Message{ID: id, Message: msg}:
+	default:
+	}
+}
+
+func (dtls *dtlsClient) connect(router *router.Switch) {
+	for {
+		dtls.Infof("connecting to %v", dtls.addr)
+
+		if socket, err := dial(dtls.hwif, dtls.addr, dtls.config, dtls.timeout, dtls.Conn, dtls.ctx); err != nil {
+			dtls.Warnf("%v", err)
+		} else {
+			dtls.retry.Reset()
+			session := conn.NewSession(dtls.Conn, socket, dtls.heartbeat)
+			eof := make(chan struct{})
+
+			go func() {
+				for {
+					select {
+					case msg := <-dtls.ch:
+						dtls.Infof("msg %v  relaying to %v", msg.ID, socket.RemoteAddr())
+						dtls.transactions.send(msg.ID, func() error {
+							return dtls.send(session, msg.ID, msg.Message)
+						})
+
+					case <-eof:
+						return
+
+					case <-dtls.ctx.Done():
+						socket.Close()
+						return
+					}
+				}
+			}()
+
+			if err := dtls.listen(socket, session, router); err != nil && !errors.Is(err, io.EOF) && dtls.ctx.Err() == nil {
+				dtls.Warnf("%v", err)
+			}
+
+			close(eof)
+			dtls.transactions.clear()
+		}
+
+		if !dtls.retry.Wait(dtls.Tag) {
+			return
+		}
+	}
+}
+
+func (dtls *dtlsClient) listen(socket net.Conn, session *conn.Session, router *router.Switch) error {
+	dtls.Infof("connected  to %v", socket.RemoteAddr())
+
+	defer socket.Close()
+	defer session.Close()
+
+	if err := session.Start(); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, MAX_RECORD)
+
+	for {
+		N, err := socket.Read(buffer)
+		if err != nil {
+			return err
+		}
+
+		dtls.received(buffer[:N], session, router, socket)
+	}
+}
+
+func (dtls *dtlsClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	dtls.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
+		request := msg.Message
+
+		if duplicate, replies := dtls.transactions.receive(socket.RemoteAddr(), id, request); duplicate {
+			dtls.Infof("msg %v  discarding duplicate message from %v", id, socket.RemoteAddr())
+
+			for _, reply := range replies {
+				dtls.send(session, id, reply)
+			}
+
+			continue
+		}
+
+		router.Received(id, request, func(message []byte) {
+			dtls.transactions.reply(socket.RemoteAddr(), id, request, message)
+			dtls.send(session, id, message)
+		})
+	}
+}
+
+func (dtls *dtlsClient) send(session *conn.Session, id uint32, msg []byte) error {
+	if err := session.Send(id, msg); err != nil {
+		dtls.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
+		return err
+	} else {
+		dtls.Infof("msg %v  sent %v bytes to %v", id, len(msg), session.RemoteAddr())
+	}
+
+	return nil
+}
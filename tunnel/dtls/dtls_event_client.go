@@ -0,0 +1,23 @@
+package dtls
+
+import (
+	"context"
+	"net"
+	"time"
+
+	DTLS "github.com/pion/dtls/v3"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type dtlsEventClient struct {
+	conn.EventClient
+	hwif    string
+	addr    *net.UDPAddr
+	config  *DTLS.Config
+	timeout time.Duration
+}
+
+func (dtls *dtlsEventClient) dial(ctx context.Context) (net.Conn, error) {
+	return dial(dtls.hwif, dtls.addr, dtls.config, dtls.timeout, dtls.Conn, ctx)
+}
@@ -0,0 +1,67 @@
+package dtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type dtlsEventInClient struct {
+	dtlsEventClient
+	dedup *conn.Dedup
+}
+
+func NewDTLSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsEventInClient, error) {
+	client, err := makeDTLSEventInClient(hwif, spec, ca, keypair, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::dtls-event-in-client")
+	}
+
+	return client, err
+}
+
+func makeDTLSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsEventInClient, error) {
+	addr, host, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	dtls := dtlsEventInClient{
+		dtlsEventClient{
+			EventClient: conn.NewEventClient("DTLS", addr.String(), retry, heartbeat, nil, MAX_RECORD, ctx),
+			hwif:        hwif,
+			addr:        addr,
+			config:      clientConfig(host, ca, keypair),
+			timeout:     5 * time.Second,
+		},
+		conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	dtls.Dial = dtls.dial
+	dtls.Received = dtls.received
+	dtls.Relay = dtls.send
+
+	return &dtls, nil
+}
+
+func (dtls *dtlsEventInClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	dtls.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		if dtls.dedup.Duplicate(msg.ID, msg.Message) {
+			dtls.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
+	}
+}
+
+func (dtls *dtlsEventInClient) send(session *conn.Session, id uint32, msg []byte) error {
+	return nil
+}
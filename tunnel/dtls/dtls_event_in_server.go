@@ -0,0 +1,68 @@
+package dtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type dtlsEventIn struct {
+	dtlsServer
+	dedup *conn.Dedup
+}
+
+func NewDTLSEventInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsEventIn, error) {
+	server, err := makeDTLSEventInServer(hwif, spec, ca, keypair, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::dtls-event-in-server")
+	}
+
+	return server, err
+}
+
+func makeDTLSEventInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsEventIn, error) {
+	addr, _, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	dtls := dtlsEventIn{
+		dtlsServer: dtlsServer{
+			Server:       conn.NewServer("DTLS", retry, heartbeat, MAX_RECORD, ctx),
+			hwif:         hwif,
+			addr:         addr,
+			config:       serverConfig(ca, keypair),
+			timeout:      5 * time.Second,
+			transactions: newTransactions(),
+			ctx:          ctx,
+		},
+		dedup: conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	dtls.Listen = dtls.listen
+	dtls.Accept = dtls.accept
+	dtls.Received = dtls.received
+
+	return &dtls, nil
+}
+
+func (dtls *dtlsEventIn) Send(id uint32, message []byte) {
+}
+
+func (dtls *dtlsEventIn) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	dtls.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		if dtls.dedup.Duplicate(msg.ID, msg.Message) {
+			dtls.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
+	}
+}
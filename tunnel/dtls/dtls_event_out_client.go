@@ -0,0 +1,47 @@
+package dtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type dtlsEventOutClient struct {
+	dtlsEventClient
+}
+
+func NewDTLSEventOutClient(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (*dtlsEventOutClient, error) {
+	client, err := makeDTLSEventOutClient(hwif, spec, ca, keypair, retry, heartbeat, queue, ctx)
+
+	if err == nil {
+		client.Infof("connector::dtls-event-out-client")
+	}
+
+	return client, err
+}
+
+func makeDTLSEventOutClient(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (*dtlsEventOutClient, error) {
+	addr, host, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	dtls := dtlsEventOutClient{
+		dtlsEventClient{
+			EventClient: conn.NewEventClient("DTLS", addr.String(), retry, heartbeat, queue, MAX_RECORD, ctx),
+			hwif:        hwif,
+			addr:        addr,
+			config:      clientConfig(host, ca, keypair),
+			timeout:     5 * time.Second,
+		},
+	}
+
+	dtls.Dial = dtls.dial
+	dtls.Received = conn.Discard
+	dtls.Relay = dtls.Deliver
+
+	return &dtls, nil
+}
@@ -0,0 +1,53 @@
+package dtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type dtlsEventOutServer struct {
+	dtlsServer
+}
+
+func NewDTLSEventOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsEventOutServer, error) {
+	server, err := makeDTLSEventOutServer(hwif, spec, ca, keypair, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::dtls-event-out-server")
+	}
+
+	return server, err
+}
+
+func makeDTLSEventOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsEventOutServer, error) {
+	addr, _, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	dtls := dtlsEventOutServer{
+		dtlsServer{
+			Server:       conn.NewServer("DTLS", retry, heartbeat, MAX_RECORD, ctx),
+			hwif:         hwif,
+			addr:         addr,
+			config:       serverConfig(ca, keypair),
+			timeout:      5 * time.Second,
+			transactions: newTransactions(),
+			ctx:          ctx,
+		},
+	}
+
+	dtls.Listen = dtls.listen
+	dtls.Accept = dtls.accept
+	dtls.Received = conn.Discard
+
+	return &dtls, nil
+}
+
+func (dtls *dtlsEventOutServer) Send(id uint32, message []byte) {
+	dtls.Post(id, message)
+}
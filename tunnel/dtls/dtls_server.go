@@ -0,0 +1,114 @@
+package dtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	DTLS "github.com/pion/dtls/v3"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type dtlsServer struct {
+	conn.Server
+	hwif         string
+	addr         *net.UDPAddr
+	config       *DTLS.Config
+	timeout      time.Duration
+	transactions *transactions
+	ctx          context.Context
+}
+
+func NewDTLSInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsServer, error) {
+	server, err := makeDTLSServer(hwif, spec, ca, keypair, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::dtls-server-in")
+	}
+
+	return server, err
+}
+
+func NewDTLSOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsServer, error) {
+	server, err := makeDTLSServer(hwif, spec, ca, keypair, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::dtls-server-out")
+	}
+
+	return server, err
+}
+
+func makeDTLSServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*dtlsServer, error) {
+	addr, _, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	server := dtlsServer{
+		Server:       conn.NewServer("DTLS", retry, heartbeat, MAX_RECORD, ctx),
+		hwif:         hwif,
+		addr:         addr,
+		config:       serverConfig(ca, keypair),
+		timeout:      5 * time.Second,
+		transactions: newTransactions(),
+		ctx:          ctx,
+	}
+
+	server.Listen = server.listen
+	server.Accept = server.accept
+	server.Received = server.received
+
+	return &server, nil
+}
+
+func (dtls *dtlsServer) Close() {
+	dtls.Server.Close()
+	dtls.transactions.clear()
+}
+
+func (dtls *dtlsServer) Send(id uint32, message []byte) {
+	go dtls.transactions.send(id, func() error {
+		dtls.Broadcast(func(session *conn.Session) {
+			dtls.Reply(session, id, message)
+		})
+
+		return nil
+	})
+}
+
+func (dtls *dtlsServer) listen() (net.Listener, error) {
+	return listen(dtls.hwif, dtls.addr, dtls.Conn)
+}
+
+func (dtls *dtlsServer) accept(client net.Conn) (net.Conn, error) {
+	return accept(client, dtls.config, dtls.timeout, dtls.ctx)
+}
+
+func (dtls *dtlsServer) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	dtls.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
+		request := msg.Message
+
+		if duplicate, replies := dtls.transactions.receive(socket.RemoteAddr(), id, request); duplicate {
+			dtls.Infof("msg %v  discarding duplicate message from %v", id, socket.RemoteAddr())
+
+			for _, reply := range replies {
+				dtls.Reply(session, id, reply)
+			}
+
+			continue
+		}
+
+		router.Received(id, request, func(message []byte) {
+			dtls.transactions.reply(socket.RemoteAddr(), id, request, message)
+			dtls.Reply(session, id, message)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package dtls
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	DTLS "github.com/pion/dtls/v3"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestDTLSScenarios(t *testing.T) {
+	ca, keypair := loopback.Certificates(t)
+
+	loopback.Scenarios(t, loopback.Transport{
+		Network: "udp",
+
+		Requests: func(t *testing.T, server string, client string, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			return loopback.Must(t)(NewDTLSOutServer("", server, ca, keypair, retry, conn.Heartbeat{}, ctx)),
+				loopback.Must(t)(NewDTLSInClient("", client, ca, keypair, retry, conn.Heartbeat{}, ctx))
+		},
+
+		Events: func(t *testing.T, server string, client string, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			return loopback.Must(t)(NewDTLSEventInServer("", server, ca, keypair, retry, heartbeat, ctx)),
+				loopback.Must(t)(NewDTLSEventOutClient("", client, ca, keypair, retry, heartbeat, queue, ctx))
+		},
+	})
+}
+
+func TestDTLSHandshakeFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := loopback.Address(t, "udp")
+	ca, keypair := loopback.Certificates(t)
+	untrusted, other := loopback.Certificates(t)
+
+	server, err := NewDTLSOutServer("", addr, ca, keypair, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer func() {
+		cancel()
+		server.Close()
+	}()
+
+	go server.Run(loopback.Sink(t))
+
+	loopback.Bound(t, "udp", addr)
+
+	udp, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	missing := clientConfig("127.0.0.1", ca, keypair)
+	missing.Certificates = nil
+
+	tests := []struct {
+		name   string
+		config *DTLS.Config
+	}{
+		{"client certificate from untrusted CA", clientConfig("127.0.0.1", ca, other)},
+		{"missing client certificate", missing},
+		{"server certificate from untrusted CA", clientConfig("127.0.0.1", untrusted, keypair)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			socket, err := dial("", udp, test.config, loopback.TIMEOUT, conn.Conn{Tag: "DTLS"}, ctx)
+			if err == nil {
+				socket.Close()
+				t.Fatalf("DTLS handshake succeeded")
+			}
+
+			loopback.Steady(t, 100*time.Millisecond, func() bool {
+				return len(server.Sessions()) == 0
+			})
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package dtls
+
+import (
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+)
+
+const RETRANSMIT_INTERVAL = 1 * time.Second
+const RETRANSMIT_ATTEMPTS = 3
+const TRANSACTION_WINDOW = 30 * time.Second
+
+// transactions tracks the requests and replies relayed by a request/reply connector.
+//
+// A request sent by the connector is retransmitted every RETRANSMIT_INTERVAL (up to
+// RETRANSMIT_ATTEMPTS times) until a message with the same ID is received.
+//
+// A message received by the connector is remembered (by remote address, message ID and a hash
+// of the message content) for the TRANSACTION_WINDOW along with the replies sent for it, so that
+// a retransmitted request is answered with those replies rather than being relayed again. A
+// repeated reply is likewise discarded.
+type transactions struct {
+	pending  map[uint32]*time.Timer
+	received map[transactionKey]*transaction
+	swept    time.Time
+	sync.Mutex
+}
+
+type transactionKey struct {
+	peer string
+	id   uint32
+	hash uint64
+}
+
+type transaction struct {
+	replies [][]byte
+	touched time.Time
+}
+
+func newTransactions() *transactions {
+	return &transactions{
+		pending:  map[uint32]*time.Timer{},
+		received: map[transactionKey]*transaction{},
+		swept:    time.Now(),
+	}
+}
+
+// send invokes the send function immediately and then again every RETRANSMIT_INTERVAL until a
+// reply is received or the retransmit attempts are exhausted.
+func (t *transactions) send(id uint32, f func() error) {
+	attempts := 0
+
+	var retransmit func()
+
+	retransmit = func() {
+		t.Lock()
+		defer t.Unlock()
+
+		if _, ok := t.pending[id]; !ok {
+			return
+		}
+
+		if attempts++; attempts > RETRANSMIT_ATTEMPTS {
+			delete(t.pending, id)
+			return
+		}
+
+		go f()
+
+		t.pending[id] = time.AfterFunc(RETRANSMIT_INTERVAL, retransmit)
+	}
+
+	t.Lock()
+	if timer, ok := t.pending[id]; ok {
+		timer.Stop()
+	}
+	t.pending[id] = time.AfterFunc(RETRANSMIT_INTERVAL, retransmit)
+	t.Unlock()
+
+	if err := f(); err != nil {
+		t.stop(id)
+	}
+}
+
+// receive stops the retransmission of a request with the same ID and returns true (with the
+// replies already sent) if the message has already been received within the transaction window.
+func (t *transactions) receive(peer net.Addr, id uint32, message []byte) (bool, [][]byte) {
+	key := transactionKey{peer.String(), id, hash(message)}
+	now := time.Now()
+
+	t.stop(id)
+
+	t.Lock()
+	defer t.Unlock()
+
+	if now.Sub(t.swept) > TRANSACTION_WINDOW {
+		for k, v := range t.received {
+			if now.Sub(v.touched) > TRANSACTION_WINDOW {
+				delete(t.received, k)
+			}
+		}
+
+		t.swept = now
+	}
+
+	if v, ok := t.received[key]; ok && now.Sub(v.touched) <= TRANSACTION_WINDOW {
+		v.touched = now
+		return true, append([][]byte{}, v.replies...)
+	}
+
+	t.received[key] = &transaction{
+		replies: [][]byte{},
+		touched: now,
+	}
+
+	return false, nil
+}
+
+// reply records a reply sent for a received request.
+func (t *transactions) reply(peer net.Addr, id uint32, request []byte, reply []byte) {
+	key := transactionKey{peer.String(), id, hash(request)}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if v, ok := t.received[key]; ok {
+		v.replies = append(v.replies, reply)
+		v.touched = time.Now()
+	}
+}
+
+func (t *transactions) stop(id uint32) {
+	t.Lock()
+	defer t.Unlock()
+
+	if timer, ok := t.pending[id]; ok {
+		timer.Stop()
+		delete(t.pending, id)
+	}
+}
+
+// clear stops all pending retransmissions.
+func (t *transactions) clear() {
+	t.Lock()
+	defer t.Unlock()
+
+	for id, timer := range t.pending {
+		timer.Stop()
+		delete(t.pending, id)
+	}
+}
+
+func hash(message []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(message)
+
+	return h.Sum64()
+}
@@ -0,0 +1,535 @@
+package http
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	codec "github.com/uhppoted/uhppote-core/encoding/UTO311-L0x"
+	"github.com/uhppoted/uhppote-core/messages"
+	"github.com/uhppoted/uhppote-core/types"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+)
+
+// The REST API encodes requests and decodes replies on the server using the uhppote-core
+// message codecs, so that clients can use the tunnel without reimplementing the UT0311-L0x
+// binary protocol.
+
+type controller struct {
+	ID      uint32           `json:"controller"`
+	Address net.IP           `json:"address"`
+	Netmask net.IP           `json:"netmask"`
+	Gateway net.IP           `json:"gateway"`
+	MAC     types.MacAddress `json:"MAC"`
+	Version types.Version    `json:"version"`
+	Date    types.Date       `json:"date"`
+}
+
+type datetime struct {
+	ID       uint32         `json:"controller"`
+	DateTime types.DateTime `json:"datetime"`
+}
+
+type status struct {
+	ID          uint32  `json:"controller"`
+	SystemTime  string  `json:"system-datetime"`
+	Doors       [4]bool `json:"doors"`
+	Buttons     [4]bool `json:"buttons"`
+	Relays      uint8   `json:"relays"`
+	Inputs      uint8   `json:"inputs"`
+	SystemError uint8   `json:"system-error"`
+	SpecialInfo uint8   `json:"special-info"`
+	SequenceNo  uint32  `json:"sequence-no"`
+	Event       *event  `json:"event,omitempty"`
+}
+
+type event struct {
+	Index     uint32         `json:"index"`
+	Type      uint8          `json:"type"`
+	Granted   bool           `json:"granted"`
+	Door      uint8          `json:"door"`
+	Direction uint8          `json:"direction"`
+	Card      uint32         `json:"card"`
+	Timestamp types.DateTime `json:"timestamp"`
+	Reason    uint8          `json:"reason"`
+}
+
+type door struct {
+	ID    uint32             `json:"controller"`
+	Door  uint8              `json:"door"`
+	Mode  types.ControlState `json:"mode"`
+	Delay uint8              `json:"delay"`
+}
+
+type card struct {
+	ID        uint32     `json:"controller"`
+	Card      uint32     `json:"card"`
+	StartDate types.Date `json:"start-date"`
+	EndDate   types.Date `json:"end-date"`
+	Doors     [4]uint8   `json:"doors"`
+	PIN       types.PIN  `json:"PIN"`
+}
+
+type result struct {
+	ID        uint32 `json:"controller"`
+	Succeeded bool   `json:"succeeded"`
+}
+
+type endpoint func(http.ResponseWriter, *http.Request, uint32, *router.Switch)
+
+// api registers the REST API handlers.
+func (h *httpd) api(mux *http.ServeMux, router *router.Switch) {
+	handle := func(pattern string, f endpoint) {
+		mux.HandleFunc(pattern, h.authenticated(func(w http.ResponseWriter, r *http.Request) {
+			if id, err := strconv.ParseUint(r.PathValue("id"), 10, 32); err != nil || id == 0 {
+				h.Warnf("%v", fmt.Errorf("invalid controller ID (%v)", r.PathValue("id")))
+				fail(w, ERR_INVALID_REQUEST, fmt.Sprintf("Invalid controller ID (%v)", r.PathValue("id")))
+			} else {
+				f(w, r, uint32(id), router)
+			}
+		}))
+	}
+
+	handle("GET /api/controllers/{id}", h.getController)
+	handle("GET /api/controllers/{id}/time", h.getTime)
+	handle("PUT /api/controllers/{id}/time", h.setTime)
+	handle("GET /api/controllers/{id}/status", h.getStatus)
+	handle("GET /api/controllers/{id}/doors/{door}", h.getDoor)
+	handle("PUT /api/controllers/{id}/doors/{door}", h.setDoor)
+	handle("POST /api/controllers/{id}/doors/{door}/open", h.openDoor)
+	handle("GET /api/controllers/{id}/cards/{card}", h.getCard)
+	handle("PUT /api/controllers/{id}/cards/{card}", h.putCard)
+	handle("DELETE /api/controllers/{id}/cards/{card}", h.deleteCard)
+
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		fail(w, ERR_NOT_FOUND, fmt.Sprintf("Invalid API request (%v %v)", r.Method, r.URL.Path))
+	})
+}
+
+func (h *httpd) getController(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	request := messages.GetDeviceRequest{
+		SerialNumber: types.SerialNumber(id),
+	}
+
+	response := messages.GetDeviceResponse{}
+
+	if h.exec(w, r, router, id, request, &response) {
+		h.reply(controller{
+			ID:      uint32(response.SerialNumber),
+			Address: response.IpAddress,
+			Netmask: response.SubnetMask,
+			Gateway: response.Gateway,
+			MAC:     response.MacAddress,
+			Version: response.Version,
+			Date:    response.Date,
+		}, w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) getTime(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	request := messages.GetTimeRequest{
+		SerialNumber: types.SerialNumber(id),
+	}
+
+	response := messages.GetTimeResponse{}
+
+	if h.exec(w, r, router, id, request, &response) {
+		h.reply(datetime{
+			ID:       uint32(response.SerialNumber),
+			DateTime: response.DateTime,
+		}, w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) setTime(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	body := struct {
+		DateTime *types.DateTime `json:"datetime"`
+	}{}
+
+	if !h.unmarshal(w, r, &body) {
+		return
+	} else if body.DateTime == nil || body.DateTime.IsZero() {
+		fail(w, ERR_INVALID_REQUEST, "Missing or invalid 'datetime'")
+		return
+	}
+
+	request := messages.SetTimeRequest{
+		SerialNumber: types.SerialNumber(id),
+		DateTime:     *body.DateTime,
+	}
+
+	response := messages.SetTimeResponse{}
+
+	if h.exec(w, r, router, id, request, &response) {
+		h.reply(datetime{
+			ID:       uint32(response.SerialNumber),
+			DateTime: response.DateTime,
+		}, w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) getStatus(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	request := messages.GetStatusRequest{
+		SerialNumber: types.SerialNumber(id),
+	}
+
+	response := messages.GetStatusResponse{}
+
+	if h.exec(w, r, router, id, request, &response) {
+		h.reply(toStatus(response), w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) getDoor(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	d, ok := h.door(w, r)
+	if !ok {
+		return
+	}
+
+	request := messages.GetDoorControlStateRequest{
+		SerialNumber: types.SerialNumber(id),
+		Door:         d,
+	}
+
+	response := messages.GetDoorControlStateResponse{}
+
+	if h.exec(w, r, router, id, request, &response) {
+		h.reply(door{
+			ID:    uint32(response.SerialNumber),
+			Door:  response.Door,
+			Mode:  mode(response.ControlState),
+			Delay: response.Delay,
+		}, w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) setDoor(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	d, ok := h.door(w, r)
+	if !ok {
+		return
+	}
+
+	body := struct {
+		Mode  *types.ControlState `json:"mode"`
+		Delay *uint8              `json:"delay"`
+	}{}
+
+	if !h.unmarshal(w, r, &body) {
+		return
+	} else if body.Mode == nil {
+		fail(w, ERR_INVALID_REQUEST, "Missing 'mode'")
+		return
+	} else if body.Delay == nil {
+		fail(w, ERR_INVALID_REQUEST, "Missing 'delay'")
+		return
+	}
+
+	request := messages.SetDoorControlStateRequest{
+		SerialNumber: types.SerialNumber(id),
+		Door:         d,
+		ControlState: uint8(*body.Mode),
+		Delay:        *body.Delay,
+	}
+
+	response := messages.SetDoorControlStateResponse{}
+
+	if h.exec(w, r, router, id, request, &response) {
+		h.reply(door{
+			ID:    uint32(response.SerialNumber),
+			Door:  response.Door,
+			Mode:  mode(response.ControlState),
+			Delay: response.Delay,
+		}, w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) openDoor(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	d, ok := h.door(w, r)
+	if !ok {
+		return
+	}
+
+	request := messages.OpenDoorRequest{
+		SerialNumber: types.SerialNumber(id),
+		Door:         d,
+	}
+
+	response := messages.OpenDoorResponse{}
+
+	if h.exec(w, r, router, id, request, &response) {
+		h.reply(result{
+			ID:        uint32(response.SerialNumber),
+			Succeeded: response.Succeeded,
+		}, w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) getCard(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	c, ok := h.card(w, r)
+	if !ok {
+		return
+	}
+
+	request := messages.GetCardByIDRequest{
+		SerialNumber: types.SerialNumber(id),
+		CardNumber:   c,
+	}
+
+	response := messages.GetCardByIDResponse{}
+
+	if !h.exec(w, r, router, id, request, &response) {
+		return
+	} else if response.CardNumber == 0 {
+		fail(w, ERR_NOT_FOUND, fmt.Sprintf("Card %v not found", c))
+	} else {
+		h.reply(card{
+			ID:        uint32(response.SerialNumber),
+			Card:      response.CardNumber,
+			StartDate: response.From,
+			EndDate:   response.To,
+			Doors:     [4]uint8{response.Door1, response.Door2, response.Door3, response.Door4},
+			PIN:       response.PIN,
+		}, w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) putCard(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	c, ok := h.card(w, r)
+	if !ok {
+		return
+	}
+
+	body := struct {
+		StartDate *types.Date `json:"start-date"`
+		EndDate   *types.Date `json:"end-date"`
+		Doors     [4]uint8    `json:"doors"`
+		PIN       types.PIN   `json:"PIN"`
+	}{}
+
+	if !h.unmarshal(w, r, &body) {
+		return
+	} else if body.StartDate == nil || body.StartDate.IsZero() {
+		fail(w, ERR_INVALID_REQUEST, "Missing or invalid 'start-date'")
+		return
+	} else if body.EndDate == nil || body.EndDate.IsZero() {
+		fail(w, ERR_INVALID_REQUEST, "Missing or invalid 'end-date'")
+		return
+	} else if body.PIN > 999999 {
+		fail(w, ERR_INVALID_REQUEST, fmt.Sprintf("Invalid PIN (%v)", body.PIN))
+		return
+	}
+
+	request := messages.PutCardRequest{
+		SerialNumber: types.SerialNumber(id),
+		CardNumber:   c,
+		From:         *body.StartDate,
+		To:           *body.EndDate,
+		Door1:        body.Doors[0],
+		Door2:        body.Doors[1],
+		Door3:        body.Doors[2],
+		Door4:        body.Doors[3],
+		PIN:          body.PIN,
+	}
+
+	response := messages.PutCardResponse{}
+
+	if h.exec(w, r, router, id, request, &response) {
+		h.reply(result{
+			ID:        uint32(response.SerialNumber),
+			Succeeded: response.Succeeded,
+		}, w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) deleteCard(w http.ResponseWriter, r *http.Request, id uint32, router *router.Switch) {
+	c, ok := h.card(w, r)
+	if !ok {
+		return
+	}
+
+	request := messages.DeleteCardRequest{
+		SerialNumber: types.SerialNumber(id),
+		CardNumber:   c,
+	}
+
+	response := messages.DeleteCardResponse{}
+
+	if h.exec(w, r, router, id, request, &response) {
+		h.reply(result{
+			ID:        uint32(response.SerialNumber),
+			Succeeded: response.Succeeded,
+		}, w, acceptsGzip(r))
+	}
+}
+
+// toStatus converts a get-status response (or event) to the JSON status record.
+func toStatus(response messages.GetStatusResponse) status {
+	status := status{
+		ID:          uint32(response.SerialNumber),
+		SystemTime:  fmt.Sprintf("%v %v", response.SystemDate, response.SystemTime),
+		Doors:       [4]bool{response.Door1State, response.Door2State, response.Door3State, response.Door4State},
+		Buttons:     [4]bool{response.Door1Button, response.Door2Button, response.Door3Button, response.Door4Button},
+		Relays:      response.RelayState,
+		Inputs:      response.InputState,
+		SystemError: response.SystemError,
+		SpecialInfo: response.SpecialInfo,
+		SequenceNo:  response.SequenceId,
+	}
+
+	if response.EventIndex != 0 {
+		status.Event = &event{
+			Index:     response.EventIndex,
+			Type:      response.EventType,
+			Granted:   response.Granted,
+			Door:      response.Door,
+			Direction: response.Direction,
+			Card:      response.CardNumber,
+			Timestamp: response.Timestamp,
+			Reason:    response.Reason,
+		}
+	}
+
+	return status
+}
+
+// exec encodes the request, relays it to the controller and decodes the first valid reply from
+// the controller into the response. Replies from other controllers (e.g. for a broadcast) are
+// discarded. Returns false if the request failed, after writing the HTTP error response.
+func (h *httpd) exec(w http.ResponseWriter, r *http.Request, router *router.Switch, controller uint32, request any, response any) bool {
+	msg, err := codec.Marshal(request)
+	if err != nil {
+		h.Warnf("%v", err)
+		fail(w, ERR_INTERNAL, "Error encoding request")
+		return false
+	}
+
+	if !h.authorised(w, r, msg) {
+		return false
+	}
+
+	id := protocol.NextID()
+	received := make(chan []byte, 8)
+	ctx, cancel := context.WithTimeout(h.ctx, h.timeout)
+
+	defer cancel()
+
+	h.Dumpf(msg, "request %v  %v bytes from %v", id, len(msg), r.RemoteAddr)
+
+	if err := router.Accept(id, msg, func(reply []byte) {
+		select {
+		case received <- reply:
+		default:
+		}
+	}); err != nil {
+		h.Warnf("request %v: %v", id, err)
+		fail(w, errcode(err), fmt.Sprintf("Request for controller %v not relayed (%v)", controller, err))
+		return false
+	}
+
+	for {
+		select {
+		case reply := <-received:
+			h.Dumpf(reply, "reply %v  %v bytes for %v", id, len(reply), r.RemoteAddr)
+
+			if len(reply) < 8 || binary.LittleEndian.Uint32(reply[4:8]) != controller {
+				continue
+			}
+
+			if err := codec.Unmarshal(reply, response); err != nil {
+				h.Warnf("%v", err)
+				continue
+			}
+
+			return true
+
+		case <-r.Context().Done():
+			h.Warnf("%v", r.Context().Err())
+			return false
+
+		case <-ctx.Done():
+			h.Warnf("request %v: no reply from controller %v (%v)", id, controller, ctx.Err())
+			fail(w, errcode(ctx.Err()), fmt.Sprintf("No reply from controller %v", controller))
+			return false
+		}
+	}
+}
+
+// unmarshal decodes a JSON request body, writing the HTTP error response if the body is not
+// valid JSON.
+func (h *httpd) unmarshal(w http.ResponseWriter, r *http.Request, body any) bool {
+	if contentType := mediaType(r); contentType != "application/json" {
+		h.Warnf("%v", fmt.Errorf("invalid request content-type (%v)", contentType))
+		fail(w, ERR_INVALID_CONTENT_TYPE, fmt.Sprintf("Invalid request content-type (%v)", contentType))
+		return false
+	}
+
+	blob, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.Warnf("%v", err)
+		fail(w, ERR_INTERNAL, "Error reading request")
+		return false
+	}
+
+	if err := json.Unmarshal(blob, body); err != nil {
+		h.Warnf("%v", err)
+		fail(w, ERR_INVALID_REQUEST, fmt.Sprintf("Invalid request body (%v)", err))
+		return false
+	}
+
+	return true
+}
+
+func (h *httpd) door(w http.ResponseWriter, r *http.Request) (uint8, bool) {
+	if door, err := strconv.ParseUint(r.PathValue("door"), 10, 8); err != nil || door < 1 || door > 4 {
+		fail(w, ERR_INVALID_REQUEST, fmt.Sprintf("Invalid door (%v)", r.PathValue("door")))
+		return 0, false
+	} else {
+		return uint8(door), true
+	}
+}
+
+func (h *httpd) card(w http.ResponseWriter, r *http.Request) (uint32, bool) {
+	if card, err := strconv.ParseUint(r.PathValue("card"), 10, 32); err != nil || card == 0 {
+		fail(w, ERR_INVALID_REQUEST, fmt.Sprintf("Invalid card number (%v)", r.PathValue("card")))
+		return 0, false
+	} else {
+		return uint32(card), true
+	}
+}
+
+// mode converts a door control state to a types.ControlState, mapping invalid values to 'unknown'.
+func mode(state uint8) types.ControlState {
+	if state > uint8(types.Controlled) {
+		return types.ModeUnknown
+	}
+
+	return types.ControlState(state)
+}
+
+func mediaType(r *http.Request) string {
+	contentType := strings.TrimSpace(strings.ToLower(r.Header.Get("Content-Type")))
+
+	if before, _, ok := strings.Cut(contentType, ";"); ok {
+		return strings.TrimSpace(before)
+	}
+
+	return contentType
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		if strings.Contains(strings.ToLower(v), "gzip") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	codec "github.com/uhppoted/uhppote-core/encoding/UTO311-L0x"
+	"github.com/uhppoted/uhppote-core/messages"
+	"github.com/uhppoted/uhppote-core/types"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestAPIRoundTrip(t *testing.T) {
+	// ... the controller date/time is local time
+	datetime := time.Date(2026, time.October, 18, 12, 34, 56, 0, time.Local).Format("2006-01-02 15:04:05 MST")
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"GET", "/api/controllers/405419896", "", http.StatusOK, `{"controller":405419896,"address":"192.168.1.100","netmask":"255.255.255.0","gateway":"192.168.1.1","MAC":"00:12:23:34:45:56","version":"0892","date":"2018-11-05"}`},
+		{"GET", "/api/controllers/405419896/time", "", http.StatusOK, fmt.Sprintf(`{"controller":405419896,"datetime":"%v"}`, datetime)},
+		{"PUT", "/api/controllers/405419896/time", `{"datetime":"2026-10-18 12:34:56"}`, http.StatusOK, fmt.Sprintf(`{"controller":405419896,"datetime":"%v"}`, datetime)},
+		{"POST", "/api/controllers/405419896/doors/3/open", "", http.StatusOK, `{"controller":405419896,"succeeded":true}`},
+		{"GET", "/api/controllers/405419896/cards/10058400", "", http.StatusOK, `{"controller":405419896,"card":10058400,"start-date":"2026-01-01","end-date":"2026-12-31","doors":[1,0,0,1],"PIN":"7531"}`},
+		{"GET", "/api/controllers/405419896/cards/10058401", "", http.StatusNotFound, `{"error":{"code":"not-found","message":"Card 10058401 not found"}}`},
+		{"GET", "/api/controllers/303986753/time", "", http.StatusGatewayTimeout, `{"error":{"code":"timeout","message":"No reply from controller 303986753"}}`},
+		{"GET", "/api/controllers/0/time", "", http.StatusBadRequest, `{"error":{"code":"invalid-request","message":"Invalid controller ID (0)"}}`},
+		{"GET", "/api/controllers/405419896/cards", "", http.StatusNotFound, `{"error":{"code":"not-found","message":"Invalid API request (GET /api/controllers/405419896/cards)"}}`},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("127.0.0.1:%v", loopback.TCPPort(t))
+
+	h, err := NewHTTP(addr, t.TempDir(), nil, 0, conn.NewBackoff(-1, time.Second, ctx), ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	h.timeout = 250 * time.Millisecond
+
+	s := standin(t, 405419896)
+
+	defer func() {
+		cancel()
+		h.Close()
+	}()
+
+	go h.Run(s)
+
+	loopback.Listening(t, addr)
+
+	for _, test := range tests {
+		rq, err := http.NewRequest(test.method, "http://"+addr+test.path, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if test.body != "" {
+			rq.Header.Set("Content-Type", "application/json")
+		}
+
+		response, err := http.DefaultClient.Do(rq)
+		if err != nil {
+			t.Fatalf("%v %v: %v", test.method, test.path, err)
+		}
+
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		if response.StatusCode != test.status {
+			t.Errorf("%v %v: incorrect status - expected:%v, got:%v", test.method, test.path, test.status, response.StatusCode)
+		}
+
+		if string(bytes.TrimSpace(body)) != test.expected {
+			t.Errorf("%v %v: incorrect response\n   expected:%s\n   got:     %s", test.method, test.path, test.expected, bytes.TrimSpace(body))
+		}
+	}
+}
+
+// standin returns a switch that replies to requests for the controller with
+// fixed responses, standing in for a controller on the other end of the tunnel. Requests
+// for any other controller are ignored.
+func standin(t *testing.T, controller uint32) *router.Switch {
+	return loopback.NewSwitch(t, func(id uint32, message []byte, h func([]byte)) {
+		if h == nil || len(message) != 64 || types.SerialNumber(controller) != serialNumber(message) {
+			return
+		}
+
+		var response any
+		datetime := types.DateTime(time.Date(2026, time.October, 18, 12, 34, 56, 0, time.Local))
+
+		switch message[1] {
+		case 0x94:
+			response = messages.GetDeviceResponse{
+				SerialNumber: types.SerialNumber(controller),
+				IpAddress:    net.IPv4(192, 168, 1, 100),
+				SubnetMask:   net.IPv4(255, 255, 255, 0),
+				Gateway:      net.IPv4(192, 168, 1, 1),
+				MacAddress:   types.MacAddress{0x00, 0x12, 0x23, 0x34, 0x45, 0x56},
+				Version:      0x0892,
+				Date:         types.ToDate(2018, time.November, 5),
+			}
+
+		case 0x32:
+			response = messages.GetTimeResponse{SerialNumber: types.SerialNumber(controller), DateTime: datetime}
+
+		case 0x30:
+			request := messages.SetTimeRequest{}
+			codec.Unmarshal(message, &request)
+			response = messages.SetTimeResponse{SerialNumber: types.SerialNumber(controller), DateTime: request.DateTime}
+
+		case 0x40:
+			response = messages.OpenDoorResponse{SerialNumber: types.SerialNumber(controller), Succeeded: true}
+
+		case 0x5a:
+			request := messages.GetCardByIDRequest{}
+			codec.Unmarshal(message, &request)
+			if request.CardNumber == 10058400 {
+				response = messages.GetCardByIDResponse{
+					SerialNumber: types.SerialNumber(controller),
+					CardNumber:   10058400,
+					From:         types.ToDate(2026, time.January, 1),
+					To:           types.ToDate(2026, time.December, 31),
+					Door1:        1,
+					Door4:        1,
+					PIN:          7531,
+				}
+			} else {
+				response = messages.GetCardByIDResponse{SerialNumber: types.SerialNumber(controller)}
+			}
+
+		default:
+			return
+		}
+
+		if reply, err := codec.Marshal(response); err == nil {
+			h(reply)
+		}
+	})
+}
+
+func serialNumber(message []byte) types.SerialNumber {
+	return types.SerialNumber(uint32(message[4]) | uint32(message[5])<<8 | uint32(message[6])<<16 | uint32(message[7])<<24)
+}
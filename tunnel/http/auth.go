@@ -0,0 +1,418 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Auth authenticates the requests to the HTTP connector API endpoints and authorises the UHPPOTE
+// function codes that a client may send. Clients authenticate with either a static bearer token,
+// HTTP Basic authentication (with bcrypt password hashes) or a JWT signed by a key in a local
+// JWKS file. Each token, user or JWT is assigned one or more roles, which define the function
+// codes that may be sent and whether the client may subscribe to events.
+//
+// The configuration is a TOML file, e.g.:
+//
+//	[tokens]
+//	"6f1c1f7c8e2a4c33a4c6b0b64f9f0a1e" = ["admin"]
+//
+//	[users.monitor]
+//	password = "$2a$10$..."
+//	roles = ["read-only"]
+//
+//	[jwt]
+//	jwks = "/etc/uhppoted/tunnel/jwks.json"
+//	issuer = "https://auth.example.com"
+//	audience = "uhppoted-tunnel"
+//	claim = "roles"
+//
+//	[roles.read-only]
+//	functions = ["0x94", "0x20", "0x32", "0x82", "0x5a"]
+//	events = true
+//
+//	[roles.admin]
+//	functions = ["*"]
+//	events = true
+type Auth struct {
+	tokens map[[32]byte][]string
+	users  map[string]user
+	jwt    *validator
+	roles  map[string]role
+	dummy  []byte
+}
+
+type user struct {
+	password []byte
+	roles    []string
+}
+
+type role struct {
+	all       bool
+	functions []uint8
+	events    bool
+}
+
+type validator struct {
+	keys   jwks
+	claim  string
+	parser *jwt.Parser
+}
+
+type principal struct {
+	name  string
+	roles []string
+}
+
+type contextKey string
+
+const PRINCIPAL contextKey = "principal"
+
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrForbidden = errors.New("forbidden")
+
+// NewAuth loads the authentication and authorisation configuration from a TOML file. Returns
+// nil (i.e. no authentication) if the file is not specified.
+func NewAuth(file string) (*Auth, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	config := struct {
+		Tokens map[string][]string `toml:"tokens"`
+		Users  map[string]struct {
+			Password string   `toml:"password"`
+			Roles    []string `toml:"roles"`
+		} `toml:"users"`
+		JWT *struct {
+			JWKS     string `toml:"jwks"`
+			Issuer   string `toml:"issuer"`
+			Audience string `toml:"audience"`
+			Claim    string `toml:"claim"`
+		} `toml:"jwt"`
+		Roles map[string]struct {
+			Functions []any `toml:"functions"`
+			Events    bool  `toml:"events"`
+		} `toml:"roles"`
+	}{}
+
+	if err := toml.Unmarshal(bytes, &config); err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+
+	auth := Auth{
+		tokens: map[[32]byte][]string{},
+		users:  map[string]user{},
+		roles:  map[string]role{},
+	}
+
+	for k, v := range config.Roles {
+		r := role{
+			events: v.Events,
+		}
+
+		for _, f := range v.Functions {
+			if s, ok := f.(string); ok && s == "*" {
+				r.all = true
+			} else if code, err := function(f); err != nil {
+				return nil, fmt.Errorf("%v: role '%v': %w", file, k, err)
+			} else {
+				r.functions = append(r.functions, code)
+			}
+		}
+
+		auth.roles[k] = r
+	}
+
+	exists := func(roles []string) error {
+		for _, r := range roles {
+			if _, ok := auth.roles[r]; !ok {
+				return fmt.Errorf("unknown role '%v'", r)
+			}
+		}
+
+		return nil
+	}
+
+	for k, v := range config.Tokens {
+		if len(k) < 16 {
+			return nil, fmt.Errorf("%v: bearer token is too short (minimum 16 characters)", file)
+		} else if err := exists(v); err != nil {
+			return nil, fmt.Errorf("%v: bearer token: %w", file, err)
+		} else {
+			auth.tokens[sha256.Sum256([]byte(k))] = v
+		}
+	}
+
+	for k, v := range config.Users {
+		if _, err := bcrypt.Cost([]byte(v.Password)); err != nil {
+			return nil, fmt.Errorf("%v: user '%v': invalid bcrypt password hash (%w)", file, k, err)
+		} else if err := exists(v.Roles); err != nil {
+			return nil, fmt.Errorf("%v: user '%v': %w", file, k, err)
+		} else {
+			auth.users[k] = user{
+				password: []byte(v.Password),
+				roles:    v.Roles,
+			}
+		}
+	}
+
+	// ... bcrypt hash used to equalise the response time for unknown users
+	if len(auth.users) > 0 {
+		if dummy, err := bcrypt.GenerateFromPassword([]byte("uhppoted-tunnel"), bcrypt.DefaultCost); err != nil {
+			return nil, err
+		} else {
+			auth.dummy = dummy
+		}
+	}
+
+	if config.JWT != nil {
+		keys, err := loadJWKS(config.JWT.JWKS)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", file, err)
+		}
+
+		options := []jwt.ParserOption{
+			jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+			jwt.WithExpirationRequired(),
+		}
+
+		if config.JWT.Issuer != "" {
+			options = append(options, jwt.WithIssuer(config.JWT.Issuer))
+		}
+
+		if config.JWT.Audience != "" {
+			options = append(options, jwt.WithAudience(config.JWT.Audience))
+		}
+
+		claim := config.JWT.Claim
+		if claim == "" {
+			claim = "roles"
+		}
+
+		auth.jwt = &validator{
+			keys:   keys,
+			claim:  claim,
+			parser: jwt.NewParser(options...),
+		}
+	}
+
+	return &auth, nil
+}
+
+// authenticate returns the authenticated principal for the request.
+func (a *Auth) authenticate(r *http.Request) (*principal, error) {
+	header := r.Header.Get("Authorization")
+	scheme, credentials, _ := strings.Cut(header, " ")
+	credentials = strings.TrimSpace(credentials)
+
+	switch {
+	case header == "":
+		return nil, fmt.Errorf("%w (missing Authorization header)", ErrUnauthorized)
+
+	case strings.EqualFold(scheme, "Bearer"):
+		if roles, ok := a.token(credentials); ok {
+			return &principal{name: "token", roles: roles}, nil
+		} else if a.jwt != nil && strings.Count(credentials, ".") == 2 {
+			return a.jwt.validate(credentials)
+		} else {
+			return nil, fmt.Errorf("%w (invalid bearer token)", ErrUnauthorized)
+		}
+
+	case strings.EqualFold(scheme, "Basic"):
+		uid, pwd, ok := r.BasicAuth()
+		if !ok {
+			return nil, fmt.Errorf("%w (invalid Basic credentials)", ErrUnauthorized)
+		}
+
+		// ... compare against a dummy hash for unknown users to avoid leaking valid user names via the response time
+		u, ok := a.users[uid]
+		if !ok {
+			bcrypt.CompareHashAndPassword(a.dummy, []byte(pwd))
+			return nil, fmt.Errorf("%w (invalid user '%v')", ErrUnauthorized, uid)
+		} else if err := bcrypt.CompareHashAndPassword(u.password, []byte(pwd)); err != nil {
+			return nil, fmt.Errorf("%w (invalid password for user '%v')", ErrUnauthorized, uid)
+		} else {
+			return &principal{name: uid, roles: u.roles}, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("%w (unsupported authorization scheme '%v')", ErrUnauthorized, scheme)
+	}
+}
+
+// token returns the roles for a static bearer token.
+func (a *Auth) token(token string) ([]string, bool) {
+	hash := sha256.Sum256([]byte(token))
+
+	for k, roles := range a.tokens {
+		if subtle.ConstantTimeCompare(k[:], hash[:]) == 1 {
+			return roles, true
+		}
+	}
+
+	return nil, false
+}
+
+// challenge returns the WWW-Authenticate header for an unauthenticated request.
+func (a *Auth) challenge() string {
+	if len(a.users) > 0 {
+		return `Basic realm="uhppoted-tunnel", charset="UTF-8"`
+	}
+
+	return `Bearer realm="uhppoted-tunnel"`
+}
+
+// allowed returns true if any of the principal roles permits the function code.
+func (a *Auth) allowed(p *principal, code uint8) bool {
+	for _, k := range p.roles {
+		if r, ok := a.roles[k]; ok && (r.all || slices.Contains(r.functions, code)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subscriber returns true if any of the principal roles permits subscribing to events.
+func (a *Auth) subscriber(p *principal) bool {
+	for _, k := range p.roles {
+		if r, ok := a.roles[k]; ok && r.events {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *validator) validate(token string) (*principal, error) {
+	claims := jwt.MapClaims{}
+
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keys.key); err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrUnauthorized, err)
+	}
+
+	p := principal{
+		name: "jwt",
+	}
+
+	if sub, err := claims.GetSubject(); err == nil && sub != "" {
+		p.name = sub
+	}
+
+	switch roles := claims[v.claim].(type) {
+	case string:
+		p.roles = strings.Fields(roles)
+
+	case []any:
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				p.roles = append(p.roles, s)
+			}
+		}
+	}
+
+	return &p, nil
+}
+
+// authenticated wraps an HTTP handler with the connector authentication, passing the authenticated
+// principal to the handler in the request context.
+func (h *httpd) authenticated(f http.HandlerFunc) http.HandlerFunc {
+	if h.auth == nil {
+		return f
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, err := h.auth.authenticate(r); err != nil {
+			h.Warnf("%v %v from %v: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", h.auth.challenge())
+			fail(w, ERR_UNAUTHORIZED, "Unauthorized")
+		} else {
+			f(w, r.WithContext(context.WithValue(r.Context(), PRINCIPAL, p)))
+		}
+	}
+}
+
+// authorised returns true if the authenticated principal is permitted to send the request,
+// writing an HTTP 403 Forbidden response if not.
+func (h *httpd) authorised(w http.ResponseWriter, r *http.Request, request []byte) bool {
+	if err := h.permitted(r, request); err != nil {
+		h.Warnf("%v: %v", r.URL.Path, err)
+		fail(w, ERR_FORBIDDEN, fmt.Sprintf("%v", err))
+		return false
+	}
+
+	return true
+}
+
+// permitted returns an ErrForbidden error if the authenticated principal is not permitted to
+// send the request.
+func (h *httpd) permitted(r *http.Request, request []byte) error {
+	if h.auth == nil {
+		return nil
+	}
+
+	p, ok := r.Context().Value(PRINCIPAL).(*principal)
+	if !ok {
+		return ErrForbidden
+	}
+
+	if len(request) < 2 {
+		return fmt.Errorf("%w (invalid request)", ErrForbidden)
+	}
+
+	if !h.auth.allowed(p, request[1]) {
+		return fmt.Errorf("%w (function 0x%02x not permitted for %v)", ErrForbidden, request[1], p.name)
+	}
+
+	return nil
+}
+
+// subscribed returns true if the authenticated principal is permitted to subscribe to events,
+// writing an HTTP 403 Forbidden response if not.
+func (h *httpd) subscribed(w http.ResponseWriter, r *http.Request) bool {
+	if h.auth == nil {
+		return true
+	}
+
+	if p, ok := r.Context().Value(PRINCIPAL).(*principal); !ok || !h.auth.subscriber(p) {
+		fail(w, ERR_FORBIDDEN, "Forbidden")
+		return false
+	}
+
+	return true
+}
+
+// function parses a function code from a TOML integer or a (decimal or 0x prefixed hexadecimal)
+// string.
+func function(v any) (uint8, error) {
+	switch f := v.(type) {
+	case int64:
+		if f >= 0 && f <= 255 {
+			return uint8(f), nil
+		}
+
+	case string:
+		if code, err := strconv.ParseUint(f, 0, 8); err == nil {
+			return uint8(code), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid function code (%v)", v)
+}
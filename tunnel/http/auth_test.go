@@ -0,0 +1,235 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const ROLES = `
+[roles.admin]
+functions = ["*"]
+events = true
+
+[roles.read-only]
+functions = ["0x94", 32, "130"]
+events = true
+
+[roles.cards]
+functions = ["0x50", "0x52"]
+`
+
+func TestNewAuth(t *testing.T) {
+	hash := hash(t, "correct horse battery staple")
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"valid", fmt.Sprintf("[tokens]\n\"0123456789abcdef\" = [\"admin\"]\n\n[users.monitor]\npassword = %q\nroles = [\"read-only\"]\n%v", hash, ROLES), ""},
+		{"short token", "[tokens]\n\"0123456789abcde\" = [\"admin\"]\n" + ROLES, "bearer token is too short"},
+		{"token with unknown role", "[tokens]\n\"0123456789abcdef\" = [\"qwerty\"]\n" + ROLES, "unknown role 'qwerty'"},
+		{"invalid bcrypt hash", "[users.monitor]\npassword = \"qwerty\"\nroles = [\"read-only\"]\n" + ROLES, "invalid bcrypt password hash"},
+		{"user with unknown role", fmt.Sprintf("[users.monitor]\npassword = %q\nroles = [\"qwerty\"]\n%v", hash, ROLES), "unknown role 'qwerty'"},
+		{"invalid function code", "[roles.admin]\nfunctions = [\"0x1ff\"]\n", "invalid function code"},
+		{"invalid function code string", "[roles.admin]\nfunctions = [\"get-status\"]\n", "invalid function code"},
+		{"function code out of range", "[roles.admin]\nfunctions = [256]\n", "invalid function code"},
+		{"missing JWKS file", "[jwt]\nissuer = \"https://auth.example.com\"\n", "missing JWKS file"},
+		{"invalid TOML", "[tokens\n", "toml"},
+	}
+
+	for _, test := range tests {
+		auth, err := NewAuth(configure(t, test.config))
+
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%v: unexpected error (%v)", test.name, err)
+
+		case test.err == "" && auth == nil:
+			t.Errorf("%v: expected auth, got:%v", test.name, auth)
+
+		case test.err != "" && err == nil:
+			t.Errorf("%v: expected error '%v'", test.name, test.err)
+
+		case test.err != "" && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%v: incorrect error - expected:'%v', got:'%v'", test.name, test.err, err)
+		}
+	}
+}
+
+func TestNewAuthWithoutFile(t *testing.T) {
+	if auth, err := NewAuth(""); err != nil || auth != nil {
+		t.Errorf("expected no authentication for empty file - got:%v, error:%v", auth, err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	auth := newAuth(t, fmt.Sprintf("[tokens]\n\"0123456789abcdef\" = [\"admin\"]\n\n[users.monitor]\npassword = %q\nroles = [\"read-only\"]\n%v", hash(t, "correct horse battery staple"), ROLES))
+
+	basic := func(uid, pwd string) string {
+		r := http.Request{Header: http.Header{}}
+		r.SetBasicAuth(uid, pwd)
+
+		return r.Header.Get("Authorization")
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		principal     string
+		roles         []string
+	}{
+		{"bearer token", "Bearer 0123456789abcdef", "token", []string{"admin"}},
+		{"bearer token (lowercase scheme)", "bearer 0123456789abcdef", "token", []string{"admin"}},
+		{"invalid bearer token", "Bearer 0123456789abcdeF", "", nil},
+		{"empty bearer token", "Bearer ", "", nil},
+		{"basic auth", basic("monitor", "correct horse battery staple"), "monitor", []string{"read-only"}},
+		{"basic auth with unknown user", basic("admin", "correct horse battery staple"), "", nil},
+		{"basic auth with wrong password", basic("monitor", "qwerty"), "", nil},
+		{"invalid basic credentials", "Basic qwerty", "", nil},
+		{"missing Authorization header", "", "", nil},
+		{"unsupported scheme", "Digest username=\"monitor\"", "", nil},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/udp/send", nil)
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+
+		p, err := auth.authenticate(r)
+
+		switch {
+		case test.principal == "" && err == nil:
+			t.Errorf("%v: expected error, got principal %v", test.name, p)
+
+		case test.principal == "" && !errors.Is(err, ErrUnauthorized):
+			t.Errorf("%v: incorrect error - expected:%v, got:%v", test.name, ErrUnauthorized, err)
+
+		case test.principal != "" && err != nil:
+			t.Errorf("%v: unexpected error (%v)", test.name, err)
+
+		case test.principal != "" && (p.name != test.principal || fmt.Sprintf("%v", p.roles) != fmt.Sprintf("%v", test.roles)):
+			t.Errorf("%v: incorrect principal - expected:%v %v, got:%v %v", test.name, test.principal, test.roles, p.name, p.roles)
+		}
+	}
+}
+
+func TestPermitted(t *testing.T) {
+	h := httpd{
+		auth: newAuth(t, ROLES),
+	}
+
+	tests := []struct {
+		roles    []string
+		request  []byte
+		expected bool
+	}{
+		{[]string{"admin"}, []byte{0x17, 0x94}, true},
+		{[]string{"admin"}, []byte{0x17, 0x50}, true},
+		{[]string{"read-only"}, []byte{0x17, 0x94}, true},
+		{[]string{"read-only"}, []byte{0x17, 0x20}, true},
+		{[]string{"read-only"}, []byte{0x17, 0x82}, true},
+		{[]string{"read-only"}, []byte{0x17, 0x50}, false},
+		{[]string{"cards"}, []byte{0x17, 0x50}, true},
+		{[]string{"cards"}, []byte{0x17, 0x94}, false},
+		{[]string{"read-only", "cards"}, []byte{0x17, 0x52}, true},
+		{[]string{"qwerty"}, []byte{0x17, 0x94}, false},
+		{[]string{}, []byte{0x17, 0x94}, false},
+		{[]string{"admin"}, []byte{0x17}, false},
+	}
+
+	for _, test := range tests {
+		r := withPrincipal(&principal{name: "test", roles: test.roles})
+
+		if err := h.permitted(r, test.request); test.expected && err != nil {
+			t.Errorf("%v 0x%02x: unexpected error (%v)", test.roles, test.request, err)
+		} else if !test.expected && !errors.Is(err, ErrForbidden) {
+			t.Errorf("%v 0x%02x: incorrect error - expected:%v, got:%v", test.roles, test.request, ErrForbidden, err)
+		}
+	}
+
+	if err := h.permitted(httptest.NewRequest(http.MethodPost, "/udp/send", nil), []byte{0x17, 0x94}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("unauthenticated request: incorrect error - expected:%v, got:%v", ErrForbidden, err)
+	}
+
+	if err := (&httpd{}).permitted(httptest.NewRequest(http.MethodPost, "/udp/send", nil), []byte{0x17, 0x50}); err != nil {
+		t.Errorf("no authentication: unexpected error (%v)", err)
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	h := httpd{
+		auth: newAuth(t, ROLES),
+	}
+
+	tests := []struct {
+		roles    []string
+		expected bool
+	}{
+		{[]string{"admin"}, true},
+		{[]string{"read-only"}, true},
+		{[]string{"cards"}, false},
+		{[]string{"cards", "read-only"}, true},
+		{[]string{"qwerty"}, false},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := withPrincipal(&principal{name: "test", roles: test.roles})
+
+		if ok := h.subscribed(w, r); ok != test.expected {
+			t.Errorf("%v: incorrect result - expected:%v, got:%v", test.roles, test.expected, ok)
+		} else if !ok && w.Code != http.StatusForbidden {
+			t.Errorf("%v: incorrect HTTP status - expected:%v, got:%v", test.roles, http.StatusForbidden, w.Code)
+		}
+	}
+}
+
+func configure(t *testing.T, config string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "auth.toml")
+	if err := os.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatalf("error writing auth configuration (%v)", err)
+	}
+
+	return file
+}
+
+func newAuth(t *testing.T, config string) *Auth {
+	t.Helper()
+
+	auth, err := NewAuth(configure(t, config))
+	if err != nil {
+		t.Fatalf("error loading auth configuration (%v)", err)
+	}
+
+	return auth
+}
+
+func hash(t *testing.T, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("error generating bcrypt hash (%v)", err)
+	}
+
+	return string(hash)
+}
+
+func withPrincipal(p *principal) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/udp/send", nil)
+
+	return r.WithContext(context.WithValue(r.Context(), PRINCIPAL, p))
+}
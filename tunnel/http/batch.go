@@ -0,0 +1,163 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+)
+
+// The batch endpoint relays a list of requests through the router with up to 'concurrency'
+// requests in flight at any one time and returns the replies (or errors) in the same order
+// as the requests, so that e.g. provisioning a large number of cards does not require a round
+// trip per request. The requests are paced by the tunnel rate limiter rather than failing with
+// 'rate-limited' once the burst limit has been exceeded.
+
+const BATCH_CONCURRENCY = 8
+const MAX_BATCH_SIZE = 10000
+
+type item struct {
+	Reply slice     `json:"reply,omitempty"`
+	Error *apiError `json:"error,omitempty"`
+}
+
+func (h *httpd) batch(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	body := struct {
+		ID          int `json:"ID"`
+		Concurrency int `json:"concurrency,omitempty"`
+		Requests    []struct {
+			Request []byte `json:"request"`
+			Wait    *bool  `json:"wait,omitempty"`
+		} `json:"requests"`
+	}{}
+
+	if !h.unmarshal(w, r, &body) {
+		return
+	} else if len(body.Requests) > MAX_BATCH_SIZE {
+		fail(w, ERR_BATCH_TOO_LARGE, fmt.Sprintf("Too many requests in batch (maximum %v)", MAX_BATCH_SIZE))
+		return
+	}
+
+	concurrency := h.concurrency
+	if body.Concurrency > 0 && body.Concurrency < concurrency {
+		concurrency = body.Concurrency
+	}
+
+	delay, ok := router.Delay(len(body.Requests))
+	if !ok {
+		fail(w, ERR_RATE_LIMITED, "Batch exceeds the tunnel rate limit")
+		return
+	}
+
+	h.Infof("batch %v  %v requests from %v (concurrency %v, estimated delay %v)", body.ID, len(body.Requests), r.RemoteAddr, concurrency, delay.Round(time.Millisecond))
+
+	replies := make([]item, len(body.Requests))
+	pending := make(chan struct{}, concurrency)
+	ctx, cancel := context.WithCancel(h.ctx)
+
+	defer cancel()
+
+	// ... cancel the outstanding requests if the client disconnects
+	stop := context.AfterFunc(r.Context(), cancel)
+	defer stop()
+
+	var wg sync.WaitGroup
+
+loop:
+	for i, v := range body.Requests {
+		if err := h.permitted(r, v.Request); err != nil {
+			replies[i] = failed(err)
+			continue
+		} else if len(v.Request) == 0 {
+			replies[i] = item{Error: &apiError{Code: ERR_INVALID_REQUEST, Message: "invalid request"}}
+			continue
+		}
+
+		select {
+		case pending <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+
+		wg.Go(func() {
+			defer func() {
+				<-pending
+			}()
+
+			wait := v.Wait == nil || *v.Wait
+			if reply, err := h.exchange(ctx, router, v.Request, wait, r.RemoteAddr); err != nil {
+				replies[i] = failed(err)
+			} else {
+				replies[i] = item{Reply: reply}
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		h.Warnf("batch %v  %v", body.ID, ctx.Err())
+		fail(w, ERR_CANCELLED, "Request cancelled")
+		return
+	}
+
+	response := struct {
+		ID      int    `json:"ID"`
+		Replies []item `json:"replies"`
+	}{
+		ID:      body.ID,
+		Replies: replies,
+	}
+
+	h.reply(response, w, acceptsGzip(r))
+}
+
+// exchange relays a single request (once permitted by the rate limiter) and returns the first
+// reply, or nil if the request does not expect a reply (e.g. set-ip).
+func (h *httpd) exchange(ctx context.Context, router *router.Switch, request []byte, wait bool, remote string) ([]byte, error) {
+	id := protocol.NextID()
+
+	h.Dumpf(request, "request %v  %v bytes from %v", id, len(request), remote)
+
+	if !wait {
+		return nil, router.AcceptWait(ctx, id, request, func(reply []byte) {})
+	}
+
+	received := make(chan []byte, 1)
+
+	if err := router.AcceptWait(ctx, id, request, func(reply []byte) {
+		select {
+		case received <- reply:
+		default:
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+
+	defer cancel()
+
+	select {
+	case reply := <-received:
+		h.Dumpf(reply, "reply %v  %v bytes for %v", id, len(reply), remote)
+		return reply, nil
+
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no reply (%w)", ctx.Err())
+	}
+}
+
+// failed returns the batch item for a failed request.
+func failed(err error) item {
+	return item{
+		Error: &apiError{
+			Code:    errcode(err),
+			Message: fmt.Sprintf("%v", err),
+		},
+	}
+}
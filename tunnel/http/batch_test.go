@@ -0,0 +1,112 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+func TestBatchLargerThanBurst(t *testing.T) {
+	const N = 50
+	const BURST = 10
+
+	r := router.NewRouter("", rate.NewLimiter(100, BURST))
+	defer r.Close()
+
+	// ... replies to each request with the request
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {
+		if h != nil {
+			h(message)
+		}
+	})
+
+	h := httpd{
+		Conn:        conn.Conn{Tag: "HTTP"},
+		timeout:     time.Second,
+		concurrency: BATCH_CONCURRENCY,
+		ctx:         context.Background(),
+	}
+
+	type request struct {
+		Request []byte `json:"request"`
+	}
+
+	body := struct {
+		ID       int       `json:"ID"`
+		Requests []request `json:"requests"`
+	}{
+		ID: 1,
+	}
+
+	for i := range N {
+		body.Requests = append(body.Requests, request{Request: []byte{0x17, 0x94, byte(i)}})
+	}
+
+	blob, _ := json.Marshal(body)
+	rq := httptest.NewRequest(http.MethodPost, "/udp/batch", bytes.NewReader(blob))
+	rq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	h.batch(w, rq, s)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("incorrect HTTP status - expected:%v, got:%v (%v)", http.StatusOK, w.Code, w.Body)
+	}
+
+	response := struct {
+		Replies []struct {
+			Reply []uint16  `json:"reply"`
+			Error *apiError `json:"error"`
+		} `json:"replies"`
+	}{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error unmarshalling response (%v)", err)
+	} else if len(response.Replies) != N {
+		t.Fatalf("incorrect number of replies - expected:%v, got:%v", N, len(response.Replies))
+	}
+
+	for i, v := range response.Replies {
+		if v.Error != nil {
+			t.Errorf("request %v: unexpected error (%v)", i, v.Error.Code)
+		} else if len(v.Reply) != 3 || v.Reply[2] != uint16(i) {
+			t.Errorf("request %v: incorrect reply (%v)", i, v.Reply)
+		}
+	}
+}
+
+func TestBatchWithZeroBurst(t *testing.T) {
+	r := router.NewRouter("", rate.NewLimiter(1, 0))
+	defer r.Close()
+
+	s := r.NewSwitch(func(id uint32, message []byte, h func([]byte)) {
+		t.Errorf("unexpected request %v", id)
+	})
+
+	h := httpd{
+		Conn:        conn.Conn{Tag: "HTTP"},
+		timeout:     time.Second,
+		concurrency: BATCH_CONCURRENCY,
+		ctx:         context.Background(),
+	}
+
+	blob := []byte(`{"ID":1,"requests":[{"request":"F5Q="}]}`)
+	rq := httptest.NewRequest(http.MethodPost, "/udp/batch", bytes.NewReader(blob))
+	rq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	h.batch(w, rq, s)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("incorrect HTTP status - expected:%v, got:%v (%v)", http.StatusTooManyRequests, w.Code, w.Body)
+	}
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+)
+
+// The HTTP connectors return errors as a JSON envelope with a stable error code and a descriptive
+// message, e.g.:
+//
+//	{ "error": { "code": "timeout", "message": "No reply from controller 405419896" } }
+//
+// The error codes are part of the published API (see openapi.json) and should not be changed.
+
+const ERR_INVALID_REQUEST = "invalid-request"
+const ERR_INVALID_CONTENT_TYPE = "invalid-content-type"
+const ERR_BATCH_TOO_LARGE = "batch-too-large"
+const ERR_UNAUTHORIZED = "unauthorized"
+const ERR_FORBIDDEN = "forbidden"
+const ERR_NOT_FOUND = "not-found"
+const ERR_METHOD_NOT_ALLOWED = "method-not-allowed"
+const ERR_RATE_LIMITED = "rate-limited"
+const ERR_TIMEOUT = "timeout"
+const ERR_CANCELLED = "cancelled"
+const ERR_INTERNAL = "internal-error"
+
+var statuses = map[string]int{
+	ERR_INVALID_REQUEST:      http.StatusBadRequest,
+	ERR_INVALID_CONTENT_TYPE: http.StatusBadRequest,
+	ERR_BATCH_TOO_LARGE:      http.StatusBadRequest,
+	ERR_UNAUTHORIZED:         http.StatusUnauthorized,
+	ERR_FORBIDDEN:            http.StatusForbidden,
+	ERR_NOT_FOUND:            http.StatusNotFound,
+	ERR_METHOD_NOT_ALLOWED:   http.StatusMethodNotAllowed,
+	ERR_RATE_LIMITED:         http.StatusTooManyRequests,
+	ERR_TIMEOUT:              http.StatusGatewayTimeout,
+	ERR_CANCELLED:            http.StatusServiceUnavailable,
+	ERR_INTERNAL:             http.StatusInternalServerError,
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// fail writes the JSON error envelope with the HTTP status for the error code.
+func fail(w http.ResponseWriter, code string, message string) {
+	status, ok := statuses[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	envelope := struct {
+		Error apiError `json:"error"`
+	}{
+		Error: apiError{
+			Code:    code,
+			Message: message,
+		},
+	}
+
+	if code == ERR_RATE_LIMITED {
+		w.Header().Set("Retry-After", "1")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(envelope)
+}
+
+// errcode returns the error code for an error returned by a router or a request context.
+func errcode(err error) string {
+	switch {
+	case errors.Is(err, router.ErrRateLimited):
+		return ERR_RATE_LIMITED
+
+	case errors.Is(err, ErrForbidden):
+		return ERR_FORBIDDEN
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return ERR_TIMEOUT
+
+	case errors.Is(err, context.Canceled):
+		return ERR_CANCELLED
+
+	default:
+		return ERR_INTERNAL
+	}
+}
@@ -0,0 +1,267 @@
+package http
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+
+	codec "github.com/uhppoted/uhppote-core/encoding/UTO311-L0x"
+	"github.com/uhppoted/uhppote-core/messages"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+)
+
+// The HTTP connectors publish the events (and any other unsolicited messages) relayed to the
+// connector to the subscribers at /events, either as Server-Sent Events or as WebSocket text
+// messages. Subscribers can optionally filter the events by controller and have the events
+// decoded to JSON records.
+
+const SUBSCRIBER_QUEUE = 32
+const KEEPALIVE_INTERVAL = 30 * time.Second
+
+type subscriber struct {
+	remote      string
+	controllers []uint32
+	decode      bool
+	ch          chan protocol.Message
+}
+
+type subscribers struct {
+	subscribers map[*subscriber]struct{}
+	sync.RWMutex
+}
+
+type published struct {
+	ID         uint32  `json:"ID"`
+	Controller uint32  `json:"controller"`
+	Message    slice   `json:"message,omitempty"`
+	Event      *status `json:"event,omitempty"`
+}
+
+func smake() *subscribers {
+	return &subscribers{
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+func (s *subscribers) add(sub *subscriber) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.subscribers[sub] = struct{}{}
+}
+
+func (s *subscribers) remove(sub *subscriber) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.subscribers, sub)
+}
+
+func (s *subscribers) list() []*subscriber {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make([]*subscriber, 0, len(s.subscribers))
+	for sub := range s.subscribers {
+		list = append(list, sub)
+	}
+
+	return list
+}
+
+// matches returns true if the subscriber is not filtering by controller or the message is for
+// one of the subscribed controllers.
+func (sub *subscriber) matches(controller uint32) bool {
+	return len(sub.controllers) == 0 || slices.Contains(sub.controllers, controller)
+}
+
+// publish queues a message for all the matching subscribers, dropping the message for a
+// subscriber that is not keeping up.
+func (h *httpd) publish(id uint32, message []byte) {
+	controller := uint32(0)
+	if len(message) >= 8 {
+		controller = binary.LittleEndian.Uint32(message[4:8])
+	}
+
+	for _, sub := range h.subscribers.list() {
+		if sub.matches(controller) {
+			select {
+			case sub.ch <- protocol.Message{ID: id, Message: message}:
+			default:
+				h.Warnf("event %v dropped for subscriber %v (queue full)", id, sub.remote)
+			}
+		}
+	}
+}
+
+func (h *httpd) events(w http.ResponseWriter, r *http.Request) {
+	if !h.subscribed(w, r) {
+		return
+	}
+
+	sub := subscriber{
+		remote: r.RemoteAddr,
+		ch:     make(chan protocol.Message, SUBSCRIBER_QUEUE),
+	}
+
+	for _, v := range r.URL.Query()["controller"] {
+		for _, s := range strings.Split(v, ",") {
+			if controller, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32); err != nil || controller == 0 {
+				fail(w, ERR_INVALID_REQUEST, fmt.Sprintf("Invalid controller ID (%v)", s))
+				return
+			} else {
+				sub.controllers = append(sub.controllers, uint32(controller))
+			}
+		}
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "raw":
+		sub.decode = false
+
+	case "json":
+		sub.decode = true
+
+	default:
+		fail(w, ERR_INVALID_REQUEST, fmt.Sprintf("Invalid event format (%v)", format))
+		return
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		h.websocket(w, r, &sub)
+	} else {
+		h.sse(w, r, &sub)
+	}
+}
+
+// sse streams the events to the subscriber as Server-Sent Events.
+func (h *httpd) sse(w http.ResponseWriter, r *http.Request, sub *subscriber) {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		h.Warnf("%v", err)
+		return
+	}
+
+	h.subscribers.add(sub)
+	defer h.subscribers.remove(sub)
+
+	h.Infof("SSE subscriber %v connected", sub.remote)
+	defer h.Infof("SSE subscriber %v disconnected", sub.remote)
+
+	keepalive := time.NewTicker(KEEPALIVE_INTERVAL)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case msg := <-sub.ch:
+			if b, err := h.encode(msg, sub.decode); err != nil {
+				h.Warnf("%v", err)
+			} else if _, err := fmt.Fprintf(w, "id: %v\nevent: event\ndata: %s\n\n", msg.ID, b); err != nil {
+				h.Warnf("%v", err)
+				return
+			} else if err := rc.Flush(); err != nil {
+				h.Warnf("%v", err)
+				return
+			}
+
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			} else if err := rc.Flush(); err != nil {
+				return
+			}
+
+		case <-r.Context().Done():
+			return
+
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// websocket streams the events to the subscriber as WebSocket text messages.
+func (h *httpd) websocket(w http.ResponseWriter, r *http.Request, sub *subscriber) {
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		h.Warnf("%v", err)
+		return
+	}
+
+	defer ws.CloseNow()
+
+	h.subscribers.add(sub)
+	defer h.subscribers.remove(sub)
+
+	h.Infof("WebSocket subscriber %v connected", sub.remote)
+	defer h.Infof("WebSocket subscriber %v disconnected", sub.remote)
+
+	// ... subscribers don't send anything but the connection still needs to process control frames
+	ctx := ws.CloseRead(h.ctx)
+
+	for {
+		select {
+		case msg := <-sub.ch:
+			if b, err := h.encode(msg, sub.decode); err != nil {
+				h.Warnf("%v", err)
+			} else if err := h.write(ctx, ws, b); err != nil {
+				h.Warnf("%v", err)
+				return
+			}
+
+		case <-ctx.Done():
+			if h.ctx.Err() != nil {
+				ws.Close(websocket.StatusGoingAway, "closing")
+			}
+			return
+		}
+	}
+}
+
+func (h *httpd) write(ctx context.Context, ws *websocket.Conn, b []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return ws.Write(ctx, websocket.MessageText, b)
+}
+
+// encode returns the JSON representation of a published message. Events are decoded to a JSON
+// status record if requested, with any other messages published as the raw message bytes.
+func (h *httpd) encode(msg protocol.Message, decode bool) ([]byte, error) {
+	p := published{
+		ID:      msg.ID,
+		Message: msg.Message,
+	}
+
+	if len(msg.Message) >= 8 {
+		p.Controller = binary.LittleEndian.Uint32(msg.Message[4:8])
+	}
+
+	if decode {
+		event := messages.GetStatusResponse{}
+		if err := codec.Unmarshal(msg.Message, &event); err == nil {
+			status := toStatus(event)
+
+			p.Message = nil
+			p.Event = &status
+		}
+	}
+
+	return json.Marshal(p)
+}
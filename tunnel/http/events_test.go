@@ -0,0 +1,168 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestEventsWithSlowSubscriber(t *testing.T) {
+	const N = 4 * SUBSCRIBER_QUEUE
+
+	tests := []struct {
+		name      string
+		subscribe func(context.Context, *testing.T, string) <-chan published
+	}{
+		{"sse", sse},
+		{"websocket", ws},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			addr := fmt.Sprintf("127.0.0.1:%v", loopback.TCPPort(t))
+
+			h, err := NewHTTP(addr, t.TempDir(), nil, 0, conn.NewBackoff(-1, time.Second, ctx), ctx)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			s := loopback.Sink(t)
+
+			defer func() {
+				cancel()
+				h.Close()
+			}()
+
+			go h.Run(s)
+
+			loopback.Listening(t, addr)
+
+			// ... a subscriber that never reads its queue
+			slow := subscriber{
+				remote: "slow",
+				ch:     make(chan protocol.Message, SUBSCRIBER_QUEUE),
+			}
+
+			h.subscribers.add(&slow)
+
+			events := test.subscribe(ctx, t, addr)
+
+			loopback.Until(t, func() bool {
+				return len(h.subscribers.list()) == 2
+			})
+
+			for i := range N {
+				id := uint32(1000 + i)
+				start := time.Now()
+
+				h.Send(id, statusEvent(405419896, uint32(i)))
+
+				if dt := time.Since(start); dt > 100*time.Millisecond {
+					t.Fatalf("event %v: publish blocked by slow subscriber (%v)", id, dt)
+				}
+
+				select {
+				case e := <-events:
+					if e.ID != id || e.Controller != 405419896 {
+						t.Fatalf("incorrect event - expected:%v/%v, got:%v/%v", id, 405419896, e.ID, e.Controller)
+					}
+
+				case <-time.After(time.Second):
+					t.Fatalf("event %v not received", id)
+				}
+			}
+
+			if len(slow.ch) != SUBSCRIBER_QUEUE {
+				t.Errorf("incorrect slow subscriber queue - expected:%v, got:%v", SUBSCRIBER_QUEUE, len(slow.ch))
+			} else if msg := <-slow.ch; msg.ID != 1000 {
+				t.Errorf("incorrect first event for slow subscriber - expected:%v, got:%v", 1000, msg.ID)
+			}
+		})
+	}
+}
+
+// sse subscribes to /events as a Server-Sent Events client.
+func sse(ctx context.Context, t *testing.T, addr string) <-chan published {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/events", nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	response, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		t.Fatalf("%v", err)
+	} else if response.StatusCode != http.StatusOK {
+		t.Fatalf("incorrect status - expected:%v, got:%v", http.StatusOK, response.StatusCode)
+	}
+
+	ch := make(chan published, 1)
+
+	go func() {
+		defer response.Body.Close()
+
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				e := published{}
+				if err := json.Unmarshal([]byte(data), &e); err == nil {
+					ch <- e
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+// ws subscribes to /events as a WebSocket client.
+func ws(ctx context.Context, t *testing.T, addr string) <-chan published {
+	socket, _, err := websocket.Dial(ctx, "ws://"+addr+"/events", nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ch := make(chan published, 1)
+
+	go func() {
+		defer socket.CloseNow()
+
+		for {
+			_, b, err := socket.Read(ctx)
+			if err != nil {
+				return
+			}
+
+			e := published{}
+			if err := json.Unmarshal(b, &e); err == nil {
+				ch <- e
+			}
+		}
+	}()
+
+	return ch
+}
+
+// statusEvent returns a controller status event message.
+func statusEvent(controller uint32, index uint32) []byte {
+	message := make([]byte, 64)
+	message[0] = 0x17
+	message[1] = 0x20
+
+	binary.LittleEndian.PutUint32(message[4:], controller)
+	binary.LittleEndian.PutUint32(message[8:], index)
+
+	return message
+}
@@ -19,13 +19,16 @@ import (
 
 type httpd struct {
 	conn.Conn
-	addr    *net.TCPAddr
-	retry   conn.Backoff
-	timeout time.Duration
-	fs      filesystem
-	ctx     context.Context
-	ch      chan protocol.Message
-	closed  chan struct{}
+	addr        *net.TCPAddr
+	retry       conn.Backoff
+	timeout     time.Duration
+	fs          filesystem
+	auth        *Auth
+	concurrency int
+	ctx         context.Context
+	subscribers *subscribers
+	ch          chan protocol.Message
+	closed      chan struct{}
 }
 
 type slice []byte
@@ -59,7 +62,13 @@ func (d *duration) UnmarshalJSON(b []byte) (err error) {
 
 const GZIP_MINIMUM = 16384
 
-func NewHTTP(spec string, html string, retry conn.Backoff, ctx context.Context) (*httpd, error) {
+// READ_HEADER_TIMEOUT and IDLE_TIMEOUT limit how long a client can hold a connection open without
+// sending a request. There is deliberately no write timeout because the broadcast requests and
+// the event stream responses are open for as long as the client waits.
+const READ_HEADER_TIMEOUT = 10 * time.Second
+const IDLE_TIMEOUT = 60 * time.Second
+
+func NewHTTP(spec string, html string, auth *Auth, concurrency int, retry conn.Backoff, ctx context.Context) (*httpd, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 	if err != nil {
 		return nil, err
@@ -69,6 +78,10 @@ func NewHTTP(spec string, html string, retry conn.Backoff, ctx context.Context)
 		return nil, fmt.Errorf("unable to resolve HTTP base address '%v'", spec)
 	}
 
+	if concurrency < 1 {
+		concurrency = BATCH_CONCURRENCY
+	}
+
 	fs := filesystem{
 		FileSystem: http.FS(os.DirFS(html)),
 	}
@@ -77,13 +90,16 @@ func NewHTTP(spec string, html string, retry conn.Backoff, ctx context.Context)
 		Conn: conn.Conn{
 			Tag: "HTTP",
 		},
-		addr:    addr,
-		retry:   retry,
-		timeout: 5 * time.Second,
-		fs:      fs,
-		ctx:     ctx,
-		ch:      make(chan protocol.Message, 16),
-		closed:  make(chan struct{}),
+		addr:        addr,
+		retry:       retry,
+		timeout:     5 * time.Second,
+		fs:          fs,
+		auth:        auth,
+		concurrency: concurrency,
+		ctx:         ctx,
+		subscribers: smake(),
+		ch:          make(chan protocol.Message, 16),
+		closed:      make(chan struct{}),
 	}
 
 	return &h, nil
@@ -103,15 +119,13 @@ func (h *httpd) Close() {
 }
 
 func (h *httpd) Run(router *router.Switch) error {
-	mux := http.NewServeMux()
-
-	mux.Handle("/", http.FileServer(h.fs))
-	mux.HandleFunc("/udp/broadcast", func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) })
-	mux.HandleFunc("/udp/send", func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) })
+	mux := h.mux(router)
 
 	srv := &http.Server{
-		Addr:    fmt.Sprintf("%v", h.addr),
-		Handler: mux,
+		Addr:              fmt.Sprintf("%v", h.addr),
+		Handler:           mux,
+		ReadHeaderTimeout: READ_HEADER_TIMEOUT,
+		IdleTimeout:       IDLE_TIMEOUT,
 	}
 
 	closing := false
@@ -151,6 +165,25 @@ func (h *httpd) Run(router *router.Switch) error {
 }
 
 func (h *httpd) Send(id uint32, msg []byte) {
+	h.Dumpf(msg, "event %v  %v bytes", id, len(msg))
+
+	h.publish(id, msg)
+}
+
+func (h *httpd) mux(router *router.Switch) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.Handle("/", http.FileServer(h.fs))
+	mux.HandleFunc("/udp/broadcast", h.authenticated(func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) }))
+	mux.HandleFunc("/udp/send", h.authenticated(func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) }))
+	mux.HandleFunc("/udp/batch", h.authenticated(func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) }))
+
+	mux.HandleFunc("GET /events", h.authenticated(h.events))
+	mux.HandleFunc("GET /openapi.json", h.openapi)
+
+	h.api(mux, router)
+
+	return mux
 }
 
 func (h *httpd) dispatch(w http.ResponseWriter, r *http.Request, router *router.Switch) {
@@ -161,8 +194,12 @@ func (h *httpd) dispatch(w http.ResponseWriter, r *http.Request, router *router.
 	case strings.ToUpper(r.Method) == http.MethodPost && r.URL.Path == "/udp/send":
 		h.send(w, r, router)
 
+	case strings.ToUpper(r.Method) == http.MethodPost && r.URL.Path == "/udp/batch":
+		h.batch(w, r, router)
+
 	default:
-		http.Error(w, "Invalid request", http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", http.MethodPost)
+		fail(w, ERR_METHOD_NOT_ALLOWED, fmt.Sprintf("Invalid request method (%v)", r.Method))
 	}
 }
 
@@ -200,19 +237,23 @@ func (h *httpd) broadcast(w http.ResponseWriter, r *http.Request, router *router
 		blob, err := io.ReadAll(r.Body)
 		if err != nil {
 			h.Warnf("%v", err)
-			http.Error(w, "Error reading request", http.StatusInternalServerError)
+			fail(w, ERR_INTERNAL, "Error reading request")
 			return
 		}
 
 		if err := json.Unmarshal(blob, &body); err != nil {
 			h.Warnf("%v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			fail(w, ERR_INVALID_REQUEST, "Invalid request body")
 			return
 		}
 
 	default:
 		h.Warnf("%v", fmt.Errorf("invalid request content-type (%v)", contentType))
-		http.Error(w, fmt.Sprintf("Invalid request content-type (%v)", contentType), http.StatusBadRequest)
+		fail(w, ERR_INVALID_CONTENT_TYPE, fmt.Sprintf("Invalid request content-type (%v)", contentType))
+		return
+	}
+
+	if !h.authorised(w, r, body.Request) {
 		return
 	}
 
@@ -227,7 +268,11 @@ func (h *httpd) broadcast(w http.ResponseWriter, r *http.Request, router *router
 
 	h.Dumpf(body.Request, "request %v  %v bytes from %v", id, len(body.Request), r.RemoteAddr)
 
-	router.Received(id, body.Request, func(reply []byte) { received <- reply })
+	if err := router.Accept(id, body.Request, func(reply []byte) { received <- reply }); err != nil {
+		h.Warnf("request %v: %v", id, err)
+		fail(w, errcode(err), fmt.Sprintf("Request not relayed (%v)", err))
+		return
+	}
 
 	for {
 		select {
@@ -237,7 +282,11 @@ func (h *httpd) broadcast(w http.ResponseWriter, r *http.Request, router *router
 
 		case <-ctx.Done():
 			h.Warnf("%v", ctx.Err())
-			http.Error(w, "Request cancelled", http.StatusInternalServerError)
+			if code := errcode(ctx.Err()); code == ERR_TIMEOUT {
+				fail(w, code, "Timeout waiting for reply")
+			} else {
+				fail(w, code, "Request cancelled")
+			}
 			return
 
 		case <-waited:
@@ -289,19 +338,23 @@ func (h *httpd) send(w http.ResponseWriter, r *http.Request, router *router.Swit
 		blob, err := io.ReadAll(r.Body)
 		if err != nil {
 			h.Warnf("%v", err)
-			http.Error(w, "Error reading request", http.StatusInternalServerError)
+			fail(w, ERR_INTERNAL, "Error reading request")
 			return
 		}
 
 		if err := json.Unmarshal(blob, &body); err != nil {
 			h.Warnf("%v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			fail(w, ERR_INVALID_REQUEST, "Invalid request body")
 			return
 		}
 
 	default:
 		h.Warnf("%v", fmt.Errorf("invalid request content-type (%v)", contentType))
-		http.Error(w, fmt.Sprintf("Invalid request content-type (%v)", contentType), http.StatusBadRequest)
+		fail(w, ERR_INVALID_CONTENT_TYPE, fmt.Sprintf("Invalid request content-type (%v)", contentType))
+		return
+	}
+
+	if !h.authorised(w, r, body.Request) {
 		return
 	}
 
@@ -314,7 +367,11 @@ func (h *httpd) send(w http.ResponseWriter, r *http.Request, router *router.Swit
 
 	// ... set-ip request does not expect a response
 	if !body.Wait {
-		router.Received(id, body.Request, func(reply []byte) {})
+		if err := router.Accept(id, body.Request, func(reply []byte) {}); err != nil {
+			h.Warnf("request %v: %v", id, err)
+			fail(w, errcode(err), fmt.Sprintf("Request not relayed (%v)", err))
+			return
+		}
 
 		response := struct {
 			ID int `json:"ID"`
@@ -329,7 +386,11 @@ func (h *httpd) send(w http.ResponseWriter, r *http.Request, router *router.Swit
 	// ... normal request/response
 	received := make(chan []byte)
 
-	router.Received(id, body.Request, func(reply []byte) { received <- reply })
+	if err := router.Accept(id, body.Request, func(reply []byte) { received <- reply }); err != nil {
+		h.Warnf("request %v: %v", id, err)
+		fail(w, errcode(err), fmt.Sprintf("Request not relayed (%v)", err))
+		return
+	}
 
 	for {
 		select {
@@ -349,7 +410,11 @@ func (h *httpd) send(w http.ResponseWriter, r *http.Request, router *router.Swit
 
 		case <-ctx.Done():
 			h.Warnf("%v", ctx.Err())
-			http.Error(w, "Request cancelled", http.StatusInternalServerError)
+			if code := errcode(ctx.Err()); code == ERR_TIMEOUT {
+				fail(w, code, "Timeout waiting for reply")
+			} else {
+				fail(w, code, "Request cancelled")
+			}
 			return
 		}
 	}
@@ -358,7 +423,7 @@ func (h *httpd) send(w http.ResponseWriter, r *http.Request, router *router.Swit
 func (h *httpd) reply(response any, w http.ResponseWriter, acceptsGzip bool) {
 	if b, err := json.Marshal(response); err != nil {
 		h.Warnf("%v", err)
-		http.Error(w, "Internal error generating response", http.StatusInternalServerError)
+		fail(w, ERR_INTERNAL, "Internal error generating response")
 	} else {
 		w.Header().Set("Content-Type", "application/json")
 
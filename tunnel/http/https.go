@@ -20,7 +20,7 @@ type https struct {
 	TLS *tls.Config
 }
 
-func NewHTTPS(spec string, html string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, ctx context.Context) (*https, error) {
+func NewHTTPS(spec string, html string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, auth *Auth, concurrency int, retry conn.Backoff, ctx context.Context) (*https, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 	if err != nil {
 		return nil, err
@@ -30,6 +30,10 @@ func NewHTTPS(spec string, html string, ca *x509.CertPool, keypair tls.Certifica
 		return nil, fmt.Errorf("unable to resolve HTTPS base address '%v'", spec)
 	}
 
+	if concurrency < 1 {
+		concurrency = BATCH_CONCURRENCY
+	}
+
 	fs := filesystem{
 		FileSystem: http.FS(os.DirFS(html)),
 	}
@@ -56,13 +60,16 @@ func NewHTTPS(spec string, html string, ca *x509.CertPool, keypair tls.Certifica
 			Conn: conn.Conn{
 				Tag: "HTTPS",
 			},
-			addr:    addr,
-			retry:   retry,
-			timeout: 5 * time.Second,
-			fs:      fs,
-			ctx:     ctx,
-			ch:      make(chan protocol.Message, 16),
-			closed:  make(chan struct{}),
+			addr:        addr,
+			retry:       retry,
+			timeout:     5 * time.Second,
+			fs:          fs,
+			auth:        auth,
+			concurrency: concurrency,
+			ctx:         ctx,
+			subscribers: smake(),
+			ch:          make(chan protocol.Message, 16),
+			closed:      make(chan struct{}),
 		},
 		TLS: &config,
 	}
@@ -71,16 +78,14 @@ func NewHTTPS(spec string, html string, ca *x509.CertPool, keypair tls.Certifica
 }
 
 func (h *https) Run(router *router.Switch) error {
-	mux := http.NewServeMux()
-
-	mux.Handle("/", http.FileServer(h.fs))
-	mux.HandleFunc("/udp/broadcast", func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) })
-	mux.HandleFunc("/udp/send", func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) })
+	mux := h.mux(router)
 
 	srv := &http.Server{
-		Addr:      fmt.Sprintf("%v", h.addr),
-		TLSConfig: h.TLS,
-		Handler:   mux,
+		Addr:              fmt.Sprintf("%v", h.addr),
+		TLSConfig:         h.TLS,
+		Handler:           mux,
+		ReadHeaderTimeout: READ_HEADER_TIMEOUT,
+		IdleTimeout:       IDLE_TIMEOUT,
 	}
 
 	closing := false
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwks is the set of public keys loaded from a local JSON Web Key Set file (RFC 7517), indexed by
+// key ID. Only the RSA, EC (P-256, P-384 and P-521) and OKP (Ed25519) signing keys are loaded.
+type jwks map[string]crypto.PublicKey
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func loadJWKS(file string) (jwks, error) {
+	if file == "" {
+		return nil, fmt.Errorf("missing JWKS file")
+	}
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(bytes, &set); err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+
+	keys := jwks{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		if key, err := k.publicKey(); err != nil {
+			return nil, fmt.Errorf("%v: key '%v': %w", file, k.KeyID, err)
+		} else {
+			keys[k.KeyID] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%v: no signing keys", file)
+	}
+
+	return keys, nil
+}
+
+// key is the jwt.Keyfunc that returns the JWKS key matching the JWT 'kid' header. A JWT without
+// a key ID is only accepted if the key set has a single key.
+func (k jwks) key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if key, ok := k[kid]; ok {
+		return key, nil
+	}
+
+	if kid == "" && len(k) == 1 {
+		for _, key := range k {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown signing key '%v'", kid)
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.KeyType {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus (%w)", err)
+		}
+
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent (%w)", err)
+		}
+
+		if len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve '%v'", k.Curve)
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate (%w)", err)
+		}
+
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate (%w)", err)
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("invalid EC key size")
+		}
+
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{0x04}, x...), y...))
+
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve '%v'", k.Curve)
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ed25519 key (%w)", err)
+		} else if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type '%v'", k.KeyType)
+	}
+}
@@ -0,0 +1,276 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const ISSUER = "https://auth.example.com"
+const AUDIENCE = "uhppoted-tunnel"
+
+type keys struct {
+	ed25519 ed25519.PrivateKey
+	rsa     *rsa.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+}
+
+func TestJWT(t *testing.T) {
+	k := generate(t)
+	auth := newAuth(t, fmt.Sprintf("[jwt]\njwks = %q\nissuer = %q\naudience = %q\n%v", writeJWKS(t, k), ISSUER, AUDIENCE, ROLES))
+
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Now()
+
+	claims := func(f func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub":   "qwerty",
+			"iss":   ISSUER,
+			"aud":   AUDIENCE,
+			"exp":   now.Add(time.Hour).Unix(),
+			"roles": []string{"read-only", "cards"},
+		}
+
+		if f != nil {
+			f(c)
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		roles  []string
+		reject bool
+	}{
+		{"EdDSA", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(nil)), []string{"read-only", "cards"}, false},
+		{"RS256", sign(t, jwt.SigningMethodRS256, "k2", k.rsa, claims(nil)), []string{"read-only", "cards"}, false},
+		{"ES256", sign(t, jwt.SigningMethodES256, "k3", k.ecdsa, claims(nil)), []string{"read-only", "cards"}, false},
+		{"roles as string", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { c["roles"] = "admin read-only" })), []string{"admin", "read-only"}, false},
+		{"roles as array", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { c["roles"] = []any{"admin", 12345} })), []string{"admin"}, false},
+		{"missing roles", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { delete(c, "roles") })), nil, false},
+		{"HS256", sign(t, jwt.SigningMethodHS256, "k1", []byte("0123456789abcdef0123456789abcdef"), claims(nil)), nil, true},
+		{"alg none", sign(t, jwt.SigningMethodNone, "k1", jwt.UnsafeAllowNoneSignatureType, claims(nil)), nil, true},
+		{"unknown kid", sign(t, jwt.SigningMethodEdDSA, "k9", k.ed25519, claims(nil)), nil, true},
+		{"missing kid", sign(t, jwt.SigningMethodEdDSA, "", k.ed25519, claims(nil)), nil, true},
+		{"wrong key", sign(t, jwt.SigningMethodEdDSA, "k1", other, claims(nil)), nil, true},
+		{"key for other alg", sign(t, jwt.SigningMethodEdDSA, "k2", k.ed25519, claims(nil)), nil, true},
+		{"expired", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() })), nil, true},
+		{"missing exp", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { delete(c, "exp") })), nil, true},
+		{"not yet valid", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Hour).Unix() })), nil, true},
+		{"wrong iss", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { c["iss"] = "https://example.com" })), nil, true},
+		{"missing iss", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { delete(c, "iss") })), nil, true},
+		{"wrong aud", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { c["aud"] = []string{"uhppoted-rest"} })), nil, true},
+		{"missing aud", sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, claims(func(c jwt.MapClaims) { delete(c, "aud") })), nil, true},
+		{"malformed", "qwerty.uiop.asdf", nil, true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/udp/send", nil)
+		r.Header.Set("Authorization", "Bearer "+test.token)
+
+		p, err := auth.authenticate(r)
+
+		switch {
+		case test.reject && err == nil:
+			t.Errorf("%v: expected JWT to be rejected", test.name)
+
+		case test.reject && !errors.Is(err, ErrUnauthorized):
+			t.Errorf("%v: incorrect error - expected:%v, got:%v", test.name, ErrUnauthorized, err)
+
+		case !test.reject && err != nil:
+			t.Errorf("%v: unexpected error (%v)", test.name, err)
+
+		case !test.reject && p.name != "qwerty":
+			t.Errorf("%v: incorrect principal - expected:%v, got:%v", test.name, "qwerty", p.name)
+
+		case !test.reject && fmt.Sprintf("%v", p.roles) != fmt.Sprintf("%v", test.roles):
+			t.Errorf("%v: incorrect roles - expected:%v, got:%v", test.name, test.roles, p.roles)
+		}
+	}
+}
+
+func TestJWTCustomClaim(t *testing.T) {
+	k := generate(t)
+	auth := newAuth(t, fmt.Sprintf("[jwt]\njwks = %q\nclaim = \"groups\"\n%v", writeJWKS(t, k), ROLES))
+
+	token := sign(t, jwt.SigningMethodEdDSA, "k1", k.ed25519, jwt.MapClaims{
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"roles":  []string{"admin"},
+		"groups": []string{"cards"},
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/udp/send", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	if p, err := auth.authenticate(r); err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	} else if p.name != "jwt" || fmt.Sprintf("%v", p.roles) != "[cards]" {
+		t.Errorf("incorrect principal - expected:%v %v, got:%v %v", "jwt", "[cards]", p.name, p.roles)
+	}
+}
+
+func TestJWKSKeyWithoutKeyID(t *testing.T) {
+	k := generate(t)
+	token := &jwt.Token{Header: map[string]any{}}
+
+	single := jwks{"k1": k.ed25519.Public()}
+	multiple := jwks{"k1": k.ed25519.Public(), "k2": &k.rsa.PublicKey}
+
+	if key, err := single.key(token); err != nil || key == nil {
+		t.Errorf("expected single key for JWT without 'kid' - got:%v, error:%v", key, err)
+	}
+
+	if _, err := multiple.key(token); err == nil {
+		t.Errorf("expected error for JWT without 'kid' and multiple keys")
+	}
+}
+
+func TestLoadJWKS(t *testing.T) {
+	k := generate(t)
+	b64 := base64.RawURLEncoding.EncodeToString
+	x := b64(k.ed25519.Public().(ed25519.PublicKey))
+
+	tests := []struct {
+		name string
+		jwks string
+		keys int
+		err  string
+	}{
+		{"valid", string(jwksJSON(t, k)), 3, ""},
+		{"encryption keys", fmt.Sprintf(`{"keys":[{"kty":"OKP","kid":"k1","use":"sig","crv":"Ed25519","x":%q},{"kty":"OKP","kid":"k2","use":"enc","crv":"Ed25519","x":%q}]}`, x, x), 1, ""},
+		{"no signing keys", fmt.Sprintf(`{"keys":[{"kty":"OKP","kid":"k1","use":"enc","crv":"Ed25519","x":%q}]}`, x), 0, "no signing keys"},
+		{"unsupported key type", `{"keys":[{"kty":"oct","kid":"k1","k":"qwerty"}]}`, 0, "unsupported key type 'oct'"},
+		{"unsupported EC curve", `{"keys":[{"kty":"EC","kid":"k1","crv":"P-192","x":"AA","y":"AA"}]}`, 0, "unsupported EC curve"},
+		{"invalid EC key size", `{"keys":[{"kty":"EC","kid":"k1","crv":"P-256","x":"AAAA","y":"AAAA"}]}`, 0, "invalid EC key size"},
+		{"invalid EC point", fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k1","crv":"P-256","x":%q,"y":%q}]}`, b64(make([]byte, 32)), b64(make([]byte, 32))), 0, "key 'k1'"},
+		{"unsupported OKP curve", fmt.Sprintf(`{"keys":[{"kty":"OKP","kid":"k1","crv":"X25519","x":%q}]}`, x), 0, "unsupported OKP curve"},
+		{"invalid Ed25519 key size", `{"keys":[{"kty":"OKP","kid":"k1","crv":"Ed25519","x":"AAAA"}]}`, 0, "invalid Ed25519 key size"},
+		{"invalid RSA modulus", `{"keys":[{"kty":"RSA","kid":"k1","n":"!!!","e":"AQAB"}]}`, 0, "invalid RSA modulus"},
+		{"invalid RSA exponent", `{"keys":[{"kty":"RSA","kid":"k1","n":"AQAB","e":"AQABAQAB"}]}`, 0, "invalid RSA exponent"},
+		{"invalid JSON", `{"keys":[`, 0, "unexpected end of JSON input"},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join(t.TempDir(), "jwks.json")
+		if err := os.WriteFile(file, []byte(test.jwks), 0600); err != nil {
+			t.Fatalf("error writing JWKS file (%v)", err)
+		}
+
+		keys, err := loadJWKS(file)
+
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%v: unexpected error (%v)", test.name, err)
+
+		case test.err == "" && len(keys) != test.keys:
+			t.Errorf("%v: incorrect number of keys - expected:%v, got:%v", test.name, test.keys, len(keys))
+
+		case test.err != "" && err == nil:
+			t.Errorf("%v: expected error '%v'", test.name, test.err)
+
+		case test.err != "" && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%v: incorrect error - expected:'%v', got:'%v'", test.name, test.err, err)
+		}
+	}
+
+	if _, err := loadJWKS(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("expected error loading missing JWKS file")
+	}
+}
+
+func generate(t *testing.T) keys {
+	t.Helper()
+
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating Ed25519 key (%v)", err)
+	}
+
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating RSA key (%v)", err)
+	}
+
+	eckey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating EC key (%v)", err)
+	}
+
+	return keys{
+		ed25519: ed,
+		rsa:     rsakey,
+		ecdsa:   eckey,
+	}
+}
+
+// jwksJSON returns the JWKS for the public keys, with key IDs k1 (Ed25519), k2 (RSA) and k3 (EC).
+func jwksJSON(t *testing.T, k keys) []byte {
+	t.Helper()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	point, err := k.ecdsa.PublicKey.Bytes()
+	if err != nil {
+		t.Fatalf("error encoding EC public key (%v)", err)
+	}
+
+	set := map[string]any{
+		"keys": []map[string]string{
+			{"kty": "OKP", "kid": "k1", "use": "sig", "crv": "Ed25519", "x": b64(k.ed25519.Public().(ed25519.PublicKey))},
+			{"kty": "RSA", "kid": "k2", "n": b64(k.rsa.N.Bytes()), "e": b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+			{"kty": "EC", "kid": "k3", "crv": "P-256", "x": b64(point[1:33]), "y": b64(point[33:])},
+		},
+	}
+
+	bytes, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("error encoding JWKS (%v)", err)
+	}
+
+	return bytes
+}
+
+func writeJWKS(t *testing.T, k keys) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, jwksJSON(t, k), 0600); err != nil {
+		t.Fatalf("error writing JWKS file (%v)", err)
+	}
+
+	return file
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("error signing JWT (%v)", err)
+	}
+
+	return signed
+}
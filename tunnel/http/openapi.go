@@ -0,0 +1,19 @@
+package http
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// The OpenAPI 3 description of the HTTP connector endpoints is published (without authentication)
+// at /openapi.json, for use with e.g. Swagger UI or client code generators.
+
+//go:embed openapi.json
+var openapiJSON []byte
+
+func (h *httpd) openapi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	w.Write(openapiJSON)
+}
@@ -0,0 +1,251 @@
+// Package loopback implements the fixtures shared by the connector tests, which run a pair of
+// connectors against each other over the loopback interface.
+package loopback
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// TIMEOUT is the time allowed for a connection, reply or event before a test fails.
+const TIMEOUT = 2 * time.Second
+
+// REQUEST is the request relayed by the round trip tests (a get-status request).
+var REQUEST = []byte{0x17, 0x94, 0x00, 0x00}
+
+// EVENT is the event relayed by the event tests.
+var EVENT = []byte{0x17, 0x20, 0x00, 0x00}
+
+// HEARTBEAT is a heartbeat that closes a connection within a fraction of TIMEOUT if the
+// remote end stops answering.
+var HEARTBEAT = conn.Heartbeat{Interval: 50 * time.Millisecond, Misses: 2}
+
+// Echo returns a switch that replies to each request with the request. The router is closed
+// when the test completes.
+func Echo(t *testing.T) *router.Switch {
+	return NewSwitch(t, func(id uint32, message []byte, h func([]byte)) {
+		if h != nil {
+			h(message)
+		}
+	})
+}
+
+// Sink returns a switch that discards everything except replies. The router is closed when
+// the test completes.
+func Sink(t *testing.T) *router.Switch {
+	return NewSwitch(t, func(id uint32, message []byte, h func([]byte)) {})
+}
+
+// Events returns a switch that relays the events received by a connector to the returned
+// channel. The router is closed when the test completes.
+func Events(t *testing.T) (*router.Switch, <-chan protocol.Message) {
+	events := make(chan protocol.Message, 64)
+	s := NewSwitch(t, func(id uint32, message []byte, h func([]byte)) {
+		if h == nil {
+			events <- protocol.Message{ID: id, Message: message}
+		}
+	})
+
+	return s, events
+}
+
+// NewSwitch returns a switch for the relay function on a router that is closed when the test
+// completes.
+func NewSwitch(t *testing.T, relay func(uint32, []byte, func([]byte))) *router.Switch {
+	r := router.NewRouter("", rate.NewLimiter(rate.Inf, 0))
+
+	t.Cleanup(r.Close)
+
+	return r.NewSwitch(relay)
+}
+
+// RoundTrip sends REQUEST with the send function and fails the test unless it is echoed back
+// to the switch within TIMEOUT.
+func RoundTrip(t *testing.T, s *router.Switch, send func(uint32, []byte)) {
+	t.Helper()
+
+	replies := make(chan []byte, 1)
+	s.Expect(12345, func(reply []byte) {
+		select {
+		case replies <- reply:
+		default:
+		}
+	})
+
+	send(12345, REQUEST)
+
+	select {
+	case reply := <-replies:
+		if string(reply) != string(REQUEST) {
+			t.Errorf("incorrect reply - expected:%v, got:%v", REQUEST, reply)
+		}
+
+	case <-time.After(TIMEOUT):
+		t.Errorf("no reply")
+	}
+}
+
+// Received fails the test unless the events with the IDs are received in order within TIMEOUT.
+func Received(t *testing.T, events <-chan protocol.Message, ids ...uint32) {
+	t.Helper()
+
+	timeout := time.After(TIMEOUT)
+
+	for _, id := range ids {
+		select {
+		case event := <-events:
+			if event.ID != id {
+				t.Fatalf("incorrect event - expected:%v, got:%v", id, event.ID)
+			} else if string(event.Message) != string(EVENT) {
+				t.Fatalf("incorrect event %v - expected:%v, got:%v", id, EVENT, event.Message)
+			}
+
+		case <-timeout:
+			t.Fatalf("timeout waiting for event %v", id)
+		}
+	}
+}
+
+// Frames decodes the frames received on a connection and relays them to the returned channel
+// until the connection is closed.
+func Frames(socket net.Conn) <-chan protocol.Frame {
+	frames := make(chan protocol.Frame, 64)
+
+	go func() {
+		stream := protocol.NewStream()
+		buffer := make([]byte, 2048)
+
+		for {
+			N, err := socket.Read(buffer)
+			if err != nil {
+				return
+			}
+
+			decoded, _ := stream.Decode(buffer[:N])
+			for _, frame := range decoded {
+				frames <- frame
+			}
+		}
+	}()
+
+	return frames
+}
+
+// Reply fails the test unless a DATA frame with the ID and REQUEST is received within TIMEOUT.
+func Reply(t *testing.T, frames <-chan protocol.Frame, id uint32) {
+	t.Helper()
+
+	timeout := time.After(TIMEOUT)
+
+	for {
+		select {
+		case frame := <-frames:
+			if frame.Type == protocol.DATA && frame.ID == id {
+				if string(frame.Message) != string(REQUEST) {
+					t.Errorf("incorrect reply - expected:%v, got:%v", REQUEST, frame.Message)
+				}
+
+				return
+			}
+
+		case <-timeout:
+			t.Fatalf("no reply")
+		}
+	}
+}
+
+// Queue returns an unbounded event queue in a temporary directory.
+func Queue(t *testing.T) *conn.Queue {
+	t.Helper()
+
+	queue, err := conn.NewQueue(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return queue
+}
+
+// TCPPort returns an unused local TCP port.
+func TCPPort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// UDPPort returns an unused local UDP port.
+func UDPPort(t *testing.T) int {
+	t.Helper()
+
+	socket, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer socket.Close()
+
+	return socket.LocalAddr().(*net.UDPAddr).Port
+}
+
+// Listening waits for a server to start listening on the TCP address.
+func Listening(t *testing.T, addr string) {
+	t.Helper()
+
+	Until(t, func() bool {
+		socket, err := net.Dial("tcp", addr)
+		if err == nil {
+			socket.Close()
+		}
+
+		return err == nil
+	})
+}
+
+// Bound waits for a server to bind the UDP address.
+func Bound(t *testing.T, network string, addr string) {
+	t.Helper()
+
+	Until(t, func() bool {
+		socket, err := net.ListenPacket(network, addr)
+		if err == nil {
+			socket.Close()
+		}
+
+		return err != nil
+	})
+}
+
+// Until polls f until it returns true, failing the test if it is still false after TIMEOUT.
+func Until(t *testing.T, f func() bool) {
+	t.Helper()
+
+	wait(t, TIMEOUT, "connection", f)
+}
+
+// Steady fails the test if f returns false at any time during the interval.
+func Steady(t *testing.T, interval time.Duration, f func() bool) {
+	t.Helper()
+
+	timeout := time.Now().Add(interval)
+	for time.Now().Before(timeout) {
+		if !f() {
+			t.Fatalf("connection closed")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
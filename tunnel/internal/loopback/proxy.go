@@ -0,0 +1,192 @@
+package loopback
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Proxy relays the connections (or datagrams) between a client and a server connector, so that
+// a test can simulate a dead peer. A paused proxy discards everything it receives: the connections
+// stay open but neither end hears from the other, as for a half-open connection.
+type Proxy struct {
+	network string
+	addr    string
+	server  string
+	paused  atomic.Bool
+	closers []io.Closer
+	sync.Mutex
+}
+
+// NewProxy starts a proxy that relays connections to addr on the network ("tcp", "unix", "udp" or
+// "unixgram") to the server address. The proxy is closed when the test completes.
+func NewProxy(t *testing.T, network string, addr string, server string) *Proxy {
+	t.Helper()
+
+	p := Proxy{
+		network: network,
+		addr:    addr,
+		server:  server,
+	}
+
+	t.Cleanup(p.close)
+
+	switch network {
+	case "tcp", "unix":
+		listener, err := net.Listen(network, addr)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		p.add(listener)
+
+		go p.accept(listener)
+
+	case "udp", "unixgram":
+		socket, err := net.ListenPacket(network, addr)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		p.add(socket)
+
+		go p.relay(socket, t.TempDir())
+
+	default:
+		t.Fatalf("unsupported proxy network %v", network)
+	}
+
+	return &p
+}
+
+// Address returns the address on which the proxy accepts client connections.
+func (p *Proxy) Address() string {
+	return p.addr
+}
+
+// Pause stops relaying data between the client and the server.
+func (p *Proxy) Pause() {
+	p.paused.Store(true)
+}
+
+// Resume restarts relaying data between the client and the server.
+func (p *Proxy) Resume() {
+	p.paused.Store(false)
+}
+
+func (p *Proxy) add(c io.Closer) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.closers = append(p.closers, c)
+}
+
+func (p *Proxy) close() {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, c := range p.closers {
+		c.Close()
+	}
+}
+
+func (p *Proxy) accept(listener net.Listener) {
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		server, err := net.Dial(p.network, p.server)
+		if err != nil {
+			client.Close()
+			continue
+		}
+
+		p.add(client)
+		p.add(server)
+
+		go p.copy(client, server)
+		go p.copy(server, client)
+	}
+}
+
+func (p *Proxy) copy(dst net.Conn, src net.Conn) {
+	defer dst.Close()
+
+	buffer := make([]byte, 4096)
+
+	for {
+		N, err := src.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		if !p.paused.Load() {
+			if _, err := dst.Write(buffer[:N]); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// relay forwards the datagrams from each client address to the server from its own socket (bound
+// to a socket file in the directory for 'unixgram'), so that the server sees a separate peer for
+// each client.
+func (p *Proxy) relay(socket net.PacketConn, dir string) {
+	peers := map[string]net.Conn{}
+	buffer := make([]byte, 4096)
+
+	for {
+		N, addr, err := socket.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+
+		if p.paused.Load() {
+			continue
+		}
+
+		server, ok := peers[addr.String()]
+		if !ok {
+			if server, err = p.dial(dir, len(peers)); err != nil {
+				continue
+			}
+
+			peers[addr.String()] = server
+			p.add(server)
+
+			go func() {
+				reply := make([]byte, 4096)
+
+				for {
+					N, err := server.Read(reply)
+					if err != nil {
+						return
+					}
+
+					if !p.paused.Load() {
+						socket.WriteTo(reply[:N], addr)
+					}
+				}
+			}()
+		}
+
+		server.Write(buffer[:N])
+	}
+}
+
+func (p *Proxy) dial(dir string, peer int) (net.Conn, error) {
+	if p.network == "unixgram" {
+		local := net.UnixAddr{Net: "unixgram", Name: filepath.Join(dir, fmt.Sprintf("peer-%v.sock", peer))}
+		remote := net.UnixAddr{Net: "unixgram", Name: p.server}
+
+		return net.DialUnix("unixgram", &local, &remote)
+	}
+
+	return net.Dial(p.network, p.server)
+}
@@ -0,0 +1,277 @@
+package loopback
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// Connector is a tunnel connector under test.
+type Connector interface {
+	Run(*router.Switch) error
+	Send(uint32, []byte)
+	Close()
+}
+
+// Transport creates the connectors for the shared connector scenarios.
+//
+// Requests returns a server that relays requests to the client (i.e. a server-out/client-in pair)
+// and Events returns a client that relays events to the server (i.e. a client-event-out/
+// server-event-in pair). The client connects to the client address, which is either the server
+// address or the address of a proxy in front of the server.
+//
+// Connected returns the server end of the current client connection (nil if no client is
+// connected) and defaults to the first of the server sessions.
+type Transport struct {
+	Network   string
+	Requests  func(t *testing.T, server string, client string, ctx context.Context) (Connector, Connector)
+	Events    func(t *testing.T, server string, client string, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (Connector, Connector)
+	Connected func(server Connector) any
+}
+
+type sessions interface {
+	Sessions() []*conn.Session
+}
+
+var scenarios = []struct {
+	name string
+	run  func(*testing.T, Transport)
+}{
+	{"round trip", roundTrip},
+	{"event queue", eventQueue},
+	{"heartbeat", heartbeat},
+}
+
+// Scenarios runs the shared connector scenarios for a transport.
+func Scenarios(t *testing.T, transport Transport) {
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			scenario.run(t, transport)
+		})
+	}
+}
+
+// roundTrip relays a request from the server to the client and the reply back to the server.
+func roundTrip(t *testing.T, transport Transport) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := Address(t, transport.Network)
+	server, client := transport.Requests(t, addr, addr, ctx)
+
+	s1 := Echo(t)
+	s2 := Sink(t)
+
+	defer func() {
+		cancel()
+		client.Close()
+		server.Close()
+	}()
+
+	go server.Run(s2)
+
+	Ready(t, transport.Network, addr)
+
+	go client.Run(s1)
+
+	Until(t, func() bool {
+		return transport.connected(server) != nil
+	})
+
+	RoundTrip(t, s2, server.Send)
+}
+
+// eventQueue replays the events queued before the client connects, in order, and only removes
+// them from the queue once they have been acknowledged.
+func eventQueue(t *testing.T, transport Transport) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := Address(t, transport.Network)
+	queue := Queue(t)
+	server, client := transport.Events(t, addr, addr, conn.Heartbeat{}, queue, ctx)
+
+	s1, events := Events(t)
+	s2 := Sink(t)
+
+	defer func() {
+		cancel()
+		client.Close()
+		server.Close()
+	}()
+
+	for _, id := range []uint32{1, 2, 3} {
+		client.Send(id, EVENT)
+	}
+
+	go server.Run(s1)
+
+	Ready(t, transport.Network, addr)
+
+	go client.Run(s2)
+
+	Received(t, events, 1, 2, 3)
+
+	Until(t, func() bool {
+		return queue.Stats().Forwarded == 3
+	})
+
+	if s, ok := server.(sessions); ok {
+		for _, session := range s.Sessions() {
+			if session.Features()&protocol.ACKNOWLEDGE == 0 {
+				t.Errorf("ACK not negotiated")
+			}
+		}
+	}
+
+	client.Send(4, EVENT)
+
+	Received(t, events, 4)
+}
+
+// heartbeat keeps a connection that answers the heartbeat open, tears it down once the remote
+// end stops answering (simulated by pausing a proxy between the client and the server) and
+// reconnects once the remote end is reachable again.
+func heartbeat(t *testing.T, transport Transport) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := Address(t, transport.Network)
+	proxy := NewProxy(t, transport.Network, Address(t, transport.Network), addr)
+	server, client := transport.Events(t, addr, proxy.Address(), HEARTBEAT, nil, ctx)
+
+	s1, events := Events(t)
+	s2 := Sink(t)
+
+	defer func() {
+		cancel()
+		client.Close()
+		server.Close()
+	}()
+
+	go server.Run(s1)
+
+	Ready(t, transport.Network, addr)
+
+	go client.Run(s2)
+
+	var connection any
+
+	Until(t, func() bool {
+		connection = transport.connected(server)
+		return connection != nil
+	})
+
+	if s, ok := server.(sessions); ok {
+		Until(t, func() bool {
+			for _, session := range s.Sessions() {
+				return session.Features()&protocol.HEARTBEAT != 0
+			}
+
+			return false
+		})
+	}
+
+	// ... a connection that answers the heartbeat is kept open
+	Steady(t, 10*HEARTBEAT.Interval, func() bool {
+		return transport.connected(server) == connection
+	})
+
+	// ... and a dead peer is torn down
+	proxy.Pause()
+
+	Until(t, func() bool {
+		return transport.connected(server) != connection
+	})
+
+	// ... and reconnects once the peer is reachable again
+	proxy.Resume()
+
+	wait(t, conn.RETRY_MIN_DELAY+TIMEOUT, "reconnect", func() bool {
+		c := transport.connected(server)
+		return c != nil && c != connection
+	})
+
+	client.Send(1, EVENT)
+
+	Received(t, events, 1)
+}
+
+// Must returns a function that fails the test if a connector could not be created, for use as
+// e.g. Must(t)(NewWSOutServer(...)).
+func Must(t *testing.T) func(Connector, error) Connector {
+	return func(c Connector, err error) Connector {
+		t.Helper()
+
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		return c
+	}
+}
+
+func (transport Transport) connected(server Connector) any {
+	if transport.Connected != nil {
+		return transport.Connected(server)
+	}
+
+	if s, ok := server.(sessions); ok {
+		for _, session := range s.Sessions() {
+			return session
+		}
+	}
+
+	return nil
+}
+
+// Address returns an unused local address for the network ("tcp", "udp", "unix" or "unixgram").
+func Address(t *testing.T, network string) string {
+	t.Helper()
+
+	switch network {
+	case "tcp":
+		return fmt.Sprintf("127.0.0.1:%v", TCPPort(t))
+
+	case "udp":
+		return fmt.Sprintf("127.0.0.1:%v", UDPPort(t))
+
+	default:
+		return filepath.Join(t.TempDir(), "tunnel.sock")
+	}
+}
+
+// Ready waits for a server to start listening on the address.
+func Ready(t *testing.T, network string, addr string) {
+	t.Helper()
+
+	switch network {
+	case "tcp":
+		Listening(t, addr)
+
+	case "udp":
+		Bound(t, network, addr)
+
+	default:
+		Until(t, func() bool {
+			_, err := os.Stat(addr)
+			return err == nil
+		})
+	}
+}
+
+func wait(t *testing.T, timeout time.Duration, condition string, f func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if f() {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("timeout waiting for %v", condition)
+}
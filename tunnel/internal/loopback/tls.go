@@ -0,0 +1,65 @@
+package loopback
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// Certificates returns a self-signed CA and a certificate for 127.0.0.1 signed by the CA, for
+// use as both the server and the client certificate.
+func Certificates(t *testing.T) (*x509.CertPool, tls.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ca := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "uhppoted-tunnel CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	leaf := x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "uhppoted-tunnel"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &ca, &ca, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, &leaf, root, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(root)
+
+	return pool, tls.Certificate{Certificate: [][]byte{certificate}, PrivateKey: key}
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
+const UHPPOTE_PORT = 60000
+
 type ipOut struct {
 	conn.Conn
 	hwif          string
@@ -128,15 +130,9 @@ func (ip *ipOut) udpSendto(id uint32, message []byte, addr *net.UDPAddr) {
 
 	deadline := time.Now().Add(ip.timeout)
 	address := fmt.Sprintf("%v", addr)
-	bind := &net.UDPAddr{
-		IP:   net.IPv4(0, 0, 0, 0),
-		Port: 0,
-		Zone: "",
-	}
 
 	dialer := net.Dialer{
-		Deadline:  deadline,
-		LocalAddr: bind,
+		Deadline: deadline,
 		Control: func(network, address string, connection syscall.RawConn) (err error) {
 			var operr error
 
@@ -152,7 +148,7 @@ func (ip *ipOut) udpSendto(id uint32, message []byte, addr *net.UDPAddr) {
 		},
 	}
 
-	if connection, err := dialer.Dial("udp4", address); err != nil {
+	if connection, err := dialer.Dial("udp", address); err != nil {
 		ip.Warnf("%v", err)
 	} else if connection == nil {
 		ip.Warnf("invalid UDP socket (%v)", connection)
@@ -202,15 +198,9 @@ func (ip *ipOut) tcpSendto(id uint32, message []byte, addr *net.TCPAddr) {
 
 	deadline := time.Now().Add(ip.timeout)
 	address := fmt.Sprintf("%v", addr)
-	bind := &net.TCPAddr{
-		IP:   net.IPv4(0, 0, 0, 0),
-		Port: 0,
-		Zone: "",
-	}
 
 	dialer := net.Dialer{
-		Deadline:  deadline,
-		LocalAddr: bind,
+		Deadline: deadline,
 		Control: func(network, address string, connection syscall.RawConn) (err error) {
 			var operr error
 
@@ -226,7 +216,7 @@ func (ip *ipOut) tcpSendto(id uint32, message []byte, addr *net.TCPAddr) {
 		},
 	}
 
-	if connection, err := dialer.Dial("tcp4", address); err != nil {
+	if connection, err := dialer.Dial("tcp", address); err != nil {
 		ip.Warnf("%v", err)
 	} else if connection == nil {
 		ip.Warnf("invalid TCP socket (%v)", connection)
@@ -276,9 +266,9 @@ func (ip *ipOut) broadcast(id uint32, message []byte) {
 		},
 	}
 
-	if bind, err := net.ResolveUDPAddr("udp", "0.0.0.0:0"); err != nil {
-		ip.Warnf("%v", err)
-	} else if socket, err := listener.ListenPacket(context.Background(), "udp4", fmt.Sprintf("%v", bind)); err != nil {
+	network, bind := conn.UDPBind(ip.broadcastAddr)
+
+	if socket, err := listener.ListenPacket(context.Background(), network, fmt.Sprintf("%v", bind)); err != nil {
 		ip.Warnf("%v", err)
 	} else if socket == nil {
 		ip.Warnf("invalid UDP socket (%v)", socket)
@@ -333,26 +323,46 @@ func (ip *ipOut) broadcast(id uint32, message []byte) {
 	}
 }
 
+// resolve parses a controller address from the [controllers] table. The address may be prefixed
+// with the transport (udp:: or tcp::, defaulting to UDP) and may be an IPv4 address, an IPv6 address
+// (with a zone for link-local addresses) or a host name, with an optional port (defaulting to 60000)
+// e.g. udp::192.168.1.100:60000, tcp::[2001:db8::100]:60000, fe80::1%eth0, controller.local.
 func resolve(addr string) (any, error) {
-	if strings.HasPrefix(addr, "tcp::") {
-		if v, err := netip.ParseAddrPort(addr[5:]); err != nil {
+	switch {
+	case strings.HasPrefix(addr, "tcp::"):
+		if v, err := net.ResolveTCPAddr("tcp", withPort(addr[5:])); err != nil {
 			return nil, err
 		} else {
-			return net.TCPAddrFromAddrPort(v), nil
+			return v, nil
 		}
-	}
 
-	if strings.HasPrefix(addr, "udp::") {
-		if v, err := netip.ParseAddrPort(addr[5:]); err != nil {
-			return nil, err
-		} else {
-			return net.UDPAddrFromAddrPort(v), nil
-		}
+	case strings.HasPrefix(addr, "udp::"):
+		addr = addr[5:]
 	}
 
-	if v, err := netip.ParseAddrPort(addr); err != nil {
+	if v, err := net.ResolveUDPAddr("udp", withPort(addr)); err != nil {
 		return nil, err
 	} else {
-		return net.UDPAddrFromAddrPort(v), nil
+		return v, nil
 	}
 }
+
+// withPort adds the default UHPPOTE port to an address without a port.
+func withPort(addr string) string {
+	host := addr
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+
+	// ... netip accepts anything as an IPv6 zone, so exclude e.g. fe80::1%eth0]:60000
+	if v, err := netip.ParseAddr(host); err == nil && !strings.ContainsAny(v.Zone(), ":[]") {
+		return netip.AddrPortFrom(v, UHPPOTE_PORT).String()
+	}
+
+	var e *net.AddrError
+	if _, _, err := net.SplitHostPort(addr); errors.As(err, &e) && e.Err == "missing port in address" {
+		return net.JoinHostPort(addr, fmt.Sprintf("%v", UHPPOTE_PORT))
+	}
+
+	return addr
+}
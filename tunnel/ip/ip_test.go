@@ -0,0 +1,206 @@
+package ip
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestIPOutIPv6(t *testing.T) {
+	if !ipv6() {
+		t.Skip("IPv6 loopback not available")
+	}
+
+	udp := controller(t, "udp")
+	tcp := controller(t, "tcp")
+
+	tests := []struct {
+		name       string
+		controller uint32
+	}{
+		{"udp", 405419896},
+		{"tcp", 303986753},
+		{"broadcast", 201020304},
+	}
+
+	controllers := map[uint32]string{
+		405419896: fmt.Sprintf("udp::%v", udp),
+		303986753: fmt.Sprintf("tcp::%v", tcp),
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			ip, err := NewIPOut("", udp, controllers, 500*time.Millisecond, ctx)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			s := loopback.Sink(t)
+
+			defer func() {
+				cancel()
+				ip.Close()
+			}()
+
+			go ip.Run(s)
+
+			request := make([]byte, 64)
+			request[0] = 0x17
+			request[1] = 0x94
+			binary.LittleEndian.PutUint32(request[4:], test.controller)
+
+			replies := make(chan []byte, 1)
+			s.Expect(12345, func(reply []byte) {
+				select {
+				case replies <- reply:
+				default:
+				}
+			})
+
+			ip.Send(12345, request)
+
+			select {
+			case reply := <-replies:
+				if string(reply) != string(request) {
+					t.Errorf("incorrect reply - expected:%v, got:%v", request, reply)
+				}
+
+			case <-time.After(loopback.TIMEOUT):
+				t.Errorf("no reply")
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"192.168.1.100", "udp::192.168.1.100:60000"},
+		{"192.168.1.100:54321", "udp::192.168.1.100:54321"},
+		{"udp::192.168.1.100:54321", "udp::192.168.1.100:54321"},
+		{"tcp::192.168.1.100", "tcp::192.168.1.100:60000"},
+		{"::1", "udp::[::1]:60000"},
+		{"[::1]", "udp::[::1]:60000"},
+		{"[::1]:54321", "udp::[::1]:54321"},
+		{"tcp::[2001:db8::100]:54321", "tcp::[2001:db8::100]:54321"},
+		{"fe80::1%1", "udp::[fe80::1%1]:60000"},
+	}
+
+	for _, test := range tests {
+		v, err := resolve(test.addr)
+		if err != nil {
+			t.Errorf("%v: unexpected error (%v)", test.addr, err)
+			continue
+		}
+
+		var addr string
+		switch a := v.(type) {
+		case *net.UDPAddr:
+			addr = fmt.Sprintf("udp::%v", a)
+		case *net.TCPAddr:
+			addr = fmt.Sprintf("tcp::%v", a)
+		}
+
+		if addr != test.expected {
+			t.Errorf("%v: incorrect address - expected:%v, got:%v", test.addr, test.expected, addr)
+		}
+	}
+}
+
+func TestWithPort(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"192.168.1.100", "192.168.1.100:60000"},
+		{"192.168.1.100:54321", "192.168.1.100:54321"},
+		{"[::1]", "[::1]:60000"},
+		{"[::1]:54321", "[::1]:54321"},
+		{"controller.local", "controller.local:60000"},
+		{"controller.local:54321", "controller.local:54321"},
+		{"controller.local:54321:1", "controller.local:54321:1"},
+	}
+
+	for _, test := range tests {
+		if addr := withPort(test.addr); addr != test.expected {
+			t.Errorf("%v: incorrect address - expected:%v, got:%v", test.addr, test.expected, addr)
+		}
+	}
+}
+
+// controller starts a UDP or TCP echo server on the IPv6 loopback address that stands in for
+// a controller, returning the server address.
+func controller(t *testing.T, network string) string {
+	t.Helper()
+
+	switch network {
+	case "tcp":
+		listener, err := net.Listen("tcp6", "[::1]:0")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		t.Cleanup(func() { listener.Close() })
+
+		go func() {
+			for {
+				socket, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				go func() {
+					defer socket.Close()
+
+					buffer := make([]byte, 1024)
+					if N, err := socket.Read(buffer); err == nil {
+						socket.Write(buffer[:N])
+					}
+				}()
+			}
+		}()
+
+		return listener.Addr().String()
+
+	default:
+		socket, err := net.ListenPacket("udp6", "[::1]:0")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		t.Cleanup(func() { socket.Close() })
+
+		go func() {
+			buffer := make([]byte, 2048)
+			for {
+				N, remote, err := socket.ReadFrom(buffer)
+				if err != nil {
+					return
+				}
+
+				socket.WriteTo(buffer[:N], remote)
+			}
+		}()
+
+		return socket.LocalAddr().String()
+	}
+}
+
+// ipv6 returns true if the IPv6 loopback address is available.
+func ipv6() bool {
+	if socket, err := net.ListenPacket("udp6", "[::1]:0"); err != nil {
+		return false
+	} else {
+		socket.Close()
+		return true
+	}
+}
@@ -0,0 +1,203 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// The MQTT connectors relay the tunnel messages through an MQTT broker. Each message is published
+// as a version 2 DATA frame (which includes the message ID) on a topic derived from the base topic
+// in the connector spec:
+//
+//   - <topic>/requests: requests published by the 'out' client and relayed by the 'in' client
+//   - <topic>/replies:  replies published by the 'in' client and relayed by the 'out' client
+//   - <topic>/events:   events published by the event 'out' client and relayed by the event 'in' client
+//
+// Requests and replies are published with QoS 0 (a late reply is no use to anybody) while events
+// are published with QoS 1 and de-duplicated by the receiving connector.
+
+const REQUESTS = "requests"
+const REPLIES = "replies"
+const EVENTS = "events"
+
+const QOS_REQUEST byte = 0
+const QOS_EVENT byte = 1
+
+// broker is the parsed connector spec.
+type broker struct {
+	host     string
+	topic    string
+	username string
+	password string
+}
+
+func (b broker) String() string {
+	return fmt.Sprintf("%v/%v", b.host, b.topic)
+}
+
+// resolve parses a connector spec of the form [<username>:<password>@]<host:port>/<topic>. The
+// broker host is only resolved locally if the connector is not connecting through a proxy.
+func resolve(spec string, proxy conn.Proxy) (*broker, error) {
+	u, err := url.Parse("mqtt://" + spec)
+	if err != nil {
+		return nil, err
+	}
+
+	topic := strings.Trim(u.Path, "/")
+	if topic == "" {
+		return nil, fmt.Errorf("MQTT connector requires a topic (%v)", u.Redacted())
+	}
+
+	if _, err := proxy.Resolve(u.Host); err != nil {
+		return nil, err
+	} else if u.Port() == "" || u.Port() == "0" {
+		return nil, fmt.Errorf("MQTT broker requires a non-zero port")
+	}
+
+	b := broker{
+		host:  u.Host,
+		topic: topic,
+	}
+
+	if u.User != nil {
+		b.username = u.User.Username()
+		b.password, _ = u.User.Password()
+	}
+
+	return &b, nil
+}
+
+func clientConfig(host string, ca *x509.CertPool, keypair *tls.Certificate) *tls.Config {
+	name, _, _ := net.SplitHostPort(host)
+
+	config := tls.Config{
+		ServerName: name,
+		RootCAs:    ca,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if keypair != nil {
+		config.Certificates = []tls.Certificate{*keypair}
+	}
+
+	return &config
+}
+
+// options returns the MQTT client options for the broker. The client does not reconnect
+// automatically - the connectors reconnect using the usual retry backoff. A publish that
+// cannot be queued within the timeout (e.g. a slow broker) fails rather than blocking.
+func options(ctx context.Context, b *broker, hwif string, config *tls.Config, heartbeat conn.Heartbeat, proxy conn.Proxy, timeout time.Duration, c conn.Conn) *MQTT.ClientOptions {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if hwif != "" {
+				return conn.BindToDevice(connection, hwif, network == "tcp4", c)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	scheme := "tcp"
+	if config != nil {
+		scheme = "ssl"
+	}
+
+	opts := MQTT.NewClientOptions().
+		AddBroker(fmt.Sprintf("%v://%v", scheme, b.host)).
+		SetClientID(clientID()).
+		SetUsername(b.username).
+		SetPassword(b.password).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectRetry(false).
+		SetConnectTimeout(timeout).
+		SetWriteTimeout(timeout).
+		SetKeepAlive(0).
+		SetCustomOpenConnectionFn(func(uri *url.URL, options MQTT.ClientOptions) (net.Conn, error) {
+			if config != nil {
+				return proxy.DialTLS(ctx, dialer, "tcp", uri.Host, config)
+			}
+
+			return proxy.DialContext(ctx, dialer, "tcp", uri.Host)
+		})
+
+	if heartbeat.Enabled() {
+		opts.SetKeepAlive(heartbeat.Interval)
+		opts.SetPingTimeout(timeout)
+	}
+
+	return opts
+}
+
+// wait waits for an MQTT operation to complete, returning an error if the operation failed or
+// timed out.
+func wait(token MQTT.Token, timeout time.Duration) error {
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("timeout waiting for MQTT broker")
+	}
+
+	return token.Error()
+}
+
+func tag(config *tls.Config) string {
+	if config != nil {
+		return "MQTTS"
+	}
+
+	return "MQTT"
+}
+
+// clientID generates a random client ID so that multiple tunnels can share a broker.
+func clientID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+
+	return "uhppoted-tunnel-" + hex.EncodeToString(bytes)
+}
+
+func topic(b *broker, subtopic string) string {
+	return b.topic + "/" + subtopic
+}
+
+func encode(id uint32, message []byte) ([]byte, error) {
+	frame := protocol.Frame{
+		Type:    protocol.DATA,
+		ID:      id,
+		Message: message,
+	}
+
+	if err := frame.Check(); err != nil {
+		return nil, err
+	}
+
+	return frame.Encode(), nil
+}
+
+// decode returns the DATA frames in an MQTT message payload.
+func decode(payload []byte) ([]protocol.Frame, error) {
+	frames := []protocol.Frame{}
+	decoded, err := protocol.NewV2Stream().Decode(payload)
+
+	for _, frame := range decoded {
+		if frame.Type == protocol.DATA {
+			frames = append(frames, frame)
+		}
+	}
+
+	return frames, err
+}
@@ -0,0 +1,211 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type mqttClient struct {
+	conn.Conn
+	hwif      string
+	broker    *broker
+	config    *tls.Config
+	retry     conn.Backoff
+	heartbeat conn.Heartbeat
+	proxy     conn.Proxy
+	timeout   time.Duration
+	subscribe string
+	publish   string
+	client    MQTT.Client
+	ctx       context.Context
+	closed    chan struct{}
+	sync.RWMutex
+}
+
+func NewMQTTInClient(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*mqttClient, error) {
+	client, err := makeMQTTClient(hwif, spec, nil, nil, REQUESTS, REPLIES, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::mqtt-client-in")
+	}
+
+	return client, err
+}
+
+func NewMQTTOutClient(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*mqttClient, error) {
+	client, err := makeMQTTClient(hwif, spec, nil, nil, REPLIES, REQUESTS, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::mqtt-client-out")
+	}
+
+	return client, err
+}
+
+func NewMQTTSInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*mqttClient, error) {
+	client, err := makeMQTTClient(hwif, spec, ca, keypair, REQUESTS, REPLIES, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::mqtts-client-in")
+	}
+
+	return client, err
+}
+
+func NewMQTTSOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*mqttClient, error) {
+	client, err := makeMQTTClient(hwif, spec, ca, keypair, REPLIES, REQUESTS, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::mqtts-client-out")
+	}
+
+	return client, err
+}
+
+func makeMQTTClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, subscribe, publish string, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*mqttClient, error) {
+	broker, err := resolve(spec, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	var config *tls.Config
+	if ca != nil {
+		config = clientConfig(broker.host, ca, keypair)
+	}
+
+	client := mqttClient{
+		Conn: conn.Conn{
+			Tag: tag(config),
+		},
+		hwif:      hwif,
+		broker:    broker,
+		config:    config,
+		retry:     retry,
+		heartbeat: heartbeat,
+		proxy:     proxy,
+		timeout:   5 * time.Second,
+		subscribe: topic(broker, subscribe),
+		publish:   topic(broker, publish),
+		ctx:       ctx,
+		closed:    make(chan struct{}),
+	}
+
+	return &client, nil
+}
+
+func (m *mqttClient) Close() {
+	m.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-m.closed:
+		m.Infof("closed")
+
+	case <-timeout.C:
+		m.Infof("close timeout")
+	}
+}
+
+func (m *mqttClient) Run(router *router.Switch) error {
+	m.connect(router)
+	m.closed <- struct{}{}
+
+	return nil
+}
+
+// Send publishes the message on the 'publish' topic. Messages are discarded while the client is
+// not connected to the broker.
+func (m *mqttClient) Send(id uint32, msg []byte) {
+	m.RLock()
+	client := m.client
+	m.RUnlock()
+
+	if client != nil {
+		m.Infof("msg %v  relaying to %v", id, m.publish)
+		m.send(client, id, msg)
+	}
+}
+
+func (m *mqttClient) connect(router *router.Switch) {
+	for {
+		m.Infof("connecting to %v", m.broker)
+
+		lost := make(chan error, 1)
+		opts := options(m.ctx, m.broker, m.hwif, m.config, m.heartbeat, m.proxy, m.timeout, m.Conn).
+			SetConnectionLostHandler(func(client MQTT.Client, err error) {
+				lost <- err
+			})
+
+		client := MQTT.NewClient(opts)
+
+		if err := wait(client.Connect(), m.timeout); err != nil {
+			m.Warnf("%v", err)
+		} else if err := wait(client.Subscribe(m.subscribe, QOS_REQUEST, m.received(router)), m.timeout); err != nil {
+			m.Warnf("%v", err)
+			client.Disconnect(0)
+		} else {
+			m.retry.Reset()
+			m.Infof("connected  to %v (subscribed to %v)", m.broker, m.subscribe)
+
+			m.Lock()
+			m.client = client
+			m.Unlock()
+
+			select {
+			case err := <-lost:
+				m.Warnf("%v", err)
+
+			case <-m.ctx.Done():
+				client.Disconnect(250)
+			}
+
+			m.Lock()
+			m.client = nil
+			m.Unlock()
+		}
+
+		if !m.retry.Wait(m.Tag) {
+			return
+		}
+	}
+}
+
+func (m *mqttClient) received(router *router.Switch) MQTT.MessageHandler {
+	return func(client MQTT.Client, message MQTT.Message) {
+		frames, err := decode(message.Payload())
+		if err != nil {
+			m.Warnf("invalid message from %v (%v)", message.Topic(), err)
+		}
+
+		for _, frame := range frames {
+			id := frame.ID
+
+			m.Dumpf(frame.Message, "msg %v  received %v bytes from %v", id, len(frame.Message), message.Topic())
+
+			router.Received(id, frame.Message, func(reply []byte) {
+				m.send(client, id, reply)
+			})
+		}
+	}
+}
+
+// send publishes the message asynchronously so that a slow broker does not block the caller.
+func (m *mqttClient) send(client MQTT.Client, id uint32, msg []byte) {
+	go func() {
+		if payload, err := encode(id, msg); err != nil {
+			m.Warnf("msg %v  error publishing message to %v (%v)", id, m.publish, err)
+		} else if err := wait(client.Publish(m.publish, QOS_REQUEST, false, payload), m.timeout); err != nil {
+			m.Warnf("msg %v  error publishing message to %v (%v)", id, m.publish, err)
+		} else {
+			m.Infof("msg %v  sent %v bytes to %v", id, len(msg), m.publish)
+		}
+	}()
+}
@@ -0,0 +1,111 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type mqttEventClient struct {
+	conn.Forwarder
+	hwif      string
+	broker    *broker
+	config    *tls.Config
+	retry     conn.Backoff
+	heartbeat conn.Heartbeat
+	proxy     conn.Proxy
+	timeout   time.Duration
+	topic     string
+	ctx       context.Context
+	closed    chan struct{}
+
+	subscribe func(MQTT.Client, *router.Switch) error
+	send      func(MQTT.Client, uint32, []byte) error
+}
+
+func (m *mqttEventClient) Close() {
+	m.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-m.closed:
+		m.Infof("closed")
+
+	case <-timeout.C:
+		m.Infof("close timeout")
+	}
+}
+
+func (m *mqttEventClient) Run(router *router.Switch) error {
+	m.connect(router)
+	m.closed <- struct{}{}
+
+	return nil
+}
+
+func (m *mqttEventClient) connect(router *router.Switch) {
+	for {
+		m.Infof("connecting to %v", m.broker)
+
+		lost := make(chan error, 1)
+		opts := options(m.ctx, m.broker, m.hwif, m.config, m.heartbeat, m.proxy, m.timeout, m.Conn).
+			SetConnectionLostHandler(func(client MQTT.Client, err error) {
+				lost <- err
+			})
+
+		client := MQTT.NewClient(opts)
+
+		if err := wait(client.Connect(), m.timeout); err != nil {
+			m.Warnf("%v", err)
+		} else if err := m.subscribe(client, router); err != nil {
+			m.Warnf("%v", err)
+			client.Disconnect(0)
+		} else {
+			m.retry.Reset()
+			m.Infof("connected  to %v", m.broker)
+
+			eof := make(chan struct{})
+
+			go func() {
+				m.recv(eof, client)
+			}()
+
+			select {
+			case err := <-lost:
+				m.Warnf("%v", err)
+
+			case <-m.ctx.Done():
+				client.Disconnect(250)
+			}
+
+			close(eof)
+		}
+
+		if !m.retry.Wait(m.Tag) {
+			return
+		}
+	}
+}
+
+// recv publishes events until the connection is closed. An event is only removed from the
+// queue once the broker has acknowledged it and an event that could not be published is
+// published again after the timeout.
+func (m *mqttEventClient) recv(eof chan struct{}, client MQTT.Client) {
+	send := func(id uint32, msg []byte) error {
+		return m.send(client, id, msg)
+	}
+
+	for m.Forward(eof, m.topic, send) != nil {
+		select {
+		case <-eof:
+			return
+
+		case <-time.After(m.timeout):
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type mqttEventInClient struct {
+	mqttEventClient
+	dedup *conn.Dedup
+}
+
+func NewMQTTEventInClient(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*mqttEventInClient, error) {
+	client, err := makeMQTTEventInClient(hwif, spec, nil, nil, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::mqtt-event-in-client")
+	}
+
+	return client, err
+}
+
+func NewMQTTSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*mqttEventInClient, error) {
+	client, err := makeMQTTEventInClient(hwif, spec, ca, keypair, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::mqtts-event-in-client")
+	}
+
+	return client, err
+}
+
+func makeMQTTEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*mqttEventInClient, error) {
+	broker, err := resolve(spec, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	var config *tls.Config
+	if ca != nil {
+		config = clientConfig(broker.host, ca, keypair)
+	}
+
+	m := mqttEventInClient{
+		mqttEventClient{
+			Forwarder: conn.NewForwarder(tag(config), nil),
+			hwif:      hwif,
+			broker:    broker,
+			config:    config,
+			retry:     retry,
+			heartbeat: heartbeat,
+			proxy:     proxy,
+			timeout:   5 * time.Second,
+			topic:     topic(broker, EVENTS),
+			ctx:       ctx,
+			closed:    make(chan struct{}),
+		},
+		conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	m.mqttEventClient.subscribe = m.subscribe
+	m.mqttEventClient.send = m.send
+
+	return &m, nil
+}
+
+func (m *mqttEventInClient) subscribe(client MQTT.Client, router *router.Switch) error {
+	handler := func(client MQTT.Client, message MQTT.Message) {
+		frames, err := decode(message.Payload())
+		if err != nil {
+			m.Warnf("invalid message from %v (%v)", message.Topic(), err)
+		}
+
+		for _, frame := range frames {
+			m.Dumpf(frame.Message, "msg %v  received %v bytes from %v", frame.ID, len(frame.Message), message.Topic())
+
+			if m.dedup.Duplicate(frame.ID, frame.Message) {
+				m.Infof("msg %v  discarding duplicate event from %v", frame.ID, message.Topic())
+			} else {
+				router.Received(frame.ID, frame.Message, nil)
+			}
+		}
+	}
+
+	if err := wait(client.Subscribe(m.topic, QOS_EVENT, handler), m.timeout); err != nil {
+		return err
+	}
+
+	m.Infof("subscribed to %v", m.topic)
+
+	return nil
+}
+
+func (m *mqttEventInClient) send(client MQTT.Client, id uint32, msg []byte) error {
+	return nil
+}
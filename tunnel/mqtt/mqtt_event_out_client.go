@@ -0,0 +1,90 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type mqttEventOutClient struct {
+	mqttEventClient
+}
+
+func NewMQTTEventOutClient(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, queue *conn.Queue, ctx context.Context) (*mqttEventOutClient, error) {
+	client, err := makeMQTTEventOutClient(hwif, spec, nil, nil, retry, heartbeat, proxy, queue, ctx)
+
+	if err == nil {
+		client.Infof("connector::mqtt-event-out-client")
+	}
+
+	return client, err
+}
+
+func NewMQTTSEventOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, queue *conn.Queue, ctx context.Context) (*mqttEventOutClient, error) {
+	client, err := makeMQTTEventOutClient(hwif, spec, ca, keypair, retry, heartbeat, proxy, queue, ctx)
+
+	if err == nil {
+		client.Infof("connector::mqtts-event-out-client")
+	}
+
+	return client, err
+}
+
+func makeMQTTEventOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, queue *conn.Queue, ctx context.Context) (*mqttEventOutClient, error) {
+	broker, err := resolve(spec, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	var config *tls.Config
+	if ca != nil {
+		config = clientConfig(broker.host, ca, keypair)
+	}
+
+	m := mqttEventOutClient{
+		mqttEventClient{
+			Forwarder: conn.NewForwarder(tag(config), queue),
+			hwif:      hwif,
+			broker:    broker,
+			config:    config,
+			retry:     retry,
+			heartbeat: heartbeat,
+			proxy:     proxy,
+			timeout:   5 * time.Second,
+			topic:     topic(broker, EVENTS),
+			ctx:       ctx,
+			closed:    make(chan struct{}),
+		},
+	}
+
+	m.mqttEventClient.subscribe = m.subscribe
+	m.mqttEventClient.send = m.send
+
+	return &m, nil
+}
+
+func (m *mqttEventOutClient) subscribe(client MQTT.Client, router *router.Switch) error {
+	// ... events are relayed in one direction only so there is nothing to subscribe to
+	return nil
+}
+
+// send publishes the event with QoS 1 and waits for the broker to acknowledge it.
+func (m *mqttEventOutClient) send(client MQTT.Client, id uint32, msg []byte) error {
+	if payload, err := encode(id, msg); err != nil {
+		m.Warnf("msg %v  error publishing message to %v (%v)", id, m.topic, err)
+		return err
+	} else if err := wait(client.Publish(m.topic, QOS_EVENT, false, payload), m.timeout); err != nil {
+		m.Warnf("msg %v  error publishing message to %v (%v)", id, m.topic, err)
+		return err
+	} else {
+		m.Infof("msg %v  sent %v bytes to %v", id, len(msg), m.topic)
+	}
+
+	return nil
+}
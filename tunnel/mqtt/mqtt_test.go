@@ -0,0 +1,461 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestMQTTRequestReply(t *testing.T) {
+	b := newStandin(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	spec := fmt.Sprintf("%v/uhppoted/tunnel", b.addr())
+
+	in, err := NewMQTTInClient("", spec, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, err := NewMQTTOutClient("", spec, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s1 := loopback.Echo(t)
+	s2 := loopback.Sink(t)
+
+	go in.Run(s1)
+	go out.Run(s2)
+
+	defer func() {
+		cancel()
+		in.Close()
+		out.Close()
+	}()
+
+	b.subscribed(t, "uhppoted/tunnel/requests")
+	b.subscribed(t, "uhppoted/tunnel/replies")
+
+	loopback.RoundTrip(t, s2, out.Send)
+}
+
+func TestMQTTEvents(t *testing.T) {
+	b := newStandin(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	spec := fmt.Sprintf("%v/uhppoted/tunnel", b.addr())
+
+	in, err := NewMQTTEventInClient("", spec, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, err := NewMQTTEventOutClient("", spec, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, nil, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s1, events := loopback.Events(t)
+	s2 := loopback.Sink(t)
+
+	go in.Run(s1)
+	go out.Run(s2)
+
+	defer func() {
+		cancel()
+		in.Close()
+		out.Close()
+	}()
+
+	b.subscribed(t, "uhppoted/tunnel/events")
+	b.connected(t, 2)
+
+	for id := uint32(1); id <= 5; id++ {
+		out.Send(id, loopback.EVENT)
+	}
+
+	loopback.Received(t, events, 1, 2, 3, 4, 5)
+}
+
+func TestMQTTEventQueue(t *testing.T) {
+	b := newStandin(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	spec := fmt.Sprintf("%v/uhppoted/tunnel", b.addr())
+	queue := loopback.Queue(t)
+
+	in, err := NewMQTTEventInClient("", spec, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, err := NewMQTTEventOutClient("", spec, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, queue, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s1, events := loopback.Events(t)
+	s2 := loopback.Sink(t)
+
+	defer func() {
+		cancel()
+		in.Close()
+		out.Close()
+	}()
+
+	go in.Run(s1)
+
+	b.subscribed(t, "uhppoted/tunnel/events")
+
+	// ... events queued before the client connects are published in order
+	for _, id := range []uint32{1, 2, 3} {
+		out.Send(id, loopback.EVENT)
+	}
+
+	go out.Run(s2)
+
+	loopback.Received(t, events, 1, 2, 3)
+
+	// ... and only removed from the queue once the broker has acknowledged them
+	loopback.Until(t, func() bool {
+		return queue.Stats().Forwarded == 3
+	})
+
+	if N := b.acknowledged(); N != 3 {
+		t.Errorf("incorrect number of acknowledged events - expected:%v, got:%v", 3, N)
+	}
+
+	out.Send(4, loopback.EVENT)
+
+	loopback.Received(t, events, 4)
+}
+
+func TestMQTTEventHeartbeat(t *testing.T) {
+	b := newStandin(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	spec := fmt.Sprintf("%v/uhppoted/tunnel", b.addr())
+
+	// ... the MQTT keep-alive has a resolution of one second
+	heartbeat := conn.Heartbeat{Interval: time.Second, Misses: 2}
+
+	out, err := NewMQTTEventOutClient("", spec, conn.NewBackoff(-1, time.Second, ctx), heartbeat, conn.Proxy{}, nil, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s := loopback.Sink(t)
+
+	defer func() {
+		cancel()
+		out.Close()
+	}()
+
+	go out.Run(s)
+
+	b.connected(t, 1)
+
+	timeout := time.Now().Add(3 * heartbeat.Interval)
+	for b.pinged() == 0 {
+		if time.Now().After(timeout) {
+			t.Fatalf("no PINGREQ within %v", 3*heartbeat.Interval)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMQTTSendDoesNotBlock(t *testing.T) {
+	b := newStandin(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	spec := fmt.Sprintf("%v/uhppoted/tunnel", b.addr())
+
+	out, err := NewMQTTOutClient("", spec, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out.timeout = 500 * time.Millisecond
+
+	s := loopback.Sink(t)
+
+	go out.Run(s)
+
+	defer func() {
+		cancel()
+		out.Close()
+	}()
+
+	b.subscribed(t, "uhppoted/tunnel/replies")
+
+	// ... a broker that has stopped reading eventually blocks the client writes
+	b.pause()
+
+	message := make([]byte, 65536)
+	start := time.Now()
+
+	for id := uint32(1); id <= 256; id++ {
+		out.Send(id, message)
+	}
+
+	if dt := time.Since(start); dt > time.Second {
+		t.Errorf("Send blocked by slow broker (%v)", dt)
+	}
+}
+
+// standin is a minimal in-process MQTT 3.1.1 broker that supports just enough of the protocol
+// for the MQTT connectors i.e. CONNECT, SUBSCRIBE (exact topics only), PUBLISH (QoS 0 and 1),
+// PINGREQ and DISCONNECT. Messages are delivered to subscribers with QoS 0.
+type standin struct {
+	listener      net.Listener
+	sessions      int
+	acks          int
+	pings         int
+	subscriptions map[string][]*session
+	gate          chan struct{}
+	sync.Mutex
+}
+
+type session struct {
+	socket net.Conn
+	sync.Mutex
+}
+
+func (s *session) write(packet []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.socket.Write(packet)
+}
+
+func newStandin(t *testing.T) *standin {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error creating MQTT broker (%v)", err)
+	}
+
+	b := standin{
+		listener:      listener,
+		subscriptions: map[string][]*session{},
+	}
+
+	t.Cleanup(func() {
+		b.resume()
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			socket, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer socket.Close()
+				b.serve(&session{socket: socket})
+			}()
+		}
+	}()
+
+	return &b
+}
+
+func (b *standin) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *standin) pause() {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.gate == nil {
+		b.gate = make(chan struct{})
+	}
+}
+
+func (b *standin) resume() {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.gate != nil {
+		close(b.gate)
+		b.gate = nil
+	}
+}
+
+// subscribed waits for a client to subscribe to the topic.
+func (b *standin) subscribed(t *testing.T, topic string) {
+	t.Helper()
+
+	b.until(t, fmt.Sprintf("subscription to %v", topic), func() bool { return len(b.subscriptions[topic]) > 0 })
+}
+
+// connected waits for N clients to connect.
+func (b *standin) connected(t *testing.T, N int) {
+	t.Helper()
+
+	b.until(t, fmt.Sprintf("%v connections", N), func() bool { return b.sessions >= N })
+}
+
+// acknowledged returns the number of QoS 1 PUBLISH packets acknowledged by the broker.
+func (b *standin) acknowledged() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.acks
+}
+
+// pinged returns the number of PINGREQ packets received by the broker.
+func (b *standin) pinged() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.pings
+}
+
+func (b *standin) until(t *testing.T, what string, f func() bool) {
+	t.Helper()
+
+	timeout := time.Now().Add(2 * time.Second)
+	for time.Now().Before(timeout) {
+		b.Lock()
+		ok := f()
+		b.Unlock()
+
+		if ok {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("timeout waiting for %v", what)
+}
+
+func (b *standin) serve(s *session) {
+	r := bufio.NewReader(s.socket)
+
+	defer func() {
+		b.Lock()
+		defer b.Unlock()
+
+		for k, v := range b.subscriptions {
+			for i, ss := range v {
+				if ss == s {
+					b.subscriptions[k] = append(v[:i], v[i+1:]...)
+					break
+				}
+			}
+		}
+	}()
+
+	for {
+		b.Lock()
+		gate := b.gate
+		b.Unlock()
+
+		if gate != nil {
+			<-gate
+		}
+
+		header, packet, err := read(r)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			b.Lock()
+			b.sessions++
+			b.Unlock()
+
+			s.write([]byte{0x20, 0x02, 0x00, 0x00})
+
+		case 3: // PUBLISH
+			qos := (header >> 1) & 0x03
+			N := int(binary.BigEndian.Uint16(packet))
+			topic := string(packet[2 : 2+N])
+			payload := packet[2+N:]
+
+			if qos > 0 {
+				b.Lock()
+				b.acks++
+				b.Unlock()
+
+				s.write([]byte{0x40, 0x02, payload[0], payload[1]})
+				payload = payload[2:]
+			}
+
+			b.Lock()
+			subscribers := append([]*session{}, b.subscriptions[topic]...)
+			b.Unlock()
+
+			for _, ss := range subscribers {
+				ss.write(publish(topic, payload))
+			}
+
+		case 8: // SUBSCRIBE
+			ack := []byte{packet[0], packet[1]}
+
+			for p := packet[2:]; len(p) > 2; {
+				N := int(binary.BigEndian.Uint16(p))
+				topic := string(p[2 : 2+N])
+				p = p[2+N+1:]
+
+				b.Lock()
+				b.subscriptions[topic] = append(b.subscriptions[topic], s)
+				b.Unlock()
+
+				ack = append(ack, 0x00)
+			}
+
+			s.write(append([]byte{0x90, byte(len(ack))}, ack...))
+
+		case 12: // PINGREQ
+			b.Lock()
+			b.pings++
+			b.Unlock()
+
+			s.write([]byte{0xd0, 0x00})
+
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// read reads an MQTT control packet, returning the fixed header byte and the variable header
+// and payload.
+func read(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	N, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	packet := make([]byte, N)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return 0, nil, err
+	}
+
+	return header, packet, nil
+}
+
+func publish(topic string, payload []byte) []byte {
+	packet := binary.BigEndian.AppendUint16(nil, uint16(len(topic)))
+	packet = append(packet, []byte(topic)...)
+	packet = append(packet, payload...)
+
+	return append(binary.AppendUvarint([]byte{0x30}, uint64(len(packet))), packet...)
+}
@@ -0,0 +1,371 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// The QUIC connectors carry each request (with its replies) and each event on its own QUIC
+// stream, so that a slow or unresponsive controller only delays its own replies.
+//
+// A request stream carries a single DATA frame from the requester followed by the DATA frames
+// for the replies. The replying end closes the stream once no replies have been received for
+// router.IDLE_TIME. An event stream carries a single DATA frame flagged ACK_REQUEST and is
+// closed by the receiver after it has sent the ACK frame.
+//
+// QUIC identifies a connection by connection ID rather than by IP address and port, so an
+// established connection follows a client across NAT rebinding or a change of IP address
+// (e.g. an LTE modem). The QUIC keep-alive replaces the tunnel PING/PONG heartbeat.
+
+const ALPN = "uhppoted-tunnel"
+const KEEPALIVE = 15 * time.Second
+const MAX_STREAMS = 1024
+const IDLE_TIME = router.IDLE_TIME
+
+const (
+	CLOSED QUIC.ApplicationErrorCode = 0x00
+	NO_ACK QUIC.ApplicationErrorCode = 0x01
+)
+
+func resolve(spec string) (*net.UDPAddr, string, error) {
+	addr, err := net.ResolveUDPAddr("udp", spec)
+	if err != nil {
+		return nil, "", err
+	} else if addr == nil {
+		return nil, "", fmt.Errorf("unable to resolve UDP address '%v'", spec)
+	} else if addr.Port == 0 {
+		return nil, "", fmt.Errorf("QUIC host requires a non-zero port")
+	}
+
+	host, _, err := net.SplitHostPort(spec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return addr, host, nil
+}
+
+func clientConfig(host string, ca *x509.CertPool, keypair *tls.Certificate) *tls.Config {
+	config := tls.Config{
+		ServerName: host,
+		RootCAs:    ca,
+		NextProtos: []string{ALPN},
+		MinVersion: tls.VersionTLS13,
+	}
+
+	if keypair != nil {
+		config.Certificates = []tls.Certificate{*keypair}
+	}
+
+	return &config
+}
+
+func serverConfig(ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool) *tls.Config {
+	config := tls.Config{
+		ClientCAs:    ca,
+		Certificates: []tls.Certificate{keypair},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		NextProtos:   []string{ALPN},
+		MinVersion:   tls.VersionTLS13,
+	}
+
+	if requireClientCertificate {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &config
+}
+
+// quicConfig maps the tunnel heartbeat onto the QUIC keep-alive and idle timeout. The keep-alive
+// is always enabled (if only to hold the NAT binding open) but the idle timeout is left at the
+// QUIC default if the heartbeat is disabled.
+func quicConfig(heartbeat conn.Heartbeat) *QUIC.Config {
+	config := QUIC.Config{
+		HandshakeIdleTimeout: 5 * time.Second,
+		KeepAlivePeriod:      KEEPALIVE,
+		MaxIncomingStreams:   MAX_STREAMS,
+	}
+
+	if heartbeat.Enabled() {
+		config.KeepAlivePeriod = heartbeat.Interval
+		config.MaxIdleTimeout = time.Duration(heartbeat.Misses) * heartbeat.Interval
+	}
+
+	return &config
+}
+
+// listen opens the UDP socket for a QUIC connection, bound to the network interface (if any).
+func listen(hwif string, addr *net.UDPAddr, c conn.Conn) (*net.UDPConn, error) {
+	listener := net.ListenConfig{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if hwif != "" {
+				return conn.BindToDevice(connection, hwif, conn.IsIPv4(addr.IP), c)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	socket, err := listener.ListenPacket(context.Background(), "udp", fmt.Sprintf("%v", addr))
+	if err != nil {
+		return nil, err
+	} else if udp, ok := socket.(*net.UDPConn); !ok {
+		socket.Close()
+		return nil, fmt.Errorf("failed to create UDP socket (%v)", socket)
+	} else {
+		return udp, nil
+	}
+}
+
+// dial opens a QUIC connection to the server. The UDP socket is closed when the connection is
+// closed.
+func dial(hwif string, addr *net.UDPAddr, config *tls.Config, quic *QUIC.Config, timeout time.Duration, c conn.Conn, ctx context.Context) (*QUIC.Conn, error) {
+	bind := net.UDPAddr{IP: net.IPv4zero}
+	if !conn.IsIPv4(addr.IP) {
+		bind = net.UDPAddr{IP: net.IPv6zero}
+	}
+
+	socket, err := listen(hwif, &bind, c)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := QUIC.Transport{
+		Conn: socket,
+	}
+
+	handshake, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	connection, err := transport.Dial(handshake, addr, config, quic)
+	if err != nil {
+		transport.Close()
+		socket.Close()
+		return nil, err
+	}
+
+	context.AfterFunc(connection.Context(), func() {
+		transport.Close()
+		socket.Close()
+	})
+
+	return connection, nil
+}
+
+// closed returns true if the error is the result of the connection being closed normally
+// by either end.
+func closed(err error) bool {
+	var e *QUIC.ApplicationError
+
+	return errors.Is(err, context.Canceled) || errors.Is(err, net.ErrClosed) || (errors.As(err, &e) && e.ErrorCode == CLOSED)
+}
+
+// read decodes the frames received on a stream, invoking the handler for each frame until the
+// stream is closed by the remote end or the handler returns false.
+func read(stream *QUIC.Stream, f func(protocol.Frame) bool) error {
+	decoder := protocol.NewV2Stream()
+	buffer := make([]byte, 2048)
+
+	for {
+		N, err := stream.Read(buffer)
+		frames, invalid := decoder.Decode(buffer[:N])
+
+		for _, frame := range frames {
+			if !f(frame) {
+				return nil
+			}
+		}
+
+		if invalid != nil {
+			return invalid
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func write(stream *QUIC.Stream, frame protocol.Frame) error {
+	if err := frame.Check(); err != nil {
+		return err
+	}
+
+	packet := frame.Encode()
+
+	if N, err := stream.Write(packet); err != nil {
+		return err
+	} else if N != len(packet) {
+		return fmt.Errorf("sent %v of %v bytes", N, len(packet))
+	}
+
+	return nil
+}
+
+// request sends a request on a new stream and passes the replies to the reply handler for the
+// request until the remote end closes the stream, giving up if no reply has been received for
+// twice the idle time. Replies received after the reply handler has been removed are discarded.
+func request(c conn.Conn, connection *QUIC.Conn, id uint32, message []byte, idle time.Duration, router *router.Switch) error {
+	stream, err := connection.OpenStreamSync(connection.Context())
+	if err != nil {
+		return err
+	}
+
+	defer stream.CancelRead(0)
+
+	if err := write(stream, protocol.Frame{Type: protocol.DATA, ID: id, Message: message}); err != nil {
+		stream.CancelWrite(0)
+		return err
+	} else if err := stream.Close(); err != nil {
+		return err
+	}
+
+	c.Infof("msg %v  sent %v bytes to %v", id, len(message), connection.RemoteAddr())
+
+	stream.SetReadDeadline(time.Now().Add(2 * idle))
+
+	return read(stream, func(frame protocol.Frame) bool {
+		if frame.Type == protocol.DATA {
+			c.Dumpf(frame.Message, "msg %v  received %v bytes from %v", frame.ID, len(frame.Message), connection.RemoteAddr())
+			stream.SetReadDeadline(time.Now().Add(2 * idle))
+
+			if frame.ID != id {
+				c.Warnf("msg %v  discarding reply with mismatched ID %v from %v", id, frame.ID, connection.RemoteAddr())
+			} else if !router.Reply(id, frame.Message) {
+				c.Warnf("msg %v  discarding late reply from %v", id, connection.RemoteAddr())
+			}
+		}
+
+		return true
+	})
+}
+
+// reply relays the request received on a stream to the router and sends the replies on the same
+// stream, closing the stream once the replies have been idle for the idle time.
+func reply(c conn.Conn, stream *QUIC.Stream, remote net.Addr, idle time.Duration, router *router.Switch) error {
+	var guard sync.Mutex
+
+	timer := time.AfterFunc(idle, func() {
+		guard.Lock()
+		defer guard.Unlock()
+
+		stream.Close()
+	})
+
+	stream.SetReadDeadline(time.Now().Add(idle))
+
+	return read(stream, func(frame protocol.Frame) bool {
+		if frame.Type != protocol.DATA {
+			return true
+		}
+
+		id := frame.ID
+
+		c.Dumpf(frame.Message, "msg %v  received %v bytes from %v", id, len(frame.Message), remote)
+
+		router.Received(id, frame.Message, func(message []byte) {
+			guard.Lock()
+			defer guard.Unlock()
+
+			timer.Reset(idle)
+
+			if err := write(stream, protocol.Frame{Type: protocol.DATA, ID: id, Message: message}); err != nil {
+				c.Warnf("msg %v  error sending message to %v (%v)", id, remote, err)
+			} else {
+				c.Infof("msg %v  sent %v bytes to %v", id, len(message), remote)
+			}
+		})
+
+		return true
+	})
+}
+
+// deliver sends an event on a new stream and waits for the remote end to acknowledge it.
+func deliver(connection *QUIC.Conn, id uint32, message []byte) error {
+	ctx, cancel := context.WithTimeout(connection.Context(), conn.ACK_MAX_TIMEOUT)
+	defer cancel()
+
+	stream, err := connection.OpenStreamSync(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer stream.CancelRead(0)
+
+	frame := protocol.Frame{
+		Type:    protocol.DATA,
+		Flags:   protocol.ACK_REQUEST,
+		ID:      id,
+		Message: message,
+	}
+
+	if err := write(stream, frame); err != nil {
+		stream.CancelWrite(0)
+		return err
+	} else if err := stream.Close(); err != nil {
+		return err
+	}
+
+	acknowledged := false
+
+	stream.SetReadDeadline(time.Now().Add(conn.ACK_MAX_TIMEOUT))
+
+	err = read(stream, func(frame protocol.Frame) bool {
+		acknowledged = frame.Type == protocol.ACK && frame.ID == id
+
+		return !acknowledged
+	})
+
+	if err != nil {
+		return err
+	} else if !acknowledged {
+		return fmt.Errorf("no ACK from %v", connection.RemoteAddr())
+	}
+
+	return nil
+}
+
+// receive relays the event received on a stream to the router and acknowledges it.
+func receive(c conn.Conn, stream *QUIC.Stream, remote net.Addr, dedup *conn.Dedup, router *router.Switch) error {
+	defer stream.Close()
+
+	stream.SetReadDeadline(time.Now().Add(conn.ACK_MAX_TIMEOUT))
+
+	return read(stream, func(frame protocol.Frame) bool {
+		if frame.Type != protocol.DATA {
+			return true
+		}
+
+		c.Dumpf(frame.Message, "msg %v  received %v bytes from %v", frame.ID, len(frame.Message), remote)
+
+		if dedup.Duplicate(frame.ID, frame.Message) {
+			c.Infof("msg %v  discarding duplicate event from %v", frame.ID, remote)
+		} else {
+			router.Received(frame.ID, frame.Message, nil)
+		}
+
+		if frame.Flags&protocol.ACK_REQUEST == protocol.ACK_REQUEST {
+			if err := write(stream, protocol.Ack(frame.ID)); err != nil {
+				c.Warnf("msg %v  error acknowledging event from %v (%v)", frame.ID, remote, err)
+			}
+		}
+
+		return false
+	})
+}
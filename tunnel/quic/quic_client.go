@@ -0,0 +1,164 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync"
+	"time"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type quicClient struct {
+	conn.Conn
+	hwif       string
+	addr       *net.UDPAddr
+	config     *tls.Config
+	quic       *QUIC.Config
+	retry      conn.Backoff
+	timeout    time.Duration
+	connection *QUIC.Conn
+	router     *router.Switch
+	ctx        context.Context
+	closed     chan struct{}
+	sync.RWMutex
+}
+
+func NewQUICInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*quicClient, error) {
+	client, err := makeQUICClient(hwif, spec, ca, keypair, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::quic-client-in")
+	}
+
+	return client, err
+}
+
+func NewQUICOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*quicClient, error) {
+	client, err := makeQUICClient(hwif, spec, ca, keypair, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::quic-client-out")
+	}
+
+	return client, err
+}
+
+func makeQUICClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*quicClient, error) {
+	addr, host, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	client := quicClient{
+		Conn: conn.Conn{
+			Tag: "QUIC",
+		},
+		hwif:    hwif,
+		addr:    addr,
+		config:  clientConfig(host, ca, keypair),
+		quic:    quicConfig(heartbeat),
+		retry:   retry,
+		timeout: 5 * time.Second,
+		ctx:     ctx,
+		closed:  make(chan struct{}),
+	}
+
+	return &client, nil
+}
+
+func (q *quicClient) Close() {
+	q.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-q.closed:
+		q.Infof("closed")
+
+	case <-timeout.C:
+		q.Infof("close timeout")
+	}
+}
+
+func (q *quicClient) Run(router *router.Switch) error {
+	q.router = router
+	q.connect(router)
+	q.closed <- struct{}{}
+
+	return nil
+}
+
+// Send sends the request on a new stream. Requests are discarded while the client is not
+// connected.
+func (q *quicClient) Send(id uint32, msg []byte) {
+	q.RLock()
+	connection := q.connection
+	q.RUnlock()
+
+	if connection != nil {
+		go func() {
+			q.Infof("msg %v  relaying to %v", id, connection.RemoteAddr())
+
+			if err := request(q.Conn, connection, id, msg, IDLE_TIME, q.router); err != nil && !closed(err) {
+				q.Warnf("msg %v  error sending message to %v (%v)", id, connection.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (q *quicClient) connect(router *router.Switch) {
+	for {
+		q.Infof("connecting to %v", q.addr)
+
+		if connection, err := dial(q.hwif, q.addr, q.config, q.quic, q.timeout, q.Conn, q.ctx); err != nil {
+			q.Warnf("%v", err)
+		} else {
+			q.retry.Reset()
+
+			q.Lock()
+			q.connection = connection
+			q.Unlock()
+
+			if err := q.listen(connection, router); err != nil && !closed(err) && q.ctx.Err() == nil {
+				q.Warnf("%v", err)
+			}
+
+			q.Lock()
+			q.connection = nil
+			q.Unlock()
+		}
+
+		if !q.retry.Wait(q.Tag) {
+			return
+		}
+	}
+}
+
+func (q *quicClient) listen(connection *QUIC.Conn, router *router.Switch) error {
+	q.Infof("connected  to %v", connection.RemoteAddr())
+
+	stop := context.AfterFunc(q.ctx, func() {
+		connection.CloseWithError(CLOSED, "closed")
+	})
+
+	defer stop()
+	defer connection.CloseWithError(CLOSED, "closed")
+
+	for {
+		stream, err := connection.AcceptStream(q.ctx)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := reply(q.Conn, stream, connection.RemoteAddr(), IDLE_TIME, router); err != nil && !closed(err) {
+				q.Warnf("%v", err)
+			}
+		}()
+	}
+}
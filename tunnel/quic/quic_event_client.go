@@ -0,0 +1,109 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type quicEventClient struct {
+	conn.Forwarder
+	hwif    string
+	addr    *net.UDPAddr
+	config  *tls.Config
+	quic    *QUIC.Config
+	retry   conn.Backoff
+	timeout time.Duration
+	ctx     context.Context
+	closed  chan struct{}
+
+	received func(*QUIC.Stream, net.Addr, *router.Switch) error
+	send     func(*QUIC.Conn, uint32, []byte) error
+}
+
+func (q *quicEventClient) Close() {
+	q.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-q.closed:
+		q.Infof("closed")
+
+	case <-timeout.C:
+		q.Infof("close timeout")
+	}
+}
+
+func (q *quicEventClient) Run(router *router.Switch) error {
+	q.connect(router)
+	q.closed <- struct{}{}
+
+	return nil
+}
+
+func (q *quicEventClient) connect(router *router.Switch) {
+	for {
+		q.Infof("connecting to %v", q.addr)
+
+		if connection, err := dial(q.hwif, q.addr, q.config, q.quic, q.timeout, q.Conn, q.ctx); err != nil {
+			q.Warnf("%v", err)
+		} else {
+			q.retry.Reset()
+
+			go func() {
+				q.recv(connection)
+			}()
+
+			if err := q.listen(connection, router); err != nil && !closed(err) && q.ctx.Err() == nil {
+				q.Warnf("%v", err)
+			}
+		}
+
+		if !q.retry.Wait(q.Tag) {
+			return
+		}
+	}
+}
+
+func (q *quicEventClient) listen(connection *QUIC.Conn, router *router.Switch) error {
+	q.Infof("connected  to %v", connection.RemoteAddr())
+
+	stop := context.AfterFunc(q.ctx, func() {
+		connection.CloseWithError(CLOSED, "closed")
+	})
+
+	defer stop()
+	defer connection.CloseWithError(CLOSED, "closed")
+
+	for {
+		stream, err := connection.AcceptStream(q.ctx)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := q.received(stream, connection.RemoteAddr(), router); err != nil && !closed(err) {
+				q.Warnf("%v", err)
+			}
+		}()
+	}
+}
+
+// recv relays events over the connection until it is closed. An event is only removed from the
+// queue once it has been acknowledged - if an event is not acknowledged the connection is closed
+// and the event is relayed again once the client has reconnected.
+func (q *quicEventClient) recv(connection *QUIC.Conn) {
+	send := func(id uint32, msg []byte) error {
+		return q.send(connection, id, msg)
+	}
+
+	if err := q.Forward(connection.Context().Done(), connection.RemoteAddr(), send); err != nil {
+		connection.CloseWithError(NO_ACK, "no ACK")
+	}
+}
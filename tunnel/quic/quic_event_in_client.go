@@ -0,0 +1,56 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type quicEventInClient struct {
+	quicEventClient
+	dedup *conn.Dedup
+}
+
+func NewQUICEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*quicEventInClient, error) {
+	addr, host, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	q := quicEventInClient{
+		quicEventClient{
+			Forwarder: conn.NewForwarder("QUIC", nil),
+			hwif:      hwif,
+			addr:      addr,
+			config:    clientConfig(host, ca, keypair),
+			quic:      quicConfig(heartbeat),
+			retry:     retry,
+			timeout:   5 * time.Second,
+			ctx:       ctx,
+			closed:    make(chan struct{}),
+		},
+		conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	q.quicEventClient.received = q.received
+	q.quicEventClient.send = q.send
+
+	q.Infof("connector::quic-event-in-client")
+
+	return &q, nil
+}
+
+func (q *quicEventInClient) received(stream *QUIC.Stream, remote net.Addr, router *router.Switch) error {
+	return receive(q.Conn, stream, remote, q.dedup, router)
+}
+
+func (q *quicEventInClient) send(connection *QUIC.Conn, id uint32, msg []byte) error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type quicEventInServer struct {
+	quicEventServer
+	dedup *conn.Dedup
+}
+
+func NewQUICEventInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*quicEventInServer, error) {
+	addr, _, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	q := quicEventInServer{
+		quicEventServer{
+			Conn: conn.Conn{
+				Tag: "QUIC",
+			},
+			hwif:        hwif,
+			addr:        addr,
+			config:      serverConfig(ca, keypair, requireClientCertificate),
+			quic:        quicConfig(heartbeat),
+			retry:       retry,
+			connections: map[*QUIC.Conn]struct{}{},
+			ctx:         ctx,
+			closed:      make(chan struct{}),
+		},
+		conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	q.quicEventServer.received = q.received
+	q.quicEventServer.send = q.send
+
+	q.Infof("connector::quic-event-in-server")
+
+	return &q, nil
+}
+
+func (q *quicEventInServer) received(stream *QUIC.Stream, remote net.Addr, router *router.Switch) error {
+	return receive(q.Conn, stream, remote, q.dedup, router)
+}
+
+func (q *quicEventInServer) send(connection *QUIC.Conn, id uint32, message []byte) {
+}
@@ -0,0 +1,65 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type quicEventOutClient struct {
+	quicEventClient
+}
+
+func NewQUICEventOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (*quicEventOutClient, error) {
+	addr, host, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	q := quicEventOutClient{
+		quicEventClient{
+			Forwarder: conn.NewForwarder("QUIC", queue),
+			hwif:      hwif,
+			addr:      addr,
+			config:    clientConfig(host, ca, keypair),
+			quic:      quicConfig(heartbeat),
+			retry:     retry,
+			timeout:   5 * time.Second,
+			ctx:       ctx,
+			closed:    make(chan struct{}),
+		},
+	}
+
+	q.quicEventClient.received = q.received
+	q.quicEventClient.send = q.send
+
+	q.Infof("connector::quic-event-out-client")
+
+	return &q, nil
+}
+
+func (q *quicEventOutClient) received(stream *QUIC.Stream, remote net.Addr, router *router.Switch) error {
+	// ... events are relayed in one direction only so incoming streams are discarded
+	stream.CancelRead(0)
+	stream.Close()
+
+	return nil
+}
+
+func (q *quicEventOutClient) send(connection *QUIC.Conn, id uint32, msg []byte) error {
+	if err := deliver(connection, id, msg); err != nil {
+		q.Warnf("msg %v  error sending message to %v (%v)", id, connection.RemoteAddr(), err)
+		return err
+	} else {
+		q.Infof("msg %v  sent %v bytes to %v", id, len(msg), connection.RemoteAddr())
+	}
+
+	return nil
+}
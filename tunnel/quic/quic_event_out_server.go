@@ -0,0 +1,63 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type quicEventOutServer struct {
+	quicEventServer
+}
+
+func NewQUICEventOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*quicEventOutServer, error) {
+	addr, _, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	q := quicEventOutServer{
+		quicEventServer{
+			Conn: conn.Conn{
+				Tag: "QUIC",
+			},
+			hwif:        hwif,
+			addr:        addr,
+			config:      serverConfig(ca, keypair, requireClientCertificate),
+			quic:        quicConfig(heartbeat),
+			retry:       retry,
+			connections: map[*QUIC.Conn]struct{}{},
+			ctx:         ctx,
+			closed:      make(chan struct{}),
+		},
+	}
+
+	q.quicEventServer.received = q.received
+	q.quicEventServer.send = q.send
+
+	q.Infof("connector::quic-event-out-server")
+
+	return &q, nil
+}
+
+func (q *quicEventOutServer) received(stream *QUIC.Stream, remote net.Addr, router *router.Switch) error {
+	// ... events are relayed in one direction only so incoming streams are discarded
+	stream.CancelRead(0)
+	stream.Close()
+
+	return nil
+}
+
+func (q *quicEventOutServer) send(connection *QUIC.Conn, id uint32, message []byte) {
+	if err := deliver(connection, id, message); err != nil {
+		q.Warnf("msg %v  error sending message to %v (%v)", id, connection.RemoteAddr(), err)
+	} else {
+		q.Infof("msg %v  sent %v bytes to %v", id, len(message), connection.RemoteAddr())
+	}
+}
@@ -0,0 +1,146 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type quicEventServer struct {
+	conn.Conn
+	hwif        string
+	addr        *net.UDPAddr
+	config      *tls.Config
+	quic        *QUIC.Config
+	retry       conn.Backoff
+	connections map[*QUIC.Conn]struct{}
+	ctx         context.Context
+	closed      chan struct{}
+	sync.RWMutex
+
+	received func(*QUIC.Stream, net.Addr, *router.Switch) error
+	send     func(*QUIC.Conn, uint32, []byte)
+}
+
+func (q *quicEventServer) Close() {
+	q.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-q.closed:
+		q.Infof("closed")
+
+	case <-timeout.C:
+		q.Infof("close timeout")
+	}
+}
+
+func (q *quicEventServer) Send(id uint32, message []byte) {
+	q.RLock()
+	defer q.RUnlock()
+
+	for connection := range q.connections {
+		go func() {
+			q.send(connection, id, message)
+		}()
+	}
+}
+
+func (q *quicEventServer) Run(router *router.Switch) error {
+	go func() {
+		for {
+			if socket, err := listen(q.hwif, q.addr, q.Conn); err != nil {
+				q.Warnf("%v", err)
+			} else {
+				transport := QUIC.Transport{
+					Conn: socket,
+				}
+
+				if listener, err := transport.Listen(q.config, q.quic); err != nil {
+					q.Warnf("%v", err)
+				} else {
+					q.retry.Reset()
+					q.listen(listener, router)
+				}
+
+				transport.Close()
+				socket.Close()
+			}
+
+			if q.ctx.Err() != nil || !q.retry.Wait(q.Tag) {
+				break
+			}
+		}
+
+		q.RLock()
+		for connection := range q.connections {
+			connection.CloseWithError(CLOSED, "closed")
+		}
+		q.RUnlock()
+
+		q.closed <- struct{}{}
+	}()
+
+	<-q.ctx.Done()
+
+	return nil
+}
+
+func (q *quicEventServer) listen(listener *QUIC.Listener, router *router.Switch) {
+	q.Infof("listening on %v", listener.Addr())
+
+	defer listener.Close()
+
+	for {
+		connection, err := listener.Accept(q.ctx)
+		if err != nil && !closed(err) {
+			q.Errorf("%v", err)
+		}
+
+		if err != nil {
+			return
+		}
+
+		q.Infof("incoming connection (%v)", connection.RemoteAddr())
+
+		q.Lock()
+		q.connections[connection] = struct{}{}
+		q.Unlock()
+
+		go func() {
+			if err := q.accept(connection, router); err != nil && !closed(err) {
+				q.Warnf("%v", err)
+			} else {
+				q.Infof("client connection %v closed", connection.RemoteAddr())
+			}
+
+			q.Lock()
+			delete(q.connections, connection)
+			q.Unlock()
+		}()
+	}
+}
+
+func (q *quicEventServer) accept(connection *QUIC.Conn, router *router.Switch) error {
+	defer connection.CloseWithError(CLOSED, "closed")
+
+	for {
+		stream, err := connection.AcceptStream(q.ctx)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := q.received(stream, connection.RemoteAddr(), router); err != nil && !closed(err) {
+				q.Warnf("%v", err)
+			}
+		}()
+	}
+}
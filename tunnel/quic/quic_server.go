@@ -0,0 +1,193 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync"
+	"time"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type quicServer struct {
+	conn.Conn
+	hwif        string
+	addr        *net.UDPAddr
+	config      *tls.Config
+	quic        *QUIC.Config
+	retry       conn.Backoff
+	connections map[*QUIC.Conn]struct{}
+	router      *router.Switch
+	ctx         context.Context
+	closed      chan struct{}
+	sync.RWMutex
+}
+
+func NewQUICInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*quicServer, error) {
+	server, err := makeQUICServer(hwif, spec, ca, keypair, requireClientCertificate, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::quic-server-in")
+	}
+
+	return server, err
+}
+
+func NewQUICOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*quicServer, error) {
+	server, err := makeQUICServer(hwif, spec, ca, keypair, requireClientCertificate, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::quic-server-out")
+	}
+
+	return server, err
+}
+
+func makeQUICServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*quicServer, error) {
+	addr, _, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	server := quicServer{
+		Conn: conn.Conn{
+			Tag: "QUIC",
+		},
+		hwif:        hwif,
+		addr:        addr,
+		config:      serverConfig(ca, keypair, requireClientCertificate),
+		quic:        quicConfig(heartbeat),
+		retry:       retry,
+		connections: map[*QUIC.Conn]struct{}{},
+		ctx:         ctx,
+		closed:      make(chan struct{}),
+	}
+
+	return &server, nil
+}
+
+func (q *quicServer) Close() {
+	q.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-q.closed:
+		q.Infof("closed")
+
+	case <-timeout.C:
+		q.Infof("close timeout")
+	}
+}
+
+func (q *quicServer) Run(router *router.Switch) error {
+	q.router = router
+
+	go func() {
+		for {
+			if socket, err := listen(q.hwif, q.addr, q.Conn); err != nil {
+				q.Warnf("%v", err)
+			} else {
+				transport := QUIC.Transport{
+					Conn: socket,
+				}
+
+				if listener, err := transport.Listen(q.config, q.quic); err != nil {
+					q.Warnf("%v", err)
+				} else {
+					q.retry.Reset()
+					q.listen(listener, router)
+				}
+
+				transport.Close()
+				socket.Close()
+			}
+
+			if q.ctx.Err() != nil || !q.retry.Wait(q.Tag) {
+				break
+			}
+		}
+
+		q.RLock()
+		for connection := range q.connections {
+			connection.CloseWithError(CLOSED, "closed")
+		}
+		q.RUnlock()
+
+		q.closed <- struct{}{}
+	}()
+
+	<-q.ctx.Done()
+
+	return nil
+}
+
+// Send sends the request to every connected client, each on a new stream.
+func (q *quicServer) Send(id uint32, message []byte) {
+	q.RLock()
+	defer q.RUnlock()
+
+	for connection := range q.connections {
+		go func() {
+			if err := request(q.Conn, connection, id, message, IDLE_TIME, q.router); err != nil && !closed(err) {
+				q.Warnf("msg %v  error sending message to %v (%v)", id, connection.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (q *quicServer) listen(listener *QUIC.Listener, router *router.Switch) {
+	q.Infof("listening on %v", listener.Addr())
+
+	defer listener.Close()
+
+	for {
+		connection, err := listener.Accept(q.ctx)
+		if err != nil && !closed(err) {
+			q.Errorf("%v", err)
+		}
+
+		if err != nil {
+			return
+		}
+
+		q.Infof("incoming connection (%v)", connection.RemoteAddr())
+
+		q.Lock()
+		q.connections[connection] = struct{}{}
+		q.Unlock()
+
+		go func() {
+			if err := q.accept(connection, router); err != nil && !closed(err) {
+				q.Warnf("%v", err)
+			} else {
+				q.Infof("client connection %v closed", connection.RemoteAddr())
+			}
+
+			q.Lock()
+			delete(q.connections, connection)
+			q.Unlock()
+		}()
+	}
+}
+
+func (q *quicServer) accept(connection *QUIC.Conn, router *router.Switch) error {
+	defer connection.CloseWithError(CLOSED, "closed")
+
+	for {
+		stream, err := connection.AcceptStream(q.ctx)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := reply(q.Conn, stream, connection.RemoteAddr(), IDLE_TIME, router); err != nil && !closed(err) {
+				q.Warnf("%v", err)
+			}
+		}()
+	}
+}
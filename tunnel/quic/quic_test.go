@@ -0,0 +1,216 @@
+package quic
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	QUIC "github.com/quic-go/quic-go"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestQUICScenarios(t *testing.T) {
+	ca, keypair := loopback.Certificates(t)
+
+	loopback.Scenarios(t, loopback.Transport{
+		Network: "udp",
+
+		Requests: func(t *testing.T, server string, client string, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			return loopback.Must(t)(NewQUICOutServer("", server, ca, keypair, false, retry, conn.Heartbeat{}, ctx)),
+				loopback.Must(t)(NewQUICInClient("", client, ca, nil, retry, conn.Heartbeat{}, ctx))
+		},
+
+		Events: func(t *testing.T, server string, client string, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			return loopback.Must(t)(NewQUICEventInServer("", server, ca, keypair, false, retry, heartbeat, ctx)),
+				loopback.Must(t)(NewQUICEventOutClient("", client, ca, nil, retry, heartbeat, queue, ctx))
+		},
+
+		Connected: func(server loopback.Connector) any {
+			switch s := server.(type) {
+			case *quicServer:
+				s.RLock()
+				defer s.RUnlock()
+
+				for c := range s.connections {
+					return c
+				}
+
+			case *quicEventInServer:
+				s.RLock()
+				defer s.RUnlock()
+
+				for c := range s.connections {
+					return c
+				}
+			}
+
+			return nil
+		},
+	})
+}
+
+// The replier closes a request stream once it has not sent a reply for the idle time, which
+// ends the request without an error.
+func TestQUICReplierClosesIdleStream(t *testing.T) {
+	idle := 250 * time.Millisecond
+	requester, replier := pair(t)
+
+	s1 := loopback.Echo(t)
+	s2 := loopback.Sink(t)
+
+	go func() {
+		if stream, err := replier.AcceptStream(context.Background()); err == nil {
+			reply(conn.Conn{Tag: "QUIC"}, stream, requester.LocalAddr(), idle, s1)
+		}
+	}()
+
+	replies := make(chan []byte, 1)
+	s2.Expect(12345, func(reply []byte) {
+		replies <- reply
+	})
+
+	start := time.Now()
+	err := request(conn.Conn{Tag: "QUIC"}, requester, 12345, loopback.REQUEST, idle, s2)
+	dt := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	select {
+	case reply := <-replies:
+		if string(reply) != string(loopback.REQUEST) {
+			t.Errorf("incorrect reply - expected:%v, got:%v", loopback.REQUEST, reply)
+		}
+
+	default:
+		t.Errorf("no reply")
+	}
+
+	if dt < idle || dt >= 2*idle {
+		t.Errorf("incorrect stream lifetime - expected:%v, got:%v", idle, dt)
+	}
+}
+
+// The requester gives up on a request stream that the replier neither answers nor closes
+// after twice the idle time.
+func TestQUICRequesterTimeout(t *testing.T) {
+	idle := 250 * time.Millisecond
+	requester, replier := pair(t)
+
+	// ... accepts the request stream but never replies (the stream is closed with the connection)
+	go replier.AcceptStream(context.Background())
+
+	start := time.Now()
+	err := request(conn.Conn{Tag: "QUIC"}, requester, 12345, loopback.REQUEST, idle, loopback.Sink(t))
+	dt := time.Since(start)
+
+	var e net.Error
+	if err == nil {
+		t.Fatalf("expected request timeout, got:%v", err)
+	} else if !errors.As(err, &e) || !e.Timeout() {
+		t.Fatalf("incorrect error - expected:timeout, got:%v", err)
+	}
+
+	if dt < 2*idle || dt >= 3*idle {
+		t.Errorf("incorrect request timeout - expected:%v, got:%v", 2*idle, dt)
+	}
+}
+
+// A reply received after the reply handler for the request has been removed is discarded rather
+// than being relayed as an event.
+func TestQUICRequesterDiscardsLateReply(t *testing.T) {
+	idle := 250 * time.Millisecond
+	requester, replier := pair(t)
+
+	go func() {
+		if stream, err := replier.AcceptStream(context.Background()); err == nil {
+			reply(conn.Conn{Tag: "QUIC"}, stream, requester.LocalAddr(), idle, loopback.Echo(t))
+		}
+	}()
+
+	relayed := make(chan uint32, 1)
+	s := loopback.NewSwitch(t, func(id uint32, message []byte, h func([]byte)) {
+		relayed <- id
+	})
+
+	if err := request(conn.Conn{Tag: "QUIC"}, requester, 12345, loopback.REQUEST, idle, s); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	select {
+	case id := <-relayed:
+		t.Errorf("late reply relayed as event %v", id)
+
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestQUICConfig(t *testing.T) {
+	tests := []struct {
+		heartbeat conn.Heartbeat
+		keepalive time.Duration
+		idle      time.Duration
+	}{
+		{conn.Heartbeat{}, KEEPALIVE, 0},
+		{conn.Heartbeat{Interval: 10 * time.Second, Misses: 3}, 10 * time.Second, 30 * time.Second},
+	}
+
+	for _, test := range tests {
+		config := quicConfig(test.heartbeat)
+
+		if config.KeepAlivePeriod != test.keepalive {
+			t.Errorf("incorrect keep-alive for %v - expected:%v, got:%v", test.heartbeat, test.keepalive, config.KeepAlivePeriod)
+		}
+
+		if config.MaxIdleTimeout != test.idle {
+			t.Errorf("incorrect idle timeout for %v - expected:%v, got:%v", test.heartbeat, test.idle, config.MaxIdleTimeout)
+		}
+	}
+}
+
+// pair returns the two ends of a QUIC connection over the loopback interface. The connections
+// are closed when the test completes.
+func pair(t *testing.T) (*QUIC.Conn, *QUIC.Conn) {
+	t.Helper()
+
+	ca, keypair := loopback.Certificates(t)
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	listener, err := QUIC.ListenAddr(addr.String(), serverConfig(ca, keypair, false), quicConfig(conn.Heartbeat{}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), loopback.TIMEOUT)
+	defer cancel()
+
+	client, err := QUIC.DialAddr(ctx, listener.Addr().String(), clientConfig("127.0.0.1", ca, nil), quicConfig(conn.Heartbeat{}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	t.Cleanup(func() {
+		client.CloseWithError(CLOSED, "")
+		server.CloseWithError(CLOSED, "")
+	})
+
+	return client, server
+}
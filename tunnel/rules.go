@@ -0,0 +1,136 @@
+package tunnel
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+// Rule routes the messages received on a connector to one or more connectors. A rule matches
+// a message if the message matches all the rule criteria, where an empty criterion matches
+// any message:
+//   - Source: names of the connectors on which the message was received
+//   - Serial: controller serial numbers (or ranges of serial numbers)
+//   - Function: UHPPOTE function codes
+//
+// The serial number and function code criteria only match UHPPOTE messages.
+type Rule struct {
+	Source   []string
+	Serial   []Range
+	Function []uint8
+	To       []string
+}
+
+// Match returns true if the message received on the source connector matches the rule.
+func (r Rule) Match(source string, message []byte) bool {
+	if len(r.Source) > 0 && !slices.Contains(r.Source, source) {
+		return false
+	}
+
+	if len(r.Serial) > 0 || len(r.Function) > 0 {
+		if !isUHPPOTE(message) {
+			return false
+		}
+
+		if len(r.Serial) > 0 {
+			serial := binary.LittleEndian.Uint32(message[4:])
+			if !slices.ContainsFunc(r.Serial, func(v Range) bool { return v.Contains(serial) }) {
+				return false
+			}
+		}
+
+		if len(r.Function) > 0 && !slices.Contains(r.Function, message[1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Range is an inclusive range of controller serial numbers.
+type Range struct {
+	From uint32
+	To   uint32
+}
+
+// Serial returns a Range that matches a single controller serial number.
+func Serial(serial uint32) Range {
+	return Range{From: serial, To: serial}
+}
+
+func (r Range) Contains(serial uint32) bool {
+	return serial >= r.From && serial <= r.To
+}
+
+func (r Range) String() string {
+	if r.From == r.To {
+		return fmt.Sprintf("%v", r.From)
+	}
+
+	return fmt.Sprintf("%v-%v", r.From, r.To)
+}
+
+func (r Rule) routes(connector string) bool {
+	return slices.Contains(r.To, connector)
+}
+
+func isUHPPOTE(message []byte) bool {
+	return len(message) == 64 && message[0] == 0x17
+}
+
+// Route maps a controller serial number (or range of serial numbers) to one or more 'out'
+// connectors.
+type Route struct {
+	Serial Range
+	To     []string
+}
+
+// Routes returns the routing rules for a serial number routing table:
+//   - requests from the 'in' connectors are routed to the connectors for the most specific
+//     route that matches the controller serial number
+//   - broadcast requests (serial number 0) are routed to all the 'out' connectors (unless
+//     explicitly routed)
+//   - messages from the 'out' connectors (e.g. events) are routed to all the 'in' connectors.
+//
+// Requests for controllers that do not match any route are discarded.
+func Routes(routes []Route, in []string, out []string) []Rule {
+	rules := []Rule{}
+	sorted := slices.Clone(routes)
+	broadcast := true
+
+	slices.SortStableFunc(sorted, func(p, q Route) int {
+		if dp, dq := p.Serial.To-p.Serial.From, q.Serial.To-q.Serial.From; dp != dq {
+			return cmp.Compare(dp, dq)
+		}
+
+		return cmp.Compare(p.Serial.From, q.Serial.From)
+	})
+
+	for _, route := range sorted {
+		if route.Serial.Contains(0) {
+			broadcast = false
+		}
+
+		rules = append(rules, Rule{
+			Source: in,
+			Serial: []Range{route.Serial},
+			To:     route.To,
+		})
+	}
+
+	if broadcast {
+		rules = append(rules, Rule{
+			Source: in,
+			Serial: []Range{Serial(0)},
+			To:     out,
+		})
+	}
+
+	rules = append(rules, Rule{
+		Source: out,
+		To:     in,
+	})
+
+	return rules
+}
@@ -0,0 +1,279 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	SSH "golang.org/x/crypto/ssh"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// The SSH connectors carry the tunnel protocol frames over a single SSH channel of type
+// 'uhppoted-tunnel', so the connectors use the same session framing, heartbeats and
+// acknowledgements as the TCP and TLS connectors.
+//
+// Clients authenticate with a private key and verify the server host key against a known_hosts
+// file. The server accepts clients with a public key listed in an authorized_keys file (re-read
+// for every connection so that keys can be added or revoked without a restart) and rejects all
+// other channel types i.e. it does not provide a shell, command execution or port forwarding.
+
+const CHANNEL = "uhppoted-tunnel"
+const USER = "uhppoted"
+
+// channel wraps the tunnel SSH channel as a net.Conn. Closing the channel closes the SSH
+// connection.
+type channel struct {
+	SSH.Channel
+	conn SSH.Conn
+}
+
+func (c channel) Close() error {
+	c.Channel.Close()
+
+	return c.conn.Close()
+}
+
+func (c channel) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c channel) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c channel) SetDeadline(t time.Time) error {
+	return errors.ErrUnsupported
+}
+
+func (c channel) SetReadDeadline(t time.Time) error {
+	return errors.ErrUnsupported
+}
+
+func (c channel) SetWriteDeadline(t time.Time) error {
+	return errors.ErrUnsupported
+}
+
+// resolve splits a connector spec of the form [<user>@]<host:port> into the TCP address, the
+// host:port and the SSH user (defaults to 'uhppoted').
+func resolve(spec string) (*net.TCPAddr, string, string, error) {
+	user, hostport := split(spec)
+
+	addr, err := net.ResolveTCPAddr("tcp", hostport)
+	if err != nil {
+		return nil, "", "", err
+	} else if addr == nil {
+		return nil, "", "", fmt.Errorf("unable to resolve TCP address '%v'", hostport)
+	} else if addr.Port == 0 {
+		return nil, "", "", fmt.Errorf("SSH host requires a non-zero port")
+	}
+
+	return addr, hostport, user, nil
+}
+
+// target parses a client connector spec of the form [<user>@]<host:port>, returning the address to
+// dial, the host and the user. The host is only resolved locally if the connector is not connecting
+// through a proxy.
+func target(spec string, proxy conn.Proxy) (string, string, string, error) {
+	user, hostport := split(spec)
+
+	if addr, err := proxy.Resolve(hostport); err != nil {
+		return "", "", "", err
+	} else if _, port, _ := net.SplitHostPort(hostport); port == "" || port == "0" {
+		return "", "", "", fmt.Errorf("SSH host requires a non-zero port")
+	} else {
+		return addr, hostport, user, nil
+	}
+}
+
+func split(spec string) (string, string) {
+	if ix := strings.LastIndex(spec, "@"); ix >= 0 {
+		return spec[:ix], spec[ix+1:]
+	}
+
+	return USER, spec
+}
+
+func clientConfig(user string, key SSH.Signer, hostkeys SSH.HostKeyCallback, timeout time.Duration) *SSH.ClientConfig {
+	return &SSH.ClientConfig{
+		User:            user,
+		Auth:            []SSH.AuthMethod{SSH.PublicKeys(key)},
+		HostKeyCallback: hostkeys,
+		Timeout:         timeout,
+	}
+}
+
+// serverConfig returns the SSH server configuration for the host key, authenticating clients
+// against the public keys in the authorized_keys file.
+func serverConfig(hostkey SSH.Signer, authorizedKeys string, c *conn.Conn) *SSH.ServerConfig {
+	config := SSH.ServerConfig{
+		PublicKeyCallback: func(meta SSH.ConnMetadata, key SSH.PublicKey) (*SSH.Permissions, error) {
+			keys, err := authorized(authorizedKeys, c)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, k := range keys {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return &SSH.Permissions{
+						Extensions: map[string]string{
+							"pubkey-fp": SSH.FingerprintSHA256(key),
+						},
+					}, nil
+				}
+			}
+
+			return nil, fmt.Errorf("unknown public key %v for %v from %v", SSH.FingerprintSHA256(key), meta.User(), meta.RemoteAddr())
+		},
+	}
+
+	config.AddHostKey(hostkey)
+
+	return &config
+}
+
+// authorized returns the public keys in an authorized_keys file, skipping (with a warning) any
+// lines that are not valid public keys.
+func authorized(file string, c *conn.Conn) ([]SSH.PublicKey, error) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []SSH.PublicKey{}
+	for i, line := range strings.Split(string(bytes), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, _, _, _, err := SSH.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			c.Warnf("%v: line %v: invalid public key (%v)", file, i+1, err)
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// dial opens an SSH connection to the server (through the proxy, if enabled) and returns the
+// tunnel channel wrapped as a net.Conn.
+func dial(ctx context.Context, hwif string, addr string, host string, config *SSH.ClientConfig, proxy conn.Proxy, timeout time.Duration, c conn.Conn) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if hwif != "" {
+				return conn.BindToDevice(connection, hwif, network == "tcp4", c)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	socket, err := proxy.DialContext(ctx, dialer, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	socket.SetDeadline(time.Now().Add(timeout))
+
+	sshconn, channels, requests, err := SSH.NewClientConn(socket, host, config)
+	if err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	go SSH.DiscardRequests(requests)
+	go reject(channels)
+
+	ch, requests, err := sshconn.OpenChannel(CHANNEL, nil)
+	if err != nil {
+		sshconn.Close()
+		return nil, err
+	}
+
+	go SSH.DiscardRequests(requests)
+
+	socket.SetDeadline(time.Time{})
+
+	return channel{ch, sshconn}, nil
+}
+
+// listen opens the listen socket for an SSH server.
+func listen(hwif string, addr *net.TCPAddr, c conn.Conn) (net.Listener, error) {
+	listener := net.ListenConfig{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if hwif != "" {
+				return conn.BindToDevice(connection, hwif, conn.IsIPv4(addr.IP), c)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	socket, err := listener.Listen(context.Background(), "tcp", fmt.Sprintf("%v", addr))
+	if err != nil {
+		return nil, err
+	} else if socket == nil {
+		return nil, fmt.Errorf("failed to create TCP listen socket (%v)", socket)
+	}
+
+	return socket, nil
+}
+
+// accept completes the SSH handshake for an incoming connection and waits for the client to open
+// the tunnel channel, which is returned wrapped as a net.Conn.
+func accept(socket net.Conn, config *SSH.ServerConfig, timeout time.Duration) (net.Conn, error) {
+	socket.SetDeadline(time.Now().Add(timeout))
+
+	sshconn, channels, requests, err := SSH.NewServerConn(socket, config)
+	if err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	go SSH.DiscardRequests(requests)
+
+	accepted := make(chan SSH.Channel, 1)
+
+	go func() {
+		for ch := range channels {
+			if ch.ChannelType() != CHANNEL {
+				ch.Reject(SSH.UnknownChannelType, "unsupported channel type")
+			} else if c, requests, err := ch.Accept(); err == nil {
+				go SSH.DiscardRequests(requests)
+
+				accepted <- c
+				break
+			}
+		}
+
+		reject(channels)
+	}()
+
+	select {
+	case ch := <-accepted:
+		socket.SetDeadline(time.Time{})
+		return channel{ch, sshconn}, nil
+
+	case <-time.After(timeout):
+		sshconn.Close()
+		return nil, fmt.Errorf("timeout waiting for %v channel from %v", CHANNEL, sshconn.RemoteAddr())
+	}
+}
+
+// reject rejects any further channels opened by the remote end.
+func reject(channels <-chan SSH.NewChannel) {
+	for ch := range channels {
+		ch.Reject(SSH.Prohibited, "only one channel per connection")
+	}
+}
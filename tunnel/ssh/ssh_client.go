@@ -0,0 +1,187 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	SSH "golang.org/x/crypto/ssh"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type sshClient struct {
+	conn.Conn
+	hwif      string
+	addr      string
+	host      string
+	config    *SSH.ClientConfig
+	retry     conn.Backoff
+	heartbeat conn.Heartbeat
+	proxy     conn.Proxy
+	timeout   time.Duration
+	ch        chan protocol.Message
+	ctx       context.Context
+	closed    chan struct{}
+}
+
+func NewSSHInClient(hwif string, spec string, key SSH.Signer, hostkeys SSH.HostKeyCallback, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*sshClient, error) {
+	client, err := makeSSHClient(hwif, spec, key, hostkeys, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::ssh-client-in")
+	}
+
+	return client, err
+}
+
+func NewSSHOutClient(hwif string, spec string, key SSH.Signer, hostkeys SSH.HostKeyCallback, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*sshClient, error) {
+	client, err := makeSSHClient(hwif, spec, key, hostkeys, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::ssh-client-out")
+	}
+
+	return client, err
+}
+
+func makeSSHClient(hwif string, spec string, key SSH.Signer, hostkeys SSH.HostKeyCallback, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*sshClient, error) {
+	addr, host, user, err := target(spec, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := 5 * time.Second
+	client := sshClient{
+		Conn: conn.Conn{
+			Tag: "SSH",
+		},
+		hwif:      hwif,
+		addr:      addr,
+		host:      host,
+		config:    clientConfig(user, key, hostkeys, timeout),
+		retry:     retry,
+		heartbeat: heartbeat,
+		proxy:     proxy,
+		timeout:   timeout,
+		ch:        make(chan protocol.Message, 16),
+		ctx:       ctx,
+		closed:    make(chan struct{}),
+	}
+
+	return &client, nil
+}
+
+func (ssh *sshClient) Close() {
+	ssh.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-ssh.closed:
+		ssh.Infof("closed")
+
+	case <-timeout.C:
+		ssh.Infof("close timeout")
+	}
+}
+
+func (ssh *sshClient) Run(router *router.Switch) error {
+	ssh.connect(router)
+	ssh.closed <- struct{}{}
+
+	return nil
+}
+
+func (ssh *sshClient) Send(id uint32, msg []byte) {
+	select {
+	case ssh.ch <- protocol.Message{ID: id, Message: msg}:
+	default:
+	}
+}
+
+func (ssh *sshClient) connect(router *router.Switch) {
+	for {
+		ssh.Infof("connecting to %v@%v", ssh.config.User, ssh.host)
+
+		if socket, err := dial(ssh.ctx, ssh.hwif, ssh.addr, ssh.host, ssh.config, ssh.proxy, ssh.timeout, ssh.Conn); err != nil {
+			ssh.Warnf("%v", err)
+		} else {
+			ssh.retry.Reset()
+			session := conn.NewSession(ssh.Conn, socket, ssh.heartbeat)
+			eof := make(chan struct{})
+
+			go func() {
+				for {
+					select {
+					case msg := <-ssh.ch:
+						ssh.Infof("msg %v  relaying to %v", msg.ID, socket.RemoteAddr())
+						ssh.send(session, msg.ID, msg.Message)
+
+					case <-eof:
+						return
+
+					case <-ssh.ctx.Done():
+						socket.Close()
+						return
+					}
+				}
+			}()
+
+			if err := ssh.listen(socket, session, router); err != nil && !errors.Is(err, io.EOF) && ssh.ctx.Err() == nil {
+				ssh.Warnf("%v", err)
+			}
+
+			close(eof)
+		}
+
+		if !ssh.retry.Wait(ssh.Tag) {
+			return
+		}
+	}
+}
+
+func (ssh *sshClient) listen(socket net.Conn, session *conn.Session, router *router.Switch) error {
+	ssh.Infof("connected  to %v", socket.RemoteAddr())
+
+	defer socket.Close()
+	defer session.Close()
+
+	if err := session.Start(); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 2048)
+
+	for {
+		N, err := socket.Read(buffer)
+		if err != nil {
+			return err
+		}
+
+		ssh.received(buffer[:N], session, router, socket)
+	}
+}
+
+func (ssh *sshClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	ssh.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
+
+		router.Received(id, msg.Message, func(message []byte) {
+			ssh.send(session, id, message)
+		})
+	}
+}
+
+func (ssh *sshClient) send(session *conn.Session, id uint32, msg []byte) {
+	if err := session.Send(id, msg); err != nil {
+		ssh.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
+	} else {
+		ssh.Infof("msg %v  sent %v bytes to %v", id, len(msg), session.RemoteAddr())
+	}
+}
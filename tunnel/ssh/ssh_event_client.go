@@ -0,0 +1,25 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"time"
+
+	SSH "golang.org/x/crypto/ssh"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type sshEventClient struct {
+	conn.EventClient
+	hwif    string
+	addr    string
+	host    string
+	config  *SSH.ClientConfig
+	proxy   conn.Proxy
+	timeout time.Duration
+}
+
+func (ssh *sshEventClient) dial(ctx context.Context) (net.Conn, error) {
+	return dial(ctx, ssh.hwif, ssh.addr, ssh.host, ssh.config, ssh.proxy, ssh.timeout, ssh.Conn)
+}
@@ -0,0 +1,71 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	SSH "golang.org/x/crypto/ssh"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type sshEventInClient struct {
+	sshEventClient
+	dedup *conn.Dedup
+}
+
+func NewSSHEventInClient(hwif string, spec string, key SSH.Signer, hostkeys SSH.HostKeyCallback, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*sshEventInClient, error) {
+	client, err := makeSSHEventInClient(hwif, spec, key, hostkeys, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::ssh-event-in-client")
+	}
+
+	return client, err
+}
+
+func makeSSHEventInClient(hwif string, spec string, key SSH.Signer, hostkeys SSH.HostKeyCallback, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*sshEventInClient, error) {
+	addr, host, user, err := target(spec, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := 5 * time.Second
+	ssh := sshEventInClient{
+		sshEventClient{
+			EventClient: conn.NewEventClient("SSH", fmt.Sprintf("%v@%v", user, host), retry, heartbeat, nil, 2048, ctx),
+			hwif:        hwif,
+			addr:        addr,
+			host:        host,
+			config:      clientConfig(user, key, hostkeys, timeout),
+			proxy:       proxy,
+			timeout:     timeout,
+		},
+		conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	ssh.Dial = ssh.dial
+	ssh.Received = ssh.received
+	ssh.Relay = ssh.send
+
+	return &ssh, nil
+}
+
+func (ssh *sshEventInClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	ssh.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		if ssh.dedup.Duplicate(msg.ID, msg.Message) {
+			ssh.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
+	}
+}
+
+func (ssh *sshEventInClient) send(session *conn.Session, id uint32, msg []byte) error {
+	return nil
+}
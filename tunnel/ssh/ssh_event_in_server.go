@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"time"
+
+	SSH "golang.org/x/crypto/ssh"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type sshEventIn struct {
+	sshServer
+	dedup *conn.Dedup
+}
+
+func NewSSHEventInServer(hwif string, spec string, hostkey SSH.Signer, authorizedKeys string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*sshEventIn, error) {
+	server, err := makeSSHEventInServer(hwif, spec, hostkey, authorizedKeys, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::ssh-event-in-server")
+	}
+
+	return server, err
+}
+
+func makeSSHEventInServer(hwif string, spec string, hostkey SSH.Signer, authorizedKeys string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*sshEventIn, error) {
+	addr, _, _, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	ssh := sshEventIn{
+		sshServer: sshServer{
+			Server:  conn.NewServer("SSH", retry, heartbeat, 2048, ctx),
+			hwif:    hwif,
+			addr:    addr,
+			timeout: 5 * time.Second,
+		},
+		dedup: conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	ssh.init(hostkey, authorizedKeys)
+	ssh.Received = ssh.received
+
+	return &ssh, nil
+}
+
+func (ssh *sshEventIn) Send(id uint32, message []byte) {
+}
+
+func (ssh *sshEventIn) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	ssh.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		if ssh.dedup.Duplicate(msg.ID, msg.Message) {
+			ssh.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
+	}
+}
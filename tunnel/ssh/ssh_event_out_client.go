@@ -0,0 +1,51 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	SSH "golang.org/x/crypto/ssh"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type sshEventOutClient struct {
+	sshEventClient
+}
+
+func NewSSHEventOutClient(hwif string, spec string, key SSH.Signer, hostkeys SSH.HostKeyCallback, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, queue *conn.Queue, ctx context.Context) (*sshEventOutClient, error) {
+	client, err := makeSSHEventOutClient(hwif, spec, key, hostkeys, retry, heartbeat, proxy, queue, ctx)
+
+	if err == nil {
+		client.Infof("connector::ssh-event-out-client")
+	}
+
+	return client, err
+}
+
+func makeSSHEventOutClient(hwif string, spec string, key SSH.Signer, hostkeys SSH.HostKeyCallback, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, queue *conn.Queue, ctx context.Context) (*sshEventOutClient, error) {
+	addr, host, user, err := target(spec, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := 5 * time.Second
+	ssh := sshEventOutClient{
+		sshEventClient{
+			EventClient: conn.NewEventClient("SSH", fmt.Sprintf("%v@%v", user, host), retry, heartbeat, queue, 2048, ctx),
+			hwif:        hwif,
+			addr:        addr,
+			host:        host,
+			config:      clientConfig(user, key, hostkeys, timeout),
+			proxy:       proxy,
+			timeout:     timeout,
+		},
+	}
+
+	ssh.Dial = ssh.dial
+	ssh.Received = conn.Discard
+	ssh.Relay = ssh.Deliver
+
+	return &ssh, nil
+}
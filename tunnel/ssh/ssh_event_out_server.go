@@ -0,0 +1,49 @@
+package ssh
+
+import (
+	"context"
+	"time"
+
+	SSH "golang.org/x/crypto/ssh"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type sshEventOutServer struct {
+	sshServer
+}
+
+func NewSSHEventOutServer(hwif string, spec string, hostkey SSH.Signer, authorizedKeys string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*sshEventOutServer, error) {
+	server, err := makeSSHEventOutServer(hwif, spec, hostkey, authorizedKeys, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::ssh-event-out-server")
+	}
+
+	return server, err
+}
+
+func makeSSHEventOutServer(hwif string, spec string, hostkey SSH.Signer, authorizedKeys string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*sshEventOutServer, error) {
+	addr, _, _, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	ssh := sshEventOutServer{
+		sshServer{
+			Server:  conn.NewServer("SSH", retry, heartbeat, 2048, ctx),
+			hwif:    hwif,
+			addr:    addr,
+			timeout: 5 * time.Second,
+		},
+	}
+
+	ssh.init(hostkey, authorizedKeys)
+	ssh.Received = conn.Discard
+
+	return &ssh, nil
+}
+
+func (ssh *sshEventOutServer) Send(id uint32, message []byte) {
+	ssh.Post(id, message)
+}
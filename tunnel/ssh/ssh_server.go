@@ -0,0 +1,74 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"time"
+
+	SSH "golang.org/x/crypto/ssh"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type sshServer struct {
+	conn.Server
+	hwif    string
+	addr    *net.TCPAddr
+	config  *SSH.ServerConfig
+	timeout time.Duration
+}
+
+func NewSSHInServer(hwif string, spec string, hostkey SSH.Signer, authorizedKeys string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*sshServer, error) {
+	server, err := makeSSHServer(hwif, spec, hostkey, authorizedKeys, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::ssh-server-in")
+	}
+
+	return server, err
+}
+
+func NewSSHOutServer(hwif string, spec string, hostkey SSH.Signer, authorizedKeys string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*sshServer, error) {
+	server, err := makeSSHServer(hwif, spec, hostkey, authorizedKeys, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::ssh-server-out")
+	}
+
+	return server, err
+}
+
+func makeSSHServer(hwif string, spec string, hostkey SSH.Signer, authorizedKeys string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*sshServer, error) {
+	addr, _, _, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	server := sshServer{
+		Server:  conn.NewServer("SSH", retry, heartbeat, 2048, ctx),
+		hwif:    hwif,
+		addr:    addr,
+		timeout: 5 * time.Second,
+	}
+
+	server.init(hostkey, authorizedKeys)
+	server.Received = server.Dispatch
+
+	return &server, nil
+}
+
+// init sets the SSH server configuration and the listen and handshake functions for the
+// shared server loop.
+func (ssh *sshServer) init(hostkey SSH.Signer, authorizedKeys string) {
+	ssh.config = serverConfig(hostkey, authorizedKeys, &ssh.Conn)
+	ssh.Listen = ssh.listen
+	ssh.Accept = ssh.accept
+}
+
+func (ssh *sshServer) listen() (net.Listener, error) {
+	return listen(ssh.hwif, ssh.addr, ssh.Conn)
+}
+
+func (ssh *sshServer) accept(client net.Conn) (net.Conn, error) {
+	return accept(client, ssh.config, ssh.timeout)
+}
@@ -0,0 +1,191 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	SSH "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func newKey(t *testing.T) SSH.Signer {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key (%v)", err)
+	}
+
+	signer, err := SSH.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatalf("error creating signer (%v)", err)
+	}
+
+	return signer
+}
+
+func TestAuthorizedSkipsInvalidKeys(t *testing.T) {
+	k1 := newKey(t).PublicKey()
+	k2 := newKey(t).PublicKey()
+
+	var b bytes.Buffer
+
+	b.WriteString("# authorized keys\n")
+	b.Write(SSH.MarshalAuthorizedKey(k1))
+	b.WriteString("\n")
+	b.WriteString("ssh-ed25519 not-a-valid-key qwerty\n")
+	b.Write(SSH.MarshalAuthorizedKey(k2))
+
+	file := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := os.WriteFile(file, b.Bytes(), 0600); err != nil {
+		t.Fatalf("error writing authorized_keys (%v)", err)
+	}
+
+	keys, err := authorized(file, &conn.Conn{Tag: "SSH"})
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("incorrect number of keys - expected:%v, got:%v", 2, len(keys))
+	}
+
+	if !bytes.Equal(keys[0].Marshal(), k1.Marshal()) || !bytes.Equal(keys[1].Marshal(), k2.Marshal()) {
+		t.Errorf("incorrect authorized keys")
+	}
+}
+
+func TestSSHScenarios(t *testing.T) {
+	hostkey := newKey(t)
+	key := newKey(t)
+
+	loopback.Scenarios(t, loopback.Transport{
+		Network: "tcp",
+
+		Requests: func(t *testing.T, server string, client string, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			return loopback.Must(t)(NewSSHOutServer("", server, hostkey, authorizedKeys(t, key), retry, conn.Heartbeat{}, ctx)),
+				loopback.Must(t)(NewSSHInClient("", "tunnel@"+client, key, SSH.FixedHostKey(hostkey.PublicKey()), retry, conn.Heartbeat{}, conn.Proxy{}, ctx))
+		},
+
+		Events: func(t *testing.T, server string, client string, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			return loopback.Must(t)(NewSSHEventInServer("", server, hostkey, authorizedKeys(t, key), retry, heartbeat, ctx)),
+				loopback.Must(t)(NewSSHEventOutClient("", "tunnel@"+client, key, SSH.FixedHostKey(hostkey.PublicKey()), retry, heartbeat, conn.Proxy{}, queue, ctx))
+		},
+	})
+}
+
+func TestSSHUnknownHostKey(t *testing.T) {
+	hostkey := newKey(t)
+	key := newKey(t)
+	addr, server := serve(t, hostkey, key)
+
+	tests := []struct {
+		name      string
+		knownhost SSH.PublicKey
+	}{
+		{"host not in known_hosts", nil},
+		{"host key mismatch", newKey(t).PublicKey()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "known_hosts")
+			known := []byte{}
+			if test.knownhost != nil {
+				known = []byte(knownhosts.Line([]string{knownhosts.Normalize(addr)}, test.knownhost) + "\n")
+			}
+
+			if err := os.WriteFile(file, known, 0600); err != nil {
+				t.Fatalf("error writing known_hosts (%v)", err)
+			}
+
+			hostkeys, err := knownhosts.New(file)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			config := clientConfig("tunnel", key, hostkeys, loopback.TIMEOUT)
+			socket, err := dial(context.Background(), "", addr, addr, config, conn.Proxy{}, loopback.TIMEOUT, conn.Conn{Tag: "SSH"})
+
+			var e *knownhosts.KeyError
+			if err == nil {
+				socket.Close()
+				t.Fatalf("connected to host with unknown host key")
+			} else if !errors.As(err, &e) {
+				t.Fatalf("incorrect error - expected:%T, got:%v", e, err)
+			}
+
+			if len(server.Sessions()) != 0 {
+				t.Errorf("incorrect number of sessions - expected:%v, got:%v", 0, len(server.Sessions()))
+			}
+		})
+	}
+}
+
+func TestSSHUnauthorizedClientKey(t *testing.T) {
+	hostkey := newKey(t)
+	addr, server := serve(t, hostkey, newKey(t))
+
+	config := clientConfig("tunnel", newKey(t), SSH.FixedHostKey(hostkey.PublicKey()), loopback.TIMEOUT)
+	socket, err := dial(context.Background(), "", addr, addr, config, conn.Proxy{}, loopback.TIMEOUT, conn.Conn{Tag: "SSH"})
+	if err == nil {
+		socket.Close()
+		t.Fatalf("connected with a client key that is not in authorized_keys")
+	} else if !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Fatalf("incorrect error - expected:%v, got:%v", "unable to authenticate", err)
+	}
+
+	if len(server.Sessions()) != 0 {
+		t.Errorf("incorrect number of sessions - expected:%v, got:%v", 0, len(server.Sessions()))
+	}
+}
+
+// serve starts an SSH server with the host key that authorizes the client key, returning the
+// server address. The server is closed when the test completes.
+func serve(t *testing.T, hostkey SSH.Signer, key SSH.Signer) (string, *sshServer) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := loopback.Address(t, "tcp")
+
+	server, err := NewSSHOutServer("", addr, hostkey, authorizedKeys(t, key), conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+
+	go server.Run(loopback.Sink(t))
+
+	loopback.Listening(t, addr)
+
+	return addr, server
+}
+
+// authorizedKeys writes an authorized_keys file for the key to a temporary directory.
+func authorizedKeys(t *testing.T, key SSH.Signer) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := os.WriteFile(file, SSH.MarshalAuthorizedKey(key.PublicKey()), 0600); err != nil {
+		t.Fatalf("error writing authorized_keys (%v)", err)
+	}
+
+	return file
+}
@@ -0,0 +1,91 @@
+package tunnel
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+const RESTART_MAX_DELAY = 5 * time.Minute
+const RESTART_RESET = 1 * time.Minute
+
+// Supervisor runs multiple tunnels in the same process, restarting any tunnel that fails.
+// Tunnels are (re)created by a factory function because connectors cannot be restarted
+// once closed.
+type Supervisor struct {
+	tunnels []supervised
+	ctx     context.Context
+}
+
+type supervised struct {
+	label string
+	f     func(ctx context.Context) (*Tunnel, error)
+}
+
+func NewSupervisor(ctx context.Context) *Supervisor {
+	return &Supervisor{
+		tunnels: []supervised{},
+		ctx:     ctx,
+	}
+}
+
+// Add registers a tunnel with the supervisor. The factory function is invoked to create
+// the tunnel when the supervisor starts and again whenever the tunnel fails.
+func (s *Supervisor) Add(label string, f func(ctx context.Context) (*Tunnel, error)) {
+	s.tunnels = append(s.tunnels, supervised{
+		label: label,
+		f:     f,
+	})
+}
+
+// Run starts all the supervised tunnels and waits for them to terminate after the
+// supervisor context has been cancelled.
+func (s *Supervisor) Run(interrupt chan os.Signal) error {
+	infof("", "supervising %v tunnels", len(s.tunnels))
+
+	var wg sync.WaitGroup
+
+	for _, t := range s.tunnels {
+		wg.Go(func() {
+			s.supervise(t, interrupt)
+		})
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func (s *Supervisor) supervise(t supervised, interrupt chan os.Signal) {
+	retry := conn.NewBackoff(-1, RESTART_MAX_DELAY, s.ctx)
+
+	for {
+		ctx, cancel := conn.WithFailure(s.ctx)
+		started := time.Now()
+
+		if tunnel, err := t.f(ctx); err != nil {
+			errorf(t.label, "%v", err)
+		} else if err := tunnel.Run(interrupt); err != nil {
+			errorf(t.label, "%v", err)
+		}
+
+		cancel(nil)
+
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(started) > RESTART_RESET {
+			retry.Reset()
+		}
+
+		warnf(t.label, "tunnel failed - restarting")
+
+		if !retry.Wait(t.label) {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package tunnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// failing is a connector that fails its tunnel by exceeding the retry count, like a client
+// connector that cannot reach its server.
+type failing struct {
+	ctx context.Context
+}
+
+func (f *failing) Run(r *router.Switch) error {
+	retry := conn.NewBackoff(0, time.Second, f.ctx)
+	retry.Wait("FAILING")
+
+	return nil
+}
+
+func (f *failing) Close() {
+}
+
+func (f *failing) Send(id uint32, message []byte) {
+}
+
+func TestSupervisorRestartsFailedTunnel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan time.Time, 4)
+
+	supervisor := NewSupervisor(ctx)
+	supervisor.Add("failing", func(ctx context.Context) (*Tunnel, error) {
+		started <- time.Now()
+
+		return NewTunnel("failing", &failing{ctx}, newStub(), nil, ctx), nil
+	})
+
+	done := make(chan struct{})
+
+	go func() {
+		supervisor.Run(nil)
+		close(done)
+	}()
+
+	var first time.Time
+
+	select {
+	case first = <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("tunnel not started")
+	}
+
+	// ... restarted after the initial backoff delay
+	select {
+	case second := <-started:
+		if dt := second.Sub(first); dt < conn.RETRY_MIN_DELAY {
+			t.Errorf("tunnel restarted without backing off (%v)", dt)
+		}
+
+	case <-time.After(conn.RETRY_MIN_DELAY + 2*time.Second):
+		t.Fatalf("tunnel not restarted")
+	}
+
+	// ... and not restarted once the supervisor has been stopped
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("supervisor did not stop")
+	}
+
+	select {
+	case <-started:
+		t.Errorf("tunnel restarted after supervisor stopped")
+	default:
+	}
+}
@@ -17,21 +17,22 @@ import (
 
 type tailscaleClient struct {
 	conn.Conn
-	dir      string
-	hostname string
-	addr     string
-	port     uint16
-	auth     string
-	retry    conn.Backoff
-	logging  string
-	timeout  time.Duration
-	ch       chan protocol.Message
-	ctx      context.Context
-	closed   chan struct{}
+	dir       string
+	hostname  string
+	addr      string
+	port      uint16
+	auth      string
+	retry     conn.Backoff
+	heartbeat conn.Heartbeat
+	logging   string
+	timeout   time.Duration
+	ch        chan protocol.Message
+	ctx       context.Context
+	closed    chan struct{}
 }
 
-func NewTailscaleOutClient(workdir string, hostname string, spec string, auth string, retry conn.Backoff, logging string, ctx context.Context) (*tailscaleClient, error) {
-	client, err := makeTailscaleClient(workdir, hostname, spec, auth, retry, logging, ctx)
+func NewTailscaleOutClient(workdir string, hostname string, spec string, auth string, retry conn.Backoff, heartbeat conn.Heartbeat, logging string, ctx context.Context) (*tailscaleClient, error) {
+	client, err := makeTailscaleClient(workdir, hostname, spec, auth, retry, heartbeat, logging, ctx)
 
 	if err == nil {
 		client.Infof("connector::tailscale-client-out  %v", client.hostname)
@@ -41,7 +42,7 @@ func NewTailscaleOutClient(workdir string, hostname string, spec string, auth st
 	return client, err
 }
 
-func makeTailscaleClient(workdir string, hostname, spec string, auth string, retry conn.Backoff, logging string, ctx context.Context) (*tailscaleClient, error) {
+func makeTailscaleClient(workdir string, hostname, spec string, auth string, retry conn.Backoff, heartbeat conn.Heartbeat, logging string, ctx context.Context) (*tailscaleClient, error) {
 	addr, port, err := resolveTailscaleAddr(spec)
 	if err != nil {
 		return nil, err
@@ -68,17 +69,18 @@ func makeTailscaleClient(workdir string, hostname, spec string, auth string, ret
 		Conn: conn.Conn{
 			Tag: "tailscale",
 		},
-		dir:      dir,
-		hostname: name,
-		addr:     addr,
-		port:     port,
-		auth:     auth,
-		retry:    retry,
-		logging:  logging,
-		timeout:  5 * time.Second,
-		ch:       make(chan protocol.Message, 16),
-		ctx:      ctx,
-		closed:   make(chan struct{}),
+		dir:       dir,
+		hostname:  name,
+		addr:      addr,
+		port:      port,
+		auth:      auth,
+		retry:     retry,
+		heartbeat: heartbeat,
+		logging:   logging,
+		timeout:   5 * time.Second,
+		ch:        make(chan protocol.Message, 16),
+		ctx:       ctx,
+		closed:    make(chan struct{}),
 	}
 
 	return &in, nil
@@ -182,6 +184,7 @@ func (ts *tailscaleClient) connect(router *router.Switch) error {
 			ts.Warnf("connect %v failed (%v)", ts.addr, socket)
 		} else {
 			ts.retry.Reset()
+			session := conn.NewSession(ts.Conn, socket, ts.heartbeat)
 			eof := make(chan struct{})
 
 			go func() {
@@ -189,7 +192,7 @@ func (ts *tailscaleClient) connect(router *router.Switch) error {
 					select {
 					case msg := <-ts.ch:
 						ts.Infof("msg %v  relaying to %v", msg.ID, socket.RemoteAddr())
-						ts.send(socket, msg.ID, msg.Message)
+						ts.send(session, msg.ID, msg.Message)
 
 					case <-eof:
 						return
@@ -201,7 +204,7 @@ func (ts *tailscaleClient) connect(router *router.Switch) error {
 				}
 			}()
 
-			if err := ts.listen(socket, router); err != nil && !errors.Is(err, net.ErrClosed) {
+			if err := ts.listen(socket, session, router); err != nil && !errors.Is(err, net.ErrClosed) {
 				ts.Warnf("%v", err)
 			}
 
@@ -216,47 +219,44 @@ func (ts *tailscaleClient) connect(router *router.Switch) error {
 	}
 }
 
-func (ts *tailscaleClient) listen(socket net.Conn, router *router.Switch) error {
+func (ts *tailscaleClient) listen(socket net.Conn, session *conn.Session, router *router.Switch) error {
 	ts.Infof("connected  to %v", socket.RemoteAddr())
 
 	defer socket.Close()
+	defer session.Close()
+
+	if err := session.Start(); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 2048)
 
 	for {
-		buffer := make([]byte, 2048)
 		N, err := socket.Read(buffer)
 		if err != nil {
 			return err
 		}
 
-		go func() {
-			ts.received(buffer[:N], router, socket)
-		}()
+		ts.received(buffer[:N], session, router, socket)
 	}
 }
 
-func (ts *tailscaleClient) received(buffer []byte, router *router.Switch, socket net.Conn) {
+func (ts *tailscaleClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
 	ts.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
 
-	for len(buffer) > 0 {
-		id, msg, remaining := protocol.Depacketize(buffer)
-		buffer = remaining
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
 
-		router.Received(id, msg, func(message []byte) {
-			ts.send(socket, id, message)
+		router.Received(id, msg.Message, func(message []byte) {
+			ts.send(session, id, message)
 		})
 	}
 }
 
-func (ts *tailscaleClient) send(conn net.Conn, id uint32, msg []byte) []byte {
-	packet := protocol.Packetize(id, msg)
-
-	if N, err := conn.Write(packet); err != nil {
-		ts.Warnf("msg %v  error sending message to %v (%v)", id, conn.RemoteAddr(), err)
-	} else if N != len(packet) {
-		ts.Warnf("msg %v  sent %v of %v bytes to %v", id, N, len(msg), conn.RemoteAddr())
+func (ts *tailscaleClient) send(session *conn.Session, id uint32, msg []byte) {
+	if err := session.Send(id, msg); err != nil {
+		ts.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
 	} else {
-		ts.Infof("msg %v  sent %v bytes to %v", id, len(msg), conn.RemoteAddr())
+		ts.Infof("msg %v  sent %v bytes to %v", id, len(msg), session.RemoteAddr())
 	}
-
-	return nil
 }
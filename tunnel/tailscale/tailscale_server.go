@@ -12,7 +12,6 @@ import (
 
 	"tailscale.com/tsnet"
 
-	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
@@ -25,16 +24,17 @@ type tailscaleServer struct {
 	port        uint16
 	auth        string
 	retry       conn.Backoff
+	heartbeat   conn.Heartbeat
 	logging     string
-	connections map[net.Conn]struct{}
+	connections map[net.Conn]*conn.Session
 	ctx         context.Context
 	closed      chan struct{}
 	closing     bool
 	sync.RWMutex
 }
 
-func NewTailscaleInServer(workdir string, hostname string, spec string, auth string, retry conn.Backoff, logging string, ctx context.Context) (*tailscaleServer, error) {
-	server, err := makeTailscaleServer(workdir, hostname, spec, auth, retry, logging, ctx)
+func NewTailscaleInServer(workdir string, hostname string, spec string, auth string, retry conn.Backoff, heartbeat conn.Heartbeat, logging string, ctx context.Context) (*tailscaleServer, error) {
+	server, err := makeTailscaleServer(workdir, hostname, spec, auth, retry, heartbeat, logging, ctx)
 
 	if err == nil {
 		server.Infof("connector::tailscale-server-in  %v", server.hostname)
@@ -44,7 +44,7 @@ func NewTailscaleInServer(workdir string, hostname string, spec string, auth str
 	return server, err
 }
 
-func makeTailscaleServer(workdir string, hostname string, spec string, auth string, retry conn.Backoff, logging string, ctx context.Context) (*tailscaleServer, error) {
+func makeTailscaleServer(workdir string, hostname string, spec string, auth string, retry conn.Backoff, heartbeat conn.Heartbeat, logging string, ctx context.Context) (*tailscaleServer, error) {
 	addr, port, err := resolveTailscaleAddr(spec)
 	if err != nil {
 		return nil, err
@@ -77,8 +77,9 @@ func makeTailscaleServer(workdir string, hostname string, spec string, auth stri
 		port:        port,
 		auth:        auth,
 		retry:       retry,
+		heartbeat:   heartbeat,
 		logging:     logging,
-		connections: map[net.Conn]struct{}{},
+		connections: map[net.Conn]*conn.Session{},
 		ctx:         ctx,
 		closed:      make(chan struct{}),
 	}
@@ -183,9 +184,11 @@ func (ts *tailscaleServer) Run(router *router.Switch) (err error) {
 			}
 		}
 
+		ts.RLock()
 		for k := range ts.connections {
 			k.Close()
 		}
+		ts.RUnlock()
 
 		ts.closed <- struct{}{}
 	}()
@@ -198,10 +201,13 @@ func (ts *tailscaleServer) Run(router *router.Switch) (err error) {
 }
 
 func (ts *tailscaleServer) Send(id uint32, message []byte) {
-	for c := range ts.connections {
-		go func(conn net.Conn) {
-			ts.send(conn, id, message)
-		}(c)
+	ts.RLock()
+	defer ts.RUnlock()
+
+	for _, session := range ts.connections {
+		go func(session *conn.Session) {
+			ts.send(session, id, message)
+		}(session)
 	}
 }
 
@@ -224,13 +230,20 @@ func (ts *tailscaleServer) listen(socket net.Listener, router *router.Switch) {
 
 		defer client.Close()
 
+		session := conn.NewSession(ts.Conn, client, ts.heartbeat)
+
 		ts.Lock()
-		ts.connections[client] = struct{}{}
+		ts.connections[client] = session
 		ts.Unlock()
 
-		go func(socket net.Conn) {
+		go func(socket net.Conn, session *conn.Session) {
+			buffer := make([]byte, 2048)
+
+			if err := session.Start(); err != nil {
+				ts.Warnf("%v", err)
+			}
+
 			for {
-				buffer := make([]byte, 2048) // buffer is handed off to router
 				if N, err := socket.Read(buffer); err != nil {
 					if err == io.EOF {
 						ts.Infof("client connection %v closed ", addr)
@@ -241,40 +254,37 @@ func (ts *tailscaleServer) listen(socket net.Listener, router *router.Switch) {
 					}
 					break
 				} else {
-					ts.received(buffer[:N], router, socket)
+					ts.received(buffer[:N], session, router, socket)
 				}
 
 				time.Sleep(5000)
 			}
 
+			session.Close()
+
 			ts.Lock()
 			delete(ts.connections, socket)
 			ts.Unlock()
-		}(client)
+		}(client, session)
 	}
 }
 
-func (ts *tailscaleServer) received(buffer []byte, router *router.Switch, socket net.Conn) {
+func (ts *tailscaleServer) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
 	ts.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
 
-	for len(buffer) > 0 {
-		id, msg, remaining := protocol.Depacketize(buffer)
-		buffer = remaining
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
 
-		router.Received(id, msg, func(message []byte) {
-			ts.send(socket, id, message)
+		router.Received(id, msg.Message, func(message []byte) {
+			ts.send(session, id, message)
 		})
 	}
 }
 
-func (ts *tailscaleServer) send(conn net.Conn, id uint32, message []byte) {
-	packet := protocol.Packetize(id, message)
-
-	if N, err := conn.Write(packet); err != nil {
-		ts.Warnf("msg %v  error sending message to %v (%v)", id, conn.RemoteAddr(), err)
-	} else if N != len(packet) {
-		ts.Warnf("msg %v  sent %v of %v bytes to %v", id, N, len(message), conn.RemoteAddr())
+func (ts *tailscaleServer) send(session *conn.Session, id uint32, message []byte) {
+	if err := session.Send(id, message); err != nil {
+		ts.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
 	} else {
-		ts.Infof("msg %v sent %v bytes to %v", id, len(message), conn.RemoteAddr())
+		ts.Infof("msg %v sent %v bytes to %v", id, len(message), session.RemoteAddr())
 	}
 }
@@ -0,0 +1,66 @@
+package tailscale
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+// A frame split across socket reads is reassembled by the session stream decoder. The tailscale
+// connectors need a tailnet to connect so the received data is fed directly to the connector.
+func TestTailscaleSplitFrame(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	retry := conn.NewBackoff(-1, time.Second, ctx)
+
+	defer cancel()
+
+	server, err := makeTailscaleServer(t.TempDir(), "", "127.0.0.1:12345", "", retry, conn.Heartbeat{}, "", ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	client, err := makeTailscaleClient(t.TempDir(), "", "127.0.0.1:12345", "", retry, conn.Heartbeat{}, "", ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tests := []struct {
+		name     string
+		c        conn.Conn
+		received func([]byte, *conn.Session, *router.Switch, net.Conn)
+	}{
+		{"server", server.Conn, server.received},
+		{"client", client.Conn, client.received},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+
+			defer local.Close()
+			defer remote.Close()
+
+			frames := loopback.Frames(remote)
+			session := conn.NewSession(test.c, local, conn.Heartbeat{})
+
+			defer session.Close()
+
+			go session.Start()
+
+			s := loopback.Echo(t)
+			request := protocol.Frame{Type: protocol.DATA, ID: 12345, Message: loopback.REQUEST}.Encode()
+
+			for _, packet := range [][]byte{protocol.Hello(0).Encode(), request[:5], request[5:]} {
+				test.received(packet, session, s, local)
+			}
+
+			loopback.Reply(t, frames, 12345)
+		})
+	}
+}
@@ -3,7 +3,6 @@ package tcp
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net"
 	"syscall"
 	"time"
@@ -15,17 +14,20 @@ import (
 
 type tcpClient struct {
 	conn.Conn
-	hwif    string
-	addr    *net.TCPAddr
-	retry   conn.Backoff
-	timeout time.Duration
-	ch      chan protocol.Message
-	ctx     context.Context
-	closed  chan struct{}
+	hwif      string
+	addr      string
+	psk       []byte
+	retry     conn.Backoff
+	heartbeat conn.Heartbeat
+	proxy     conn.Proxy
+	timeout   time.Duration
+	ch        chan protocol.Message
+	ctx       context.Context
+	closed    chan struct{}
 }
 
-func NewTCPInClient(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpClient, error) {
-	client, err := makeTCPClient(hwif, spec, retry, ctx)
+func NewTCPInClient(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*tcpClient, error) {
+	client, err := makeTCPClient(hwif, spec, key, retry, heartbeat, proxy, ctx)
 
 	if err == nil {
 		client.Infof("connector::tcp-client-in")
@@ -34,8 +36,8 @@ func NewTCPInClient(hwif string, spec string, retry conn.Backoff, ctx context.Co
 	return client, err
 }
 
-func NewTCPOutClient(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpClient, error) {
-	client, err := makeTCPClient(hwif, spec, retry, ctx)
+func NewTCPOutClient(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*tcpClient, error) {
+	client, err := makeTCPClient(hwif, spec, key, retry, heartbeat, proxy, ctx)
 
 	if err == nil {
 		client.Infof("connector::tcp-client-out")
@@ -44,25 +46,26 @@ func NewTCPOutClient(hwif string, spec string, retry conn.Backoff, ctx context.C
 	return client, err
 }
 
-func makeTCPClient(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpClient, error) {
-	addr, err := net.ResolveTCPAddr("tcp", spec)
+func makeTCPClient(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*tcpClient, error) {
+	addr, err := proxy.Resolve(spec)
 	if err != nil {
 		return nil, err
-	} else if addr == nil {
-		return nil, fmt.Errorf("unable to resolve TCP address '%v'", spec)
 	}
 
 	in := tcpClient{
 		Conn: conn.Conn{
 			Tag: "TCP",
 		},
-		hwif:    hwif,
-		addr:    addr,
-		retry:   retry,
-		timeout: 5 * time.Second,
-		ch:      make(chan protocol.Message, 16),
-		ctx:     ctx,
-		closed:  make(chan struct{}),
+		hwif:      hwif,
+		addr:      addr,
+		psk:       key,
+		retry:     retry,
+		heartbeat: heartbeat,
+		proxy:     proxy,
+		timeout:   5 * time.Second,
+		ch:        make(chan protocol.Message, 16),
+		ctx:       ctx,
+		closed:    make(chan struct{}),
 	}
 
 	return &in, nil
@@ -103,19 +106,22 @@ func (tcp *tcpClient) connect(router *router.Switch) {
 			Timeout: tcp.timeout,
 			Control: func(network, address string, connection syscall.RawConn) error {
 				if tcp.hwif != "" {
-					return conn.BindToDevice(connection, tcp.hwif, conn.IsIPv4(tcp.addr.IP), tcp.Conn)
+					return conn.BindToDevice(connection, tcp.hwif, network == "tcp4", tcp.Conn)
 				} else {
 					return nil
 				}
 			},
 		}
 
-		if socket, err := dialer.Dial("tcp", fmt.Sprintf("%v", tcp.addr)); err != nil {
+		if socket, err := tcp.proxy.DialContext(tcp.ctx, dialer, "tcp", tcp.addr); err != nil {
 			tcp.Warnf("%v", err)
 		} else if socket == nil {
 			tcp.Warnf("connect %v failed (%v)", tcp.addr, socket)
+		} else if socket, err := conn.SecureClient(socket, tcp.psk); err != nil {
+			tcp.Warnf("%v", err)
 		} else {
 			tcp.retry.Reset()
+			session := conn.NewSession(tcp.Conn, socket, tcp.heartbeat)
 			eof := make(chan struct{})
 
 			go func() {
@@ -123,7 +129,7 @@ func (tcp *tcpClient) connect(router *router.Switch) {
 					select {
 					case msg := <-tcp.ch:
 						tcp.Infof("msg %v  relaying to %v", msg.ID, socket.RemoteAddr())
-						tcp.send(socket, msg.ID, msg.Message)
+						tcp.send(session, msg.ID, msg.Message)
 
 					case <-eof:
 						return
@@ -135,7 +141,7 @@ func (tcp *tcpClient) connect(router *router.Switch) {
 				}
 			}()
 
-			if err := tcp.listen(socket, router); err != nil && !errors.Is(err, net.ErrClosed) {
+			if err := tcp.listen(socket, session, router); err != nil && !errors.Is(err, net.ErrClosed) {
 				tcp.Warnf("%v", err)
 			}
 
@@ -148,47 +154,44 @@ func (tcp *tcpClient) connect(router *router.Switch) {
 	}
 }
 
-func (tcp *tcpClient) listen(socket net.Conn, router *router.Switch) error {
+func (tcp *tcpClient) listen(socket net.Conn, session *conn.Session, router *router.Switch) error {
 	tcp.Infof("connected  to %v", socket.RemoteAddr())
 
 	defer socket.Close()
+	defer session.Close()
+
+	if err := session.Start(); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 2048)
 
 	for {
-		buffer := make([]byte, 2048)
 		N, err := socket.Read(buffer)
 		if err != nil {
 			return err
 		}
 
-		go func() {
-			tcp.received(buffer[:N], router, socket)
-		}()
+		tcp.received(buffer[:N], session, router, socket)
 	}
 }
 
-func (tcp *tcpClient) received(buffer []byte, router *router.Switch, socket net.Conn) {
+func (tcp *tcpClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
 	tcp.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
 
-	for len(buffer) > 0 {
-		id, msg, remaining := protocol.Depacketize(buffer)
-		buffer = remaining
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
 
-		router.Received(id, msg, func(message []byte) {
-			tcp.send(socket, id, message)
+		router.Received(id, msg.Message, func(message []byte) {
+			tcp.send(session, id, message)
 		})
 	}
 }
 
-func (tcp *tcpClient) send(conn net.Conn, id uint32, msg []byte) []byte {
-	packet := protocol.Packetize(id, msg)
-
-	if N, err := conn.Write(packet); err != nil {
-		tcp.Warnf("msg %v  error sending message to %v (%v)", id, conn.RemoteAddr(), err)
-	} else if N != len(packet) {
-		tcp.Warnf("msg %v  sent %v of %v bytes to %v", id, N, len(msg), conn.RemoteAddr())
+func (tcp *tcpClient) send(session *conn.Session, id uint32, msg []byte) {
+	if err := session.Send(id, msg); err != nil {
+		tcp.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
 	} else {
-		tcp.Infof("msg %v  sent %v bytes to %v", id, len(msg), conn.RemoteAddr())
+		tcp.Infof("msg %v  sent %v bytes to %v", id, len(msg), session.RemoteAddr())
 	}
-
-	return nil
 }
@@ -2,69 +2,62 @@ package tcp
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"time"
 
-	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
 type tcpEventInClient struct {
 	tcpEventClient
+	dedup *conn.Dedup
 }
 
-func NewTCPEventInClient(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpEventInClient, error) {
-	addr, err := net.ResolveTCPAddr("tcp", spec)
+func NewTCPEventInClient(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*tcpEventInClient, error) {
+	addr, err := proxy.Resolve(spec)
 	if err != nil {
 		return nil, err
-	} else if addr == nil {
-		return nil, fmt.Errorf("unable to resolve TCP address '%v'", spec)
 	}
 
 	tcp := tcpEventInClient{
 		tcpEventClient{
-			Conn: conn.Conn{
-				Tag: "TCP",
-			},
-			hwif:    hwif,
-			addr:    addr,
-			retry:   retry,
-			timeout: 5 * time.Second,
-			ch:      make(chan protocol.Message, 16),
-			ctx:     ctx,
-			closed:  make(chan struct{}),
+			EventClient: conn.NewEventClient("TCP", addr, retry, heartbeat, nil, 2048, ctx),
+			hwif:        hwif,
+			psk:         key,
+			proxy:       proxy,
+			timeout:     5 * time.Second,
 		},
+		conn.NewDedup(conn.DEDUP_WINDOW),
 	}
 
-	tcp.tcpEventClient.received = tcp.received
-	tcp.tcpEventClient.send = tcp.send
+	tcp.Dial = tcp.dial
+	tcp.Received = tcp.received
+	tcp.Relay = tcp.send
 
 	tcp.Infof("connector::tcp-event-in-client")
 
 	return &tcp, nil
 }
 
-func (tcp *tcpEventInClient) received(buffer []byte, router *router.Switch, socket net.Conn) {
+func (tcp *tcpEventInClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
 	tcp.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
 
-	for len(buffer) > 0 {
-		id, msg, remaining := protocol.Depacketize(buffer)
-		buffer = remaining
-
-		router.Received(id, msg, nil)
+	for _, msg := range session.Received(buffer) {
+		if tcp.dedup.Duplicate(msg.ID, msg.Message) {
+			tcp.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
 	}
 }
 
-func (tcp *tcpEventInClient) send(conn net.Conn, id uint32, msg []byte) {
-	// packet := protocol.Packetize(id, msg)
-	//
-	// if N, err := conn.Write(packet); err != nil {
-	// 	tcp.Warnf("msg %v  error sending message to %v (%v)", id, conn.RemoteAddr(), err)
-	// } else if N != len(packet) {
-	// 	tcp.Warnf("msg %v  sent %v of %v bytes to %v", id, N, len(msg), conn.RemoteAddr())
+func (tcp *tcpEventInClient) send(session *conn.Session, id uint32, msg []byte) error {
+	// if err := session.Send(id, msg); err != nil {
+	// 	tcp.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
 	// } else {
-	// 	tcp.Infof("msg %v  sent %v bytes to %v", id, len(msg), conn.RemoteAddr())
+	// 	tcp.Infof("msg %v  sent %v bytes to %v", id, len(msg), session.RemoteAddr())
 	// }
+
+	return nil
 }
@@ -2,44 +2,36 @@ package tcp
 
 import (
 	"context"
-	"fmt"
 	"net"
 
-	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
 type tcpEventIn struct {
-	tcpEventServer
+	tcpServer
+	dedup *conn.Dedup
 }
 
-func NewTCPEventInServer(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpEventIn, error) {
-	addr, err := net.ResolveTCPAddr("tcp", spec)
-
+func NewTCPEventInServer(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*tcpEventIn, error) {
+	addr, err := resolve(spec)
 	if err != nil {
 		return nil, err
-	} else if addr == nil {
-		return nil, fmt.Errorf("unable to resolve TCP address '%v'", spec)
-	} else if addr.Port == 0 {
-		return nil, fmt.Errorf("TCP host requires a non-zero port")
 	}
 
 	tcp := tcpEventIn{
-		tcpEventServer{
-			Conn: conn.Conn{
-				Tag: "TCP",
-			},
-			hwif:        hwif,
-			addr:        addr,
-			retry:       retry,
-			connections: map[net.Conn]struct{}{},
-			ctx:         ctx,
-			closed:      make(chan struct{}),
+		tcpServer: tcpServer{
+			Server: conn.NewServer("TCP", retry, heartbeat, 2048, ctx),
+			hwif:   hwif,
+			addr:   addr,
+			psk:    key,
 		},
+		dedup: conn.NewDedup(conn.DEDUP_WINDOW),
 	}
 
-	tcp.tcpEventServer.received = tcp.received
+	tcp.Listen = tcp.listen
+	tcp.Accept = tcp.accept
+	tcp.Received = tcp.received
 
 	tcp.Infof("connector::tcp-event-in-server")
 
@@ -49,13 +41,14 @@ func NewTCPEventInServer(hwif string, spec string, retry conn.Backoff, ctx conte
 func (tcp *tcpEventIn) Send(id uint32, message []byte) {
 }
 
-func (tcp *tcpEventIn) received(buffer []byte, router *router.Switch, socket net.Conn) {
+func (tcp *tcpEventIn) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
 	tcp.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
 
-	for len(buffer) > 0 {
-		id, msg, remaining := protocol.Depacketize(buffer)
-		buffer = remaining
-
-		router.Received(id, msg, nil)
+	for _, msg := range session.Received(buffer) {
+		if tcp.dedup.Duplicate(msg.ID, msg.Message) {
+			tcp.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
 	}
 }
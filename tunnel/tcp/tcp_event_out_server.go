@@ -2,69 +2,38 @@ package tcp
 
 import (
 	"context"
-	"fmt"
-	"net"
 
-	"github.com/uhppoted/uhppoted-tunnel/protocol"
-	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
 type tcpEventOutServer struct {
-	tcpEventServer
+	tcpServer
 }
 
-func NewTCPEventOutServer(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpEventOutServer, error) {
-	addr, err := net.ResolveTCPAddr("tcp", spec)
-
+func NewTCPEventOutServer(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*tcpEventOutServer, error) {
+	addr, err := resolve(spec)
 	if err != nil {
 		return nil, err
-	} else if addr == nil {
-		return nil, fmt.Errorf("unable to resolve TCP address '%v'", spec)
-	} else if addr.Port == 0 {
-		return nil, fmt.Errorf("TCP host requires a non-zero port")
 	}
 
 	tcp := tcpEventOutServer{
-		tcpEventServer{
-			Conn: conn.Conn{
-				Tag: "TCP",
-			},
-			hwif:        hwif,
-			addr:        addr,
-			retry:       retry,
-			connections: map[net.Conn]struct{}{},
-			ctx:         ctx,
-			closed:      make(chan struct{}),
+		tcpServer{
+			Server: conn.NewServer("TCP", retry, heartbeat, 2048, ctx),
+			hwif:   hwif,
+			addr:   addr,
+			psk:    key,
 		},
 	}
 
-	tcp.tcpEventServer.received = tcp.received
+	tcp.Listen = tcp.listen
+	tcp.Accept = tcp.accept
+	tcp.Received = conn.Discard
 
-	tcp.Infof("connector::tcp-event-out-client")
+	tcp.Infof("connector::tcp-event-out-server")
 
 	return &tcp, nil
 }
 
 func (tcp *tcpEventOutServer) Send(id uint32, message []byte) {
-	for c := range tcp.connections {
-		go func(conn net.Conn) {
-			tcp.send(conn, id, message)
-		}(c)
-	}
-}
-
-func (tcp *tcpEventOutServer) received(buffer []byte, router *router.Switch, socket net.Conn) {
-}
-
-func (tcp *tcpEventOutServer) send(conn net.Conn, id uint32, message []byte) {
-	packet := protocol.Packetize(id, message)
-
-	if N, err := conn.Write(packet); err != nil {
-		tcp.Warnf("msg %v  error sending message to %v (%v)", id, conn.RemoteAddr(), err)
-	} else if N != len(packet) {
-		tcp.Warnf("msg %v  sent %v of %v bytes to %v", id, N, len(message), conn.RemoteAddr())
-	} else {
-		tcp.Infof("msg %v sent %v bytes to %v", id, len(message), conn.RemoteAddr())
-	}
+	tcp.Post(id, message)
 }
@@ -0,0 +1,207 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+var PSK = []byte("qwerty-uiop-asdf-ghjk")
+
+func TestTCPScenarios(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"tcp", nil},
+		{"tcp with PSK", PSK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loopback.Scenarios(t, loopback.Transport{
+				Network: "tcp",
+
+				Requests: func(t *testing.T, server string, client string, ctx context.Context) (loopback.Connector, loopback.Connector) {
+					retry := conn.NewBackoff(-1, time.Second, ctx)
+
+					return loopback.Must(t)(NewTCPOutServer("", server, test.key, retry, conn.Heartbeat{}, ctx)),
+						loopback.Must(t)(NewTCPInClient("", client, test.key, retry, conn.Heartbeat{}, conn.Proxy{}, ctx))
+				},
+
+				Events: func(t *testing.T, server string, client string, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (loopback.Connector, loopback.Connector) {
+					retry := conn.NewBackoff(-1, time.Second, ctx)
+
+					return loopback.Must(t)(NewTCPEventInServer("", server, test.key, retry, heartbeat, ctx)),
+						loopback.Must(t)(NewTCPEventOutClient("", client, test.key, retry, heartbeat, conn.Proxy{}, queue, ctx))
+				},
+			})
+		})
+	}
+}
+
+func TestTCPServerClosesHandshakingConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("127.0.0.1:%v", loopback.TCPPort(t))
+
+	server, err := NewTCPOutServer("", addr, PSK, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	accepted := accepting(&server.Server)
+
+	go server.Run(loopback.Sink(t))
+
+	loopback.Listening(t, addr)
+
+	client := handshaking(t, addr, accepted)
+
+	cancel()
+	server.Close()
+
+	closed(t, client)
+}
+
+func TestTCPEventServerClosesHandshakingConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("127.0.0.1:%v", loopback.TCPPort(t))
+
+	server, err := NewTCPEventInServer("", addr, PSK, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s, _ := loopback.Events(t)
+	accepted := accepting(&server.Server)
+
+	go server.Run(s)
+
+	loopback.Listening(t, addr)
+
+	client := handshaking(t, addr, accepted)
+
+	cancel()
+	server.Close()
+
+	closed(t, client)
+}
+
+// A connector that relays events more slowly than they are received must not stall the
+// connection read loop, which would stop the PONGs being read and tear down a healthy
+// connection.
+func TestTCPHeartbeatWithStalledEventRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("127.0.0.1:%v", loopback.TCPPort(t))
+	queue := loopback.Queue(t)
+	N := 2 * router.EVENT_QUEUE
+
+	server, err := NewTCPEventInServer("", addr, PSK, conn.NewBackoff(-1, time.Second, ctx), loopback.HEARTBEAT, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	client, err := NewTCPEventOutClient("", addr, PSK, conn.NewBackoff(-1, time.Second, ctx), loopback.HEARTBEAT, conn.Proxy{}, queue, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	blocked := make(chan struct{})
+	s1 := loopback.NewSwitch(t, func(id uint32, message []byte, h func([]byte)) {
+		<-blocked
+	})
+
+	t.Cleanup(func() {
+		close(blocked)
+	})
+
+	s2 := loopback.Sink(t)
+
+	defer func() {
+		cancel()
+		client.Close()
+		server.Close()
+	}()
+
+	go server.Run(s1)
+
+	loopback.Listening(t, addr)
+
+	go client.Run(s2)
+
+	var session *conn.Session
+
+	loopback.Until(t, func() bool {
+		for _, s := range server.Sessions() {
+			session = s
+		}
+
+		return session != nil
+	})
+
+	for id := uint32(1); id <= uint32(N); id++ {
+		client.Send(id, loopback.EVENT)
+	}
+
+	loopback.Until(t, func() bool {
+		return queue.Stats().Forwarded == uint64(N)
+	})
+
+	loopback.Steady(t, 10*loopback.HEARTBEAT.Interval, func() bool {
+		for _, s := range server.Sessions() {
+			return s == session
+		}
+
+		return false
+	})
+}
+
+// accepting wraps the server Accept handshake, returning a function that reports whether the
+// server has started the handshake for an incoming connection. Must be called before Run.
+func accepting(server *conn.Server) func() bool {
+	var accepted atomic.Bool
+
+	accept := server.Accept
+	server.Accept = func(client net.Conn) (net.Conn, error) {
+		accepted.Store(true)
+		return accept(client)
+	}
+
+	return accepted.Load
+}
+
+// handshaking connects to the server but never completes the PSK handshake.
+func handshaking(t *testing.T, addr string, accepted func() bool) net.Conn {
+	t.Helper()
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	t.Cleanup(func() { client.Close() })
+
+	loopback.Until(t, accepted)
+
+	return client
+}
+
+// closed checks that the server closed the connection well before the handshake timeout.
+func closed(t *testing.T, client net.Conn) {
+	t.Helper()
+
+	client.SetReadDeadline(time.Now().Add(loopback.TIMEOUT))
+
+	if _, err := client.Read(make([]byte, 64)); err == nil {
+		t.Errorf("expected connection to be closed on shutdown")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Errorf("connection not closed on shutdown (%v)", err)
+	}
+}
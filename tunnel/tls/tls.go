@@ -1,3 +1,88 @@
 package tls
 
-var ID uint32 = 0
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// HANDSHAKE_TIMEOUT is the maximum time allowed for a client to complete the TLS handshake.
+const HANDSHAKE_TIMEOUT = 5 * time.Second
+
+func serverConfig(ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool) *tls.Config {
+	config := tls.Config{
+		ClientCAs:    ca,
+		Certificates: []tls.Certificate{keypair},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		},
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if requireClientCertificate {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &config
+}
+
+func resolve(spec string) (*net.TCPAddr, error) {
+	addr, err := net.ResolveTCPAddr("tcp", spec)
+
+	if err != nil {
+		return nil, err
+	} else if addr == nil {
+		return nil, fmt.Errorf("unable to resolve TCP address '%v'", spec)
+	} else if addr.Port == 0 {
+		return nil, fmt.Errorf("TCP host requires a non-zero port")
+	}
+
+	return addr, nil
+}
+
+// listen opens the TCP listen socket for a TLS server. The TLS handshake is completed by accept
+// so that a slow client does not hold up the accept loop.
+func listen(hwif string, addr *net.TCPAddr, c conn.Conn) (net.Listener, error) {
+	listener := net.ListenConfig{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if hwif != "" {
+				return conn.BindToDevice(connection, hwif, conn.IsIPv4(addr.IP), c)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	socket, err := listener.Listen(context.Background(), "tcp", fmt.Sprintf("%v", addr))
+	if err != nil {
+		return nil, err
+	} else if socket == nil {
+		return nil, fmt.Errorf("failed to create TCP listen socket (%v)", socket)
+	}
+
+	return socket, nil
+}
+
+// accept completes the TLS handshake for an incoming connection.
+func accept(client net.Conn, config *tls.Config, ctx context.Context) (net.Conn, error) {
+	socket := tls.Server(client, config)
+
+	ctx, cancel := context.WithTimeout(ctx, HANDSHAKE_TIMEOUT)
+	defer cancel()
+
+	if err := socket.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+
+	return socket, nil
+}
@@ -5,7 +5,6 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
-	"fmt"
 	"net"
 	"syscall"
 	"time"
@@ -17,18 +16,20 @@ import (
 
 type tlsClient struct {
 	conn.Conn
-	hwif    string
-	addr    *net.TCPAddr
-	config  *tls.Config
-	retry   conn.Backoff
-	timeout time.Duration
-	ch      chan protocol.Message
-	ctx     context.Context
-	closed  chan struct{}
+	hwif      string
+	addr      string
+	config    *tls.Config
+	retry     conn.Backoff
+	heartbeat conn.Heartbeat
+	proxy     conn.Proxy
+	timeout   time.Duration
+	ch        chan protocol.Message
+	ctx       context.Context
+	closed    chan struct{}
 }
 
-func NewTLSInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, ctx context.Context) (*tlsClient, error) {
-	client, err := makeTLSClient(hwif, spec, ca, keypair, retry, ctx)
+func NewTLSInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*tlsClient, error) {
+	client, err := makeTLSClient(hwif, spec, ca, keypair, retry, heartbeat, proxy, ctx)
 
 	if err == nil {
 		client.Infof("connector::tls-client-in")
@@ -37,8 +38,8 @@ func NewTLSInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Ce
 	return client, err
 }
 
-func NewTLSOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, ctx context.Context) (*tlsClient, error) {
-	client, err := makeTLSClient(hwif, spec, ca, keypair, retry, ctx)
+func NewTLSOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*tlsClient, error) {
+	client, err := makeTLSClient(hwif, spec, ca, keypair, retry, heartbeat, proxy, ctx)
 
 	if err == nil {
 		client.Infof("connector::tls-client-out")
@@ -47,12 +48,10 @@ func NewTLSOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.C
 	return client, err
 }
 
-func makeTLSClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, ctx context.Context) (*tlsClient, error) {
-	addr, err := net.ResolveTCPAddr("tcp", spec)
+func makeTLSClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*tlsClient, error) {
+	addr, err := proxy.Resolve(spec)
 	if err != nil {
 		return nil, err
-	} else if addr == nil {
-		return nil, fmt.Errorf("unable to resolve TCP address '%v'", spec)
 	}
 
 	config := tls.Config{
@@ -75,14 +74,16 @@ func makeTLSClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Cer
 		Conn: conn.Conn{
 			Tag: "TLS",
 		},
-		hwif:    hwif,
-		addr:    addr,
-		config:  &config,
-		retry:   retry,
-		timeout: 5 * time.Second,
-		ch:      make(chan protocol.Message, 16),
-		ctx:     ctx,
-		closed:  make(chan struct{}),
+		hwif:      hwif,
+		addr:      addr,
+		config:    &config,
+		retry:     retry,
+		heartbeat: heartbeat,
+		proxy:     proxy,
+		timeout:   5 * time.Second,
+		ch:        make(chan protocol.Message, 16),
+		ctx:       ctx,
+		closed:    make(chan struct{}),
 	}
 
 	return &in, nil
@@ -123,19 +124,20 @@ func (tcp *tlsClient) connect(router *router.Switch) {
 			Timeout: tcp.timeout,
 			Control: func(network, address string, connection syscall.RawConn) error {
 				if tcp.hwif != "" {
-					return conn.BindToDevice(connection, tcp.hwif, conn.IsIPv4(tcp.addr.IP), tcp.Conn)
+					return conn.BindToDevice(connection, tcp.hwif, network == "tcp4", tcp.Conn)
 				} else {
 					return nil
 				}
 			},
 		}
 
-		if socket, err := tls.DialWithDialer(dialer, "tcp", fmt.Sprintf("%v", tcp.addr), tcp.config); err != nil {
+		if socket, err := tcp.proxy.DialTLS(tcp.ctx, dialer, "tcp", tcp.addr, tcp.config); err != nil {
 			tcp.Warnf("%v", err)
 		} else if socket == nil {
 			tcp.Warnf("connect %v failed (%v)", tcp.addr, socket)
 		} else {
 			tcp.retry.Reset()
+			session := conn.NewSession(tcp.Conn, socket, tcp.heartbeat)
 			eof := make(chan struct{})
 
 			go func() {
@@ -143,7 +145,7 @@ func (tcp *tlsClient) connect(router *router.Switch) {
 					select {
 					case msg := <-tcp.ch:
 						tcp.Infof("msg %v  relaying to %v", msg.ID, socket.RemoteAddr())
-						tcp.send(socket, msg.ID, msg.Message)
+						tcp.send(session, msg.ID, msg.Message)
 
 					case <-eof:
 						return
@@ -155,7 +157,7 @@ func (tcp *tlsClient) connect(router *router.Switch) {
 				}
 			}()
 
-			if err := tcp.listen(socket, router); err != nil && !errors.Is(err, net.ErrClosed) {
+			if err := tcp.listen(socket, session, router); err != nil && !errors.Is(err, net.ErrClosed) {
 				tcp.Warnf("%v", err)
 			}
 
@@ -168,47 +170,44 @@ func (tcp *tlsClient) connect(router *router.Switch) {
 	}
 }
 
-func (tcp *tlsClient) listen(socket net.Conn, router *router.Switch) error {
+func (tcp *tlsClient) listen(socket net.Conn, session *conn.Session, router *router.Switch) error {
 	tcp.Infof("connected  to %v", socket.RemoteAddr())
 
 	defer socket.Close()
+	defer session.Close()
+
+	if err := session.Start(); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 2048)
 
 	for {
-		buffer := make([]byte, 2048)
 		N, err := socket.Read(buffer)
 		if err != nil {
 			return err
 		}
 
-		go func() {
-			tcp.received(buffer[:N], router, socket)
-		}()
+		tcp.received(buffer[:N], session, router, socket)
 	}
 }
 
-func (tcp *tlsClient) received(buffer []byte, router *router.Switch, socket net.Conn) {
+func (tcp *tlsClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
 	tcp.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
 
-	for len(buffer) > 0 {
-		id, msg, remaining := protocol.Depacketize(buffer)
-		buffer = remaining
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
 
-		router.Received(id, msg, func(message []byte) {
-			tcp.send(socket, id, message)
+		router.Received(id, msg.Message, func(message []byte) {
+			tcp.send(session, id, message)
 		})
 	}
 }
 
-func (tcp *tlsClient) send(conn net.Conn, id uint32, msg []byte) []byte {
-	packet := protocol.Packetize(id, msg)
-
-	if N, err := conn.Write(packet); err != nil {
-		tcp.Warnf("msg %v  error sending message to %v (%v)", id, conn.RemoteAddr(), err)
-	} else if N != len(packet) {
-		tcp.Warnf("msg %v  sent %v of %v bytes to %v", id, N, len(msg), conn.RemoteAddr())
+func (tcp *tlsClient) send(session *conn.Session, id uint32, msg []byte) {
+	if err := session.Send(id, msg); err != nil {
+		tcp.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
 	} else {
-		tcp.Infof("msg %v  sent %v bytes to %v", id, len(msg), conn.RemoteAddr())
+		tcp.Infof("msg %v  sent %v bytes to %v", id, len(msg), session.RemoteAddr())
 	}
-
-	return nil
 }
@@ -4,25 +4,22 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"fmt"
 	"net"
 	"time"
 
-	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
 type tlsEventInClient struct {
 	tlsEventClient
+	dedup *conn.Dedup
 }
 
-func NewTLSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, ctx context.Context) (*tlsEventInClient, error) {
-	addr, err := net.ResolveTCPAddr("tcp", spec)
+func NewTLSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*tlsEventInClient, error) {
+	addr, err := proxy.Resolve(spec)
 	if err != nil {
 		return nil, err
-	} else if addr == nil {
-		return nil, fmt.Errorf("unable to resolve TCP address '%v'", spec)
 	}
 
 	config := tls.Config{
@@ -43,38 +40,36 @@ func NewTLSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *t
 
 	tcp := tlsEventInClient{
 		tlsEventClient{
-			Conn: conn.Conn{
-				Tag: "TLS",
-			},
-			hwif:    hwif,
-			addr:    addr,
-			config:  &config,
-			retry:   retry,
-			timeout: 5 * time.Second,
-			ch:      make(chan protocol.Message, 16),
-			ctx:     ctx,
-			closed:  make(chan struct{}),
+			EventClient: conn.NewEventClient("TLS", addr, retry, heartbeat, nil, 2048, ctx),
+			hwif:        hwif,
+			config:      &config,
+			proxy:       proxy,
+			timeout:     5 * time.Second,
 		},
+		conn.NewDedup(conn.DEDUP_WINDOW),
 	}
 
-	tcp.tlsEventClient.received = tcp.received
-	tcp.tlsEventClient.send = tcp.send
+	tcp.Dial = tcp.dial
+	tcp.Received = tcp.received
+	tcp.Relay = tcp.send
 
 	tcp.Infof("connector::tls-event-in-client")
 
 	return &tcp, nil
 }
 
-func (tcp *tlsEventInClient) received(buffer []byte, router *router.Switch, socket net.Conn) {
+func (tcp *tlsEventInClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
 	tcp.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
 
-	for len(buffer) > 0 {
-		id, msg, remaining := protocol.Depacketize(buffer)
-		buffer = remaining
-
-		router.Received(id, msg, nil)
+	for _, msg := range session.Received(buffer) {
+		if tcp.dedup.Duplicate(msg.ID, msg.Message) {
+			tcp.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
 	}
 }
 
-func (tcp *tlsEventInClient) send(conn net.Conn, id uint32, msg []byte) {
+func (tcp *tlsEventInClient) send(session *conn.Session, id uint32, msg []byte) error {
+	return nil
 }
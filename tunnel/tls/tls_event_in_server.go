@@ -4,80 +4,54 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"fmt"
 	"net"
 
-	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
 type tlsEventInServer struct {
-	tlsEventServer
+	tlsServer
+	dedup *conn.Dedup
 }
 
-func NewTLSEventInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, ctx context.Context) (*tlsEventInServer, error) {
-	addr, err := net.ResolveTCPAddr("tcp", spec)
-
+func NewTLSEventInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*tlsEventInServer, error) {
+	addr, err := resolve(spec)
 	if err != nil {
 		return nil, err
-	} else if addr == nil {
-		return nil, fmt.Errorf("unable to resolve TCP address '%v'", spec)
-	} else if addr.Port == 0 {
-		return nil, fmt.Errorf("TCP host requires a non-zero port")
-	}
-
-	config := tls.Config{
-		ClientCAs:    ca,
-		Certificates: []tls.Certificate{keypair},
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-		},
-		ClientAuth: tls.VerifyClientCertIfGiven,
-		MinVersion: tls.VersionTLS12,
-	}
-
-	if requireClientCertificate {
-		config.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
 	tcp := tlsEventInServer{
-		tlsEventServer{
-			Conn: conn.Conn{
-				Tag: "TLS",
-			},
-			hwif:        hwif,
-			addr:        addr,
-			config:      &config,
-			retry:       retry,
-			connections: map[net.Conn]struct{}{},
-			pending:     map[uint32]context.CancelFunc{},
-			ctx:         ctx,
-			closed:      make(chan struct{}),
+		tlsServer: tlsServer{
+			Server: conn.NewServer("TLS", retry, heartbeat, 2048, ctx),
+			hwif:   hwif,
+			addr:   addr,
+			config: serverConfig(ca, keypair, requireClientCertificate),
+			ctx:    ctx,
 		},
+		dedup: conn.NewDedup(conn.DEDUP_WINDOW),
 	}
 
-	tcp.tlsEventServer.received = tcp.received
-	tcp.tlsEventServer.send = tcp.send
+	tcp.Listen = tcp.listen
+	tcp.Accept = tcp.accept
+	tcp.Received = tcp.received
 
 	tcp.Infof("connector::tls-event-in-server")
 
 	return &tcp, nil
 }
 
-func (tcp *tlsEventInServer) received(buffer []byte, router *router.Switch, socket net.Conn) {
-	tcp.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+func (tcp *tlsEventInServer) Send(id uint32, message []byte) {
+}
 
-	for len(buffer) > 0 {
-		id, msg, remaining := protocol.Depacketize(buffer)
-		buffer = remaining
+func (tcp *tlsEventInServer) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	tcp.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
 
-		router.Received(id, msg, nil)
+	for _, msg := range session.Received(buffer) {
+		if tcp.dedup.Duplicate(msg.ID, msg.Message) {
+			tcp.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
 	}
 }
-
-func (tcp *tlsEventInServer) send(conn net.Conn, id uint32, message []byte) {
-}
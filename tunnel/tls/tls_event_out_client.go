@@ -4,12 +4,8 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"fmt"
-	"net"
 	"time"
 
-	"github.com/uhppoted/uhppoted-tunnel/protocol"
-	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
@@ -17,12 +13,10 @@ type tlsEventOutClient struct {
 	tlsEventClient
 }
 
-func NewTLSEventOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, ctx context.Context) (*tlsEventOutClient, error) {
-	addr, err := net.ResolveTCPAddr("tcp", spec)
+func NewTLSEventOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, queue *conn.Queue, ctx context.Context) (*tlsEventOutClient, error) {
+	addr, err := proxy.Resolve(spec)
 	if err != nil {
 		return nil, err
-	} else if addr == nil {
-		return nil, fmt.Errorf("unable to resolve TCP address '%v'", spec)
 	}
 
 	config := tls.Config{
@@ -43,39 +37,19 @@ func NewTLSEventOutClient(hwif string, spec string, ca *x509.CertPool, keypair *
 
 	tcp := tlsEventOutClient{
 		tlsEventClient{
-			Conn: conn.Conn{
-				Tag: "TLS",
-			},
-			hwif:    hwif,
-			addr:    addr,
-			config:  &config,
-			retry:   retry,
-			timeout: 5 * time.Second,
-			ch:      make(chan protocol.Message, 16),
-			ctx:     ctx,
-			closed:  make(chan struct{}),
+			EventClient: conn.NewEventClient("TLS", addr, retry, heartbeat, queue, 2048, ctx),
+			hwif:        hwif,
+			config:      &config,
+			proxy:       proxy,
+			timeout:     5 * time.Second,
 		},
 	}
 
-	tcp.tlsEventClient.received = tcp.received
-	tcp.tlsEventClient.send = tcp.send
+	tcp.Dial = tcp.dial
+	tcp.Received = conn.Discard
+	tcp.Relay = tcp.Deliver
 
 	tcp.Infof("connector::tls-event-out-client")
 
 	return &tcp, nil
 }
-
-func (tcp *tlsEventOutClient) received(buffer []byte, router *router.Switch, socket net.Conn) {
-}
-
-func (tcp *tlsEventOutClient) send(conn net.Conn, id uint32, msg []byte) {
-	packet := protocol.Packetize(id, msg)
-
-	if N, err := conn.Write(packet); err != nil {
-		tcp.Warnf("msg %v  error sending message to %v (%v)", id, conn.RemoteAddr(), err)
-	} else if N != len(packet) {
-		tcp.Warnf("msg %v  sent %v of %v bytes to %v", id, N, len(msg), conn.RemoteAddr())
-	} else {
-		tcp.Infof("msg %v  sent %v bytes to %v", id, len(msg), conn.RemoteAddr())
-	}
-}
@@ -0,0 +1,77 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestTLSScenarios(t *testing.T) {
+	ca, keypair := loopback.Certificates(t)
+
+	loopback.Scenarios(t, loopback.Transport{
+		Network: "tcp",
+
+		Requests: func(t *testing.T, server string, client string, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			return loopback.Must(t)(NewTLSOutServer("", server, ca, keypair, false, retry, conn.Heartbeat{}, ctx)),
+				loopback.Must(t)(NewTLSInClient("", client, ca, nil, retry, conn.Heartbeat{}, conn.Proxy{}, ctx))
+		},
+
+		Events: func(t *testing.T, server string, client string, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			return loopback.Must(t)(NewTLSEventInServer("", server, ca, keypair, false, retry, heartbeat, ctx)),
+				loopback.Must(t)(NewTLSEventOutClient("", client, ca, nil, retry, heartbeat, conn.Proxy{}, queue, ctx))
+		},
+	})
+}
+
+// A frame split across TLS records (and so across socket reads) is reassembled by the session
+// stream decoder.
+func TestTLSSplitFrame(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("127.0.0.1:%v", loopback.TCPPort(t))
+	ca, keypair := loopback.Certificates(t)
+
+	server, err := NewTLSInServer("", addr, ca, keypair, false, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer func() {
+		cancel()
+		server.Close()
+	}()
+
+	go server.Run(loopback.Echo(t))
+
+	loopback.Listening(t, addr)
+
+	client, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: ca})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer client.Close()
+
+	frames := loopback.Frames(client)
+	request := protocol.Frame{Type: protocol.DATA, ID: 12345, Message: loopback.REQUEST}.Encode()
+
+	for _, packet := range [][]byte{protocol.Hello(0).Encode(), request[:5], request[5:]} {
+		if _, err := client.Write(packet); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	loopback.Reply(t, frames, 12345)
+}
@@ -2,13 +2,17 @@ package tunnel
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"sync"
 
 	"golang.org/x/time/rate"
 
 	"github.com/uhppoted/uhppoted-tunnel/log"
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 )
 
@@ -18,100 +22,230 @@ type Conn interface {
 	Send(uint32, []byte)
 }
 
+// Tunnel relays messages between a set of named connectors. A 'simple' tunnel has a
+// single IN and a single OUT connector, but a tunnel can also be a routing matrix that
+// fans requests out to several connectors and/or fans in requests and events from
+// several connectors, with the routes defined by a list of rules.
 type Tunnel struct {
-	in      Conn
-	out     Conn
-	limiter *rate.Limiter
-	ctx     context.Context
+	tag        string
+	connectors []connector
+	rules      []Rule
+	remap      bool
+	router     *router.Router
+	ctx        context.Context
 }
 
-func NewTunnel(in Conn, out Conn, limiter *rate.Limiter, ctx context.Context) *Tunnel {
-	return &Tunnel{
-		in:      in,
-		out:     out,
-		limiter: limiter,
-		ctx:     ctx,
-	}
+type connector struct {
+	name string
+	dir  Direction
+	conn Conn
 }
 
-func (t *Tunnel) Run(interrupt chan os.Signal) (err error) {
-	infof("", "%v", "uhppoted-tunnel::run")
+type Direction int
 
-	router.SetRateLimiter(t.limiter)
+const (
+	In Direction = iota + 1
+	Out
+)
 
-	p := router.NewSwitch(func(id uint32, message []byte) {
-		t.out.Send(id, message)
-	})
+func (d Direction) String() string {
+	return [...]string{"?", "in", "out"}[d]
+}
 
-	q := router.NewSwitch(func(id uint32, message []byte) {
-		t.in.Send(id, message)
-	})
+// labelled is implemented by connectors that can include the tunnel label in their log
+// messages.
+type labelled interface {
+	SetLabel(string)
+}
 
-	ctx, cancel := context.WithCancel(t.ctx)
+// NewTunnel creates a tunnel between the 'in' and 'out' connectors. The (optional) label
+// identifies the tunnel in the log messages when running multiple tunnels.
+func NewTunnel(label string, in Conn, out Conn, limiter *rate.Limiter, ctx context.Context) *Tunnel {
+	return NewMatrix(label, map[string]Conn{"IN": in}, map[string]Conn{"OUT": out}, nil, limiter, ctx)
+}
+
+// NewMatrix creates a tunnel that routes messages between the named IN and OUT connectors
+// using the first rule that matches a message. If no rules are defined messages received
+// on an IN connector are relayed to all the OUT connectors and vice versa.
+//
+// Request IDs are only unique per connector so a matrix with more than two connectors
+// remaps the ID of each relayed request to a locally unique ID.
+func NewMatrix(label string, in map[string]Conn, out map[string]Conn, rules []Rule, limiter *rate.Limiter, ctx context.Context) *Tunnel {
+	connectors := []connector{}
+	matrix := len(in)+len(out) > 2
 
-	go func() {
-		defer func() {
-			if err := recover(); err != nil {
-				fatalf("%v", err)
+	for _, v := range []struct {
+		dir        Direction
+		connectors map[string]Conn
+	}{
+		{In, in},
+		{Out, out},
+	} {
+		for _, name := range slices.Sorted(maps.Keys(v.connectors)) {
+			c := v.connectors[name]
+			if l, ok := c.(labelled); ok && matrix {
+				l.SetLabel(join(label, name))
+			} else if ok {
+				l.SetLabel(label)
 			}
-		}()
 
-		if err = t.in.Run(&p); err != nil {
-			errorf("OUT", "%v", err)
-			cancel()
+			connectors = append(connectors, connector{
+				name: name,
+				dir:  v.dir,
+				conn: c,
+			})
 		}
-	}()
+	}
+
+	return &Tunnel{
+		tag:        label,
+		connectors: connectors,
+		rules:      rules,
+		remap:      len(connectors) > 2,
+		router:     router.NewRouter(label, limiter),
+		ctx:        ctx,
+	}
+}
 
-	go func() {
-		defer func() {
-			if err := recover(); err != nil {
-				fatalf("%v", err)
+// Run relays messages between the tunnel connectors until either the tunnel context is
+// cancelled or a connector fails. Returns the cause of the failure if the tunnel context
+// was cancelled with a cause or a connector failed.
+func (t *Tunnel) Run(interrupt chan os.Signal) (err error) {
+	infof(t.tag, "%v", "uhppoted-tunnel::run")
+
+	switches := map[string]*router.Switch{}
+
+	for _, c := range t.connectors {
+		switches[c.name] = t.router.NewSwitch(func(id uint32, message []byte, h func([]byte)) {
+			t.relay(c, switches, id, message, h)
+		})
+	}
+
+	ctx, cancel := context.WithCancelCause(t.ctx)
+
+	for _, c := range t.connectors {
+		go func() {
+			defer func() {
+				if err := recover(); err != nil {
+					fatalf("%v", err)
+				}
+			}()
+
+			if err := c.conn.Run(switches[c.name]); err != nil {
+				errorf(t.label(c.name), "%v", err)
+				cancel(err)
 			}
 		}()
+	}
 
-		if err = t.out.Run(&q); err != nil {
-			errorf("IN", "%v", err)
-			cancel()
-		}
-	}()
+	<-ctx.Done()
 
-	select {
-	case <-t.ctx.Done():
-	case <-ctx.Done():
+	if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, context.Canceled) {
+		err = cause
 	}
 
-	infof("", "closing")
+	infof(t.tag, "closing")
 
 	var wg sync.WaitGroup
 
-	wg.Add(3)
-	go func() {
-		defer wg.Done()
-		router.Close()
-	}()
-
-	go func() {
-		defer wg.Done()
-		t.in.Close()
-	}()
+	wg.Go(func() {
+		t.router.Close()
+	})
 
-	go func() {
-		defer wg.Done()
-		t.out.Close()
-	}()
+	for _, c := range t.connectors {
+		wg.Go(func() {
+			c.conn.Close()
+		})
+	}
 
 	wg.Wait()
-	infof("", "closed")
+	cancel(nil)
+	infof(t.tag, "closed")
 
 	return
 }
 
+// relay sends a message received on a connector to the connectors selected by the routing
+// rules, registering the requester reply handler (if any) with each destination.
+func (t *Tunnel) relay(source connector, switches map[string]*router.Switch, id uint32, message []byte, h func([]byte)) {
+	destinations := t.route(source, message)
+	if len(destinations) == 0 {
+		warnf(t.label(source.name), "msg %v  no route", id)
+		return
+	}
+
+	if t.remap {
+		local := protocol.NextID()
+		debugf(t.label(source.name), "msg %v  relaying as msg %v", id, local)
+		id = local
+	}
+
+	for _, c := range destinations {
+		switches[c.name].Expect(id, h)
+		c.conn.Send(id, message)
+	}
+}
+
+// route returns the connectors for the first rule that matches the message or, if no
+// rules are defined, all the connectors in the 'other' direction.
+func (t *Tunnel) route(source connector, message []byte) []connector {
+	destinations := []connector{}
+
+	if len(t.rules) == 0 {
+		for _, c := range t.connectors {
+			if c.dir != source.dir {
+				destinations = append(destinations, c)
+			}
+		}
+
+		return destinations
+	}
+
+	for _, rule := range t.rules {
+		if rule.Match(source.name, message) {
+			for _, c := range t.connectors {
+				if c.name != source.name && rule.routes(c.name) {
+					destinations = append(destinations, c)
+				}
+			}
+
+			return destinations
+		}
+	}
+
+	return destinations
+}
+
+func (t *Tunnel) label(tag string) string {
+	return join(t.tag, tag)
+}
+
+func join(label, tag string) string {
+	if label != "" {
+		return fmt.Sprintf("%v/%v", label, tag)
+	}
+
+	return tag
+}
+
+func debugf(tag string, format string, args ...any) {
+	f := fmt.Sprintf("%-10v %v", tag, format)
+
+	log.Debugf(f, args...)
+}
+
 func infof(tag string, format string, args ...any) {
 	f := fmt.Sprintf("%-10v %v", tag, format)
 
 	log.Infof(f, args...)
 }
 
+func warnf(tag string, format string, args ...any) {
+	f := fmt.Sprintf("%-10v %v", tag, format)
+
+	log.Warnf(f, args...)
+}
+
 func errorf(tag string, format string, args ...any) {
 	f := fmt.Sprintf("%-10v %v", tag, format)
 
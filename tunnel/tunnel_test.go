@@ -0,0 +1,290 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+)
+
+type stub struct {
+	router chan *router.Switch
+	sent   chan protocol.Message
+	closed chan struct{}
+}
+
+func newStub() *stub {
+	return &stub{
+		router: make(chan *router.Switch, 1),
+		sent:   make(chan protocol.Message, 8),
+		closed: make(chan struct{}),
+	}
+}
+
+func (s *stub) Run(r *router.Switch) error {
+	s.router <- r
+	<-s.closed
+
+	return nil
+}
+
+func (s *stub) Close() {
+	close(s.closed)
+}
+
+func (s *stub) Send(id uint32, message []byte) {
+	s.sent <- protocol.Message{ID: id, Message: message}
+}
+
+func (s *stub) switch_(t *testing.T) *router.Switch {
+	select {
+	case r := <-s.router:
+		return r
+	case <-time.After(time.Second):
+		t.Fatalf("connector not started")
+	}
+
+	return nil
+}
+
+func (s *stub) received(t *testing.T) protocol.Message {
+	select {
+	case msg := <-s.sent:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("message not received")
+	}
+
+	return protocol.Message{}
+}
+
+func (s *stub) idle(t *testing.T) {
+	select {
+	case msg := <-s.sent:
+		t.Errorf("unexpected message %v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func request(function uint8, serial uint32) []byte {
+	message := make([]byte, 64)
+
+	message[0] = 0x17
+	message[1] = function
+	binary.LittleEndian.PutUint32(message[4:], serial)
+
+	return message
+}
+
+func run(t *Tunnel) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t.ctx = ctx
+
+	go t.Run(nil)
+
+	return cancel
+}
+
+func TestTunnel(t *testing.T) {
+	in := newStub()
+	out := newStub()
+
+	cancel := run(NewTunnel("", in, out, nil, context.Background()))
+	defer cancel()
+
+	replies := make(chan []byte, 1)
+
+	in.switch_(t).Received(12345, request(0x94, 405419896), func(reply []byte) { replies <- reply })
+
+	if msg := out.received(t); msg.ID != 12345 {
+		t.Errorf("incorrect relayed message ID - expected:%v, got:%v", 12345, msg.ID)
+	}
+
+	out.switch_(t).Received(12345, request(0x94, 405419896), nil)
+
+	select {
+	case <-replies:
+	case <-time.After(time.Second):
+		t.Errorf("reply not routed to requester")
+	}
+}
+
+func TestMatrixFanOut(t *testing.T) {
+	local := newStub()
+	siteA := newStub()
+	home := newStub()
+
+	rules := []Rule{
+		{Serial: []Range{Serial(405419896)}, To: []string{"site-a"}},
+		{Function: []uint8{0x94}, To: []string{"site-a", "home"}},
+		{Source: []string{"local"}, To: []string{"home"}},
+	}
+
+	matrix := NewMatrix("", map[string]Conn{"local": local}, map[string]Conn{"site-a": siteA, "home": home}, rules, nil, context.Background())
+	cancel := run(matrix)
+	defer cancel()
+
+	replies := make(chan []byte, 2)
+	h := func(reply []byte) { replies <- reply }
+
+	sw := local.switch_(t)
+	a := siteA.switch_(t)
+	b := home.switch_(t)
+
+	// ... serial number
+	sw.Received(1, request(0x20, 405419896), h)
+
+	msg := siteA.received(t)
+	home.idle(t)
+
+	a.Received(msg.ID, request(0x20, 405419896), nil)
+
+	select {
+	case <-replies:
+	case <-time.After(time.Second):
+		t.Errorf("reply not routed to requester")
+	}
+
+	// ... function code (broadcast)
+	sw.Received(2, request(0x94, 0), h)
+
+	p := siteA.received(t)
+	q := home.received(t)
+
+	if p.ID != q.ID {
+		t.Errorf("inconsistent relayed message IDs (%v and %v)", p.ID, q.ID)
+	}
+
+	a.Received(p.ID, request(0x94, 405419896), nil)
+	b.Received(q.ID, request(0x94, 303986753), nil)
+
+	for range 2 {
+		select {
+		case <-replies:
+		case <-time.After(time.Second):
+			t.Errorf("reply not routed to requester")
+		}
+	}
+
+	// ... source
+	sw.Received(3, request(0x20, 303986753), h)
+
+	home.received(t)
+	siteA.idle(t)
+}
+
+func TestMatrixFanIn(t *testing.T) {
+	siteA := newStub()
+	siteB := newStub()
+	sink := newStub()
+
+	matrix := NewMatrix("", map[string]Conn{"site-a": siteA, "site-b": siteB}, map[string]Conn{"sink": sink}, nil, nil, context.Background())
+	cancel := run(matrix)
+	defer cancel()
+
+	siteA.switch_(t).Received(1, request(0x20, 405419896), nil)
+	siteB.switch_(t).Received(1, request(0x20, 303986753), nil)
+
+	p := sink.received(t)
+	q := sink.received(t)
+
+	if p.ID == q.ID {
+		t.Errorf("fanned in messages not remapped to unique IDs (%v and %v)", p.ID, q.ID)
+	}
+}
+
+func TestMatrixRoutes(t *testing.T) {
+	local := newStub()
+	siteA := newStub()
+	siteB := newStub()
+
+	routes := []Route{
+		{Serial: Range{From: 303986000, To: 303986999}, To: []string{"site-b"}},
+		{Serial: Serial(405419896), To: []string{"site-a"}},
+	}
+
+	rules := Routes(routes, []string{"local"}, []string{"site-a", "site-b"})
+	matrix := NewMatrix("", map[string]Conn{"local": local}, map[string]Conn{"site-a": siteA, "site-b": siteB}, rules, nil, context.Background())
+	cancel := run(matrix)
+	defer cancel()
+
+	replies := make(chan []byte, 2)
+	h := func(reply []byte) { replies <- reply }
+
+	sw := local.switch_(t)
+	a := siteA.switch_(t)
+	b := siteB.switch_(t)
+
+	// ... serial number range
+	sw.Received(1, request(0x20, 303986753), h)
+
+	siteB.received(t)
+	siteA.idle(t)
+
+	// ... unrouted serial number
+	sw.Received(2, request(0x20, 201020304), h)
+
+	siteA.idle(t)
+	siteB.idle(t)
+
+	// ... broadcast
+	sw.Received(3, request(0x94, 0), h)
+
+	p := siteA.received(t)
+	q := siteB.received(t)
+
+	a.Received(p.ID, request(0x94, 405419896), nil)
+	b.Received(q.ID, request(0x94, 303986753), nil)
+
+	serials := map[uint32]bool{}
+	for range 2 {
+		select {
+		case reply := <-replies:
+			serials[binary.LittleEndian.Uint32(reply[4:])] = true
+		case <-time.After(time.Second):
+			t.Errorf("broadcast reply not routed to requester")
+		}
+	}
+
+	if !serials[405419896] || !serials[303986753] {
+		t.Errorf("incomplete broadcast replies - expected:%v, got:%v", []uint32{405419896, 303986753}, serials)
+	}
+
+	// ... events
+	a.Received(4, request(0x20, 405419896), nil)
+
+	local.received(t)
+}
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		rule     Rule
+		source   string
+		message  []byte
+		expected bool
+	}{
+		{Rule{}, "in", request(0x94, 405419896), true},
+		{Rule{}, "in", []byte{0x01, 0x02}, true},
+		{Rule{Source: []string{"in"}}, "in", []byte{0x01, 0x02}, true},
+		{Rule{Source: []string{"out"}}, "in", request(0x94, 405419896), false},
+		{Rule{Serial: []Range{Serial(405419896)}}, "in", request(0x94, 405419896), true},
+		{Rule{Serial: []Range{Serial(405419896)}}, "in", request(0x94, 303986753), false},
+		{Rule{Serial: []Range{Serial(405419896)}}, "in", []byte{0x01, 0x02}, false},
+		{Rule{Serial: []Range{{From: 303986000, To: 303986999}}}, "in", request(0x94, 303986753), true},
+		{Rule{Serial: []Range{{From: 303986000, To: 303986999}}}, "in", request(0x94, 405419896), false},
+		{Rule{Function: []uint8{0x94}}, "in", request(0x94, 0), true},
+		{Rule{Function: []uint8{0x94}}, "in", request(0x20, 0), false},
+		{Rule{Source: []string{"in"}, Serial: []Range{Serial(405419896)}, Function: []uint8{0x20}}, "in", request(0x20, 405419896), true},
+		{Rule{Source: []string{"in"}, Serial: []Range{Serial(405419896)}, Function: []uint8{0x20}}, "in", request(0x94, 405419896), false},
+	}
+
+	for i, test := range tests {
+		if match := test.rule.Match(test.source, test.message); match != test.expected {
+			t.Errorf("test %v: incorrect match - expected:%v, got:%v", i+1, test.expected, match)
+		}
+	}
+}
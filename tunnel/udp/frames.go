@@ -0,0 +1,209 @@
+package udp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// The udp/client and udp/server connectors carry each tunnel message as a single datagram
+// containing a protocol.Packetize frame. A frame with ID 0 is a keepalive, sent by the client
+// every keepalive interval to hold NAT mappings open and answered by the server so that the
+// client can detect a server that has gone away.
+//
+// If a pre-shared key is configured, each datagram is followed by an 8 byte sequence number and
+// a truncated HMAC-SHA256 of the sender direction, the receiver's connection nonce, the frame and
+// the sequence number. The client keepalives carry the client's nonce for the connection and the
+// server answers with a keepalive carrying its own nonce for the connection, so that a datagram
+// is only valid in one direction on one connection and cannot be replayed on a later connection
+// or reflected back to the sender. Datagrams with an invalid HMAC or a sequence number that has
+// already been received on the connection are discarded.
+//
+// The client confirms the server nonce with a keepalive bound to it and the server only relays
+// messages to a client once it has received a datagram bound to its nonce, so that a keepalive
+// replayed from another address does not receive the replies and events sent to the clients.
+
+const KEEPALIVE = 15 * time.Second
+const PEER_TIMEOUT = 5 * time.Minute
+const MAX_DATAGRAM = 2048
+const TAG_SIZE = 16
+const REPLAY_WINDOW = 64
+const NONCE_SIZE = 8
+
+type psk []byte
+
+// sequence numbers start from the current time so that they continue to increase across
+// restarts.
+var sequence atomic.Uint64
+
+func init() {
+	sequence.Store(uint64(time.Now().UnixNano()))
+}
+
+func keepalive() []byte {
+	return protocol.Packetize(0, []byte{})
+}
+
+// hello returns the keepalive frame carrying the sender's nonce for the connection, or an empty
+// keepalive if a pre-shared key is not configured.
+func (key psk) hello(nonce []byte) []byte {
+	if len(key) == 0 {
+		return keepalive()
+	}
+
+	return protocol.Packetize(0, nonce)
+}
+
+// seal returns the datagram for a frame sent in the direction ("client" or "server") with the
+// sequence number and HMAC appended, bound to the receiver's nonce, if a pre-shared key is
+// configured.
+func (key psk) seal(direction string, nonce []byte, frame []byte) []byte {
+	if len(key) == 0 {
+		return frame
+	}
+
+	datagram := binary.BigEndian.AppendUint64(frame, sequence.Add(1))
+
+	return append(datagram, key.mac(direction, nonce, datagram)...)
+}
+
+// open returns the frame and sequence number from a datagram received from the direction,
+// verifying the HMAC against the receiver's nonce if a pre-shared key is configured.
+func (key psk) open(direction string, nonce []byte, datagram []byte) ([]byte, uint64, bool) {
+	if len(key) == 0 {
+		return datagram, 0, len(datagram) >= 6
+	}
+
+	if len(datagram) < 6+8+TAG_SIZE {
+		return nil, 0, false
+	}
+
+	N := len(datagram) - TAG_SIZE
+
+	if !hmac.Equal(key.mac(direction, nonce, datagram[:N]), datagram[N:]) {
+		return nil, 0, false
+	}
+
+	return datagram[:N-8], binary.BigEndian.Uint64(datagram[N-8 : N]), true
+}
+
+func (key psk) mac(direction string, nonce []byte, datagram []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(direction))
+	mac.Write(nonce)
+	mac.Write(datagram)
+
+	return mac.Sum(nil)[:TAG_SIZE]
+}
+
+// peer holds the nonces for a connection: the local nonce that datagrams received on the
+// connection are bound to and the remote nonce (once known) for datagrams sent on the connection.
+// The replay window and the sequence number of the latest keepalive are only used by the
+// connection's receive loop. A peer is verified once a datagram bound to the local nonce has been
+// received, i.e. once the remote end has proved that it holds the pre-shared key.
+type peer struct {
+	local    []byte
+	remote   []byte
+	replay   replay
+	hello    uint64
+	verified bool
+	sync.RWMutex
+}
+
+func newPeer() *peer {
+	nonce := make([]byte, NONCE_SIZE)
+	rand.Read(nonce)
+
+	return &peer{
+		local: nonce,
+	}
+}
+
+// nonce returns the remote nonce, if known.
+func (p *peer) nonce() ([]byte, bool) {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.remote, p.remote != nil
+}
+
+func (p *peer) connected(nonce []byte) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.remote = bytes.Clone(nonce)
+}
+
+// authenticated returns true once a datagram bound to the local nonce has been received.
+func (p *peer) authenticated() bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.verified
+}
+
+func (p *peer) verify() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.verified = true
+}
+
+// greeting returns the nonce from a keepalive frame, if it has one.
+func greeting(frame []byte) ([]byte, bool) {
+	if id, msg, _ := protocol.Depacketize(frame); id == 0 && len(msg) == NONCE_SIZE {
+		return msg, true
+	}
+
+	return nil, false
+}
+
+// replay is a sliding window of the sequence numbers received from a peer, used to discard
+// replayed datagrams when a pre-shared key is configured.
+type replay struct {
+	latest uint64
+	seen   uint64
+}
+
+// accept returns false if the sequence number has already been received or is too old to be
+// checked, and records it otherwise.
+func (r *replay) accept(seqno uint64) bool {
+	switch {
+	case r.latest == 0 || seqno > r.latest+REPLAY_WINDOW:
+		r.latest = seqno
+		r.seen = 1
+
+	case seqno > r.latest:
+		r.seen = (r.seen << (seqno - r.latest)) | 1
+		r.latest = seqno
+
+	case r.latest-seqno >= REPLAY_WINDOW:
+		return false
+
+	case r.seen&(1<<(r.latest-seqno)) != 0:
+		return false
+
+	default:
+		r.seen |= 1 << (r.latest - seqno)
+	}
+
+	return true
+}
+
+// keepalives returns the keepalive interval and the idle time after which a peer is assumed
+// to have gone away (zero if the heartbeat is disabled).
+func keepalives(heartbeat conn.Heartbeat) (time.Duration, time.Duration) {
+	if heartbeat.Enabled() {
+		return heartbeat.Interval, time.Duration(heartbeat.Misses) * heartbeat.Interval
+	}
+
+	return KEEPALIVE, 0
+}
@@ -0,0 +1,61 @@
+package udp
+
+import (
+	"testing"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := psk("qwerty-uiop")
+	frame := protocol.Packetize(12345, []byte{0x17, 0x94, 0x00, 0x00})
+	nonce := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	datagram := key.seal("client", nonce, frame)
+
+	tests := []struct {
+		name      string
+		key       psk
+		direction string
+		nonce     []byte
+		ok        bool
+	}{
+		{"valid", key, "client", nonce, true},
+		{"reflected", key, "server", nonce, false},
+		{"other connection", key, "client", []byte{8, 7, 6, 5, 4, 3, 2, 1}, false},
+		{"unbound", key, "client", nil, false},
+		{"other key", psk("asdf-ghjk"), "client", nonce, false},
+	}
+
+	for _, test := range tests {
+		if f, _, ok := test.key.open(test.direction, test.nonce, datagram); ok != test.ok {
+			t.Errorf("%v: incorrect result - expected:%v, got:%v", test.name, test.ok, ok)
+		} else if ok && string(f) != string(frame) {
+			t.Errorf("%v: incorrect frame - expected:%v, got:%v", test.name, frame, f)
+		}
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	r := replay{}
+
+	tests := []struct {
+		seqno uint64
+		ok    bool
+	}{
+		{1000, true},
+		{1000, false},
+		{1002, true},
+		{1001, true},
+		{1001, false},
+		{1100, true},
+		{1002, false},
+		{1099, true},
+		{1036, false},
+	}
+
+	for _, test := range tests {
+		if ok := r.accept(test.seqno); ok != test.ok {
+			t.Errorf("seqno %v: incorrect result - expected:%v, got:%v", test.seqno, test.ok, ok)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package udp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// The udp/multicast connectors relay requests and events to (and from) a multicast group rather
+// than a broadcast address, so that discovery and event traffic can be routed across network
+// segments. Receivers join the group on the connector interface (or the system default multicast
+// interface if no interface is specified) and senders set the multicast TTL, loopback and
+// outgoing interface on each socket.
+
+const MULTICAST_TTL = 1
+
+// group resolves and validates a multicast group address.
+func group(spec string) (*net.UDPAddr, error) {
+	addr, err := net.ResolveUDPAddr("udp", spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if addr == nil {
+		return nil, fmt.Errorf("unable to resolve UDP address '%v'", spec)
+	}
+
+	if !addr.IP.IsMulticast() {
+		return nil, fmt.Errorf("%v is not a multicast group address", addr.IP)
+	}
+
+	if addr.Port == 0 {
+		return nil, fmt.Errorf("UDP multicast requires a non-zero port")
+	}
+
+	return addr, nil
+}
+
+// join adds the socket to the multicast group on the interface.
+func join(socket net.PacketConn, hwif string, group *net.UDPAddr) error {
+	ifi, err := multicastInterface(hwif, group)
+	if err != nil {
+		return err
+	}
+
+	if group.IP.To4() != nil {
+		return ipv4.NewPacketConn(socket).JoinGroup(ifi, group)
+	} else {
+		return ipv6.NewPacketConn(socket).JoinGroup(ifi, group)
+	}
+}
+
+// configure sets the multicast TTL (hop limit for IPv6), loopback and outgoing interface for a
+// socket used to send to a multicast group.
+func configure(socket net.PacketConn, hwif string, group *net.UDPAddr, ttl int, loopback bool) error {
+	ifi, err := multicastInterface(hwif, group)
+	if err != nil {
+		return err
+	}
+
+	if group.IP.To4() != nil {
+		p := ipv4.NewPacketConn(socket)
+
+		if err := p.SetMulticastTTL(ttl); err != nil {
+			return err
+		} else if err := p.SetMulticastLoopback(loopback); err != nil {
+			return err
+		} else if ifi != nil {
+			return p.SetMulticastInterface(ifi)
+		}
+	} else {
+		p := ipv6.NewPacketConn(socket)
+
+		if err := p.SetMulticastHopLimit(ttl); err != nil {
+			return err
+		} else if err := p.SetMulticastLoopback(loopback); err != nil {
+			return err
+		} else if ifi != nil {
+			return p.SetMulticastInterface(ifi)
+		}
+	}
+
+	return nil
+}
+
+// multicastInterface returns the interface for the multicast group, which is the connector interface
+// if specified, or the zone of an IPv6 link-local group address (e.g. ff02::1%eth0).
+func multicastInterface(hwif string, group *net.UDPAddr) (*net.Interface, error) {
+	if hwif == "" && group.Zone == "" {
+		return nil, nil
+	} else if hwif == "" {
+		hwif = group.Zone
+	}
+
+	if index, err := strconv.Atoi(hwif); err == nil {
+		return net.InterfaceByIndex(index)
+	}
+
+	if ifi, err := net.InterfaceByName(hwif); err != nil {
+		return nil, fmt.Errorf("invalid multicast interface %v (%w)", hwif, err)
+	} else if ifi.Flags&net.FlagMulticast == 0 {
+		return nil, fmt.Errorf("interface %v does not support multicast", hwif)
+	} else {
+		return ifi, nil
+	}
+}
@@ -103,9 +103,9 @@ func (udp *udpBroadcast) send(id uint32, message []byte) {
 		},
 	}
 
-	if bind, err := net.ResolveUDPAddr("udp", "0.0.0.0:0"); err != nil {
-		udp.Warnf("%v", err)
-	} else if socket, err := listener.ListenPacket(context.Background(), "udp4", fmt.Sprintf("%v", bind)); err != nil {
+	network, bind := conn.UDPBind(udp.addr)
+
+	if socket, err := listener.ListenPacket(context.Background(), network, fmt.Sprintf("%v", bind)); err != nil {
 		udp.Warnf("%v", err)
 	} else if socket == nil {
 		udp.Warnf("invalid UDP socket (%v)", socket)
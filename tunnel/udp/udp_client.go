@@ -0,0 +1,250 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type udpClient struct {
+	conn.Conn
+	hwif      string
+	addr      *net.UDPAddr
+	psk       psk
+	retry     conn.Backoff
+	keepalive time.Duration
+	idle      time.Duration
+	ch        chan protocol.Message
+	ctx       context.Context
+	closed    chan struct{}
+}
+
+func NewUDPInClient(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*udpClient, error) {
+	client, err := makeUDPClient(hwif, spec, key, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::udp-client-in")
+	}
+
+	return client, err
+}
+
+func NewUDPOutClient(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*udpClient, error) {
+	client, err := makeUDPClient(hwif, spec, key, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::udp-client-out")
+	}
+
+	return client, err
+}
+
+func makeUDPClient(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*udpClient, error) {
+	addr, err := net.ResolveUDPAddr("udp", spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if addr == nil {
+		return nil, fmt.Errorf("unable to resolve UDP address '%v'", spec)
+	}
+
+	if addr.Port == 0 {
+		return nil, fmt.Errorf("UDP client requires a non-zero port")
+	}
+
+	keepalive, idle := keepalives(heartbeat)
+	client := udpClient{
+		Conn: conn.Conn{
+			Tag: "UDP",
+		},
+		hwif:      hwif,
+		addr:      addr,
+		psk:       key,
+		retry:     retry,
+		keepalive: keepalive,
+		idle:      idle,
+		ch:        make(chan protocol.Message, 16),
+		ctx:       ctx,
+		closed:    make(chan struct{}),
+	}
+
+	return &client, nil
+}
+
+func (udp *udpClient) Close() {
+	udp.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-udp.closed:
+		udp.Infof("closed")
+
+	case <-timeout.C:
+		udp.Infof("close timeout")
+	}
+}
+
+func (udp *udpClient) Run(router *router.Switch) error {
+	udp.connect(router)
+	udp.closed <- struct{}{}
+
+	return nil
+}
+
+func (udp *udpClient) Send(id uint32, msg []byte) {
+	select {
+	case udp.ch <- protocol.Message{ID: id, Message: msg}:
+	default:
+	}
+}
+
+func (udp *udpClient) connect(router *router.Switch) {
+	dialer := net.Dialer{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if udp.hwif != "" {
+				return conn.BindToDevice(connection, udp.hwif, conn.IsIPv4(udp.addr.IP), udp.Conn)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	for {
+		udp.Infof("connecting to %v", udp.addr)
+
+		if socket, err := dialer.DialContext(udp.ctx, "udp", fmt.Sprintf("%v", udp.addr)); err != nil {
+			udp.Warnf("%v", err)
+		} else {
+			p := newPeer()
+			eof := make(chan struct{})
+
+			go func() {
+				ticker := time.NewTicker(udp.keepalive)
+				defer ticker.Stop()
+
+				udp.hello(socket, p)
+
+				for {
+					select {
+					case msg := <-udp.ch:
+						udp.Infof("msg %v  relaying to %v", msg.ID, socket.RemoteAddr())
+						udp.send(socket, p, msg.ID, msg.Message)
+
+					case <-ticker.C:
+						udp.hello(socket, p)
+
+					case <-eof:
+						return
+
+					case <-udp.ctx.Done():
+						socket.Close()
+						return
+					}
+				}
+			}()
+
+			if err := udp.listen(socket, p, router); err != nil && udp.ctx.Err() == nil {
+				udp.Warnf("%v", err)
+			}
+
+			close(eof)
+		}
+
+		if !udp.retry.Wait(udp.Tag) {
+			return
+		}
+	}
+}
+
+// listen handles the datagrams received from the server until the socket is closed or nothing
+// has been received for the idle time. The connection is only considered established once the
+// server has answered a keepalive.
+func (udp *udpClient) listen(socket net.Conn, p *peer, router *router.Switch) error {
+	defer socket.Close()
+
+	buffer := make([]byte, MAX_DATAGRAM)
+	connected := false
+
+	for {
+		if udp.idle > 0 {
+			socket.SetReadDeadline(time.Now().Add(udp.idle))
+		}
+
+		N, err := socket.Read(buffer)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("no reply from %v for %v", socket.RemoteAddr(), udp.idle)
+		} else if err != nil {
+			return err
+		}
+
+		frame, seqno, ok := udp.psk.open("server", p.local, buffer[:N])
+		if !ok || (len(udp.psk) > 0 && !p.replay.accept(seqno)) {
+			udp.Warnf("discarding invalid datagram from %v", socket.RemoteAddr())
+			continue
+		}
+
+		// ... confirm the server nonce so that the server knows the keepalive was not replayed
+		if nonce, ok := greeting(frame); ok && len(udp.psk) > 0 {
+			p.connected(nonce)
+			frame = keepalive()
+
+			if err := udp.write(socket, p, keepalive()); err != nil {
+				udp.Warnf("error sending keepalive to %v (%v)", socket.RemoteAddr(), err)
+			}
+		}
+
+		if !connected {
+			udp.Infof("connected  to %v", socket.RemoteAddr())
+			udp.retry.Reset()
+			connected = true
+		}
+
+		udp.received(frame, router, socket, p)
+	}
+}
+
+func (udp *udpClient) received(frame []byte, router *router.Switch, socket net.Conn, p *peer) {
+	udp.Dumpf(frame, "received %v bytes from %v", len(frame), socket.RemoteAddr())
+
+	if id, msg, _ := protocol.Depacketize(frame); len(msg) > 0 {
+		router.Received(id, msg, func(message []byte) {
+			udp.send(socket, p, id, message)
+		})
+	}
+}
+
+func (udp *udpClient) send(socket net.Conn, p *peer, id uint32, msg []byte) {
+	if err := udp.write(socket, p, protocol.Packetize(id, msg)); err != nil {
+		udp.Warnf("msg %v  error sending message to %v (%v)", id, socket.RemoteAddr(), err)
+	} else {
+		udp.Infof("msg %v  sent %v bytes to %v", id, len(msg), socket.RemoteAddr())
+	}
+}
+
+// hello sends a keepalive carrying the client nonce for the connection.
+func (udp *udpClient) hello(socket net.Conn, p *peer) error {
+	_, err := socket.Write(udp.psk.seal("client", nil, udp.psk.hello(p.local)))
+
+	return err
+}
+
+// write sends a frame bound to the server nonce for the connection.
+func (udp *udpClient) write(socket net.Conn, p *peer, frame []byte) error {
+	nonce, ok := p.nonce()
+	if !ok && len(udp.psk) > 0 {
+		return fmt.Errorf("not connected to %v", socket.RemoteAddr())
+	}
+
+	_, err := socket.Write(udp.psk.seal("client", nonce, frame))
+
+	return err
+}
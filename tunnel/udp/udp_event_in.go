@@ -66,9 +66,6 @@ func (udp *udpEventIn) Close() {
 }
 
 func (udp *udpEventIn) Run(router *router.Switch) (err error) {
-	var socket *net.UDPConn
-	var closing = false
-
 	listener := net.ListenConfig{
 		Control: func(network, address string, connection syscall.RawConn) error {
 			if udp.hwif != "" {
@@ -82,7 +79,7 @@ func (udp *udpEventIn) Run(router *router.Switch) (err error) {
 	go func() {
 	loop:
 		for {
-			socket, err := listener.ListenPacket(context.Background(), "udp4", fmt.Sprintf("%v", udp.addr))
+			socket, err := listener.ListenPacket(context.Background(), "udp", fmt.Sprintf("%v", udp.addr))
 			if err != nil {
 				udp.Warnf("%v", err)
 			} else if socket == nil {
@@ -92,7 +89,7 @@ func (udp *udpEventIn) Run(router *router.Switch) (err error) {
 				udp.listen(socket, router)
 			}
 
-			if closing || !udp.retry.Wait(udp.Tag) {
+			if udp.ctx.Err() != nil || !udp.retry.Wait(udp.Tag) {
 				break loop
 			}
 		}
@@ -102,9 +99,6 @@ func (udp *udpEventIn) Run(router *router.Switch) (err error) {
 
 	<-udp.ctx.Done()
 
-	closing = true
-	socket.Close()
-
 	return nil
 }
 
@@ -114,6 +108,11 @@ func (udp *udpEventIn) Send(id uint32, message []byte) {
 func (udp *udpEventIn) listen(socket net.PacketConn, router *router.Switch) {
 	udp.Infof("listening on %v", udp.addr)
 
+	stop := context.AfterFunc(udp.ctx, func() {
+		socket.Close()
+	})
+
+	defer stop()
 	defer socket.Close()
 
 	for {
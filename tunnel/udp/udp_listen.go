@@ -15,13 +15,11 @@ import (
 
 type udpListen struct {
 	conn.Conn
-	hwif    string
-	addr    *net.UDPAddr
-	retry   conn.Backoff
-	ctx     context.Context
-	sockets map[net.PacketConn]struct{}
-	closing bool
-	closed  chan struct{}
+	hwif   string
+	addr   *net.UDPAddr
+	retry  conn.Backoff
+	ctx    context.Context
+	closed chan struct{}
 }
 
 func NewUDPListen(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*udpListen, error) {
@@ -42,12 +40,11 @@ func NewUDPListen(hwif string, spec string, retry conn.Backoff, ctx context.Cont
 		Conn: conn.Conn{
 			Tag: "UDP",
 		},
-		hwif:    hwif,
-		addr:    addr,
-		retry:   retry,
-		ctx:     ctx,
-		sockets: map[net.PacketConn]struct{}{},
-		closed:  make(chan struct{}),
+		hwif:   hwif,
+		addr:   addr,
+		retry:  retry,
+		ctx:    ctx,
+		closed: make(chan struct{}),
 	}
 
 	udp.Infof("connector::udp-listen")
@@ -59,11 +56,6 @@ func (udp *udpListen) Close() {
 	udp.Infof("closing")
 
 	timeout := time.NewTimer(5 * time.Second)
-
-	for k := range udp.sockets {
-		k.Close()
-	}
-
 	select {
 	case <-udp.closed:
 		udp.Infof("closed")
@@ -74,11 +66,6 @@ func (udp *udpListen) Close() {
 }
 
 func (udp *udpListen) Run(router *router.Switch) (err error) {
-	udp.closing = false
-	sockets := conn.NewSocketList()
-
-	defer sockets.CloseAll()
-
 	listener := net.ListenConfig{
 		Control: func(network, address string, connection syscall.RawConn) error {
 			if udp.hwif != "" {
@@ -92,22 +79,17 @@ func (udp *udpListen) Run(router *router.Switch) (err error) {
 	go func() {
 	loop:
 		for {
-			socket, err := listener.ListenPacket(context.Background(), "udp4", fmt.Sprintf("%v", udp.addr))
+			socket, err := listener.ListenPacket(context.Background(), "udp", fmt.Sprintf("%v", udp.addr))
 			if err != nil {
 				udp.Warnf("%v", err)
 			} else if socket == nil {
 				udp.Warnf("Failed to create UDP listen socket (%v)", socket)
 			} else {
-				sockets.Add(socket)
-				udp.sockets[socket] = struct{}{}
 				udp.retry.Reset()
 				udp.listen(socket, router)
-				sockets.Closed(socket)
 			}
 
-			delete(udp.sockets, socket)
-
-			if udp.closing || !udp.retry.Wait(udp.Tag) {
+			if udp.ctx.Err() != nil || !udp.retry.Wait(udp.Tag) {
 				break loop
 			}
 		}
@@ -117,8 +99,6 @@ func (udp *udpListen) Run(router *router.Switch) (err error) {
 
 	<-udp.ctx.Done()
 
-	udp.closing = true
-
 	return nil
 }
 
@@ -128,6 +108,11 @@ func (udp *udpListen) Send(id uint32, message []byte) {
 func (udp *udpListen) listen(socket net.PacketConn, router *router.Switch) {
 	udp.Infof("listening on %v", udp.addr)
 
+	stop := context.AfterFunc(udp.ctx, func() {
+		socket.Close()
+	})
+
+	defer stop()
 	defer socket.Close()
 
 	for {
@@ -150,7 +135,7 @@ func (udp *udpListen) listen(socket net.PacketConn, router *router.Switch) {
 
 			if N, err := socket.WriteTo(reply, remote); err != nil {
 				udp.Warnf("%v", err)
-			} else if udp.closing {
+			} else if udp.ctx.Err() != nil {
 				udp.Infof("shutdown client connection")
 			} else {
 				udp.Debugf("sent %v bytes to %v\n", N, remote)
@@ -0,0 +1,169 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type udpMulticastIn struct {
+	conn.Conn
+	hwif   string
+	group  *net.UDPAddr
+	events bool
+	retry  conn.Backoff
+	ctx    context.Context
+	closed chan struct{}
+}
+
+func NewUDPMulticastIn(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*udpMulticastIn, error) {
+	udp, err := makeUDPMulticastIn(hwif, spec, false, retry, ctx)
+
+	if err == nil {
+		udp.Infof("connector::udp-multicast-in")
+	}
+
+	return udp, err
+}
+
+func NewUDPMulticastEventIn(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*udpMulticastIn, error) {
+	udp, err := makeUDPMulticastIn(hwif, spec, true, retry, ctx)
+
+	if err == nil {
+		udp.Infof("connector::udp-multicast-event-in")
+	}
+
+	return udp, err
+}
+
+func makeUDPMulticastIn(hwif string, spec string, events bool, retry conn.Backoff, ctx context.Context) (*udpMulticastIn, error) {
+	addr, err := group(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := multicastInterface(hwif, addr); err != nil {
+		return nil, err
+	}
+
+	udp := udpMulticastIn{
+		Conn: conn.Conn{
+			Tag: "UDP",
+		},
+		hwif:   hwif,
+		group:  addr,
+		events: events,
+		retry:  retry,
+		ctx:    ctx,
+		closed: make(chan struct{}),
+	}
+
+	return &udp, nil
+}
+
+func (udp *udpMulticastIn) Close() {
+	udp.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-udp.closed:
+		udp.Infof("closed")
+
+	case <-timeout.C:
+		udp.Infof("close timeout")
+	}
+}
+
+func (udp *udpMulticastIn) Run(router *router.Switch) error {
+	listener := net.ListenConfig{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if udp.hwif != "" {
+				return conn.BindToDevice(connection, udp.hwif, conn.IsIPv4(udp.group.IP), udp.Conn)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	go func() {
+	loop:
+		for {
+			// ... binding to a multicast address binds to the wildcard address with SO_REUSEADDR set
+			if socket, err := listener.ListenPacket(context.Background(), "udp", udp.group.String()); err != nil {
+				udp.Warnf("%v", err)
+			} else if err := join(socket, udp.hwif, udp.group); err != nil {
+				udp.Warnf("error joining multicast group %v (%v)", udp.group.IP, err)
+				socket.Close()
+			} else {
+				udp.retry.Reset()
+				udp.listen(socket, router)
+			}
+
+			if udp.ctx.Err() != nil || !udp.retry.Wait(udp.Tag) {
+				break loop
+			}
+		}
+
+		udp.closed <- struct{}{}
+	}()
+
+	<-udp.ctx.Done()
+
+	return nil
+}
+
+func (udp *udpMulticastIn) Send(id uint32, message []byte) {
+}
+
+func (udp *udpMulticastIn) listen(socket net.PacketConn, router *router.Switch) {
+	udp.Infof("listening on multicast group %v", udp.group)
+
+	stop := context.AfterFunc(udp.ctx, func() {
+		socket.Close()
+	})
+
+	defer stop()
+	defer socket.Close()
+
+	for {
+		buffer := make([]byte, 2048) // NTS: buffer is handed off to router
+
+		N, remote, err := socket.ReadFrom(buffer)
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			udp.Warnf("%v", err)
+		}
+
+		if err != nil {
+			return
+		}
+
+		id := protocol.NextID()
+
+		if udp.events {
+			udp.Dumpf(buffer[:N], "event %v  %v bytes from %v", id, N, remote)
+
+			router.Received(id, buffer[:N], nil)
+		} else {
+			udp.Dumpf(buffer[:N], "request %v  %v bytes from %v", id, N, remote)
+
+			// ... replies are returned directly to the sender rather than to the group
+			h := func(reply []byte) {
+				udp.Dumpf(reply, "reply %v  %v bytes for %v", id, len(reply), remote)
+
+				if N, err := socket.WriteTo(reply, remote); err != nil {
+					udp.Warnf("%v", err)
+				} else {
+					udp.Debugf("sent %v bytes to %v\n", N, remote)
+				}
+			}
+
+			router.Received(id, buffer[:N], h)
+		}
+	}
+}
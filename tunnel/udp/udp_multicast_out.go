@@ -0,0 +1,187 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type udpMulticastOut struct {
+	conn.Conn
+	hwif     string
+	group    *net.UDPAddr
+	ttl      int
+	loopback bool
+	events   bool
+	timeout  time.Duration
+	ctx      context.Context
+	ch       chan protocol.Message
+	closed   chan struct{}
+}
+
+func NewUDPMulticastOut(hwif string, spec string, ttl int, loopback bool, timeout time.Duration, ctx context.Context) (*udpMulticastOut, error) {
+	udp, err := makeUDPMulticastOut(hwif, spec, ttl, loopback, false, timeout, ctx)
+
+	if err == nil {
+		udp.Infof("connector::udp-multicast-out")
+	}
+
+	return udp, err
+}
+
+func NewUDPMulticastEventOut(hwif string, spec string, ttl int, loopback bool, ctx context.Context) (*udpMulticastOut, error) {
+	udp, err := makeUDPMulticastOut(hwif, spec, ttl, loopback, true, 0, ctx)
+
+	if err == nil {
+		udp.Infof("connector::udp-multicast-event-out")
+	}
+
+	return udp, err
+}
+
+func makeUDPMulticastOut(hwif string, spec string, ttl int, loopback bool, events bool, timeout time.Duration, ctx context.Context) (*udpMulticastOut, error) {
+	addr, err := group(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl < 1 || ttl > 255 {
+		return nil, fmt.Errorf("invalid multicast TTL (%v) - expected 1-255", ttl)
+	}
+
+	if _, err := multicastInterface(hwif, addr); err != nil {
+		return nil, err
+	}
+
+	udp := udpMulticastOut{
+		Conn: conn.Conn{
+			Tag: "UDP",
+		},
+		hwif:     hwif,
+		group:    addr,
+		ttl:      ttl,
+		loopback: loopback,
+		events:   events,
+		timeout:  timeout,
+		ctx:      ctx,
+		ch:       make(chan protocol.Message),
+		closed:   make(chan struct{}),
+	}
+
+	return &udp, nil
+}
+
+func (udp *udpMulticastOut) Close() {
+	udp.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-udp.closed:
+		udp.Infof("closed")
+
+	case <-timeout.C:
+		udp.Infof("close timeout")
+	}
+}
+
+func (udp *udpMulticastOut) Run(router *router.Switch) error {
+loop:
+	for {
+		select {
+		case msg := <-udp.ch:
+			router.Received(msg.ID, msg.Message, nil)
+
+		case <-udp.ctx.Done():
+			break loop
+		}
+	}
+
+	close(udp.closed)
+
+	return nil
+}
+
+func (udp *udpMulticastOut) Send(id uint32, msg []byte) {
+	go func() {
+		udp.send(id, msg)
+	}()
+}
+
+func (udp *udpMulticastOut) send(id uint32, message []byte) {
+	udp.Dumpf(message, "multicast (%v bytes)", len(message))
+
+	network, bind := conn.UDPBind(udp.group)
+	listener := net.ListenConfig{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if udp.hwif != "" {
+				return conn.BindToDevice(connection, udp.hwif, conn.IsIPv4(udp.group.IP), udp.Conn)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	socket, err := listener.ListenPacket(context.Background(), network, bind.String())
+	if err != nil {
+		udp.Warnf("%v", err)
+		return
+	}
+
+	defer socket.Close()
+
+	if err := configure(socket, udp.hwif, udp.group, udp.ttl, udp.loopback); err != nil {
+		udp.Warnf("%v", err)
+		return
+	}
+
+	if err := socket.SetWriteDeadline(time.Now().Add(1000 * time.Millisecond)); err != nil {
+		udp.Warnf("%v", err)
+	}
+
+	if N, err := socket.WriteTo(message, udp.group); err != nil {
+		udp.Warnf("%v", err)
+		return
+	} else {
+		udp.Debugf("sent %v bytes to %v\n", N, udp.group)
+	}
+
+	if udp.events {
+		return
+	}
+
+	// ... collect the replies from the group members until the UDP timeout expires
+	go func() {
+		for {
+			reply := make([]byte, 2048)
+
+			if N, remote, err := socket.ReadFrom(reply); err != nil && !errors.Is(err, net.ErrClosed) {
+				udp.Warnf("%v", err)
+				return
+			} else if err != nil {
+				return
+			} else {
+				udp.Dumpf(reply[0:N], "received %v bytes from %v", N, remote)
+
+				select {
+				case udp.ch <- protocol.Message{ID: id, Message: reply[:N]}:
+				case <-udp.ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	select {
+	case <-time.After(udp.timeout):
+		// Ok
+
+	case <-udp.ctx.Done():
+	}
+}
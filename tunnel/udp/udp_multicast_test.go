@@ -0,0 +1,161 @@
+package udp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestUDPMulticastRoundTrip(t *testing.T) {
+	if !multicast() {
+		t.Skip("no multicast interface")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("239.255.85.1:%v", loopback.UDPPort(t))
+
+	in, err := NewUDPMulticastIn("", addr, conn.NewBackoff(-1, time.Second, ctx), ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, err := NewUDPMulticastOut("", addr, 1, true, 500*time.Millisecond, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s1 := loopback.Echo(t)
+	s2 := loopback.Sink(t)
+
+	defer func() {
+		cancel()
+		out.Close()
+		in.Close()
+	}()
+
+	go in.Run(s1)
+	go out.Run(s2)
+
+	replies := make(chan []byte, 1)
+	s2.Expect(12345, func(reply []byte) {
+		select {
+		case replies <- reply:
+		default:
+		}
+	})
+
+	// ... resend until the receiver has joined the group
+	ticker := time.NewTicker(250 * time.Millisecond)
+	timeout := time.After(loopback.TIMEOUT)
+
+	defer ticker.Stop()
+
+	out.Send(12345, loopback.REQUEST)
+
+	for {
+		select {
+		case reply := <-replies:
+			if string(reply) != string(loopback.REQUEST) {
+				t.Errorf("incorrect reply - expected:%v, got:%v", loopback.REQUEST, reply)
+			}
+			return
+
+		case <-ticker.C:
+			out.Send(12345, loopback.REQUEST)
+
+		case <-timeout:
+			t.Fatalf("no reply")
+		}
+	}
+}
+
+func TestUDPMulticastEvents(t *testing.T) {
+	if !multicast() {
+		t.Skip("no multicast interface")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("239.255.85.1:%v", loopback.UDPPort(t))
+
+	in, err := NewUDPMulticastEventIn("", addr, conn.NewBackoff(-1, time.Second, ctx), ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, err := NewUDPMulticastEventOut("", addr, 1, true, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s1, events := loopback.Events(t)
+	s2 := loopback.Sink(t)
+
+	defer func() {
+		cancel()
+		out.Close()
+		in.Close()
+	}()
+
+	go in.Run(s1)
+	go out.Run(s2)
+
+	// ... resend until the receiver has joined the group
+	ticker := time.NewTicker(250 * time.Millisecond)
+	timeout := time.After(loopback.TIMEOUT)
+
+	defer ticker.Stop()
+
+	out.Send(1, loopback.EVENT)
+
+	for {
+		select {
+		case event := <-events:
+			if string(event.Message) != string(loopback.EVENT) {
+				t.Errorf("incorrect event - expected:%v, got:%v", loopback.EVENT, event.Message)
+			}
+			return
+
+		case <-ticker.C:
+			out.Send(1, loopback.EVENT)
+
+		case <-timeout:
+			t.Fatalf("no event")
+		}
+	}
+}
+
+// multicast returns true if there is an active multicast capable interface for the default
+// multicast route.
+func multicast() bool {
+	if interfaces, err := net.Interfaces(); err == nil {
+		for _, ifi := range interfaces {
+			if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 && ifi.Flags&net.FlagLoopback == 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func TestUDPMulticastOutInvalidTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("239.255.85.1:%v", loopback.UDPPort(t))
+
+	defer cancel()
+
+	for _, ttl := range []int{-1, 0, 256} {
+		if _, err := NewUDPMulticastOut("", addr, ttl, false, 500*time.Millisecond, ctx); err == nil {
+			t.Errorf("expected error for multicast TTL %v", ttl)
+		}
+
+		if _, err := NewUDPMulticastEventOut("", addr, ttl, false, ctx); err == nil {
+			t.Errorf("expected error for multicast event TTL %v", ttl)
+		}
+	}
+}
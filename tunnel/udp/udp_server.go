@@ -0,0 +1,293 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type udpServer struct {
+	conn.Conn
+	hwif        string
+	addr        *net.UDPAddr
+	psk         psk
+	retry       conn.Backoff
+	idle        time.Duration
+	connections map[net.Conn]*peer
+	ctx         context.Context
+	closed      chan struct{}
+	sync.RWMutex
+}
+
+func NewUDPInServer(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*udpServer, error) {
+	server, err := makeUDPServer(hwif, spec, key, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::udp-server-in")
+	}
+
+	return server, err
+}
+
+func NewUDPOutServer(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*udpServer, error) {
+	server, err := makeUDPServer(hwif, spec, key, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::udp-server-out")
+	}
+
+	return server, err
+}
+
+func makeUDPServer(hwif string, spec string, key []byte, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*udpServer, error) {
+	addr, err := net.ResolveUDPAddr("udp", spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if addr == nil {
+		return nil, fmt.Errorf("unable to resolve UDP address '%v'", spec)
+	}
+
+	if addr.Port == 0 {
+		return nil, fmt.Errorf("UDP server requires a non-zero port")
+	}
+
+	// ... forget clients that have stopped sending keepalives
+	_, idle := keepalives(heartbeat)
+	if idle == 0 {
+		idle = PEER_TIMEOUT
+	}
+
+	server := udpServer{
+		Conn: conn.Conn{
+			Tag: "UDP",
+		},
+		hwif:        hwif,
+		addr:        addr,
+		psk:         key,
+		retry:       retry,
+		idle:        idle,
+		connections: map[net.Conn]*peer{},
+		ctx:         ctx,
+		closed:      make(chan struct{}),
+	}
+
+	return &server, nil
+}
+
+func (udp *udpServer) Close() {
+	udp.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-udp.closed:
+		udp.Infof("closed")
+
+	case <-timeout.C:
+		udp.Infof("close timeout")
+	}
+}
+
+func (udp *udpServer) Run(router *router.Switch) error {
+	listener := net.ListenConfig{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if udp.hwif != "" {
+				return conn.BindToDevice(connection, udp.hwif, conn.IsIPv4(udp.addr.IP), udp.Conn)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	go func() {
+	loop:
+		for {
+			if socket, err := listener.ListenPacket(context.Background(), "udp", fmt.Sprintf("%v", udp.addr)); err != nil {
+				udp.Warnf("%v", err)
+			} else {
+				udp.retry.Reset()
+				udp.listen(conn.NewDatagramListener(socket, udp.valid), router)
+			}
+
+			if udp.ctx.Err() != nil || !udp.retry.Wait(udp.Tag) {
+				break loop
+			}
+		}
+
+		udp.RLock()
+		for k := range udp.connections {
+			k.Close()
+		}
+		udp.RUnlock()
+
+		udp.closed <- struct{}{}
+	}()
+
+	<-udp.ctx.Done()
+
+	return nil
+}
+
+func (udp *udpServer) Send(id uint32, message []byte) {
+	udp.RLock()
+	defer udp.RUnlock()
+
+	for socket, p := range udp.connections {
+		if len(udp.psk) == 0 || p.authenticated() {
+			udp.send(socket, p, id, message)
+		}
+	}
+}
+
+func (udp *udpServer) listen(socket net.Listener, router *router.Switch) {
+	udp.Infof("listening on %v", socket.Addr())
+
+	stop := context.AfterFunc(udp.ctx, func() {
+		socket.Close()
+	})
+
+	defer stop()
+	defer socket.Close()
+
+	for {
+		client, err := socket.Accept()
+		if err != nil {
+			if udp.ctx.Err() == nil {
+				udp.Warnf("%v", err)
+			}
+			return
+		}
+
+		udp.Infof("incoming connection (%v)", client.RemoteAddr())
+
+		go udp.accept(client, router)
+	}
+}
+
+func (udp *udpServer) accept(socket net.Conn, router *router.Switch) {
+	p := newPeer()
+
+	udp.Lock()
+	udp.connections[socket] = p
+	udp.Unlock()
+
+	buffer := make([]byte, MAX_DATAGRAM)
+
+	for {
+		socket.SetReadDeadline(time.Now().Add(udp.idle))
+
+		if N, err := socket.Read(buffer); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				udp.Infof("client connection %v idle for %v - closing", socket.RemoteAddr(), udp.idle)
+			} else if errors.Is(err, io.EOF) {
+				udp.Infof("client connection %v closed ", socket.RemoteAddr())
+			} else if udp.ctx.Err() != nil {
+				udp.Infof("shutdown client connection %v", socket.RemoteAddr())
+			} else {
+				udp.Warnf("%v", err)
+			}
+			break
+		} else if frame, ok := udp.open(p, buffer[:N]); !ok {
+			udp.Warnf("discarding invalid datagram from %v", socket.RemoteAddr())
+		} else {
+			udp.received(frame, router, socket, p)
+		}
+	}
+
+	socket.Close()
+
+	udp.Lock()
+	delete(udp.connections, socket)
+	udp.Unlock()
+}
+
+// open returns the frame from a datagram received on the connection. If a pre-shared key is
+// configured the datagram must either be bound to the connection nonce (and not be a replay),
+// which authenticates the client, or be a keepalive carrying the client nonce that is newer than
+// the last keepalive received.
+func (udp *udpServer) open(p *peer, datagram []byte) ([]byte, bool) {
+	if len(udp.psk) == 0 {
+		frame, _, ok := udp.psk.open("client", nil, datagram)
+
+		return frame, ok
+	}
+
+	if frame, seqno, ok := udp.psk.open("client", p.local, datagram); ok && p.replay.accept(seqno) {
+		p.verify()
+
+		return frame, true
+	} else if ok {
+		return nil, false
+	}
+
+	if frame, seqno, ok := udp.psk.open("client", nil, datagram); ok && seqno > p.hello {
+		if nonce, ok := greeting(frame); ok {
+			p.hello = seqno
+			p.connected(nonce)
+
+			return frame, true
+		}
+	}
+
+	return nil, false
+}
+
+func (udp *udpServer) received(frame []byte, router *router.Switch, socket net.Conn, p *peer) {
+	udp.Dumpf(frame, "received %v bytes from %v", len(frame), socket.RemoteAddr())
+
+	if _, ok := greeting(frame); ok && len(udp.psk) > 0 {
+		if err := udp.write(socket, p, udp.psk.hello(p.local)); err != nil {
+			udp.Warnf("error sending keepalive to %v (%v)", socket.RemoteAddr(), err)
+		}
+	} else if id, msg, _ := protocol.Depacketize(frame); len(msg) == 0 {
+		if err := udp.write(socket, p, keepalive()); err != nil {
+			udp.Warnf("error sending keepalive to %v (%v)", socket.RemoteAddr(), err)
+		}
+	} else {
+		router.Received(id, msg, func(message []byte) {
+			udp.send(socket, p, id, message)
+		})
+	}
+}
+
+func (udp *udpServer) send(socket net.Conn, p *peer, id uint32, message []byte) {
+	if err := udp.write(socket, p, protocol.Packetize(id, message)); err != nil {
+		udp.Warnf("msg %v  error sending message to %v (%v)", id, socket.RemoteAddr(), err)
+	} else {
+		udp.Infof("msg %v sent %v bytes to %v", id, len(message), socket.RemoteAddr())
+	}
+}
+
+// write sends a frame bound to the client nonce for the connection.
+func (udp *udpServer) write(socket net.Conn, p *peer, frame []byte) error {
+	nonce, ok := p.nonce()
+	if !ok && len(udp.psk) > 0 {
+		return fmt.Errorf("no keepalive received from %v", socket.RemoteAddr())
+	}
+
+	_, err := socket.Write(udp.psk.seal("server", nonce, frame))
+
+	return err
+}
+
+// valid returns true if the first datagram from an unknown address is a (correctly signed)
+// keepalive, so that stray datagrams and unauthenticated clients are ignored.
+func (udp *udpServer) valid(datagram []byte) bool {
+	frame, _, ok := udp.psk.open("client", nil, datagram)
+	if ok && len(udp.psk) > 0 {
+		_, ok = greeting(frame)
+	}
+
+	return ok
+}
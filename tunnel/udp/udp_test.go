@@ -0,0 +1,368 @@
+package udp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestUDPRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"plain", nil},
+		{"psk", []byte("qwerty-uiop")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			addr := fmt.Sprintf("127.0.0.1:%v", loopback.UDPPort(t))
+
+			server, err := NewUDPOutServer("", addr, test.key, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			client, err := NewUDPInClient("", addr, test.key, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			s1 := loopback.Echo(t)
+			s2 := loopback.Sink(t)
+
+			defer func() {
+				cancel()
+				client.Close()
+				server.Close()
+			}()
+
+			go server.Run(s2)
+
+			loopback.Bound(t, "udp", addr)
+
+			go client.Run(s1)
+
+			loopback.Until(t, func() bool {
+				return established(server)
+			})
+
+			loopback.RoundTrip(t, s2, server.Send)
+		})
+	}
+}
+
+func TestUDPKeepalive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("127.0.0.1:%v", loopback.UDPPort(t))
+
+	server, err := NewUDPOutServer("", addr, nil, conn.NewBackoff(-1, time.Second, ctx), loopback.HEARTBEAT, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	client, err := NewUDPInClient("", addr, nil, conn.NewBackoff(-1, time.Second, ctx), loopback.HEARTBEAT, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s1 := loopback.Echo(t)
+	s2 := loopback.Sink(t)
+
+	defer func() {
+		cancel()
+		client.Close()
+		server.Close()
+	}()
+
+	go server.Run(s2)
+
+	loopback.Bound(t, "udp", addr)
+
+	go client.Run(s1)
+
+	var peer net.Conn
+
+	loopback.Until(t, func() bool {
+		server.RLock()
+		defer server.RUnlock()
+
+		for c := range server.connections {
+			peer = c
+		}
+
+		return peer != nil
+	})
+
+	// ... the keepalives hold the peer open for longer than the idle timeout
+	loopback.Steady(t, 10*loopback.HEARTBEAT.Interval, func() bool {
+		server.RLock()
+		defer server.RUnlock()
+
+		_, ok := server.connections[peer]
+
+		return ok
+	})
+
+	loopback.RoundTrip(t, s2, server.Send)
+}
+
+func TestUDPReplayedDatagrams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("127.0.0.1:%v", loopback.UDPPort(t))
+	key := psk("qwerty-uiop")
+
+	server, err := NewUDPInServer("", addr, key, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer func() {
+		cancel()
+		server.Close()
+	}()
+
+	go server.Run(loopback.Echo(t))
+
+	loopback.Bound(t, "udp", addr)
+
+	c1, p1 := handshake(t, addr, key)
+	nonce, _ := p1.nonce()
+	request := key.seal("client", nonce, protocol.Packetize(12345, loopback.REQUEST))
+
+	if _, err := c1.Write(request); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	reply := receive(t, c1, key, p1, loopback.TIMEOUT)
+	if reply == nil {
+		t.Fatalf("no reply")
+	}
+
+	// ... a replayed request is discarded
+	c1.Write(request)
+
+	if reply := receive(t, c1, key, p1, 250*time.Millisecond); reply != nil {
+		t.Errorf("replayed request answered on the same connection")
+	}
+
+	// ... as is a request replayed on a later connection
+	c2, p2 := handshake(t, addr, key)
+
+	c2.Write(request)
+
+	if reply := receive(t, c2, key, p2, 250*time.Millisecond); reply != nil {
+		t.Errorf("replayed request answered on another connection")
+	}
+
+	// ... and a reply reflected back to the server
+	c1.Write(reply)
+
+	if reply := receive(t, c1, key, p1, 250*time.Millisecond); reply != nil {
+		t.Errorf("reflected reply answered")
+	}
+}
+
+func TestUDPReplayedKeepaliveFromAnotherAddress(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("127.0.0.1:%v", loopback.UDPPort(t))
+	key := psk("qwerty-uiop")
+
+	server, err := NewUDPOutServer("", addr, key, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer func() {
+		cancel()
+		server.Close()
+	}()
+
+	go server.Run(loopback.Sink(t))
+
+	loopback.Bound(t, "udp", addr)
+
+	// ... genuine client that confirms the server nonce
+	c1, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer c1.Close()
+
+	p1 := newPeer()
+	hello := key.seal("client", nil, key.hello(p1.local))
+
+	if _, err := c1.Write(hello); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if receive(t, c1, key, p1, loopback.TIMEOUT) == nil {
+		t.Fatalf("no keepalive from %v", addr)
+	}
+
+	nonce, _ := p1.nonce()
+
+	if _, err := c1.Write(key.seal("client", nonce, keepalive())); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if receive(t, c1, key, p1, loopback.TIMEOUT) == nil {
+		t.Fatalf("no keepalive from %v", addr)
+	}
+
+	// ... and an attacker replaying a captured keepalive from another address
+	c2, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer c2.Close()
+
+	replayed := newPeer()
+	replayed.local = p1.local
+
+	if _, err := c2.Write(hello); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if receive(t, c2, key, replayed, loopback.TIMEOUT) == nil {
+		t.Fatalf("no keepalive from %v", addr)
+	}
+
+	server.Send(12345, loopback.REQUEST)
+
+	if request := receive(t, c1, key, p1, loopback.TIMEOUT); request == nil {
+		t.Errorf("request not sent to authenticated client")
+	}
+
+	if request := receive(t, c2, key, replayed, 250*time.Millisecond); request != nil {
+		t.Errorf("request sent to client with replayed keepalive")
+	}
+}
+
+func TestUDPListenIPv6(t *testing.T) {
+	socket, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback not available")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := fmt.Sprintf("[::1]:%v", port6(t))
+
+	listen, err := NewUDPListen("", addr, conn.NewBackoff(-1, time.Second, ctx), ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s := loopback.Echo(t)
+
+	defer func() {
+		cancel()
+		socket.Close()
+		listen.Close()
+	}()
+
+	go listen.Run(s)
+
+	loopback.Bound(t, "udp6", addr)
+
+	remote, _ := net.ResolveUDPAddr("udp6", addr)
+	if _, err := socket.WriteTo(loopback.REQUEST, remote); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	reply := make([]byte, 2048)
+	socket.SetReadDeadline(time.Now().Add(loopback.TIMEOUT))
+
+	if N, _, err := socket.ReadFrom(reply); err != nil {
+		t.Errorf("no reply (%v)", err)
+	} else if string(reply[:N]) != string(loopback.REQUEST) {
+		t.Errorf("incorrect reply - expected:%v, got:%v", loopback.REQUEST, reply[:N])
+	}
+}
+
+// port6 returns an unused IPv6 loopback UDP port.
+func port6(t *testing.T) int {
+	socket, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer socket.Close()
+
+	return socket.LocalAddr().(*net.UDPAddr).Port
+}
+
+// established returns true once the server has a client connection that can be sent to.
+func established(server *udpServer) bool {
+	server.RLock()
+	defer server.RUnlock()
+
+	for _, p := range server.connections {
+		if p.authenticated() || len(server.psk) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handshake connects to the server and exchanges nonces with a keepalive.
+func handshake(t *testing.T, addr string, key psk) (net.Conn, *peer) {
+	t.Helper()
+
+	socket, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	t.Cleanup(func() { socket.Close() })
+
+	p := newPeer()
+
+	if _, err := socket.Write(key.seal("client", nil, key.hello(p.local))); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if receive(t, socket, key, p, loopback.TIMEOUT) == nil {
+		t.Fatalf("no keepalive from %v", addr)
+	} else if _, ok := p.nonce(); !ok {
+		t.Fatalf("no server nonce in keepalive from %v", addr)
+	}
+
+	return socket, p
+}
+
+// receive returns the next valid datagram from the server (if any), recording the server nonce
+// from a keepalive.
+func receive(t *testing.T, socket net.Conn, key psk, p *peer, timeout time.Duration) []byte {
+	t.Helper()
+
+	buffer := make([]byte, MAX_DATAGRAM)
+	socket.SetReadDeadline(time.Now().Add(timeout))
+
+	for {
+		N, err := socket.Read(buffer)
+		if err != nil {
+			return nil
+		}
+
+		if frame, seqno, ok := key.open("server", p.local, buffer[:N]); ok && p.replay.accept(seqno) {
+			if nonce, ok := greeting(frame); ok {
+				p.connected(nonce)
+			}
+
+			return bytes.Clone(buffer[:N])
+		}
+	}
+}
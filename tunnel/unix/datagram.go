@@ -0,0 +1,77 @@
+package unix
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// datagramListener removes the server socket file when the 'unixgram' listener is closed.
+type datagramListener struct {
+	*conn.DatagramListener
+	path string
+	once sync.Once
+}
+
+// datagram is the client end of a 'unixgram' connection, bound to a temporary socket file
+// that is removed when the connection is closed.
+type datagram struct {
+	*net.UnixConn
+	path string
+}
+
+func newDatagramListener(socket *net.UnixConn) *datagramListener {
+	return &datagramListener{
+		DatagramListener: conn.NewDatagramListener(socket, nil),
+		path:             socket.LocalAddr().String(),
+	}
+}
+
+func (l *datagramListener) Close() error {
+	err := l.DatagramListener.Close()
+
+	l.once.Do(func() {
+		os.Remove(l.path)
+	})
+
+	return err
+}
+
+func dialDatagram(addr *net.UnixAddr) (net.Conn, error) {
+	local := net.UnixAddr{
+		Net:  "unixgram",
+		Name: filepath.Join(os.TempDir(), fmt.Sprintf("uhppoted-tunnel-%08x.sock", rand.Uint32())),
+	}
+
+	socket, err := net.DialUnix("unixgram", &local, addr)
+	if err != nil {
+		os.Remove(local.Name)
+		return nil, err
+	}
+
+	return datagram{socket, local.Name}, nil
+}
+
+// Write closes the connection if the datagram cannot be sent, which unblocks the connector read
+// loop so that it can reconnect (a datagram socket does not otherwise detect that the server has
+// gone away).
+func (d datagram) Write(b []byte) (int, error) {
+	N, err := d.UnixConn.Write(b)
+	if err != nil {
+		d.Close()
+	}
+
+	return N, err
+}
+
+func (d datagram) Close() error {
+	err := d.UnixConn.Close()
+	os.Remove(d.path)
+
+	return err
+}
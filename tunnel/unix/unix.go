@@ -0,0 +1,152 @@
+package unix
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// The Unix domain socket connectors carry the tunnel protocol frames over a local socket
+// for applications running on the same host. The 'unix' connectors use a stream socket and
+// the 'unixgram' connectors use a datagram socket in which every frame is sent as a single
+// datagram, so both use the same session framing, heartbeats and acknowledgements as the TCP
+// connectors.
+
+// Permissions sets the file mode and ownership of a server socket file. A zero Mode or a
+// negative UID/GID leaves the corresponding attribute unchanged.
+type Permissions struct {
+	Mode os.FileMode
+	UID  int
+	GID  int
+}
+
+func (p Permissions) apply(path string) error {
+	if p.Mode != 0 {
+		if err := os.Chmod(path, p.Mode); err != nil {
+			return err
+		}
+	}
+
+	if p.UID >= 0 || p.GID >= 0 {
+		if err := os.Chown(path, p.UID, p.GID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resolve(network string, spec string) (*net.UnixAddr, error) {
+	if spec == "" {
+		return nil, fmt.Errorf("missing Unix socket path")
+	}
+
+	return net.ResolveUnixAddr(network, spec)
+}
+
+func tag(network string) string {
+	if network == "unixgram" {
+		return "UNIXGRAM"
+	}
+
+	return "UNIX"
+}
+
+// listen creates the server socket, replacing a stale socket file left behind by a previous
+// instance, and sets the socket file permissions. A 'unixgram' socket is wrapped in a listener
+// that accepts a connection for each client address and a 'unix' socket is wrapped in a listener
+// that names the accepted connections.
+func listen(network string, addr *net.UnixAddr, permissions Permissions) (net.Listener, error) {
+	if info, err := os.Stat(addr.Name); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(addr.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	var socket net.Listener
+	if network == "unixgram" {
+		if s, err := net.ListenUnixgram(network, addr); err != nil {
+			return nil, err
+		} else {
+			socket = newDatagramListener(s)
+		}
+	} else if s, err := net.ListenUnix(network, addr); err != nil {
+		return nil, err
+	} else {
+		socket = listener{s, addr}
+	}
+
+	if err := permissions.apply(addr.Name); err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	return socket, nil
+}
+
+// dial connects to the server socket. A 'unixgram' client is bound to a temporary socket file
+// (removed when the connection is closed) so that the server can reply.
+func dial(network string, addr *net.UnixAddr, timeout time.Duration) (net.Conn, error) {
+	if network == "unixgram" {
+		return dialDatagram(addr)
+	}
+
+	dialer := net.Dialer{
+		Timeout: timeout,
+	}
+
+	return dialer.Dial(network, addr.Name)
+}
+
+// address is the remote address for an accepted stream connection. A Unix stream client is
+// typically not bound to a path (reported as "" or "@") so accepted connections are identified
+// by a sequence number.
+type address string
+
+func (a address) Network() string {
+	return "unix"
+}
+
+func (a address) String() string {
+	return string(a)
+}
+
+type accepted struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (a accepted) RemoteAddr() net.Addr {
+	return a.addr
+}
+
+var clients atomic.Uint32
+
+// listener is a Unix stream listener that returns accepted connections with a printable remote
+// address.
+type listener struct {
+	net.Listener
+	addr *net.UnixAddr
+}
+
+func (l listener) Accept() (net.Conn, error) {
+	if socket, err := l.Listener.Accept(); err != nil {
+		return nil, err
+	} else {
+		return named(socket, l.addr), nil
+	}
+}
+
+// named returns an accepted connection with a printable remote address.
+func named(socket net.Conn, addr *net.UnixAddr) net.Conn {
+	if remote := socket.RemoteAddr(); remote != nil && remote.String() != "" && remote.String() != "@" {
+		return socket
+	}
+
+	return accepted{
+		Conn: socket,
+		addr: address(fmt.Sprintf("%v#%v", addr.Name, clients.Add(1))),
+	}
+}
@@ -0,0 +1,198 @@
+package unix
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type unixClient struct {
+	conn.Conn
+	network   string
+	addr      *net.UnixAddr
+	retry     conn.Backoff
+	heartbeat conn.Heartbeat
+	timeout   time.Duration
+	ch        chan protocol.Message
+	ctx       context.Context
+	closed    chan struct{}
+}
+
+func NewUnixInClient(spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixClient, error) {
+	client, err := makeUnixClient("unix", spec, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::unix-client-in")
+	}
+
+	return client, err
+}
+
+func NewUnixOutClient(spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixClient, error) {
+	client, err := makeUnixClient("unix", spec, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::unix-client-out")
+	}
+
+	return client, err
+}
+
+func NewUnixgramInClient(spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixClient, error) {
+	client, err := makeUnixClient("unixgram", spec, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::unixgram-client-in")
+	}
+
+	return client, err
+}
+
+func NewUnixgramOutClient(spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixClient, error) {
+	client, err := makeUnixClient("unixgram", spec, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::unixgram-client-out")
+	}
+
+	return client, err
+}
+
+func makeUnixClient(network string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixClient, error) {
+	addr, err := resolve(network, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	client := unixClient{
+		Conn: conn.Conn{
+			Tag: tag(network),
+		},
+		network:   network,
+		addr:      addr,
+		retry:     retry,
+		heartbeat: heartbeat,
+		timeout:   5 * time.Second,
+		ch:        make(chan protocol.Message, 16),
+		ctx:       ctx,
+		closed:    make(chan struct{}),
+	}
+
+	return &client, nil
+}
+
+func (unix *unixClient) Close() {
+	unix.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-unix.closed:
+		unix.Infof("closed")
+
+	case <-timeout.C:
+		unix.Infof("close timeout")
+	}
+}
+
+func (unix *unixClient) Run(router *router.Switch) error {
+	unix.connect(router)
+	unix.closed <- struct{}{}
+
+	return nil
+}
+
+func (unix *unixClient) Send(id uint32, msg []byte) {
+	select {
+	case unix.ch <- protocol.Message{ID: id, Message: msg}:
+	default:
+	}
+}
+
+func (unix *unixClient) connect(router *router.Switch) {
+	for {
+		unix.Infof("connecting to %v", unix.addr)
+
+		if socket, err := dial(unix.network, unix.addr, unix.timeout); err != nil {
+			unix.Warnf("%v", err)
+		} else {
+			unix.retry.Reset()
+			session := conn.NewSession(unix.Conn, socket, unix.heartbeat)
+			eof := make(chan struct{})
+
+			go func() {
+				for {
+					select {
+					case msg := <-unix.ch:
+						unix.Infof("msg %v  relaying to %v", msg.ID, socket.RemoteAddr())
+						unix.send(session, msg.ID, msg.Message)
+
+					case <-eof:
+						return
+
+					case <-unix.ctx.Done():
+						socket.Close()
+						return
+					}
+				}
+			}()
+
+			if err := unix.listen(socket, session, router); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && unix.ctx.Err() == nil {
+				unix.Warnf("%v", err)
+			}
+
+			close(eof)
+		}
+
+		if !unix.retry.Wait(unix.Tag) {
+			return
+		}
+	}
+}
+
+func (unix *unixClient) listen(socket net.Conn, session *conn.Session, router *router.Switch) error {
+	unix.Infof("connected  to %v", socket.RemoteAddr())
+
+	defer socket.Close()
+	defer session.Close()
+
+	if err := session.Start(); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 2048)
+
+	for {
+		N, err := socket.Read(buffer)
+		if err != nil {
+			return err
+		}
+
+		unix.received(buffer[:N], session, router, socket)
+	}
+}
+
+func (unix *unixClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	unix.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
+
+		router.Received(id, msg.Message, func(message []byte) {
+			unix.send(session, id, message)
+		})
+	}
+}
+
+func (unix *unixClient) send(session *conn.Session, id uint32, msg []byte) {
+	if err := session.Send(id, msg); err != nil {
+		unix.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
+	} else {
+		unix.Infof("msg %v  sent %v bytes to %v", id, len(msg), session.RemoteAddr())
+	}
+}
@@ -0,0 +1,20 @@
+package unix
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type unixEventClient struct {
+	conn.EventClient
+	network string
+	addr    *net.UnixAddr
+	timeout time.Duration
+}
+
+func (unix *unixEventClient) dial(ctx context.Context) (net.Conn, error) {
+	return dial(unix.network, unix.addr, unix.timeout)
+}
@@ -0,0 +1,74 @@
+package unix
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type unixEventInClient struct {
+	unixEventClient
+	dedup *conn.Dedup
+}
+
+func NewUnixEventInClient(spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixEventInClient, error) {
+	client, err := makeUnixEventInClient("unix", spec, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::unix-event-in-client")
+	}
+
+	return client, err
+}
+
+func NewUnixgramEventInClient(spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixEventInClient, error) {
+	client, err := makeUnixEventInClient("unixgram", spec, retry, heartbeat, ctx)
+
+	if err == nil {
+		client.Infof("connector::unixgram-event-in-client")
+	}
+
+	return client, err
+}
+
+func makeUnixEventInClient(network string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixEventInClient, error) {
+	addr, err := resolve(network, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	unix := unixEventInClient{
+		unixEventClient{
+			EventClient: conn.NewEventClient(tag(network), addr.String(), retry, heartbeat, nil, 2048, ctx),
+			network:     network,
+			addr:        addr,
+			timeout:     5 * time.Second,
+		},
+		conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	unix.Dial = unix.dial
+	unix.Received = unix.received
+	unix.Relay = unix.send
+
+	return &unix, nil
+}
+
+func (unix *unixEventInClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	unix.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		if unix.dedup.Duplicate(msg.ID, msg.Message) {
+			unix.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
+	}
+}
+
+func (unix *unixEventInClient) send(session *conn.Session, id uint32, msg []byte) error {
+	return nil
+}
@@ -0,0 +1,71 @@
+package unix
+
+import (
+	"context"
+	"net"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type unixEventIn struct {
+	unixServer
+	dedup *conn.Dedup
+}
+
+func NewUnixEventInServer(spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixEventIn, error) {
+	server, err := makeUnixEventInServer("unix", spec, permissions, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::unix-event-in-server")
+	}
+
+	return server, err
+}
+
+func NewUnixgramEventInServer(spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixEventIn, error) {
+	server, err := makeUnixEventInServer("unixgram", spec, permissions, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::unixgram-event-in-server")
+	}
+
+	return server, err
+}
+
+func makeUnixEventInServer(network string, spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixEventIn, error) {
+	addr, err := resolve(network, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	unix := unixEventIn{
+		unixServer: unixServer{
+			Server:      conn.NewServer(tag(network), retry, heartbeat, 2048, ctx),
+			network:     network,
+			addr:        addr,
+			permissions: permissions,
+		},
+		dedup: conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	unix.Listen = unix.listen
+	unix.Received = unix.received
+
+	return &unix, nil
+}
+
+func (unix *unixEventIn) Send(id uint32, message []byte) {
+}
+
+func (unix *unixEventIn) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	unix.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		if unix.dedup.Duplicate(msg.ID, msg.Message) {
+			unix.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package unix
+
+import (
+	"context"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type unixEventOutClient struct {
+	unixEventClient
+}
+
+func NewUnixEventOutClient(spec string, retry conn.Backoff, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (*unixEventOutClient, error) {
+	client, err := makeUnixEventOutClient("unix", spec, retry, heartbeat, queue, ctx)
+
+	if err == nil {
+		client.Infof("connector::unix-event-out-client")
+	}
+
+	return client, err
+}
+
+func NewUnixgramEventOutClient(spec string, retry conn.Backoff, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (*unixEventOutClient, error) {
+	client, err := makeUnixEventOutClient("unixgram", spec, retry, heartbeat, queue, ctx)
+
+	if err == nil {
+		client.Infof("connector::unixgram-event-out-client")
+	}
+
+	return client, err
+}
+
+func makeUnixEventOutClient(network string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (*unixEventOutClient, error) {
+	addr, err := resolve(network, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	unix := unixEventOutClient{
+		unixEventClient{
+			EventClient: conn.NewEventClient(tag(network), addr.String(), retry, heartbeat, queue, 2048, ctx),
+			network:     network,
+			addr:        addr,
+			timeout:     5 * time.Second,
+		},
+	}
+
+	unix.Dial = unix.dial
+	unix.Received = conn.Discard
+	unix.Relay = unix.Deliver
+
+	return &unix, nil
+}
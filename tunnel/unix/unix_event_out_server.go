@@ -0,0 +1,56 @@
+package unix
+
+import (
+	"context"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type unixEventOutServer struct {
+	unixServer
+}
+
+func NewUnixEventOutServer(spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixEventOutServer, error) {
+	server, err := makeUnixEventOutServer("unix", spec, permissions, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::unix-event-out-server")
+	}
+
+	return server, err
+}
+
+func NewUnixgramEventOutServer(spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixEventOutServer, error) {
+	server, err := makeUnixEventOutServer("unixgram", spec, permissions, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::unixgram-event-out-server")
+	}
+
+	return server, err
+}
+
+func makeUnixEventOutServer(network string, spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixEventOutServer, error) {
+	addr, err := resolve(network, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	unix := unixEventOutServer{
+		unixServer{
+			Server:      conn.NewServer(tag(network), retry, heartbeat, 2048, ctx),
+			network:     network,
+			addr:        addr,
+			permissions: permissions,
+		},
+	}
+
+	unix.Listen = unix.listen
+	unix.Received = conn.Discard
+
+	return &unix, nil
+}
+
+func (unix *unixEventOutServer) Send(id uint32, message []byte) {
+	unix.Post(id, message)
+}
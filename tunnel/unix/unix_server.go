@@ -0,0 +1,78 @@
+package unix
+
+import (
+	"context"
+	"net"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type unixServer struct {
+	conn.Server
+	network     string
+	addr        *net.UnixAddr
+	permissions Permissions
+}
+
+func NewUnixInServer(spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixServer, error) {
+	server, err := makeUnixServer("unix", spec, permissions, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::unix-server-in")
+	}
+
+	return server, err
+}
+
+func NewUnixOutServer(spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixServer, error) {
+	server, err := makeUnixServer("unix", spec, permissions, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::unix-server-out")
+	}
+
+	return server, err
+}
+
+func NewUnixgramInServer(spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixServer, error) {
+	server, err := makeUnixServer("unixgram", spec, permissions, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::unixgram-server-in")
+	}
+
+	return server, err
+}
+
+func NewUnixgramOutServer(spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixServer, error) {
+	server, err := makeUnixServer("unixgram", spec, permissions, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::unixgram-server-out")
+	}
+
+	return server, err
+}
+
+func makeUnixServer(network string, spec string, permissions Permissions, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*unixServer, error) {
+	addr, err := resolve(network, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	server := unixServer{
+		Server:      conn.NewServer(tag(network), retry, heartbeat, 2048, ctx),
+		network:     network,
+		addr:        addr,
+		permissions: permissions,
+	}
+
+	server.Listen = server.listen
+	server.Received = server.Dispatch
+
+	return &server, nil
+}
+
+func (unix *unixServer) listen() (net.Listener, error) {
+	return listen(unix.network, unix.addr, unix.permissions)
+}
@@ -0,0 +1,156 @@
+package unix
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+// UNCHANGED leaves the socket file mode and ownership as created.
+var UNCHANGED = Permissions{UID: -1, GID: -1}
+
+func TestUnixScenarios(t *testing.T) {
+	tests := []struct {
+		network  string
+		server   func(string, Permissions, conn.Backoff, conn.Heartbeat, context.Context) (*unixServer, error)
+		client   func(string, conn.Backoff, conn.Heartbeat, context.Context) (*unixClient, error)
+		eventsIn func(string, Permissions, conn.Backoff, conn.Heartbeat, context.Context) (*unixEventIn, error)
+		eventOut func(string, conn.Backoff, conn.Heartbeat, *conn.Queue, context.Context) (*unixEventOutClient, error)
+	}{
+		{"unix", NewUnixOutServer, NewUnixInClient, NewUnixEventInServer, NewUnixEventOutClient},
+		{"unixgram", NewUnixgramOutServer, NewUnixgramInClient, NewUnixgramEventInServer, NewUnixgramEventOutClient},
+	}
+
+	for _, test := range tests {
+		t.Run(test.network, func(t *testing.T) {
+			loopback.Scenarios(t, loopback.Transport{
+				Network: test.network,
+
+				Requests: func(t *testing.T, server string, client string, ctx context.Context) (loopback.Connector, loopback.Connector) {
+					retry := conn.NewBackoff(-1, time.Second, ctx)
+
+					return loopback.Must(t)(test.server(server, UNCHANGED, retry, conn.Heartbeat{}, ctx)),
+						loopback.Must(t)(test.client(client, retry, conn.Heartbeat{}, ctx))
+				},
+
+				Events: func(t *testing.T, server string, client string, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (loopback.Connector, loopback.Connector) {
+					retry := conn.NewBackoff(-1, time.Second, ctx)
+
+					return loopback.Must(t)(test.eventsIn(server, UNCHANGED, retry, heartbeat, ctx)),
+						loopback.Must(t)(test.eventOut(client, retry, heartbeat, queue, ctx))
+				},
+			})
+		})
+	}
+}
+
+func TestUnixPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions Permissions
+		mode        os.FileMode
+		uid         int
+		gid         int
+		root        bool
+	}{
+		{"mode", Permissions{Mode: 0600, UID: -1, GID: -1}, 0600, os.Getuid(), os.Getgid(), false},
+		{"owner", Permissions{Mode: 0660, UID: 1234, GID: 5678}, 0660, 1234, 5678, true},
+	}
+
+	for _, network := range []string{"unix", "unixgram"} {
+		for _, test := range tests {
+			t.Run(network+" "+test.name, func(t *testing.T) {
+				if test.root && os.Geteuid() != 0 {
+					t.Skipf("changing the socket file owner requires root")
+				}
+
+				addr := net.UnixAddr{Net: network, Name: filepath.Join(t.TempDir(), "tunnel.sock")}
+
+				socket, err := listen(network, &addr, test.permissions)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+
+				defer socket.Close()
+
+				info, err := os.Stat(addr.Name)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+
+				stat := info.Sys().(*syscall.Stat_t)
+
+				if info.Mode().Perm() != test.mode {
+					t.Errorf("incorrect socket file mode - expected:%v, got:%v", test.mode, info.Mode().Perm())
+				}
+
+				if int(stat.Uid) != test.uid || int(stat.Gid) != test.gid {
+					t.Errorf("incorrect socket file owner - expected:%v:%v, got:%v:%v", test.uid, test.gid, stat.Uid, stat.Gid)
+				}
+			})
+		}
+	}
+}
+
+func TestUnixStaleSocket(t *testing.T) {
+	for _, network := range []string{"unix", "unixgram"} {
+		t.Run(network, func(t *testing.T) {
+			addr := net.UnixAddr{Net: network, Name: filepath.Join(t.TempDir(), "tunnel.sock")}
+
+			// ... leave behind the socket file of a previous instance
+			if network == "unixgram" {
+				stale, err := net.ListenUnixgram(network, &addr)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+
+				stale.Close()
+			} else {
+				stale, err := net.ListenUnix(network, &addr)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+
+				stale.SetUnlinkOnClose(false)
+				stale.Close()
+			}
+
+			if _, err := os.Stat(addr.Name); err != nil {
+				t.Fatalf("missing stale socket file (%v)", err)
+			}
+
+			socket, err := listen(network, &addr, UNCHANGED)
+			if err != nil {
+				t.Fatalf("stale socket file not replaced (%v)", err)
+			}
+
+			socket.Close()
+		})
+	}
+}
+
+func TestUnixKeepsNonSocketFile(t *testing.T) {
+	addr := net.UnixAddr{Net: "unix", Name: filepath.Join(t.TempDir(), "tunnel.sock")}
+
+	if err := os.WriteFile(addr.Name, []byte("qwerty"), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if socket, err := listen("unix", &addr, UNCHANGED); err == nil {
+		socket.Close()
+		t.Fatalf("replaced a file that is not a socket")
+	}
+
+	if b, err := os.ReadFile(addr.Name); err != nil {
+		t.Fatalf("%v", err)
+	} else if string(b) != "qwerty" {
+		t.Errorf("incorrect file contents - expected:%v, got:%v", "qwerty", string(b))
+	}
+}
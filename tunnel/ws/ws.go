@@ -0,0 +1,287 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// The WebSocket connectors carry the tunnel protocol frames as binary WebSocket messages. The
+// websocket.Conn is wrapped as a net.Conn in which every Write is sent as a single binary message,
+// so the connectors use the same session framing, heartbeats and acknowledgements as the TCP and
+// TLS connectors.
+
+// READ_HEADER_TIMEOUT and IDLE_TIMEOUT stop a client holding a connection open without completing
+// the WebSocket upgrade. They do not apply to the upgraded connection, which is managed by the
+// session heartbeat.
+const READ_HEADER_TIMEOUT = 10 * time.Second
+const IDLE_TIMEOUT = 60 * time.Second
+
+var cipherSuites = []uint16{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+}
+
+// address is the remote address for a client WebSocket connection. The websocket library only
+// exposes the real address for accepted connections.
+type address string
+
+func (a address) Network() string {
+	return "websocket"
+}
+
+func (a address) String() string {
+	return string(a)
+}
+
+type socket struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (s socket) RemoteAddr() net.Addr {
+	return s.addr
+}
+
+// resolve splits a connector spec of the form host:port[/path] into the TCP address and
+// the URL path (defaults to /).
+func resolve(spec string) (*net.TCPAddr, string, string, error) {
+	hostport, path := split(spec)
+
+	addr, err := net.ResolveTCPAddr("tcp", hostport)
+	if err != nil {
+		return nil, "", "", err
+	} else if addr == nil {
+		return nil, "", "", fmt.Errorf("unable to resolve TCP address '%v'", hostport)
+	}
+
+	return addr, hostport, path, nil
+}
+
+// target splits a client connector spec of the form host:port[/path] into the host and the URL
+// path. The host is only resolved locally if the connector is not connecting through a proxy.
+func target(spec string, proxy conn.Proxy) (string, string, error) {
+	hostport, path := split(spec)
+
+	if _, err := proxy.Resolve(hostport); err != nil {
+		return "", "", err
+	}
+
+	return hostport, path, nil
+}
+
+func split(spec string) (string, string) {
+	if ix := strings.Index(spec, "/"); ix >= 0 {
+		return spec[:ix], spec[ix:]
+	}
+
+	return spec, "/"
+}
+
+func clientConfig(ca *x509.CertPool, keypair *tls.Certificate) *tls.Config {
+	config := tls.Config{
+		RootCAs:      ca,
+		CipherSuites: cipherSuites,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if keypair != nil {
+		config.Certificates = []tls.Certificate{*keypair}
+	}
+
+	return &config
+}
+
+func serverConfig(ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool) *tls.Config {
+	config := tls.Config{
+		ClientCAs:    ca,
+		Certificates: []tls.Certificate{keypair},
+		CipherSuites: cipherSuites,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if requireClientCertificate {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &config
+}
+
+// dial opens a WebSocket connection to the URL (through the proxy, if enabled) and returns it
+// wrapped as a net.Conn that sends and receives binary messages. The lifetime of the connection
+// is bounded by ctx.
+func dial(url string, hwif string, config *tls.Config, proxy conn.Proxy, timeout time.Duration, c conn.Conn, ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if hwif != "" {
+				return conn.BindToDevice(connection, hwif, network == "tcp4", c)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	options := websocket.DialOptions{
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return proxy.DialContext(ctx, dialer, network, address)
+				},
+				TLSClientConfig: config,
+			},
+			Timeout: timeout,
+		},
+	}
+
+	handshake, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ws, _, err := websocket.Dial(handshake, url, &options)
+	if err != nil {
+		return nil, err
+	}
+
+	return socket{
+		Conn: websocket.NetConn(ctx, ws, websocket.MessageBinary),
+		addr: address(url),
+	}, nil
+}
+
+// listen opens the (optionally TLS) listen socket for a WebSocket server and returns it wrapped
+// as a net.Listener that returns the upgraded connections for requests to the WebSocket path.
+func listen(hwif string, addr *net.TCPAddr, path string, config *tls.Config, c conn.Conn, ctx context.Context) (net.Listener, error) {
+	listener := net.ListenConfig{
+		Control: func(network, address string, connection syscall.RawConn) error {
+			if hwif != "" {
+				return conn.BindToDevice(connection, hwif, conn.IsIPv4(addr.IP), c)
+			} else {
+				return nil
+			}
+		},
+	}
+
+	socket, err := listener.Listen(context.Background(), "tcp", fmt.Sprintf("%v", addr))
+	if err != nil {
+		return nil, err
+	} else if socket == nil {
+		return nil, fmt.Errorf("failed to create TCP listen socket (%v)", socket)
+	}
+
+	if config != nil {
+		socket = tls.NewListener(socket, config)
+	}
+
+	return serve(socket, path, c, ctx), nil
+}
+
+// upgrader adapts the HTTP server that upgrades the requests for the WebSocket path to a
+// net.Listener, so that the WebSocket server connectors can use the shared server loop.
+type upgrader struct {
+	net.Listener
+	server   *http.Server
+	accepted chan net.Conn
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// serve starts the HTTP server for the WebSocket path on the listen socket. Requests for any
+// other path are rejected with '404 Not Found'.
+func serve(socket net.Listener, path string, c conn.Conn, ctx context.Context) *upgrader {
+	u := upgrader{
+		Listener: socket,
+		accepted: make(chan net.Conn),
+		closed:   make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrade(w, r, ctx)
+		if err != nil {
+			c.Warnf("%v", err)
+			return
+		}
+
+		select {
+		case u.accepted <- ws:
+		case <-u.closed:
+			ws.Close()
+		}
+	})
+
+	u.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: READ_HEADER_TIMEOUT,
+		IdleTimeout:       IDLE_TIMEOUT,
+	}
+
+	go func() {
+		if err := u.server.Serve(socket); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.Warnf("%v", err)
+		}
+
+		u.Close()
+	}()
+
+	return &u
+}
+
+func (u *upgrader) Accept() (net.Conn, error) {
+	select {
+	case ws := <-u.accepted:
+		return ws, nil
+
+	case <-u.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (u *upgrader) Close() error {
+	u.once.Do(func() {
+		close(u.closed)
+	})
+
+	return u.server.Close()
+}
+
+// upgrade accepts a WebSocket connection and returns it wrapped as a net.Conn that sends and
+// receives binary messages. The lifetime of the connection is bounded by ctx.
+func upgrade(w http.ResponseWriter, r *http.Request, ctx context.Context) (net.Conn, error) {
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return websocket.NetConn(ctx, ws, websocket.MessageBinary), nil
+}
+
+func scheme(config *tls.Config) string {
+	if config != nil {
+		return "wss"
+	}
+
+	return "ws"
+}
+
+func tag(config *tls.Config) string {
+	if config != nil {
+		return "WSS"
+	}
+
+	return "WS"
+}
@@ -0,0 +1,204 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type wsClient struct {
+	conn.Conn
+	hwif      string
+	url       string
+	config    *tls.Config
+	retry     conn.Backoff
+	heartbeat conn.Heartbeat
+	proxy     conn.Proxy
+	timeout   time.Duration
+	ch        chan protocol.Message
+	ctx       context.Context
+	closed    chan struct{}
+}
+
+func NewWSInClient(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*wsClient, error) {
+	client, err := makeWSClient(hwif, spec, nil, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::ws-client-in")
+	}
+
+	return client, err
+}
+
+func NewWSOutClient(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*wsClient, error) {
+	client, err := makeWSClient(hwif, spec, nil, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::ws-client-out")
+	}
+
+	return client, err
+}
+
+func NewWSSInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*wsClient, error) {
+	client, err := makeWSClient(hwif, spec, clientConfig(ca, keypair), retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::wss-client-in")
+	}
+
+	return client, err
+}
+
+func NewWSSOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*wsClient, error) {
+	client, err := makeWSClient(hwif, spec, clientConfig(ca, keypair), retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::wss-client-out")
+	}
+
+	return client, err
+}
+
+func makeWSClient(hwif string, spec string, config *tls.Config, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*wsClient, error) {
+	host, path, err := target(spec, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	client := wsClient{
+		Conn: conn.Conn{
+			Tag: tag(config),
+		},
+		hwif:      hwif,
+		url:       fmt.Sprintf("%v://%v%v", scheme(config), host, path),
+		config:    config,
+		retry:     retry,
+		heartbeat: heartbeat,
+		proxy:     proxy,
+		timeout:   5 * time.Second,
+		ch:        make(chan protocol.Message, 16),
+		ctx:       ctx,
+		closed:    make(chan struct{}),
+	}
+
+	return &client, nil
+}
+
+func (ws *wsClient) Close() {
+	ws.Infof("closing")
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-ws.closed:
+		ws.Infof("closed")
+
+	case <-timeout.C:
+		ws.Infof("close timeout")
+	}
+}
+
+func (ws *wsClient) Run(router *router.Switch) error {
+	ws.connect(router)
+	ws.closed <- struct{}{}
+
+	return nil
+}
+
+func (ws *wsClient) Send(id uint32, msg []byte) {
+	select {
+	case ws.ch <- protocol.Message{ID: id, Message: msg}:
+	default:
+	}
+}
+
+func (ws *wsClient) connect(router *router.Switch) {
+	for {
+		ws.Infof("connecting to %v", ws.url)
+
+		if socket, err := dial(ws.url, ws.hwif, ws.config, ws.proxy, ws.timeout, ws.Conn, ws.ctx); err != nil {
+			ws.Warnf("%v", err)
+		} else {
+			ws.retry.Reset()
+			session := conn.NewSession(ws.Conn, socket, ws.heartbeat)
+			eof := make(chan struct{})
+
+			go func() {
+				for {
+					select {
+					case msg := <-ws.ch:
+						ws.Infof("msg %v  relaying to %v", msg.ID, socket.RemoteAddr())
+						ws.send(session, msg.ID, msg.Message)
+
+					case <-eof:
+						return
+
+					case <-ws.ctx.Done():
+						socket.Close()
+						return
+					}
+				}
+			}()
+
+			if err := ws.listen(socket, session, router); err != nil && !errors.Is(err, net.ErrClosed) && ws.ctx.Err() == nil {
+				ws.Warnf("%v", err)
+			}
+
+			close(eof)
+		}
+
+		if !ws.retry.Wait(ws.Tag) {
+			return
+		}
+	}
+}
+
+func (ws *wsClient) listen(socket net.Conn, session *conn.Session, router *router.Switch) error {
+	ws.Infof("connected  to %v", socket.RemoteAddr())
+
+	defer socket.Close()
+	defer session.Close()
+
+	if err := session.Start(); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 2048)
+
+	for {
+		N, err := socket.Read(buffer)
+		if err != nil {
+			return err
+		}
+
+		ws.received(buffer[:N], session, router, socket)
+	}
+}
+
+func (ws *wsClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	ws.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		id := msg.ID
+
+		router.Received(id, msg.Message, func(message []byte) {
+			ws.send(session, id, message)
+		})
+	}
+}
+
+func (ws *wsClient) send(session *conn.Session, id uint32, msg []byte) {
+	if err := session.Send(id, msg); err != nil {
+		ws.Warnf("msg %v  error sending message to %v (%v)", id, session.RemoteAddr(), err)
+	} else {
+		ws.Infof("msg %v  sent %v bytes to %v", id, len(msg), session.RemoteAddr())
+	}
+}
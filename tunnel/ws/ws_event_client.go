@@ -0,0 +1,23 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type wsEventClient struct {
+	conn.EventClient
+	hwif    string
+	url     string
+	config  *tls.Config
+	proxy   conn.Proxy
+	timeout time.Duration
+}
+
+func (ws *wsEventClient) dial(ctx context.Context) (net.Conn, error) {
+	return dial(ws.url, ws.hwif, ws.config, ws.proxy, ws.timeout, ws.Conn, ctx)
+}
@@ -0,0 +1,81 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type wsEventInClient struct {
+	wsEventClient
+	dedup *conn.Dedup
+}
+
+func NewWSEventInClient(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*wsEventInClient, error) {
+	client, err := makeWSEventInClient(hwif, spec, nil, retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::ws-event-in-client")
+	}
+
+	return client, err
+}
+
+func NewWSSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*wsEventInClient, error) {
+	client, err := makeWSEventInClient(hwif, spec, clientConfig(ca, keypair), retry, heartbeat, proxy, ctx)
+
+	if err == nil {
+		client.Infof("connector::wss-event-in-client")
+	}
+
+	return client, err
+}
+
+func makeWSEventInClient(hwif string, spec string, config *tls.Config, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, ctx context.Context) (*wsEventInClient, error) {
+	host, path, err := target(spec, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%v://%v%v", scheme(config), host, path)
+
+	ws := wsEventInClient{
+		wsEventClient{
+			EventClient: conn.NewEventClient(tag(config), url, retry, heartbeat, nil, 2048, ctx),
+			hwif:        hwif,
+			url:         url,
+			config:      config,
+			proxy:       proxy,
+			timeout:     5 * time.Second,
+		},
+		conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	ws.Dial = ws.dial
+	ws.Received = ws.received
+	ws.Relay = ws.send
+
+	return &ws, nil
+}
+
+func (ws *wsEventInClient) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	ws.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		if ws.dedup.Duplicate(msg.ID, msg.Message) {
+			ws.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
+	}
+}
+
+func (ws *wsEventInClient) send(session *conn.Session, id uint32, msg []byte) error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type wsEventIn struct {
+	wsServer
+	dedup *conn.Dedup
+}
+
+func NewWSEventInServer(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsEventIn, error) {
+	server, err := makeWSEventInServer(hwif, spec, nil, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::ws-event-in-server")
+	}
+
+	return server, err
+}
+
+func NewWSSEventInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsEventIn, error) {
+	server, err := makeWSEventInServer(hwif, spec, serverConfig(ca, keypair, requireClientCertificate), retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::wss-event-in-server")
+	}
+
+	return server, err
+}
+
+func makeWSEventInServer(hwif string, spec string, config *tls.Config, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsEventIn, error) {
+	addr, _, path, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	} else if addr.Port == 0 {
+		return nil, errors.New("WebSocket host requires a non-zero port")
+	}
+
+	ws := wsEventIn{
+		wsServer: wsServer{
+			Server: conn.NewServer(tag(config), retry, heartbeat, 2048, ctx),
+			hwif:   hwif,
+			addr:   addr,
+			path:   path,
+			config: config,
+			ctx:    ctx,
+		},
+		dedup: conn.NewDedup(conn.DEDUP_WINDOW),
+	}
+
+	ws.Listen = ws.listen
+	ws.Received = ws.received
+
+	return &ws, nil
+}
+
+func (ws *wsEventIn) Send(id uint32, message []byte) {
+}
+
+func (ws *wsEventIn) received(buffer []byte, session *conn.Session, router *router.Switch, socket net.Conn) {
+	ws.Dumpf(buffer, "received %v bytes from %v", len(buffer), socket.RemoteAddr())
+
+	for _, msg := range session.Received(buffer) {
+		if ws.dedup.Duplicate(msg.ID, msg.Message) {
+			ws.Infof("msg %v  discarding duplicate event from %v", msg.ID, socket.RemoteAddr())
+		} else {
+			router.Received(msg.ID, msg.Message, nil)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type wsEventOutClient struct {
+	wsEventClient
+}
+
+func NewWSEventOutClient(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, queue *conn.Queue, ctx context.Context) (*wsEventOutClient, error) {
+	client, err := makeWSEventOutClient(hwif, spec, nil, retry, heartbeat, proxy, queue, ctx)
+
+	if err == nil {
+		client.Infof("connector::ws-event-out-client")
+	}
+
+	return client, err
+}
+
+func NewWSSEventOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, queue *conn.Queue, ctx context.Context) (*wsEventOutClient, error) {
+	client, err := makeWSEventOutClient(hwif, spec, clientConfig(ca, keypair), retry, heartbeat, proxy, queue, ctx)
+
+	if err == nil {
+		client.Infof("connector::wss-event-out-client")
+	}
+
+	return client, err
+}
+
+func makeWSEventOutClient(hwif string, spec string, config *tls.Config, retry conn.Backoff, heartbeat conn.Heartbeat, proxy conn.Proxy, queue *conn.Queue, ctx context.Context) (*wsEventOutClient, error) {
+	host, path, err := target(spec, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%v://%v%v", scheme(config), host, path)
+
+	ws := wsEventOutClient{
+		wsEventClient{
+			EventClient: conn.NewEventClient(tag(config), url, retry, heartbeat, queue, 2048, ctx),
+			hwif:        hwif,
+			url:         url,
+			config:      config,
+			proxy:       proxy,
+			timeout:     5 * time.Second,
+		},
+	}
+
+	ws.Dial = ws.dial
+	ws.Received = conn.Discard
+	ws.Relay = ws.Deliver
+
+	return &ws, nil
+}
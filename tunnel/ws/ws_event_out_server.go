@@ -0,0 +1,63 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type wsEventOutServer struct {
+	wsServer
+}
+
+func NewWSEventOutServer(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsEventOutServer, error) {
+	server, err := makeWSEventOutServer(hwif, spec, nil, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::ws-event-out-server")
+	}
+
+	return server, err
+}
+
+func NewWSSEventOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsEventOutServer, error) {
+	server, err := makeWSEventOutServer(hwif, spec, serverConfig(ca, keypair, requireClientCertificate), retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::wss-event-out-server")
+	}
+
+	return server, err
+}
+
+func makeWSEventOutServer(hwif string, spec string, config *tls.Config, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsEventOutServer, error) {
+	addr, _, path, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	} else if addr.Port == 0 {
+		return nil, errors.New("WebSocket host requires a non-zero port")
+	}
+
+	ws := wsEventOutServer{
+		wsServer{
+			Server: conn.NewServer(tag(config), retry, heartbeat, 2048, ctx),
+			hwif:   hwif,
+			addr:   addr,
+			path:   path,
+			config: config,
+			ctx:    ctx,
+		},
+	}
+
+	ws.Listen = ws.listen
+	ws.Received = conn.Discard
+
+	return &ws, nil
+}
+
+func (ws *wsEventOutServer) Send(id uint32, message []byte) {
+	ws.Post(id, message)
+}
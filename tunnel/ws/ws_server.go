@@ -0,0 +1,87 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type wsServer struct {
+	conn.Server
+	hwif   string
+	addr   *net.TCPAddr
+	path   string
+	config *tls.Config
+	ctx    context.Context
+}
+
+func NewWSInServer(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsServer, error) {
+	server, err := makeWSServer(hwif, spec, nil, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::ws-server-in")
+	}
+
+	return server, err
+}
+
+func NewWSOutServer(hwif string, spec string, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsServer, error) {
+	server, err := makeWSServer(hwif, spec, nil, retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::ws-server-out")
+	}
+
+	return server, err
+}
+
+func NewWSSInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsServer, error) {
+	server, err := makeWSServer(hwif, spec, serverConfig(ca, keypair, requireClientCertificate), retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::wss-server-in")
+	}
+
+	return server, err
+}
+
+func NewWSSOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsServer, error) {
+	server, err := makeWSServer(hwif, spec, serverConfig(ca, keypair, requireClientCertificate), retry, heartbeat, ctx)
+
+	if err == nil {
+		server.Infof("connector::wss-server-out")
+	}
+
+	return server, err
+}
+
+func makeWSServer(hwif string, spec string, config *tls.Config, retry conn.Backoff, heartbeat conn.Heartbeat, ctx context.Context) (*wsServer, error) {
+	addr, _, path, err := resolve(spec)
+	if err != nil {
+		return nil, err
+	} else if addr.Port == 0 {
+		return nil, errors.New("WebSocket host requires a non-zero port")
+	}
+
+	server := wsServer{
+		Server: conn.NewServer(tag(config), retry, heartbeat, 2048, ctx),
+		hwif:   hwif,
+		addr:   addr,
+		path:   path,
+		config: config,
+		ctx:    ctx,
+	}
+
+	server.Listen = server.listen
+	server.Received = server.Dispatch
+
+	return &server, nil
+}
+
+func (ws *wsServer) listen() (net.Listener, error) {
+	return listen(ws.hwif, ws.addr, ws.path, ws.config, ws.Conn, ws.ctx)
+}
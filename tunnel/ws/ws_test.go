@@ -0,0 +1,206 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/internal/loopback"
+)
+
+func TestWSScenarios(t *testing.T) {
+	ca, keypair := loopback.Certificates(t)
+
+	tests := []struct {
+		name      string
+		transport loopback.Transport
+	}{
+		{"ws", transport(nil, nil, tls.Certificate{})},
+		{"wss", transport(ca, &keypair, keypair)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loopback.Scenarios(t, test.transport)
+		})
+	}
+}
+
+func TestWSInServerOutClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := loopback.Address(t, "tcp")
+	spec := addr + "/tunnel"
+
+	server, err := NewWSInServer("", spec, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	client, err := NewWSOutClient("", spec, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s1 := loopback.Echo(t)
+	s2 := loopback.Sink(t)
+
+	defer func() {
+		cancel()
+		client.Close()
+		server.Close()
+	}()
+
+	go server.Run(s1)
+
+	loopback.Listening(t, addr)
+
+	go client.Run(s2)
+
+	loopback.Until(t, func() bool {
+		return len(server.Sessions()) > 0
+	})
+
+	loopback.RoundTrip(t, s2, client.Send)
+}
+
+func TestWSSClientCertificate(t *testing.T) {
+	ca, keypair := loopback.Certificates(t)
+
+	tests := []struct {
+		name      string
+		keypair   *tls.Certificate
+		connected bool
+	}{
+		{"with client certificate", &keypair, true},
+		{"without client certificate", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			addr := loopback.Address(t, "tcp")
+			spec := addr + "/tunnel"
+
+			server, err := NewWSSOutServer("", spec, ca, keypair, true, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			client, err := NewWSSInClient("", spec, ca, test.keypair, conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, ctx)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			s1 := loopback.Echo(t)
+			s2 := loopback.Sink(t)
+
+			defer func() {
+				cancel()
+				client.Close()
+				server.Close()
+			}()
+
+			go server.Run(s2)
+
+			loopback.Listening(t, addr)
+
+			go client.Run(s1)
+
+			if test.connected {
+				loopback.Until(t, func() bool {
+					return len(server.Sessions()) > 0
+				})
+
+				loopback.RoundTrip(t, s2, server.Send)
+			} else {
+				loopback.Steady(t, 500*time.Millisecond, func() bool {
+					return len(server.Sessions()) == 0
+				})
+			}
+		})
+	}
+}
+
+func TestWSPathMismatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := loopback.Address(t, "tcp")
+
+	server, err := NewWSOutServer("", addr+"/tunnel", conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	client, err := NewWSInClient("", addr+"/events", conn.NewBackoff(-1, time.Second, ctx), conn.Heartbeat{}, conn.Proxy{}, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s1 := loopback.Echo(t)
+	s2 := loopback.Sink(t)
+
+	defer func() {
+		cancel()
+		client.Close()
+		server.Close()
+	}()
+
+	go server.Run(s2)
+
+	loopback.Listening(t, addr)
+
+	go client.Run(s1)
+
+	loopback.Steady(t, 500*time.Millisecond, func() bool {
+		return len(server.Sessions()) == 0
+	})
+
+	response, err := http.Get(fmt.Sprintf("http://%v/events", addr))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("incorrect HTTP status - expected:%v, got:%v", http.StatusNotFound, response.StatusCode)
+	}
+}
+
+// transport returns the WebSocket connectors for the shared scenarios, using WSS if the CA is
+// not nil.
+func transport(ca *x509.CertPool, clientKeypair *tls.Certificate, serverKeypair tls.Certificate) loopback.Transport {
+	wss := ca != nil
+
+	return loopback.Transport{
+		Network: "tcp",
+
+		Requests: func(t *testing.T, server string, client string, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			if wss {
+				return loopback.Must(t)(NewWSSOutServer("", server+"/tunnel", ca, serverKeypair, true, retry, conn.Heartbeat{}, ctx)),
+					loopback.Must(t)(NewWSSInClient("", client+"/tunnel", ca, clientKeypair, retry, conn.Heartbeat{}, conn.Proxy{}, ctx))
+			}
+
+			return loopback.Must(t)(NewWSOutServer("", server+"/tunnel", retry, conn.Heartbeat{}, ctx)),
+				loopback.Must(t)(NewWSInClient("", client+"/tunnel", retry, conn.Heartbeat{}, conn.Proxy{}, ctx))
+		},
+
+		Events: func(t *testing.T, server string, client string, heartbeat conn.Heartbeat, queue *conn.Queue, ctx context.Context) (loopback.Connector, loopback.Connector) {
+			retry := conn.NewBackoff(-1, time.Second, ctx)
+
+			if wss {
+				return loopback.Must(t)(NewWSSEventInServer("", server+"/events", ca, serverKeypair, true, retry, heartbeat, ctx)),
+					loopback.Must(t)(NewWSSEventOutClient("", client+"/events", ca, clientKeypair, retry, heartbeat, conn.Proxy{}, queue, ctx))
+			}
+
+			return loopback.Must(t)(NewWSEventInServer("", server+"/events", retry, heartbeat, ctx)),
+				loopback.Must(t)(NewWSEventOutClient("", client+"/events", retry, heartbeat, conn.Proxy{}, queue, ctx))
+		},
+	}
+}